@@ -1,37 +1,64 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	mapset "github.com/deckarep/golang-set"
-	_ "github.com/mattn/go-sqlite3"
 )
 
-// archiveCandidatesInDir lists basenames in dir that match the gopodder
-// filename grammar (5 dashes, contains mp3, not a macOS resource fork).
-// Returns the original ReadDir error verbatim if the dir cannot be read.
-func archiveCandidatesInDir(dir string) ([]string, error) {
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, err
+// templatedNameRe is the file name grammar of any filename template (see
+// template.go): a YYYY-MM-DD date somewhere, then -<hash>.mp3 at the end.
+var templatedNameRe = regexp.MustCompile(`^.*\d{4}-\d{2}-\d{2}.*-[^-.]+\.` + mp3 + `$`)
+
+// isPodcastFileName reports whether base matches the gopodder filename
+// grammar: the legacy flat rule (5 dashes, contains mp3) or a templated name,
+// and not a macOS resource fork.
+func isPodcastFileName(base string) bool {
+	if len(base) >= 2 && base[:2] == "._" {
+		return false
 	}
-	out := make([]string, 0, len(entries))
-	for _, e := range entries {
-		if e.IsDir() {
-			continue
-		}
-		name := e.Name()
-		if len(name) >= 2 && name[:2] == "._" {
-			continue
+	return (strings.Count(base, "-") == 5 && strings.Contains(base, mp3)) || templatedNameRe.MatchString(base)
+}
+
+// archiveCandidatesInDir lists the podcast files under dir as slash paths
+// relative to it: basenames for the flat layout, "Podcast/2024/..." for a
+// nested filename template. Subdirectories are searched scanDepth() deep,
+// skipping dot dirs (the dedup trash). Returns the original ReadDir error
+// verbatim if dir cannot be read.
+func archiveCandidatesInDir(dir string) ([]string, error) {
+	out := make([]string, 0)
+	maxDepth := scanDepth()
+	var walk func(rel string, depth int) error
+	walk = func(rel string, depth int) error {
+		entries, err := os.ReadDir(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
 		}
-		if strings.Count(name, "-") != 5 || !strings.Contains(name, mp3) {
-			continue
+		for _, e := range entries {
+			name := e.Name()
+			if e.IsDir() {
+				if depth < maxDepth && !strings.HasPrefix(name, ".") {
+					// An unreadable subdirectory is not worth failing the scan for
+					if err := walk(path.Join(rel, name), depth+1); err != nil {
+						log.Printf("skipping %s: %v", filepath.Join(dir, rel, name), err)
+					}
+				}
+				continue
+			}
+			if isPodcastFileName(name) {
+				out = append(out, path.Join(rel, name))
+			}
 		}
-		out = append(out, name)
+		return nil
+	}
+	if err := walk("", 0); err != nil {
+		return nil, err
 	}
 	return out, nil
 }
@@ -40,7 +67,7 @@ func archiveCandidatesInDir(dir string) ([]string, error) {
 // filename grammar and inserts/updates rows in archived_episodes so that
 // gopodder will not try to re-download them, even if dir is unmounted.
 // Returns the number of episodes registered (or refreshed).
-func registerArchiveDir(dir string) (int, error) {
+func registerArchiveDir(s *store, dir string) (int, error) {
 	absDir, err := filepath.Abs(dir)
 	if err != nil {
 		return 0, err
@@ -51,25 +78,21 @@ func registerArchiveDir(dir string) (int, error) {
 		return 0, fmt.Errorf("read %s: %w", absDir, err)
 	}
 
-	db, err := sql.Open(sqlite3, dbFileName)
-	if err != nil {
-		return 0, err
-	}
-	defer db.Close()
-
-	stmt, err := db.Prepare(`
-		INSERT INTO archived_episodes
-			(podcastname_episodename_hash, archived_path, archived_at)
-		VALUES (?, ?, ?)
-		ON CONFLICT(podcastname_episodename_hash) DO UPDATE SET
-			archived_path = excluded.archived_path,
-			archived_at = excluded.archived_at
-		;`)
+	count := 0
+	err = s.inTx(func(tx *store) error {
+		count, err = registerArchiveNames(tx, absDir, names)
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
-	defer stmt.Close()
+	return count, nil
+}
 
+// registerArchiveNames registers the podcast files names (relative to the
+// absolute archive dir absDir) in archived_episodes, skipping names without
+// a hash. Returns how many it registered.
+func registerArchiveNames(s *store, absDir string, names []string) (int, error) {
 	count := 0
 	for _, name := range names {
 		hash, _, err := hashFromFilename(name)
@@ -77,8 +100,7 @@ func registerArchiveDir(dir string) (int, error) {
 			log.Printf("skipping %s: %v", name, err)
 			continue
 		}
-		fullPath := filepath.Join(absDir, name)
-		if _, err := stmt.Exec(hash, fullPath, ts); err != nil {
+		if err := s.upsertArchived(hash, filepath.Join(absDir, name)); err != nil {
 			return count, fmt.Errorf("upsert %s: %w", name, err)
 		}
 		count++
@@ -89,7 +111,7 @@ func registerArchiveDir(dir string) (int, error) {
 // unregisterArchiveDir deletes archive rows whose hash corresponds to a file
 // in dir. Useful when moving files back into the primary podcasts directory.
 // Returns the number of rows actually removed.
-func unregisterArchiveDir(dir string) (int, error) {
+func unregisterArchiveDir(s *store, dir string) (int, error) {
 	absDir, err := filepath.Abs(dir)
 	if err != nil {
 		return 0, err
@@ -99,33 +121,26 @@ func unregisterArchiveDir(dir string) (int, error) {
 		return 0, fmt.Errorf("read %s: %w", absDir, err)
 	}
 
-	db, err := sql.Open(sqlite3, dbFileName)
-	if err != nil {
-		return 0, err
-	}
-	defer db.Close()
-
-	stmt, err := db.Prepare(`DELETE FROM archived_episodes WHERE podcastname_episodename_hash = ?;`)
-	if err != nil {
-		return 0, err
-	}
-	defer stmt.Close()
-
 	removed := 0
-	for _, name := range names {
-		hash, _, err := hashFromFilename(name)
-		if err != nil {
-			log.Printf("skipping %s: %v", name, err)
-			continue
-		}
-		res, err := stmt.Exec(hash)
-		if err != nil {
-			return removed, fmt.Errorf("delete %s: %w", name, err)
-		}
-		affected, _ := res.RowsAffected()
-		if affected > 0 {
-			removed++
+	err = s.inTx(func(tx *store) error {
+		for _, name := range names {
+			hash, _, err := hashFromFilename(name)
+			if err != nil {
+				log.Printf("skipping %s: %v", name, err)
+				continue
+			}
+			ok, err := tx.deleteArchived(hash)
+			if err != nil {
+				return fmt.Errorf("delete %s: %w", name, err)
+			}
+			if ok {
+				removed++
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 	return removed, nil
 }
@@ -133,18 +148,8 @@ func unregisterArchiveDir(dir string) (int, error) {
 // reconcileArchiveRegistry removes archived_episodes rows whose archived_path
 // no longer resolves on disk. Useful when files have been moved or deleted
 // out from under the registry.
-func reconcileArchiveRegistry() (int, error) {
-	db, err := sql.Open(sqlite3, dbFileName)
-	if err != nil {
-		return 0, err
-	}
-	defer db.Close()
-
-	rows, err := db.Query(`
-		SELECT podcastname_episodename_hash, archived_path
-		FROM archived_episodes
-		WHERE archived_path IS NOT NULL AND archived_path != ''
-		;`)
+func reconcileArchiveRegistry(s *store) (int, error) {
+	paths, err := s.archivedPaths()
 	if err != nil {
 		return 0, err
 	}
@@ -153,12 +158,7 @@ func reconcileArchiveRegistry() (int, error) {
 		hash, path string
 	}
 	var toDelete []stale
-	for rows.Next() {
-		var hash, path string
-		if err := rows.Scan(&hash, &path); err != nil {
-			rows.Close()
-			return 0, err
-		}
+	for hash, path := range paths {
 		if _, err := os.Stat(path); err != nil {
 			if os.IsNotExist(err) {
 				toDelete = append(toDelete, stale{hash, path})
@@ -167,81 +167,107 @@ func reconcileArchiveRegistry() (int, error) {
 			}
 		}
 	}
-	rows.Close()
+	sort.Slice(toDelete, func(i, j int) bool { return toDelete[i].path < toDelete[j].path })
 
 	if len(toDelete) == 0 {
 		return 0, nil
 	}
 
-	stmt, err := db.Prepare(`DELETE FROM archived_episodes WHERE podcastname_episodename_hash = ?;`)
+	err = s.inTx(func(tx *store) error {
+		for _, st := range toDelete {
+			if _, err := tx.deleteArchived(st.hash); err != nil {
+				return err
+			}
+			log.Printf("removed stale archive row: %s -> %s", st.hash, st.path)
+		}
+		return nil
+	})
 	if err != nil {
 		return 0, err
 	}
-	defer stmt.Close()
+	return len(toDelete), nil
+}
+
+// upsertArchived registers (or re-points) one archived episode.
+func (s *store) upsertArchived(hash string, path string) error {
+	_, err := s.q.Exec(`
+		INSERT INTO archived_episodes
+			(podcastname_episodename_hash, archived_path, archived_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(podcastname_episodename_hash) DO UPDATE SET
+			archived_path = excluded.archived_path,
+			archived_at = excluded.archived_at
+		;`, hash, path, ts)
+	return err
+}
+
+// deleteArchived drops the registry row for hash, reporting whether one
+// existed.
+func (s *store) deleteArchived(hash string) (bool, error) {
+	res, err := s.q.Exec(`DELETE FROM archived_episodes WHERE podcastname_episodename_hash = ?;`, hash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
 
-	for _, s := range toDelete {
-		if _, err := stmt.Exec(s.hash); err != nil {
-			return 0, err
+// archivedPaths maps each registered episode hash to its archived_path, for
+// rows that have one.
+func (s *store) archivedPaths() (map[string]string, error) {
+	rows, err := s.q.Query(`
+		SELECT podcastname_episodename_hash, archived_path
+		FROM archived_episodes
+		WHERE archived_path IS NOT NULL AND archived_path != ''
+		;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]string)
+	for rows.Next() {
+		var hash, path string
+		if err := rows.Scan(&hash, &path); err != nil {
+			return nil, err
 		}
-		log.Printf("removed stale archive row: %s -> %s", s.hash, s.path)
+		out[hash] = path
 	}
-	return len(toDelete), nil
+	return out, rows.Err()
 }
 
-// fetchArchivedHashes returns the set of episode hashes currently registered
-// in archived_episodes. Returns an empty set if the table doesn't exist yet.
-func fetchArchivedHashes() mapset.Set {
+// archivedHashes returns the set of episode hashes currently registered in
+// archived_episodes.
+func (s *store) archivedHashes() (mapset.Set, error) {
 	out := mapset.NewSet()
-	db, err := sql.Open(sqlite3, dbFileName)
-	checkErr(err)
-	if err == nil {
-		defer db.Close()
-	}
-	rows, err := db.Query(`SELECT podcastname_episodename_hash FROM archived_episodes;`)
+	rows, err := s.q.Query(`SELECT podcastname_episodename_hash FROM archived_episodes;`)
 	if err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "no such table") {
-			return out
-		}
-		checkErr(err)
-		return out
+		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var hash string
 		if err := rows.Scan(&hash); err != nil {
-			checkErr(err)
+			return nil, err
 		}
 		out.Add(hash)
 	}
-	return out
+	return out, rows.Err()
 }
 
-// fetchArchivedBasenames returns the basename of every archived_path in
+// archivedBasenames returns the basename of every archived_path in
 // archived_episodes. These feed name-minus-hash matching, so an episode whose
 // only surviving copy is a legacy-named archive file still counts as "already
 // have" even when the archive volume is unmounted.
-func fetchArchivedBasenames() []string {
-	out := make([]string, 0)
-	db, err := sql.Open(sqlite3, dbFileName)
-	checkErr(err)
-	if err == nil {
-		defer db.Close()
-	}
-	rows, err := db.Query(`SELECT archived_path FROM archived_episodes WHERE archived_path IS NOT NULL AND archived_path != '';`)
+func (s *store) archivedBasenames() ([]string, error) {
+	paths, err := s.archivedPaths()
 	if err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "no such table") {
-			return out
-		}
-		checkErr(err)
-		return out
+		return nil, err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var p string
-		if err := rows.Scan(&p); err != nil {
-			checkErr(err)
-		}
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
 		out = append(out, filepath.Base(p))
 	}
-	return out
+	sort.Strings(out)
+	return out, nil
 }
@@ -0,0 +1,293 @@
+package main
+
+// Content hashes of downloaded files, as evidence for the dedup passes.
+//
+// Every dedup heuristic reasons from filenames, titles and sizes, and sizes
+// lie in both directions: tagThosePods rewrites the ID3 tags (so identical
+// audio differs in size) and feeds re-encode (so different audio can match).
+// The audio hash is a SHA-256 of the file minus its ID3v2 tags at the front
+// and ID3v1 tag at the back, so two copies of the same audio hash alike
+// whatever was tagged into them.
+//
+// Hashes are cached in file_hashes by (path, size, mtime): only new or
+// changed files are read, so after the first pass over a library this is
+// cheap. resolveByAudio then treats identical audio as decisive, turning
+// MANUAL and SKIP verdicts into deletes where a surviving copy of the same
+// audio is kept. A payload no bigger than a download stub is no evidence:
+// every empty or tag-only file hashes alike, and so does the same error page
+// saved under two names.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	id3v2HeaderLen = 10
+	id3v1Len       = 128
+	id3v1ExtLen    = 227 // "TAG+" enhanced tag, in front of an ID3v1 tag
+)
+
+// audioPayloadBounds returns the byte range of r that holds audio: after any
+// ID3v2 tags at the start and before an ID3v1 tag at the end.
+func audioPayloadBounds(r io.ReaderAt, size int64) (int64, int64, error) {
+	start := int64(0)
+	hdr := make([]byte, id3v2HeaderLen)
+	for start+id3v2HeaderLen <= size {
+		if _, err := r.ReadAt(hdr, start); err != nil {
+			return 0, 0, err
+		}
+		if string(hdr[:3]) != "ID3" || hdr[6]|hdr[7]|hdr[8]|hdr[9] >= 0x80 {
+			break
+		}
+		// Tag size is a 28-bit syncsafe integer, excluding the header
+		n := int64(hdr[6])<<21 | int64(hdr[7])<<14 | int64(hdr[8])<<7 | int64(hdr[9])
+		start += id3v2HeaderLen + n
+		if hdr[5]&0x10 != 0 {
+			start += id3v2HeaderLen // footer
+		}
+	}
+
+	end := size
+	tag := make([]byte, 4)
+	if end-id3v1Len >= start {
+		if _, err := r.ReadAt(tag[:3], end-id3v1Len); err != nil {
+			return 0, 0, err
+		}
+		if string(tag[:3]) == "TAG" {
+			end -= id3v1Len
+			if end-id3v1ExtLen >= start {
+				if _, err := r.ReadAt(tag, end-id3v1ExtLen); err != nil {
+					return 0, 0, err
+				}
+				if string(tag) == "TAG+" {
+					end -= id3v1ExtLen
+				}
+			}
+		}
+	}
+	if start > end {
+		start = end
+	}
+	return start, end, nil
+}
+
+// audioPayloadHash hashes the audio payload of the file at path, returning
+// the hash and the payload's length.
+func audioPayloadHash(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	start, end, err := audioPayloadBounds(f, info.Size())
+	if err != nil {
+		return "", 0, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, start, end-start)); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), end - start, nil
+}
+
+// fileHashEntry is a file_hashes row.
+type fileHashEntry struct {
+	size       int64
+	mtime      int64 // UnixNano
+	hash       string
+	audioBytes int64 // -1 for rows hashed before the length was recorded
+}
+
+// fileHashCache loads file_hashes keyed by path.
+func (s *store) fileHashCache() (map[string]fileHashEntry, error) {
+	rows, err := s.q.Query(`SELECT path, size, mtime, audio_sha256, audio_bytes FROM file_hashes;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]fileHashEntry)
+	for rows.Next() {
+		var path string
+		var e fileHashEntry
+		if err := rows.Scan(&path, &e.size, &e.mtime, &e.hash, &e.audioBytes); err != nil {
+			return nil, err
+		}
+		out[path] = e
+	}
+	return out, rows.Err()
+}
+
+// saveFileHashes upserts freshly computed hashes in one transaction.
+func (s *store) saveFileHashes(entries map[string]fileHashEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return s.inTx(func(tx *store) error {
+		stmt, err := tx.q.Prepare(`
+			INSERT INTO file_hashes (path, size, mtime, audio_sha256, audio_bytes, hashed_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(path) DO UPDATE SET
+				size = excluded.size,
+				mtime = excluded.mtime,
+				audio_sha256 = excluded.audio_sha256,
+				audio_bytes = excluded.audio_bytes,
+				hashed_at = excluded.hashed_at
+			;`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for path, e := range entries {
+			if _, err := stmt.Exec(path, e.size, e.mtime, e.hash, e.audioBytes, ts); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// withAudioHashes fills in each file's audio hash and payload length,
+// reading only files that are new or changed since they were last hashed
+// (or hashed before the length was recorded). A file that can't be read is
+// logged and left without a hash, which just means no audio evidence.
+func (s *store) withAudioHashes(files []dedupFile) ([]dedupFile, error) {
+	cache, err := s.fileHashCache()
+	if err != nil {
+		return nil, err
+	}
+	fresh := make(map[string]fileHashEntry)
+	for i := range files {
+		info, err := os.Stat(files[i].path)
+		if err != nil {
+			continue
+		}
+		mtime := info.ModTime().UnixNano()
+		if e, ok := cache[files[i].path]; ok && e.size == info.Size() && e.mtime == mtime && e.audioBytes >= 0 {
+			files[i].audio, files[i].audioBytes = e.hash, e.audioBytes
+			continue
+		}
+		hash, n, err := audioPayloadHash(files[i].path)
+		if err != nil {
+			log.Printf("not hashing %s: %v", files[i].path, err)
+			continue
+		}
+		files[i].audio, files[i].audioBytes = hash, n
+		fresh[files[i].path] = fileHashEntry{size: info.Size(), mtime: mtime, hash: hash, audioBytes: n}
+	}
+	if len(fresh) > 0 {
+		log.Printf("hashed the audio of %d new or changed file(s); %d cached", len(fresh), len(files)-len(fresh))
+	}
+	return files, s.saveFileHashes(fresh)
+}
+
+// resolveByAudio upgrades verdicts using audio hashes. Pure, like the
+// planners. Only a payload bigger than the owning podcast's stubMaxBytes
+// counts; smaller ones are left to the title and size rules.
+//
+//   - MANUAL: if another copy with identical audio survives the plan, this
+//     copy is redundant and is deleted — unless it is the only file of a
+//     different live episode, whose row would then re-queue it.
+//   - SKIP (keeper suspiciously smaller): if the keeper has identical audio,
+//     the size gap is tags or artwork and the copy is deleted.
+func resolveByAudio(actions []dedupAction, files []dedupFile, owners map[string]dedupOwner, url2ep map[string]string, now time.Time) []dedupAction {
+	attribution := func(f dedupFile) string {
+		if f.epHash != "" {
+			return f.epHash
+		}
+		if _, ok := owners[f.hash]; ok {
+			return f.hash
+		}
+		return url2ep[f.hash]
+	}
+	evidence := func(f dedupFile) bool {
+		return f.audio != "" && f.audioBytes > heuristicsFor(owners[attribution(f)].podcastTitle).stubMaxBytes
+	}
+
+	byAudio := make(map[string][]dedupFile)
+	audioOf := make(map[string]string)
+	for _, f := range files {
+		if evidence(f) {
+			byAudio[f.audio] = append(byAudio[f.audio], f)
+			audioOf[f.path] = f.audio
+		}
+	}
+	removed := make(map[string]bool)
+	manual := make(map[string]bool)
+	renamedTo := make(map[string]string)
+	for _, a := range actions {
+		switch a.kind {
+		case actDelete, actStub:
+			removed[a.file.path] = true
+		case actManual:
+			manual[a.file.path] = true
+		case actRename:
+			renamedTo[a.file.path] = a.newPath
+		}
+	}
+
+	out := make([]dedupAction, 0, len(actions))
+	for _, a := range actions {
+		switch {
+		case a.kind == actSkip && evidence(a.file) && audioOf[a.keeperPath] == a.file.audio:
+			out = append(out, dedupAction{kind: actDelete, file: a.file, keeperPath: a.keeperPath,
+				pruneEp: a.file.pruneEp, reason: "identical audio to the keeper"})
+			removed[a.file.path] = true
+			continue
+		case a.kind != actManual || !evidence(a.file):
+			out = append(out, a)
+			continue
+		}
+
+		candidates := make([]dedupFile, 0)
+		for _, c := range byAudio[a.file.audio] {
+			if c.path != a.file.path && !removed[c.path] {
+				candidates = append(candidates, c)
+			}
+		}
+		if len(candidates) == 0 {
+			out = append(out, a)
+			continue
+		}
+		// Prefer a copy the plan already keeps, then an attributed one
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if manual[candidates[i].path] != manual[candidates[j].path] {
+				return !manual[candidates[i].path]
+			}
+			ai, aj := attribution(candidates[i]) != "", attribution(candidates[j]) != ""
+			if ai != aj {
+				return ai
+			}
+			return candidates[i].path < candidates[j].path
+		})
+		keeper := candidates[0]
+		keeperPath := keeper.path
+		if to, ok := renamedTo[keeperPath]; ok {
+			keeperPath = to
+		}
+
+		ep, keeperEp := attribution(a.file), attribution(keeper)
+		pruneEp := ""
+		if ep != "" && ep != keeperEp {
+			if o := owners[ep]; ownerIsLive(o, now) || o.interactive {
+				a.reason += fmt.Sprintf("; identical audio to %s, but this copy is episode %s's", keeper.path, ep)
+				out = append(out, a)
+				continue
+			}
+			pruneEp = ep
+		}
+		out = append(out, dedupAction{kind: actDelete, file: a.file, keeperPath: keeperPath,
+			pruneEp: pruneEp, reason: "identical audio (was MANUAL: " + a.reason + ")"})
+		removed[a.file.path] = true
+	}
+	return out
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// id3v2Tag builds an ID3v2.3 tag of n bytes of (zero) frames.
+func id3v2Tag(n int) []byte {
+	tag := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+	return append(tag, make([]byte, n)...)
+}
+
+// id3v1Tag builds an ID3v1 tag with title.
+func id3v1Tag(title string) []byte {
+	tag := make([]byte, id3v1Len)
+	copy(tag, "TAG"+title)
+	return tag
+}
+
+func TestAudioPayloadHashIgnoresTags(t *testing.T) {
+	dir := t.TempDir()
+	audio := bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x64}, 1000)
+	write := func(name string, parts ...[]byte) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, bytes.Join(parts, nil), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	hashOf := func(path string) string {
+		t.Helper()
+		h, _, err := audioPayloadHash(path)
+		if err != nil {
+			t.Fatalf("audioPayloadHash(%s): %v", path, err)
+		}
+		return h
+	}
+
+	bare := hashOf(write("bare.mp3", audio))
+	for name, path := range map[string]string{
+		"v2 tag":         write("v2.mp3", id3v2Tag(300), audio),
+		"two v2 tags":    write("v2v2.mp3", id3v2Tag(20), id3v2Tag(4000), audio),
+		"v1 tag":         write("v1.mp3", audio, id3v1Tag("Retagged")),
+		"v2 and v1 tags": write("both.mp3", id3v2Tag(1024), audio, id3v1Tag("Other title")),
+	} {
+		if got := hashOf(path); got != bare {
+			t.Errorf("%s: audio hash %s, want the untagged %s", name, got, bare)
+		}
+	}
+	if got := hashOf(write("other.mp3", id3v2Tag(300), audio[4:])); got == bare {
+		t.Error("different audio should hash differently")
+	}
+	if got := hashOf(write("tagonly.mp3", id3v2Tag(300))); got == bare {
+		t.Error("a tag-only file should not match real audio")
+	}
+}
+
+// Cached hashes are reused while size and mtime hold, and recomputed after.
+func TestWithAudioHashesCaches(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	dir := t.TempDir()
+	f := mkFile(dir, "Cache Show", "Ep", "2020-01-01", strings.Repeat("a", 32), 0)
+	if err := os.WriteFile(f.path, []byte("first audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := st.withAudioHashes([]dedupFile{f})
+	if err != nil || files[0].audio == "" {
+		t.Fatalf("withAudioHashes = %+v, %v", files, err)
+	}
+	first := files[0].audio
+
+	// Tamper with the cache: an unchanged file must not be re-read
+	if _, err := st.q.Exec(`UPDATE file_hashes SET audio_sha256 = 'cached';`); err != nil {
+		t.Fatal(err)
+	}
+	files, _ = st.withAudioHashes([]dedupFile{f})
+	if files[0].audio != "cached" {
+		t.Fatalf("expected the cached hash, got %s", files[0].audio)
+	}
+
+	if err := os.WriteFile(f.path, []byte("second audio!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files, _ = st.withAudioHashes([]dedupFile{f})
+	if files[0].audio == "cached" || files[0].audio == first {
+		t.Fatalf("expected a fresh hash after the file changed, got %s", files[0].audio)
+	}
+}
+
+// Identical audio resolves MANUAL and SKIP verdicts, but never orphans a
+// live episode's only copy.
+func TestResolveByAudio(t *testing.T) {
+	p2 := liveOwner("Analysis", "The Deobandis: Part 2", "2016-04-14")
+	p1 := staleOwner("Analysis", "The Deobandis: Part 1", "2016-04-14")
+	owners := map[string]dedupOwner{p1.epHash: p1, p2.epHash: p2}
+	f1 := mkFile("/arch", "Analysis", p1.title, "2016-04-14", p1.epHash, 40361237)
+	f2 := mkFile("/arch", "Analysis", p2.title, "2016-04-14", p2.epHash, 40894464)
+
+	// Different audio: still MANUAL
+	f1.audio, f2.audio = "aaa", "bbb"
+	f1.audioBytes, f2.audioBytes = f1.size, f2.size
+	actions := resolveByAudio(planDedup([]dedupFile{f1, f2}, owners, nil, dedupNow), []dedupFile{f1, f2}, owners, nil, dedupNow)
+	if byKind := actionsByKind(actions); len(byKind[actManual]) != 1 || len(byKind[actDelete]) != 0 {
+		t.Fatalf("different audio should stay manual, got %+v", actions)
+	}
+
+	// Same audio: the stale copy is redundant and its row is pruned
+	f1.audio = "bbb"
+	actions = resolveByAudio(planDedup([]dedupFile{f1, f2}, owners, nil, dedupNow), []dedupFile{f1, f2}, owners, nil, dedupNow)
+	byKind := actionsByKind(actions)
+	if len(byKind[actManual]) != 0 || len(byKind[actDelete]) != 1 {
+		t.Fatalf("identical audio should resolve the manual verdict, got %+v", actions)
+	}
+	if d := byKind[actDelete][0]; d.file.path != f1.path || d.keeperPath != f2.path || d.pruneEp != p1.epHash {
+		t.Fatalf("expected %s deleted keeping %s and pruning %s, got %+v", f1.path, f2.path, p1.epHash, d)
+	}
+
+	// A live episode's only copy is kept even with identical audio
+	manual := dedupAction{kind: actManual, file: f2, reason: "test"}
+	actions = resolveByAudio([]dedupAction{manual}, []dedupFile{f1, f2}, owners, nil, dedupNow)
+	if len(actions) != 1 || actions[0].kind != actManual || !strings.Contains(actions[0].reason, "identical audio") {
+		t.Fatalf("a live episode's copy should stay manual with a note, got %+v", actions)
+	}
+
+	// SKIP because the keeper is smaller, but the audio matches: delete
+	ep := liveOwner("Pat Show", "Ep", "2020-01-01")
+	keeper := mkFile("/pods", "Pat Show", ep.title, "2020-01-01", ep.epHash, 3000000)
+	bigger := mkFile("/arch", "Pat Show", ep.title, "2020-01-01", strings.Repeat("9", 32), 4000000)
+	keeper.audio, bigger.audio = "ccc", "ccc"
+	keeper.audioBytes, bigger.audioBytes = 2990000, 2990000
+	skip := dedupAction{kind: actSkip, file: bigger, keeperPath: keeper.path, reason: "keeper smaller"}
+	actions = resolveByAudio([]dedupAction{skip}, []dedupFile{keeper, bigger}, map[string]dedupOwner{ep.epHash: ep}, nil, dedupNow)
+	if len(actions) != 1 || actions[0].kind != actDelete {
+		t.Fatalf("identical audio should turn the skip into a delete, got %+v", actions)
+	}
+}
+
+// Empty and tag-only files all hash like sha256(""), and two saves of the
+// same error page hash alike: none of that is evidence, so the MANUAL
+// verdict stands and no episode row is pruned.
+func TestResolveByAudioIgnoresStubPayloads(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	dir := t.TempDir()
+	p2 := liveOwner("Analysis", "The Deobandis: Part 2", "2016-04-14")
+	p1 := staleOwner("Analysis", "The Deobandis: Part 1", "2016-04-14")
+	owners := map[string]dedupOwner{p1.epHash: p1, p2.epHash: p2}
+	f1 := mkFile(dir, "Analysis", p1.title, "2016-04-14", p1.epHash, 40361237)
+	f2 := mkFile(dir, "Analysis", p2.title, "2016-04-14", p2.epHash, 40894464)
+
+	errorPage := []byte("<html><body><h1>403 Forbidden</h1></body></html>")
+	for name, contents := range map[string][2][]byte{
+		"empty and tag-only": {nil, id3v2Tag(300)},
+		"same error page":    {errorPage, append(id3v2Tag(64), errorPage...)},
+	} {
+		if err := os.WriteFile(f1.path, contents[0], 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f2.path, contents[1], 0644); err != nil {
+			t.Fatal(err)
+		}
+		files, err := st.withAudioHashes([]dedupFile{f1, f2})
+		if err != nil {
+			t.Fatalf("%s: withAudioHashes: %v", name, err)
+		}
+		if files[0].audio == "" || files[0].audio != files[1].audio {
+			t.Fatalf("%s: expected identical payload hashes, got %q and %q", name, files[0].audio, files[1].audio)
+		}
+		actions := resolveByAudio(planDedup(files, owners, nil, dedupNow), files, owners, nil, dedupNow)
+		if byKind := actionsByKind(actions); len(byKind[actManual]) != 1 || len(byKind[actDelete]) != 0 {
+			t.Fatalf("%s: a stub-sized payload merged the copies: %+v", name, actions)
+		}
+	}
+}
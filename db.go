@@ -4,7 +4,7 @@ import (
 	"crypto/md5"
 	"database/sql"
 	"fmt"
-	"path/filepath"
+	"path"
 	"strings"
 
 	strip "github.com/grokify/html-strip-tags-go" // Lift of stripTags from html/template package
@@ -19,6 +19,8 @@ type latestPodResult struct {
 	dateForFilename sql.NullString
 	hash            sql.NullString
 	file            sql.NullString
+	status          string
+	season, episode string
 }
 
 // nullStrToStr is a utility function to convert a NullString to a string
@@ -53,8 +55,8 @@ func nullWrap(s string) sql.NullString {
 	}
 }
 
-// createTablesIfNotExist creates our SQLite db and tables if they do not exist
-func createTablesIfNotExist() {
+// createTablesIfNotExist creates our SQLite tables if they do not exist
+func (s *store) createTablesIfNotExist() error {
 	/*
 		select * from podcasts where title is null;
 		select * from episodes where podcast_title is null;
@@ -180,82 +182,167 @@ func createTablesIfNotExist() {
 		matched_title TEXT,
 		reason TEXT,
 		first_skipped TEXT NOT NULL,
-		last_skipped TEXT NOT NULL
+		last_skipped TEXT NOT NULL,
+		override TEXT -- 'force' or 'never' when a download override applied
 	);
 	`
 
-	db, err := sql.Open(sqlite3, dbFileName)
-	checkErr(err)
-
-	if err == nil {
-		defer db.Close()
-
-		statement, err := db.Prepare(createPodcasts)
-		checkErr(err)
-		_, err = statement.Exec()
-		checkErr(err)
-
-		statement, err = db.Prepare(createEpisodes)
-		checkErr(err)
-		_, err = statement.Exec()
-		checkErr(err)
-
-		statement, err = db.Prepare(createInteractiveEpisodes)
-		checkErr(err)
-		_, err = statement.Exec()
-		checkErr(err)
+	// Manual verdicts that beat the download-pass heuristics; see overrides.go
+	createDownloadOverrides := `
+	CREATE TABLE IF NOT EXISTS download_overrides (
+		podcastname_episodename_hash TEXT PRIMARY KEY,
+		action TEXT NOT NULL CHECK (action IN ('force', 'never')),
+		created TEXT NOT NULL
+	);
+	`
 
-		statement, err = db.Prepare(createInteractiveEpisodesPodcastIdx)
-		checkErr(err)
-		_, err = statement.Exec()
-		checkErr(err)
+	// Dedup runs and their undo journal; see trash.go
+	createDedupRuns := `
+	CREATE TABLE IF NOT EXISTS dedup_runs (
+		run_id TEXT PRIMARY KEY,
+		command TEXT NOT NULL,
+		started TEXT NOT NULL,
+		undone TEXT,
+		purged TEXT
+	);
+	`
+	createDedupJournal := `
+	CREATE TABLE IF NOT EXISTS dedup_journal (
+		run_id TEXT NOT NULL,
+		seq INTEGER NOT NULL,
+		op TEXT NOT NULL, -- move, delete_row or insert_row
+		path TEXT,
+		new_path TEXT,
+		table_name TEXT,
+		row_key TEXT,
+		row_json TEXT, -- column -> SQL literal, for delete_row
+		PRIMARY KEY (run_id, seq)
+	);
+	`
 
-		statement, err = db.Prepare(createEpisodesFileUrlHashIdx)
-		checkErr(err)
-		_, err = statement.Exec()
-		checkErr(err)
+	// Audio payload hashes of files on the scan paths; see audiohash.go
+	createFileHashes := `
+	CREATE TABLE IF NOT EXISTS file_hashes (
+		path TEXT PRIMARY KEY,
+		size INTEGER NOT NULL,
+		mtime INTEGER NOT NULL, -- UnixNano
+		audio_sha256 TEXT NOT NULL,
+		audio_bytes INTEGER NOT NULL DEFAULT -1, -- payload length; -1 if not recorded
+		hashed_at TEXT NOT NULL
+	);
+	`
 
-		statement, err = db.Prepare(createEpisodesTitleIdx)
-		checkErr(err)
-		_, err = statement.Exec()
-		checkErr(err)
+	// Per-podcast overrides of the skip and dedup heuristics; see heuristics.go
+	createPodcastSettings := `
+	CREATE TABLE IF NOT EXISTS podcast_settings (
+		podcast_title TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		updated TEXT NOT NULL,
+		PRIMARY KEY (podcast_title, key)
+	);
+	`
 
-		statement, err = db.Prepare(createInteractiveEpisodesFileUrlHashIdx)
-		checkErr(err)
-		_, err = statement.Exec()
-		checkErr(err)
+	// Episodes played from the TUI; see played.go
+	createPlayedEpisodes := `
+	CREATE TABLE IF NOT EXISTS played_episodes (
+		podcastname_episodename_hash TEXT PRIMARY KEY,
+		position INTEGER NOT NULL DEFAULT 0, -- seconds the player was open on it
+		completed_at TEXT, -- when marked played; NULL while unplayed
+		updated TEXT NOT NULL
+	);
+	`
 
-		statement, err = db.Prepare(createEpisodesPodcastGuidIdx)
-		checkErr(err)
-		_, err = statement.Exec()
-		checkErr(err)
+	// How fetching each feed URL has gone; see subscriptions.go
+	createFeedHealth := `
+	CREATE TABLE IF NOT EXISTS feed_health (
+		url TEXT PRIMARY KEY,
+		podcast_title TEXT,
+		last_fetch TEXT NOT NULL,
+		last_ok TEXT,
+		last_error TEXT,
+		failures INTEGER NOT NULL DEFAULT 0 -- since the last good fetch
+	);
+	`
 
-		statement, err = db.Prepare(createDownloaded)
-		checkErr(err)
-		_, err = statement.Exec()
-		checkErr(err)
+	for _, stmt := range []string{
+		createPodcasts,
+		createEpisodes,
+		createInteractiveEpisodes,
+		createInteractiveEpisodesPodcastIdx,
+		createEpisodesFileUrlHashIdx,
+		createEpisodesTitleIdx,
+		createInteractiveEpisodesFileUrlHashIdx,
+		createEpisodesPodcastGuidIdx,
+		createDownloaded,
+		createArchivedEpisodes,
+		createArchivedEpisodesPathIdx,
+		createSkippedEpisodes,
+		createDownloadOverrides,
+		createDedupRuns,
+		createDedupJournal,
+		createFileHashes,
+		createPodcastSettings,
+		createFeedHealth,
+		createPlayedEpisodes,
+	} {
+		if _, err := s.q.Exec(stmt); err != nil {
+			return err
+		}
+	}
 
-		statement, err = db.Prepare(createArchivedEpisodes)
-		checkErr(err)
-		_, err = statement.Exec()
-		checkErr(err)
+	// Columns added after their table first shipped
+	if err := s.addColumnIfMissing("skipped_episodes", "override", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("file_hashes", "audio_bytes", "INTEGER NOT NULL DEFAULT -1"); err != nil {
+		return err
+	}
+	// itunes season, for filename templates (see template.go); itunes
+	// duration and enclosure length, for the TUI detail pane
+	for _, table := range []string{"episodes", "interactive_episodes"} {
+		for _, col := range []string{season, duration, fileSize} {
+			if err := s.addColumnIfMissing(table, col, "TEXT"); err != nil {
+				return err
+			}
+		}
+	}
 
-		statement, err = db.Prepare(createArchivedEpisodesPathIdx)
-		checkErr(err)
-		_, err = statement.Exec()
-		checkErr(err)
+	// Clean up historical rows with NULL or empty podcast_title
+	if _, err := s.q.Exec(`DELETE FROM episodes WHERE podcast_title IS NULL OR TRIM(podcast_title) = '';`); err != nil {
+		return err
+	}
+	if _, err := s.q.Exec(`DELETE FROM interactive_episodes WHERE podcast_title IS NULL OR TRIM(podcast_title) = '';`); err != nil {
+		return err
+	}
 
-		statement, err = db.Prepare(createSkippedEpisodes)
-		checkErr(err)
-		_, err = statement.Exec()
-		checkErr(err)
+	// Last, so a rebuild sees the cleaned-up episodes table
+	return s.createSearchIndex()
+}
 
-		// Clean up historical rows with NULL or empty podcast_title
-		_, err = db.Exec(`DELETE FROM episodes WHERE podcast_title IS NULL OR TRIM(podcast_title) = '';`)
-		checkErr(err)
-		_, err = db.Exec(`DELETE FROM interactive_episodes WHERE podcast_title IS NULL OR TRIM(podcast_title) = '';`)
-		checkErr(err)
+// addColumnIfMissing adds a column to an existing table, for databases
+// created before the column was in the CREATE TABLE.
+func (s *store) addColumnIfMissing(table, column, decl string) error {
+	rows, err := s.q.Query(`SELECT name FROM pragma_table_info(?);`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
 	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = s.q.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s;`, table, column, decl))
+	return err
 }
 
 // A feed title we have never seen is only treated as a NEW podcast after a
@@ -271,7 +358,7 @@ const renameMinGuidMatches = 3
 // titles that still have a podcasts row count: orphaned episode rows can't be
 // renamed in place coherently, and the cross-podcast guard in skip.go still
 // protects their files from re-download.
-func detectPodcastRename(tx *sql.Tx, newTitle string, episodes []M) (oldTitle string, matched int, total int) {
+func detectPodcastRename(tx dbtx, newTitle string, episodes []M) (oldTitle string, matched int, total int) {
 	guidSet := make(map[string]bool)
 	for idx := range episodes {
 		if g, ok := episodes[idx][guid].(string); ok {
@@ -339,7 +426,7 @@ func detectPodcastRename(tx *sql.Tx, newTitle string, episodes []M) (oldTitle st
 // (podcastname_episodename_hash) are deliberately NOT recomputed: the hash is
 // the stable identity that ties a row to its file on disk and to the archive
 // registry, and the files keep their old-name filenames.
-func renamePodcastInPlace(tx *sql.Tx, oldTitle string, pod map[string]string) {
+func renamePodcastInPlace(tx dbtx, oldTitle string, pod map[string]string) {
 	_, err := tx.Exec(`
 		UPDATE podcasts
 		SET title = ?, author = ?, category = ?, description = ?,
@@ -403,7 +490,7 @@ func findGuidSibling(stmt *sql.Stmt, podTitle string, ep map[string]string) stri
 		var hash, rowTitle, rowPublished string
 		checkErr(rows.Scan(&hash, &rowTitle, &rowPublished))
 		if (epDate != "" && epDate == publishedDate10(rowPublished)) ||
-			materialTitleOverlap(ep[title], rowTitle) {
+			heuristicsFor(podTitle).materialTitleOverlap(ep[title], rowTitle) {
 			return hash
 		}
 	}
@@ -411,6 +498,26 @@ func findGuidSibling(stmt *sql.Stmt, podTitle string, ep map[string]string) stri
 	return ""
 }
 
+// feedChanges records what podEpisodesIntoDatabase did with one feed, for
+// --simulate.
+type feedChanges struct {
+	url          string
+	podcastTitle string
+	newPodcast   bool
+	renamedFrom  string             // previous podcast title on an in-place rename
+	inserted     []string           // titles of new episodes rows
+	refreshed    []refreshedEpisode // hash misses matched to an existing row
+	seen         int                // episodes whose last_seen was bumped, refreshed ones included
+	err          error              // the feed failed to fetch or parse
+}
+
+// refreshedEpisode is an incoming episode that kept an existing row's
+// identity (a retitle, rename or repeat) instead of being inserted.
+type refreshedEpisode struct {
+	title        string
+	existingHash string
+}
+
 // podEpisodesIntoDatabase adds the podcast metadata to the db.
 //
 // All writes for one feed are wrapped in a single transaction, and the
@@ -421,23 +528,20 @@ func findGuidSibling(stmt *sql.Stmt, podTitle string, ep map[string]string) stri
 // feed. The SQL and the insert/update/upsert decision logic are unchanged, so
 // the resulting rows are identical to the previous autocommit version; the only
 // behavioural difference is that a feed's writes are now atomic (all-or-nothing
-// if an error aborts mid-feed). The caller owns db and must not have it closed.
-func podEpisodesIntoDatabase(db *sql.DB, pod map[string]string, episodes []M) {
+// if an error aborts mid-feed). It returns what the feed changed.
+func podEpisodesIntoDatabase(s *store, pod map[string]string, episodes []M) feedChanges {
+	changes := feedChanges{podcastTitle: pod[title]}
 
 	// For the podcast
 	// 1. Is it in the db?
 	//   If yes then update the last seen timestamp
 	//   If no then add it to the db
 
-	tx, err := db.Begin()
+	txs, err := s.begin()
 	checkErr(err)
-	committed := false
-	defer func() {
-		// No-op once Commit has succeeded; otherwise unwind the feed's writes.
-		if !committed {
-			_ = tx.Rollback()
-		}
-	}()
+	// No-op once commit has succeeded; otherwise unwind the feed's writes.
+	defer txs.rollback()
+	tx := txs.q
 
 	// 1. Is it in the db?
 	rows, err := tx.Query(`
@@ -489,12 +593,15 @@ func podEpisodesIntoDatabase(db *sql.DB, pod map[string]string, episodes []M) {
 			log.Printf("%q is not in the db but %d/%d feed guids belong to %q — treating as a podcast rename, updating in place",
 				pod[title], matched, total, oldTitle)
 			renamePodcastInPlace(tx, oldTitle, pod)
+			checkErr(txs.renamePodcastInSearchIndex(oldTitle, pod[title]))
+			changes.renamedFrom = oldTitle
 			count = 1
 		}
 	}
 
 	if count == 0 {
 		log.Println(pod[title], "is not in the db and seems to be a new podcast, adding")
+		changes.newPodcast = true
 
 		// We wrap these because we don't want empty strings in the db ideally
 		res, err := tx.Exec(`
@@ -581,12 +688,14 @@ func podEpisodesIntoDatabase(db *sql.DB, pod map[string]string, episodes []M) {
 			file, format, guid,
 			link, published, title,
 			updated, first_seen, last_seen,
-			podcast_title, podcastname_episodename_hash, file_url_hash
+			podcast_title, podcastname_episodename_hash, file_url_hash,
+			season, duration, file_size
 		) VALUES (
 			?, ?, ?,
 			?, ?, ?,
 			?, ?, ?,
 			?, ?, ?,
+			?, ?, ?,
 			?, ?, ?
 		);`)
 	checkErr(err)
@@ -658,7 +767,10 @@ func podEpisodesIntoDatabase(db *sql.DB, pod map[string]string, episodes []M) {
 				}
 				podcastNameEpisodenameHash = sibling
 				guidRefreshed++
+				changes.refreshed = append(changes.refreshed, refreshedEpisode{title: ep[title], existingHash: sibling})
 				count = 1
+			} else {
+				changes.inserted = append(changes.inserted, ep[title])
 			}
 		}
 
@@ -676,6 +788,7 @@ func podEpisodesIntoDatabase(db *sql.DB, pod map[string]string, episodes []M) {
 			if verbose {
 				log.Println(affected, "rows updated (last_seen)")
 			}
+			changes.seen++
 		}
 
 		if count == 0 {
@@ -703,6 +816,9 @@ func podEpisodesIntoDatabase(db *sql.DB, pod map[string]string, episodes []M) {
 				nullWrap(pod[title]),
 				podcastNameEpisodenameHash,
 				fileUrlHash,
+				nullWrap(ep[season]),
+				nullWrap(ep[duration]),
+				nullWrap(ep[fileSize]),
 			)
 			checkErr(err)
 
@@ -711,6 +827,9 @@ func podEpisodesIntoDatabase(db *sql.DB, pod map[string]string, episodes []M) {
 			if verbose {
 				log.Println("insert id for episode", ep[title], "is", idx)
 			}
+
+			err = txs.indexEpisodeForSearch(podcastNameEpisodenameHash, pod[title], ep[title], ep[description], ep[author])
+			checkErr(err)
 		}
 
 		err = execInteractiveUpsert(interStmt, pod[title], ep, podcastNameEpisodenameHash, fileUrlHash)
@@ -721,26 +840,28 @@ func podEpisodesIntoDatabase(db *sql.DB, pod map[string]string, episodes []M) {
 		log.Printf("%d episode(s) of %q matched existing rows by guid or title (retitle/rename/repeat) and were refreshed in place", guidRefreshed, pod[title])
 	}
 
-	checkErr(tx.Commit())
-	committed = true
+	checkErr(txs.commit())
+	return changes
 }
 
 // interactiveEpisodeUpsertSQL upserts a row into interactive_episodes. It is
-// shared by the batch parse path (prepared once per feed on a *sql.Tx) and by
-// the interactive importer (prepared per call on a *sql.DB), so the two paths
-// stay in lockstep.
+// shared by the batch parse path and by the interactive importer (each
+// prepared once per feed inside its transaction), so the two paths stay in
+// lockstep.
 const interactiveEpisodeUpsertSQL = `
 	INSERT INTO interactive_episodes (
 		author, description, episode,
 		file, format, guid,
 		link, published, title,
 		updated, first_seen, last_seen,
-		podcast_title, podcastname_episodename_hash, file_url_hash
+		podcast_title, podcastname_episodename_hash, file_url_hash,
+		season, duration, file_size
 	) VALUES (
 		?, ?, ?,
 		?, ?, ?,
 		?, ?, ?,
 		?, ?, ?,
+		?, ?, ?,
 		?, ?, ?
 	)
 	ON CONFLICT(podcastname_episodename_hash) DO UPDATE SET
@@ -756,12 +877,15 @@ const interactiveEpisodeUpsertSQL = `
 		updated = excluded.updated,
 		podcast_title = excluded.podcast_title,
 		file_url_hash = excluded.file_url_hash,
+		season = excluded.season,
+		duration = excluded.duration,
+		file_size = excluded.file_size,
 		last_seen = excluded.last_seen
 	;`
 
 // execInteractiveUpsert runs interactiveEpisodeUpsertSQL against an
-// already-prepared statement (prepared from either a *sql.DB or a *sql.Tx). The
-// argument order matches the placeholders in interactiveEpisodeUpsertSQL.
+// already-prepared statement. The argument order matches the placeholders
+// in interactiveEpisodeUpsertSQL.
 func execInteractiveUpsert(stmt *sql.Stmt, podTitle string, ep map[string]string, podcastNameEpisodenameHash string, fileUrlHash string) error {
 	_, err := stmt.Exec(
 		nullWrap(ep[author]),
@@ -779,79 +903,70 @@ func execInteractiveUpsert(stmt *sql.Stmt, podTitle string, ep map[string]string
 		podTitle,
 		podcastNameEpisodenameHash,
 		fileUrlHash,
+		nullWrap(ep[season]),
+		nullWrap(ep[duration]),
+		nullWrap(ep[fileSize]),
 	)
 	return err
 }
 
-func upsertInteractiveEpisodeRecord(db *sql.DB, podTitle string, ep map[string]string, podcastNameEpisodenameHash string, fileUrlHash string) error {
-	stmt, err := db.Prepare(interactiveEpisodeUpsertSQL)
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-
-	return execInteractiveUpsert(stmt, podTitle, ep, podcastNameEpisodenameHash, fileUrlHash)
-}
-
-func storeParsedFeedInInteractiveTable(pod map[string]string, episodes []M) error {
+// storeParsedFeedInInteractiveTable upserts a feed fetched from the TUI into
+// interactive_episodes, in one transaction.
+func (s *store) storeParsedFeedInInteractiveTable(pod map[string]string, episodes []M) error {
 	podTitle := strings.TrimSpace(pod[title])
 	if podTitle == "" {
 		return fmt.Errorf("podcast title is empty")
 	}
 
-	db, err := sql.Open(sqlite3, dbFileName)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	for idx := range episodes {
-		ep := make(map[string]string)
-		for key, value := range episodes[idx] {
-			if value == nil {
-				ep[key] = ""
-				continue
-			}
-			strVal, ok := value.(string)
-			if !ok {
-				ep[key] = ""
-				continue
-			}
-			ep[key] = strVal
-		}
-
-		podcastNameEpisodeName := podTitle + ep[title]
-		podcastNameEpisodenameHash := fmt.Sprintf("%x", md5.Sum([]byte(podcastNameEpisodeName)))
-		fileUrlHash := fmt.Sprintf("%x", md5.Sum([]byte(ep[file])))
-		ep[description] = strip.StripTags(ep[description])
-
-		err = upsertInteractiveEpisodeRecord(db, podTitle, ep, podcastNameEpisodenameHash, fileUrlHash)
+	return s.inTx(func(tx *store) error {
+		stmt, err := tx.q.Prepare(interactiveEpisodeUpsertSQL)
 		if err != nil {
 			return err
 		}
-	}
+		defer stmt.Close()
+
+		for idx := range episodes {
+			ep := make(map[string]string)
+			for key, value := range episodes[idx] {
+				if value == nil {
+					ep[key] = ""
+					continue
+				}
+				strVal, ok := value.(string)
+				if !ok {
+					ep[key] = ""
+					continue
+				}
+				ep[key] = strVal
+			}
 
-	return nil
+			podcastNameEpisodeName := podTitle + ep[title]
+			podcastNameEpisodenameHash := fmt.Sprintf("%x", md5.Sum([]byte(podcastNameEpisodeName)))
+			fileUrlHash := fmt.Sprintf("%x", md5.Sum([]byte(ep[file])))
+			ep[description] = strip.StripTags(ep[description])
+
+			if err := execInteractiveUpsert(stmt, podTitle, ep, podcastNameEpisodenameHash, fileUrlHash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func recordInteractiveDownload(downloadPath string) error {
-	filename := strings.TrimSpace(filepath.Base(downloadPath))
+// recordInteractiveDownload records a file downloaded (and tagged) from the
+// TUI in the downloads table, under its path relative to the podcasts dir.
+func (s *store) recordInteractiveDownload(downloadPath string) error {
+	filename := strings.TrimSpace(nameTemplate.relName(downloadPath))
 	if filename == "" {
 		return fmt.Errorf("download path does not contain a filename")
 	}
 
-	hash, err := hashFromDownloadFilename(filename)
-	if err != nil {
-		return err
-	}
-
-	db, err := sql.Open(sqlite3, dbFileName)
+	hash, err := hashFromDownloadFilename(path.Base(filename))
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
-	_, err = db.Exec(`
+	_, err = s.q.Exec(`
 		INSERT INTO downloads
 		(filename, hash, first_seen, last_seen, tagged_at)
 		VALUES
@@ -888,99 +1003,344 @@ func hashFromDownloadFilename(filename string) (string, error) {
 }
 
 // updateDatabaseForDownloads updates the db to record the pods downloaded as downloaded
-func updateDatabaseForDownloads() {
+func updateDatabaseForDownloads(s *store) {
 	cwd := getCwd()
 	fmt.Printf("Note: updating db with downloaded files in %s\n", cwd)
 
 	// Get files
 	files := sensibleFilesInDir(cwd).ToSlice()
 
-	// Open db
-	db, err := sql.Open(sqlite3, dbFileName)
+	// Update or insert as appropriate, all in one commit
+	err := s.inTx(func(tx *store) error {
+		for _, file := range files {
+			fileStr := fmt.Sprintf("%v", file)
+			hash, _, err := hashFromFilename(fileStr)
+			if err != nil {
+				log.Printf("skipping file %s: %v", fileStr, err)
+				continue
+			}
+
+			inserted, err := tx.recordDownloadSeen(fileStr, hash)
+			if err != nil {
+				return err
+			}
+			if inserted {
+				log.Println(file, "is not in the db and seems to be a fresh download, adding")
+			} else if verbose {
+				log.Println(file, "was already in the db, last_seen updated")
+			}
+		}
+		return nil
+	})
 	checkErr(err)
 
-	if err == nil {
-		defer db.Close()
+	// Could check to see if anything has unexpectedly disappeared but this seems pointless hence not done
+}
+
+// recordDownloadSeen refreshes the downloads row for filename, inserting it
+// (untagged) if it is new. Reports whether a row was inserted.
+func (s *store) recordDownloadSeen(filename string, hash string) (bool, error) {
+	var count int
+	if err := s.q.QueryRow(`SELECT count(*) FROM downloads WHERE filename = ?;`, filename).Scan(&count); err != nil {
+		return false, err
+	}
+	if count > 1 {
+		return false, fmt.Errorf("%s is in the db more than once, this should not happen", filename)
+	}
+	if count == 1 {
+		_, err := s.q.Exec(`
+			UPDATE downloads
+			SET hash = ?, last_seen = ?
+			WHERE filename = ?
+			;`, hash, ts, filename)
+		return false, err
+	}
+	_, err := s.q.Exec(`
+		INSERT INTO downloads
+		(filename, hash, first_seen, last_seen)
+		VALUES
+		(?, ?, ?, ?)
+		;`, filename, hash, ts, ts)
+	return err == nil, err
+}
+
+// deleteDownload forgets filename in the downloads table.
+func (s *store) deleteDownload(filename string) error {
+	_, err := s.q.Exec(`DELETE FROM downloads WHERE filename = ?;`, filename)
+	return err
+}
+
+// untaggedDownload is a downloads row awaiting ID3 tagging, joined to its
+// episode metadata.
+type untaggedDownload struct {
+	filename     string
+	podcastTitle string
+	title        string
+}
+
+// untaggedDownloads lists downloaded files not yet tagged, by filename.
+func (s *store) untaggedDownloads() ([]untaggedDownload, error) {
+	rows, err := s.q.Query(`
+		SELECT
+			filename,
+			COALESCE(podcast_title, 'title missing') AS podcast_title,
+			COALESCE(title, 'title missing') AS title
+		FROM downloads AS d
+		JOIN episodes AS e ON d.hash = e.podcastname_episodename_hash
+		WHERE tagged_at IS null
+		ORDER BY filename
+		;`)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Update or insert as appropriate
-	for _, file := range files {
-		fileStr := fmt.Sprintf("%v", file)
-		hash, _, err := hashFromFilename(fileStr)
-		if err != nil {
-			log.Printf("skipping file %s: %v", fileStr, err)
-			continue
+	out := make([]untaggedDownload, 0)
+	for rows.Next() {
+		var d untaggedDownload
+		if err := rows.Scan(&d.filename, &d.podcastTitle, &d.title); err != nil {
+			return nil, err
 		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
 
-		// See if it's in already
-		rows, err := db.Query(`
-			SELECT count(*) AS COUNT
-			FROM downloads
-			WHERE filename = ?
-			;`, file)
-		checkErr(err)
+// markDownloadTagged stamps tagged_at on one downloads row.
+func (s *store) markDownloadTagged(filename string) error {
+	res, err := s.q.Exec(`UPDATE downloads SET tagged_at = ? WHERE filename = ?;`, ts, filename)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != 1 {
+		return fmt.Errorf("tagging %s updated %d rows, want 1", filename, affected)
+	}
+	return nil
+}
 
-		// If it is, update last_seen
-		var count int
-		for rows.Next() {
-			err = rows.Scan(&count)
-			checkErr(err)
+// episodeWithFile is an episodes row that has an enclosure URL, i.e. one
+// that could be (or has been) downloaded.
+type episodeWithFile struct {
+	podcastTitle string
+	title        string
+	episodeHash  string
+}
+
+// episodesWithFiles lists every episode that has an enclosure URL.
+func (s *store) episodesWithFiles() ([]episodeWithFile, error) {
+	rows, err := s.q.Query(`SELECT podcast_title, title, podcastname_episodename_hash FROM episodes WHERE file IS NOT NULL AND file !='';`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]episodeWithFile, 0)
+	for rows.Next() {
+		var e episodeWithFile
+		if err := rows.Scan(&e.podcastTitle, &e.title, &e.episodeHash); err != nil {
+			return nil, err
 		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
 
-		if count > 1 {
-			log.Panicln(file, "is in the db more than once, this should not happen")
+// deleteEpisode drops one episodes row (and its search index entry) by
+// episode hash.
+func (s *store) deleteEpisode(episodeHash string) error {
+	if _, err := s.q.Exec(`DELETE FROM episodes WHERE podcastname_episodename_hash = ?;`, episodeHash); err != nil {
+		return err
+	}
+	return s.unindexEpisodeForSearch(episodeHash)
+}
+
+// legacyURLHashes returns a map from file_url_hash to
+// podcastname_episodename_hash for every episode in the db.
+func (s *store) legacyURLHashes() (map[string]string, error) {
+	rows, err := s.q.Query(`SELECT file_url_hash, podcastname_episodename_hash FROM episodes WHERE file_url_hash IS NOT NULL AND file_url_hash != '';`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]string)
+	for rows.Next() {
+		var urlHash, episodeHash string
+		if err := rows.Scan(&urlHash, &episodeHash); err != nil {
+			return nil, err
 		}
+		out[urlHash] = episodeHash
+	}
+	return out, rows.Err()
+}
 
-		// If yes then update the last seen timestamp
-		if count == 1 {
-			stmt, err := db.Prepare(`
-				UPDATE downloads 
-				SET hash = ?, last_seen = ?
-				WHERE filename = ?
-				;`)
-			checkErr(err)
+// queueRow is one downloadable episode considered by the download pass.
+// published falls back to first_seen when the feed gives no date, which
+// sensibly handles feeds without a published tag.
+type queueRow struct {
+	podcastTitle, published, title, episodeHash, file string
+	guid, firstSeen, lastSeen                         string
+	season, episode                                   string
+}
 
-			res, err := stmt.Exec(hash, ts, file)
-			checkErr(err)
+// filename is where the filename template puts the episode.
+func (r queueRow) filename() string {
+	return episodeFilename(episodeNaming{podcast: r.podcastTitle, title: r.title,
+		date: shortDate(r.published), hash: r.episodeHash, season: r.season, episode: r.episode})
+}
 
-			affected, err := res.RowsAffected()
-			checkErr(err)
+// downloadQueue lists every episode with an enclosure, the raw input the
+// download pass filters down to the script. Some feeds carry entries with no
+// file (e.g. the Risky Talk RSS includes transcripts with an empty file
+// tag); those are excluded here.
+func (s *store) downloadQueue() ([]queueRow, error) {
+	rows, err := s.q.Query(`
+		SELECT podcast_title, IFNULL(published, first_seen), title,
+			podcastname_episodename_hash, file, IFNULL(guid, ''),
+			IFNULL(first_seen, ''), IFNULL(last_seen, ''),
+			IFNULL(season, ''), IFNULL(episode, '')
+		FROM episodes
+		WHERE file != '' AND file IS NOT NULL
+		;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-			if verbose {
-				log.Println(affected, "rows updated (last_seen)")
-			}
+	out := make([]queueRow, 0)
+	for rows.Next() {
+		var r queueRow
+		if err := rows.Scan(&r.podcastTitle, &r.published, &r.title, &r.episodeHash, &r.file, &r.guid, &r.firstSeen, &r.lastSeen,
+			&r.season, &r.episode); err != nil {
+			return nil, err
 		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
 
-		//   If no then add it to the db
-		if count == 0 {
-			log.Println(file, "is not in the db and seems to be a fresh download, adding")
-
-			stmt, err := db.Prepare(`
-				INSERT INTO downloads
-				(filename, hash, first_seen, last_seen)
-				VALUES
-				(?, ?, ?, ?)
-				;`)
-			checkErr(err)
+// latestEpisodes returns the episodes matching f in f's sort order, each
+// with its status (see episodeStatusSQL).
+func (s *store) latestEpisodes(f latestFilter) ([]latestPodResult, error) {
+	const dateExpr = `IFNULL(e.published, e.first_seen)`
+	where := make([]string, 0)
+	args := make([]interface{}, 0)
+	if len(f.podcasts) > 0 {
+		where = append(where, `e.podcast_title IN (?`+strings.Repeat(`, ?`, len(f.podcasts)-1)+`)`)
+		for _, p := range f.podcasts {
+			args = append(args, p)
+		}
+	}
+	if !f.since.IsZero() {
+		where = append(where, `substr(`+dateExpr+`, 1, 10) >= ?`)
+		args = append(args, f.since.Format("2006-01-02"))
+	}
+	if !f.until.IsZero() {
+		where = append(where, `substr(`+dateExpr+`, 1, 10) <= ?`)
+		args = append(args, f.until.Format("2006-01-02"))
+	}
+	if f.status != "" {
+		where = append(where, episodeStatusSQL+` = ?`)
+		args = append(args, f.status)
+	}
+	if f.unplayed {
+		where = append(where, `NOT EXISTS (SELECT 1 FROM played_episodes AS p
+			WHERE p.podcastname_episodename_hash = e.podcastname_episodename_hash AND p.completed_at IS NOT NULL)`)
+	}
+	for _, t := range searchTerms(f.match) {
+		where = append(where, `(e.title LIKE ? ESCAPE '\' OR e.description LIKE ? ESCAPE '\')`)
+		pat := "%" + likeEscaper.Replace(t) + "%"
+		args = append(args, pat, pat)
+	}
+	whereSQL := ""
+	if len(where) > 0 {
+		whereSQL = "where " + strings.Join(where, " and ")
+	}
 
-			// We wrap these because we don't want empty strings in the db ideally
-			res, err := stmt.Exec(file, hash, ts, ts)
-			checkErr(err)
+	orderSQL := `e.published desc`
+	switch f.sort {
+	case sortOldest:
+		orderSQL = dateExpr + ` asc`
+	case sortPodcast:
+		orderSQL = `e.podcast_title collate nocase asc, e.published desc`
+	case sortTitle:
+		orderSQL = `e.title collate nocase asc, e.podcast_title collate nocase asc`
+	}
 
-			idx, err := res.LastInsertId()
-			checkErr(err)
+	// SQLite treats a negative LIMIT as no limit
+	limit := f.limit
+	if limit == 0 {
+		limit = -1
+	}
+	args = append(args, limit)
+
+	rows, err := s.q.Query(`select
+	  e.author,
+	  e.title,
+	  e.published,
+	  e.podcast_title,
+	  `+dateExpr+`,
+	  e.podcastname_episodename_hash,
+	  e.file,
+	  `+episodeStatusSQL+`,
+	  IFNULL(e.season, ''),
+	  IFNULL(e.episode, '')
+	from episodes as e
+	`+whereSQL+`
+	order by `+orderSQL+`
+	limit ?;`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-			if verbose {
-				log.Println("insert id for podcast download", file, "is", idx)
-			}
+	out := make([]latestPodResult, 0)
+	for rows.Next() {
+		var latest latestPodResult
+		if err := rows.Scan(
+			&latest.author,
+			&latest.title,
+			&latest.published,
+			&latest.podcast_title,
+			&latest.dateForFilename,
+			&latest.hash,
+			&latest.file,
+			&latest.status,
+			&latest.season,
+			&latest.episode,
+		); err != nil {
+			return nil, err
 		}
+		out = append(out, latest)
 	}
+	return out, rows.Err()
+}
 
-	// Could check to see if anything has unexpectedly disappeared but this seems pointless hence not done
+// episodePodcastTitles lists the distinct podcast titles episodes carry, for
+// resolving a -l --podcast pattern.
+func (s *store) episodePodcastTitles() ([]string, error) {
+	rows, err := s.q.Query(`SELECT DISTINCT podcast_title FROM episodes WHERE podcast_title IS NOT NULL ORDER BY podcast_title;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]string, 0)
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
 }
 
-// skippedEpisodeRecord is one download-pass retitle skip destined for the
-// skipped_episodes audit table.
+// skippedEpisodeRecord is one download-pass retitle skip or applied download
+// override destined for the skipped_episodes audit table.
 type skippedEpisodeRecord struct {
 	episodeHash  string
 	podcastTitle string
@@ -989,48 +1349,72 @@ type skippedEpisodeRecord struct {
 	matchedHash  string
 	matchedTitle string
 	reason       string
+	override     string // overrideForce or overrideNever when one applied
 }
 
-// recordSkippedEpisodes upserts the run's retitle skips into skipped_episodes
-// in one transaction: new skips get first_skipped, repeat skips refresh
-// last_skipped and the match details.
-func recordSkippedEpisodes(records []skippedEpisodeRecord) error {
-	if len(records) == 0 {
-		return nil
-	}
-	db, err := sql.Open(sqlite3, dbFileName)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
+// skippedEpisodeRow is a skipped_episodes row as read back for --skipped.
+type skippedEpisodeRow struct {
+	skippedEpisodeRecord
+	firstSkipped string
+	lastSkipped  string
+}
 
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	stmt, err := tx.Prepare(`
-		INSERT INTO skipped_episodes
-			(podcastname_episodename_hash, podcast_title, title, guid,
-			 matched_episode_hash, matched_title, reason, first_skipped, last_skipped)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-		ON CONFLICT(podcastname_episodename_hash) DO UPDATE SET
-			matched_episode_hash = excluded.matched_episode_hash,
-			matched_title = excluded.matched_title,
-			reason = excluded.reason,
-			last_skipped = excluded.last_skipped
+// skippedEpisodes lists the skip audit, most recently skipped first.
+func (s *store) skippedEpisodes() ([]skippedEpisodeRow, error) {
+	rows, err := s.q.Query(`
+		SELECT podcastname_episodename_hash, IFNULL(podcast_title, ''), IFNULL(title, ''),
+			IFNULL(guid, ''), IFNULL(matched_episode_hash, ''), IFNULL(matched_title, ''),
+			IFNULL(reason, ''), first_skipped, last_skipped, IFNULL(override, '')
+		FROM skipped_episodes
+		ORDER BY last_skipped DESC, podcast_title, title
 		;`)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]skippedEpisodeRow, 0)
+	for rows.Next() {
+		var r skippedEpisodeRow
+		if err := rows.Scan(&r.episodeHash, &r.podcastTitle, &r.title, &r.guid,
+			&r.matchedHash, &r.matchedTitle, &r.reason, &r.firstSkipped, &r.lastSkipped, &r.override); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
 	}
-	defer stmt.Close()
+	return out, rows.Err()
+}
 
-	for _, r := range records {
-		if _, err := stmt.Exec(r.episodeHash, r.podcastTitle, r.title, r.guid,
-			r.matchedHash, r.matchedTitle, r.reason, ts, ts); err != nil {
+// recordSkippedEpisodes upserts the run's skip audit into skipped_episodes
+// in one transaction: new skips get first_skipped, repeat skips refresh
+// last_skipped and the match details.
+func (s *store) recordSkippedEpisodes(records []skippedEpisodeRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return s.inTx(func(tx *store) error {
+		stmt, err := tx.q.Prepare(`
+			INSERT INTO skipped_episodes
+				(podcastname_episodename_hash, podcast_title, title, guid,
+				 matched_episode_hash, matched_title, reason, first_skipped, last_skipped, override)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(podcastname_episodename_hash) DO UPDATE SET
+				matched_episode_hash = excluded.matched_episode_hash,
+				matched_title = excluded.matched_title,
+				reason = excluded.reason,
+				last_skipped = excluded.last_skipped,
+				override = excluded.override
+			;`)
+		if err != nil {
 			return err
 		}
-	}
-	return tx.Commit()
+		defer stmt.Close()
+
+		for _, r := range records {
+			if _, err := stmt.Exec(r.episodeHash, r.podcastTitle, r.title, r.guid,
+				r.matchedHash, r.matchedTitle, r.reason, ts, ts, nullWrap(r.override)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
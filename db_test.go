@@ -11,7 +11,7 @@ import (
 
 func TestNullPodcastTitleCleanup(t *testing.T) {
 	useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -55,7 +55,9 @@ func TestNullPodcastTitleCleanup(t *testing.T) {
 	db.Close()
 
 	// Run createTablesIfNotExist again — this triggers the cleanup migration
-	createTablesIfNotExist()
+	if err := st.createTablesIfNotExist(); err != nil {
+		t.Fatalf("createTablesIfNotExist: %v", err)
+	}
 
 	// Verify bad rows are gone, good rows remain
 	db, err = sql.Open(sqlite3, dbFileName)
@@ -101,7 +103,7 @@ func TestNullPodcastTitleCleanup(t *testing.T) {
 
 func TestUpdateDatabaseForDownloadsNormalizesExistingHash(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	podcastTitle := "Repair Show"
 	episodeTitle := "Repair Episode"
@@ -128,7 +130,7 @@ func TestUpdateDatabaseForDownloadsNormalizesExistingHash(t *testing.T) {
 		t.Fatalf("insert downloads row: %v", err)
 	}
 
-	updateDatabaseForDownloads()
+	updateDatabaseForDownloads(st)
 
 	wantHash, _, err := hashFromFilename(filename)
 	if err != nil {
@@ -169,7 +171,7 @@ func renameTestFeed(podTitle string, n int) (map[string]string, []M) {
 // because the hash is what ties a row to its file on disk.
 func TestPodcastRenameUpdatesInPlace(t *testing.T) {
 	useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -178,14 +180,14 @@ func TestPodcastRenameUpdatesInPlace(t *testing.T) {
 	defer db.Close()
 
 	oldPod, episodes := renameTestFeed("Arts & Ideas", 5)
-	podEpisodesIntoDatabase(db, oldPod, episodes)
+	podEpisodesIntoDatabase(st, oldPod, episodes)
 
 	newPod, episodes := renameTestFeed("Free Thinking", 5)
 	// One genuinely new episode alongside the renamed back catalogue
 	episodes = append(episodes, M{"title": "A brand new episode about rocks",
 		"guid": "urn:test:guid-new", "published": "2026-07-09T10:00:00Z",
 		"file": "https://example.com/audio/new.mp3"})
-	podEpisodesIntoDatabase(db, newPod, episodes)
+	podEpisodesIntoDatabase(st, newPod, episodes)
 
 	var podCount int
 	if err := db.QueryRow(`SELECT COUNT(*) FROM podcasts;`).Scan(&podCount); err != nil {
@@ -236,7 +238,7 @@ func TestPodcastRenameUpdatesInPlace(t *testing.T) {
 // podcast, exactly as before.
 func TestPodcastRenameNotDetectedBelowThreshold(t *testing.T) {
 	useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -245,14 +247,14 @@ func TestPodcastRenameNotDetectedBelowThreshold(t *testing.T) {
 	defer db.Close()
 
 	oldPod, oldEpisodes := renameTestFeed("Some Established Show", 6)
-	podEpisodesIntoDatabase(db, oldPod, oldEpisodes)
+	podEpisodesIntoDatabase(st, oldPod, oldEpisodes)
 
 	newPod, newEpisodes := renameTestFeed("A Different Show Entirely", 6)
 	// Overlap on 2 of 6 guids: under renameMinGuidMatches and under half
 	for i := 2; i < 6; i++ {
 		newEpisodes[i]["guid"] = fmt.Sprintf("urn:test:other-%d", i)
 	}
-	podEpisodesIntoDatabase(db, newPod, newEpisodes)
+	podEpisodesIntoDatabase(st, newPod, newEpisodes)
 
 	var podCount int
 	if err := db.QueryRow(`SELECT COUNT(*) FROM podcasts;`).Scan(&podCount); err != nil {
@@ -267,7 +269,7 @@ func TestPodcastRenameNotDetectedBelowThreshold(t *testing.T) {
 // the existing row instead of inserting a twin that would be re-downloaded.
 func TestEpisodeRetitleRefreshedByGuidNoTwinRow(t *testing.T) {
 	useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -276,11 +278,11 @@ func TestEpisodeRetitleRefreshedByGuidNoTwinRow(t *testing.T) {
 	defer db.Close()
 
 	pod, episodes := renameTestFeed("The Knowledge Project", 4)
-	podEpisodesIntoDatabase(db, pod, episodes)
+	podEpisodesIntoDatabase(st, pod, episodes)
 
 	// Feed retitles episode 0, keeping guid and published date
 	episodes[0]["title"] = "A completely rewritten marketing title"
-	podEpisodesIntoDatabase(db, pod, episodes)
+	podEpisodesIntoDatabase(st, pod, episodes)
 
 	var epCount int
 	if err := db.QueryRow(`SELECT COUNT(*) FROM episodes;`).Scan(&epCount); err != nil {
@@ -303,7 +305,7 @@ func TestEpisodeRetitleRefreshedByGuidNoTwinRow(t *testing.T) {
 // sharing a guid must differ in published date to both get rows.
 func TestEpisodeGuidFallbackDistinctEpisodesDifferentDates(t *testing.T) {
 	useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -317,13 +319,13 @@ func TestEpisodeGuidFallbackDistinctEpisodesDifferentDates(t *testing.T) {
 		{"title": "Markets slide on tariff news", "guid": "1",
 			"published": "2026-07-01T06:00:00Z", "file": "https://x/1.mp3"},
 	}
-	podEpisodesIntoDatabase(db, pod, episodes)
+	podEpisodesIntoDatabase(st, pod, episodes)
 
 	episodes = []M{
 		{"title": "An interview about gardening", "guid": "1",
 			"published": "2026-07-02T06:00:00Z", "file": "https://x/2.mp3"},
 	}
-	podEpisodesIntoDatabase(db, pod, episodes)
+	podEpisodesIntoDatabase(st, pod, episodes)
 
 	var epCount int
 	if err := db.QueryRow(`SELECT COUNT(*) FROM episodes;`).Scan(&epCount); err != nil {
@@ -339,7 +341,7 @@ func TestEpisodeGuidFallbackDistinctEpisodesDifferentDates(t *testing.T) {
 // the identity the episode hash provided before podcast renames split it.
 func TestEpisodeRepeatNewGuidNewDateRefreshedByTitle(t *testing.T) {
 	useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -351,12 +353,12 @@ func TestEpisodeRepeatNewGuidNewDateRefreshedByTitle(t *testing.T) {
 		"description": "d", "language": "l", "link": "k"}
 	episodes := []M{{"title": "Hitchhiking", "guid": "urn:bbc:podcast:p0bpr86s",
 		"published": "2023-06-15T16:00:00Z", "file": "https://x/orig.mp3"}}
-	podEpisodesIntoDatabase(db, pod, episodes)
+	podEpisodesIntoDatabase(st, pod, episodes)
 
 	// Same episode repeated: new guid, new date, identical title
 	episodes = []M{{"title": "Hitchhiking", "guid": "urn:bbc:podcast:p0hffcg6",
 		"published": "2024-02-28T17:00:00Z", "file": "https://x/repeat.mp3"}}
-	podEpisodesIntoDatabase(db, pod, episodes)
+	podEpisodesIntoDatabase(st, pod, episodes)
 
 	var epCount int
 	if err := db.QueryRow(`SELECT COUNT(*) FROM episodes;`).Scan(&epCount); err != nil {
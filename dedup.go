@@ -19,28 +19,34 @@ package main
 // parses) and digit-sequence comparison tells genuine distinct episodes
 // apart from retitled duplicates, which filenames alone cannot.
 //
-// Invariant: a file is only ever deleted when a surviving copy of the SAME
-// episode is kept; the keeper ends up under the canonical episode-hash
-// filename so detection recognises it directly. Anything the evidence
-// doesn't decide is reported as MANUAL and left alone.
+// Invariant: a file is only ever removed when a surviving copy of the SAME
+// episode is kept, and even then it goes to the trash (see trash.go); the
+// keeper ends up under the canonical episode-hash filename so detection
+// recognises it directly. Anything the evidence doesn't decide is reported
+// as MANUAL and left alone. Identical audio (see audiohash.go) is decisive
+// evidence and resolves MANUAL and SKIP verdicts after planning.
 //
 // Dry run by default (--dedup-twins); --dedup-twins-delete applies the plan
 // and maintains the downloads and archived_episodes tables in the same
 // transaction, so no separate SQL file or reconcile pass is needed.
 
 import (
-	"database/sql"
 	"fmt"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Defaults; podcast_settings can override any of them per podcast (see
+// heuristics.go).
 const (
 	dedupStubMaxBytes      = 4096
 	dedupBigKeeperMinBytes = 1000000
@@ -58,18 +64,22 @@ type dedupOwner struct {
 	published    string // IFNULL(published, first_seen), never empty
 	lastSeen     string
 	guid         string
+	season       string
+	episode      string
 	interactive  bool
 }
 
 type dedupFile struct {
-	path    string
-	dir     string
-	name    string
-	hash    string
-	prefix  string
-	size    int64
-	epHash  string // resolved owner episode hash, or ""
-	pruneEp string // stale episodes row to prune if this file is removed/renamed
+	path       string
+	dir        string // the scan path the file was found under
+	name       string // path relative to dir; the downloads key
+	hash       string
+	prefix     string
+	size       int64
+	epHash     string // resolved owner episode hash, or ""
+	pruneEp    string // stale episodes row to prune if this file is removed/renamed
+	audio      string // SHA-256 of the audio payload, or "" (see audiohash.go)
+	audioBytes int64  // length of the audio payload
 }
 
 // dedupAction kinds
@@ -80,6 +90,7 @@ const (
 	actSkip     = "skip"     // keeper suspiciously small vs this copy
 	actSameName = "samename" // same filename in two dirs; not touched
 	actManual   = "manual"   // evidence inconclusive; not touched
+	actPruneRow = "prune"    // stale fileless episodes row (--dedup only)
 )
 
 type dedupAction struct {
@@ -89,25 +100,21 @@ type dedupAction struct {
 	newPath    string // rename target (actRename)
 	reason     string
 	pruneEp    string // stale episodes row to prune alongside this action
+	podcast    string // heading to group under in the --dedup plan, or ""
 }
 
 // loadDedupOwners returns episode attribution data from both episode tables:
 // hash -> owner, and file_url_hash -> episode hash for legacy names.
-func loadDedupOwners(dbFile string) (map[string]dedupOwner, map[string]string, error) {
+func (s *store) loadDedupOwners() (map[string]dedupOwner, map[string]string, error) {
 	byHash := make(map[string]dedupOwner)
 	url2ep := make(map[string]string)
 
-	db, err := sql.Open(sqlite3, dbFile)
-	if err != nil {
-		return nil, nil, err
-	}
-	defer db.Close()
-
 	load := func(table string, interactive bool) error {
 		q := fmt.Sprintf(`SELECT podcastname_episodename_hash, podcast_title, title,
-			IFNULL(published, first_seen), last_seen, IFNULL(file_url_hash, ''), IFNULL(guid, '')
+			IFNULL(published, first_seen), last_seen, IFNULL(file_url_hash, ''), IFNULL(guid, ''),
+			IFNULL(season, ''), IFNULL(episode, '')
 			FROM %s;`, table)
-		rows, err := db.Query(q)
+		rows, err := s.q.Query(q)
 		if err != nil {
 			return err
 		}
@@ -115,7 +122,8 @@ func loadDedupOwners(dbFile string) (map[string]dedupOwner, map[string]string, e
 		for rows.Next() {
 			var o dedupOwner
 			var urlHash string
-			if err := rows.Scan(&o.epHash, &o.podcastTitle, &o.title, &o.published, &o.lastSeen, &urlHash, &o.guid); err != nil {
+			if err := rows.Scan(&o.epHash, &o.podcastTitle, &o.title, &o.published, &o.lastSeen, &urlHash, &o.guid,
+				&o.season, &o.episode); err != nil {
 				return err
 			}
 			o.interactive = interactive
@@ -139,9 +147,13 @@ func loadDedupOwners(dbFile string) (map[string]dedupOwner, map[string]string, e
 	return byHash, url2ep, nil
 }
 
-// gatherDedupFiles lists podcast files across the scan paths with sizes.
+// gatherDedupFiles lists podcast files across the scan paths with sizes. A
+// scan path nested inside another (an archive under the podcasts dir) would
+// list its files twice; each file is kept once, under the innermost scan
+// path, so a copy is never taken for its own duplicate.
 func gatherDedupFiles(scanPaths []string) ([]dedupFile, error) {
 	out := make([]dedupFile, 0)
+	byPath := make(map[string]int)
 	for _, dir := range scanPaths {
 		names, err := archiveCandidatesInDir(dir)
 		if err != nil {
@@ -160,14 +172,22 @@ func gatherDedupFiles(scanPaths []string) ([]dedupFile, error) {
 			if err != nil {
 				continue
 			}
-			out = append(out, dedupFile{
+			f := dedupFile{
 				path:   filepath.Join(dir, name),
 				dir:    dir,
 				name:   name,
 				hash:   hash,
 				prefix: prefix,
 				size:   info.Size(),
-			})
+			}
+			if i, seen := byPath[f.path]; seen {
+				if len(dir) > len(out[i].dir) {
+					out[i] = f
+				}
+				continue
+			}
+			byPath[f.path] = len(out)
+			out = append(out, f)
 		}
 	}
 	return out, nil
@@ -182,7 +202,7 @@ func ownerIsLive(o dedupOwner, now time.Time) bool {
 	if err != nil {
 		return true // unparseable: err on the safe side
 	}
-	return now.Sub(t) <= dedupLivenessWindow
+	return now.Sub(t) <= heuristicsFor(o.podcastTitle).livenessWindow
 }
 
 var digitRunRe = regexp.MustCompile(`[0-9]+`)
@@ -230,13 +250,15 @@ func canonicalNameFor(o dedupOwner) string {
 	if len([]rune(o.published)) < 10 {
 		return ""
 	}
-	return buildNonInteractiveFilename(o.podcastTitle, o.title, o.published, o.epHash)
+	return episodeFilename(episodeNaming{podcast: o.podcastTitle, title: o.title,
+		date: shortDate(o.published), hash: o.epHash, season: o.season, episode: o.episode})
 }
 
 // chooseKeeper picks the index of the copy to keep: the largest copy already
 // named with canonicalHash, unless it is a stub or truncated relative to the
-// largest copy overall; else the largest copy overall.
-func chooseKeeper(files []dedupFile, canonicalHash string) int {
+// largest copy overall (by h's size thresholds); else the largest copy
+// overall.
+func chooseKeeper(files []dedupFile, canonicalHash string, h heuristics) int {
 	k := -1
 	if canonicalHash != "" {
 		for i, f := range files {
@@ -255,8 +277,8 @@ func chooseKeeper(files []dedupFile, canonicalHash string) int {
 		return m
 	}
 	if files[k].size < files[m].size &&
-		((files[k].size < dedupStubMaxBytes && files[m].size > dedupBigKeeperMinBytes) ||
-			(files[k].size < files[m].size-dedupSizeSlackBytes && files[k].size*100 < files[m].size*95)) {
+		((files[k].size < h.stubMaxBytes && files[m].size > h.bigKeeperMinBytes) ||
+			(files[k].size < files[m].size-h.sizeSlackBytes && files[k].size*100 < files[m].size*95)) {
 		return m
 	}
 	return k
@@ -264,12 +286,13 @@ func chooseKeeper(files []dedupFile, canonicalHash string) int {
 
 // dedupCopies emits actions reducing files (all copies of one episode) to a
 // single keeper, renaming the keeper to canonicalName when it is known and
-// the keeper is not already named with the episode hash.
-func dedupCopies(files []dedupFile, epHash, canonicalName string, actions *[]dedupAction) {
+// the keeper is not already named with the episode hash. h is the owning
+// podcast's heuristics.
+func dedupCopies(files []dedupFile, epHash, canonicalName string, h heuristics, actions *[]dedupAction) {
 	if len(files) == 0 {
 		return
 	}
-	k := chooseKeeper(files, epHash)
+	k := chooseKeeper(files, epHash, h)
 	keeper := files[k]
 	for i, f := range files {
 		if i == k {
@@ -278,9 +301,9 @@ func dedupCopies(files []dedupFile, epHash, canonicalName string, actions *[]ded
 		switch {
 		case f.name == keeper.name:
 			*actions = append(*actions, dedupAction{kind: actSameName, file: f, keeperPath: keeper.path})
-		case f.size < dedupStubMaxBytes && keeper.size > dedupBigKeeperMinBytes:
+		case f.size < h.stubMaxBytes && keeper.size > h.bigKeeperMinBytes:
 			*actions = append(*actions, dedupAction{kind: actStub, file: f, keeperPath: keeper.path, pruneEp: f.pruneEp})
-		case keeper.size < f.size-dedupSizeSlackBytes && keeper.size*100 < f.size*95:
+		case keeper.size < f.size-h.sizeSlackBytes && keeper.size*100 < f.size*95:
 			*actions = append(*actions, dedupAction{kind: actSkip, file: f, keeperPath: keeper.path,
 				reason: fmt.Sprintf("keeper %d bytes vs %d", keeper.size, f.size)})
 		default:
@@ -394,7 +417,7 @@ func planDedup(files []dedupFile, owners map[string]dedupOwner, url2ep map[strin
 				}
 				eligible = kept
 			}
-			dedupCopies(eligible, groupEp, canonical, &actions)
+			dedupCopies(eligible, groupEp, canonical, heuristicsFor(owners[groupEp].podcastTitle), &actions)
 
 		default:
 			// Two or more live episodes share the prefix (same-day digit
@@ -436,7 +459,7 @@ func planDedup(files []dedupFile, owners map[string]dedupOwner, url2ep map[strin
 			}
 			sort.Strings(eps)
 			for _, ep := range eps {
-				dedupCopies(byEp[ep], ep, canonicalNameFor(owners[ep]), &actions)
+				dedupCopies(byEp[ep], ep, canonicalNameFor(owners[ep]), heuristicsFor(owners[ep].podcastTitle), &actions)
 			}
 		}
 	}
@@ -446,8 +469,8 @@ func planDedup(files []dedupFile, owners map[string]dedupOwner, url2ep map[strin
 // runDedupTwins gathers files across scanPaths, plans, prints, and (when
 // apply is true) executes: file deletions/renames plus downloads and
 // archived_episodes maintenance in one transaction.
-func runDedupTwins(scanPaths []string, apply bool) error {
-	owners, url2ep, err := loadDedupOwners(dbFileName)
+func runDedupTwins(s *store, scanPaths []string, apply bool) error {
+	owners, url2ep, err := s.loadDedupOwners()
 	if err != nil {
 		return err
 	}
@@ -455,14 +478,18 @@ func runDedupTwins(scanPaths []string, apply bool) error {
 	if err != nil {
 		return err
 	}
+	if files, err = s.withAudioHashes(files); err != nil {
+		return err
+	}
 	actions := planDedup(files, owners, url2ep, time.Now())
-	return executeDedupPlan(actions, scanPaths, apply, "--dedup-twins-delete")
+	actions = resolveByAudio(actions, files, owners, url2ep, time.Now())
+	return executeDedupPlan(s, actions, scanPaths, apply, "--dedup-twins-delete")
 }
 
 // executeDedupPlan prints a plan and, when apply is true, executes it: file
 // deletions/renames plus downloads, archived_episodes, and stale episodes-row
 // maintenance in one transaction. Shared by the twin and retitle passes.
-func executeDedupPlan(actions []dedupAction, scanPaths []string, apply bool, applyFlag string) error {
+func executeDedupPlan(s *store, actions []dedupAction, scanPaths []string, apply bool, applyFlag string) error {
 	archiveDirs := make(map[string]bool)
 	for _, d := range scanPaths[1:] {
 		archiveDirs[d] = true
@@ -473,18 +500,21 @@ func executeDedupPlan(actions []dedupAction, scanPaths []string, apply bool, app
 		would = ""
 	}
 
-	var tx *sql.Tx
+	command := strings.TrimSuffix(strings.TrimPrefix(strings.Fields(applyFlag)[0], "--"), "-delete")
+	var tx *store
+	var j *dedupJournal
 	if apply {
-		db, err := sql.Open(sqlite3, dbFileName)
+		var err error
+		tx, err = s.begin()
 		if err != nil {
 			return err
 		}
-		defer db.Close()
-		tx, err = db.Begin()
-		if err != nil {
+		defer tx.rollback()
+		// Deferred after the rollback, so files go back first on failure
+		if j, err = newDedupJournal(tx, command, time.Now()); err != nil {
 			return err
 		}
-		defer tx.Rollback()
+		defer j.close()
 	}
 
 	// A deleted or renamed-away stale variant leaves its episodes row without
@@ -495,43 +525,67 @@ func executeDedupPlan(actions []dedupAction, scanPaths []string, apply bool, app
 		if !apply || epHash == "" {
 			return nil
 		}
-		_, err := tx.Exec(`DELETE FROM episodes WHERE podcastname_episodename_hash = ?;`, epHash)
-		return err
+		if err := j.saveRows("episodes", epHash); err != nil {
+			return err
+		}
+		return tx.deleteEpisode(epHash)
 	}
 
 	removeFile := func(f dedupFile) error {
 		if !apply {
 			return nil
 		}
-		if err := os.Remove(f.path); err != nil {
+		if err := j.trash(f); err != nil {
+			return err
+		}
+		if err := j.saveRows("downloads", f.name); err != nil {
 			return err
 		}
-		if _, err := tx.Exec(`DELETE FROM downloads WHERE filename = ?;`, f.name); err != nil {
+		if err := tx.deleteDownload(f.name); err != nil {
 			return err
 		}
 		if archiveDirs[f.dir] {
-			if _, err := tx.Exec(`DELETE FROM archived_episodes WHERE podcastname_episodename_hash = ?;`, f.hash); err != nil {
+			if err := j.saveRows("archived_episodes", f.hash); err != nil {
+				return err
+			}
+			if _, err := tx.deleteArchived(f.hash); err != nil {
 				return err
 			}
 		}
 		return nil
 	}
 
+	out := newDedupOutput(command, apply)
 	counts := make(map[string]int)
 	var reclaimed int64
 	for _, a := range actions {
+		if a.podcast != out.podcast {
+			out.podcast = a.podcast
+			out.heading(a.podcast)
+		}
 		switch a.kind {
+		case actPruneRow:
+			out.add(dedupRecord{Action: "prune_row", EpisodeHash: a.pruneEp, Title: a.reason},
+				"%sprune stale episodes row %s (%s)\n", would, a.pruneEp, a.reason)
+			if err := pruneRow(a.pruneEp); err != nil {
+				return err
+			}
 		case actDelete, actStub:
-			label := "duplicate"
+			label, action := "duplicate", "delete"
 			if a.kind == actStub {
-				label = "failed-download stub"
+				label, action = "failed-download stub", "delete_stub"
+			}
+			if a.reason != "" {
+				label += ", " + a.reason
 			}
-			fmt.Printf("%sdelete %s: %s (%d bytes; keeping %s)\n", would, label, a.file.path, a.file.size, a.keeperPath)
+			out.add(dedupRecord{Action: action, Path: a.file.path, Keeper: a.keeperPath, Bytes: a.file.size, Reason: a.reason},
+				"%sdelete %s: %s (%d bytes; keeping %s)\n", would, label, a.file.path, a.file.size, a.keeperPath)
 			if err := removeFile(a.file); err != nil {
 				return err
 			}
 			if a.pruneEp != "" {
-				fmt.Printf("%sprune stale episodes row %s\n", would, a.pruneEp)
+				out.add(dedupRecord{Action: "prune_row", EpisodeHash: a.pruneEp},
+					"%sprune stale episodes row %s\n", would, a.pruneEp)
 				if err := pruneRow(a.pruneEp); err != nil {
 					return err
 				}
@@ -539,64 +593,198 @@ func executeDedupPlan(actions []dedupAction, scanPaths []string, apply bool, app
 			reclaimed += a.file.size
 		case actRename:
 			if _, err := os.Stat(a.newPath); err == nil {
-				fmt.Printf("NOT renaming (target exists): %s -> %s\n", a.file.path, a.newPath)
+				out.add(dedupRecord{Action: "rename_blocked", Path: a.file.path, NewPath: a.newPath, Reason: "target exists"},
+					"NOT renaming (target exists): %s -> %s\n", a.file.path, a.newPath)
 				continue
 			}
-			fmt.Printf("%srename keeper to canonical name: %s -> %s\n", would, a.file.path, a.newPath)
+			out.add(dedupRecord{Action: "rename", Path: a.file.path, NewPath: a.newPath},
+				"%srename keeper to canonical name: %s -> %s\n", would, a.file.path, a.newPath)
 			if a.pruneEp != "" {
-				fmt.Printf("%sprune stale episodes row %s\n", would, a.pruneEp)
+				out.add(dedupRecord{Action: "prune_row", EpisodeHash: a.pruneEp},
+					"%sprune stale episodes row %s\n", would, a.pruneEp)
 				if err := pruneRow(a.pruneEp); err != nil {
 					return err
 				}
 			}
 			if apply {
-				if err := os.Rename(a.file.path, a.newPath); err != nil {
+				if err := j.move(a.file.path, a.newPath); err != nil {
 					return err
 				}
-				if _, err := tx.Exec(`DELETE FROM downloads WHERE filename = ?;`, a.file.name); err != nil {
+				if err := j.saveRows("downloads", a.file.name); err != nil {
+					return err
+				}
+				if err := tx.deleteDownload(a.file.name); err != nil {
 					return err
 				}
 				if archiveDirs[a.file.dir] {
 					newName := filepath.Base(a.newPath)
 					newHash, _, err := hashFromFilename(newName)
 					if err == nil {
-						if _, err := tx.Exec(`DELETE FROM archived_episodes WHERE podcastname_episodename_hash = ?;`, a.file.hash); err != nil {
+						if err := j.saveRows("archived_episodes", a.file.hash); err != nil {
 							return err
 						}
-						if _, err := tx.Exec(`
-							INSERT INTO archived_episodes (podcastname_episodename_hash, archived_path, archived_at)
-							VALUES (?, ?, ?)
-							ON CONFLICT(podcastname_episodename_hash) DO UPDATE SET
-								archived_path = excluded.archived_path, archived_at = excluded.archived_at;`,
-							newHash, a.newPath, ts); err != nil {
+						if _, err := tx.deleteArchived(a.file.hash); err != nil {
+							return err
+						}
+						if err := j.replacingRow("archived_episodes", newHash); err != nil {
+							return err
+						}
+						if err := tx.upsertArchived(newHash, a.newPath); err != nil {
 							return err
 						}
 					}
 				}
 			}
 		case actSkip:
-			fmt.Printf("SKIP (%s): %s (keeper %s)\n", a.reason, a.file.path, a.keeperPath)
+			out.add(dedupRecord{Action: "skip", Path: a.file.path, Keeper: a.keeperPath, Reason: a.reason},
+				"SKIP (%s): %s (keeper %s)\n", a.reason, a.file.path, a.keeperPath)
 		case actSameName:
-			fmt.Printf("NOTE same filename in two dirs (not touching): %s (also %s)\n", a.file.path, a.keeperPath)
+			out.add(dedupRecord{Action: "same_name", Path: a.file.path, Keeper: a.keeperPath},
+				"NOTE same filename in two dirs (not touching): %s (also %s)\n", a.file.path, a.keeperPath)
 		case actManual:
-			fmt.Printf("MANUAL (%s): %s\n", a.reason, a.file.path)
+			out.add(dedupRecord{Action: "manual", Path: a.file.path, Reason: a.reason},
+				"MANUAL (%s): %s\n", a.reason, a.file.path)
 		}
 		counts[a.kind]++
 	}
 
 	if apply {
-		if err := tx.Commit(); err != nil {
+		if err := tx.commit(); err != nil {
 			return err
 		}
+		j.done()
+		out.report.RunID = j.runID
+	}
+
+	out.report.Summary = dedupSummary{
+		Duplicates:     counts[actDelete],
+		Stubs:          counts[actStub],
+		ReclaimedBytes: reclaimed,
+		Renames:        counts[actRename],
+		Skipped:        counts[actSkip],
+		SameName:       counts[actSameName],
+		Manual:         counts[actManual],
+		PrunedRows:     counts[actPruneRow],
+	}
+	return out.finish(func() {
+		fmt.Printf("\n%s%d duplicates and %d stubs (%.1f GiB), %d keeper renames, %d skipped, %d same-name, %d manual\n",
+			map[bool]string{true: "Applied: ", false: "Dry run: "}[apply],
+			counts[actDelete], counts[actStub], float64(reclaimed)/1073741824.0,
+			counts[actRename], counts[actSkip], counts[actSameName], counts[actManual])
+		if n := counts[actPruneRow]; n > 0 {
+			fmt.Printf("%d stale fileless episodes row(s)\n", n)
+		}
+		if !apply {
+			fmt.Printf("Re-run with %s to apply.\n", applyFlag)
+		}
+		printUndoHint(out.report.RunID, counts[actDelete]+counts[actStub] > 0)
+	})
+}
+
+// printUndoHint tells the user how to take an applied run back.
+func printUndoHint(runID string, trashed bool) {
+	if runID == "" {
+		return
+	}
+	if trashed {
+		fmt.Printf("Removed files are in %s/%s in their scan path.\n", trashDirName, runID)
+	}
+	fmt.Printf("Undo with --undo-dedup %s\n", runID)
+}
+
+// dedupRecord is one line of a dedup or prune plan in the json/csv reports.
+// Action is one of delete, delete_stub, rename, rename_blocked, prune_row,
+// skip, same_name or manual; --relayout adds move, move_blocked and
+// unattributed.
+type dedupRecord struct {
+	Action       string `json:"action"`
+	Path         string `json:"path,omitempty"`
+	Keeper       string `json:"keeper,omitempty"`
+	NewPath      string `json:"new_path,omitempty"`
+	EpisodeHash  string `json:"episode_hash,omitempty"`
+	PodcastTitle string `json:"podcast_title,omitempty"`
+	Title        string `json:"title,omitempty"`
+	Bytes        int64  `json:"bytes,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+var dedupRecordCSVHeader = []string{"action", "path", "keeper", "new_path", "episode_hash", "podcast_title", "title", "bytes", "reason"}
+
+func (r dedupRecord) csvRow() []string {
+	return []string{r.Action, r.Path, r.Keeper, r.NewPath, r.EpisodeHash, r.PodcastTitle, r.Title, strconv.FormatInt(r.Bytes, 10), r.Reason}
+}
+
+// dedupSummary totals a plan; the prune pass only fills PrunedRows.
+type dedupSummary struct {
+	Duplicates     int   `json:"duplicates"`
+	Stubs          int   `json:"stubs"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+	Renames        int   `json:"renames"`
+	Skipped        int   `json:"skipped"`
+	SameName       int   `json:"same_name"`
+	Manual         int   `json:"manual"`
+	PrunedRows     int   `json:"pruned_rows"`
+}
+
+// dedupReport is the JSON shape of the dedup and prune passes. Applied is
+// false for a dry run, where Actions is what would be done.
+type dedupReport struct {
+	reportHeader
+	Applied bool          `json:"applied"`
+	RunID   string        `json:"run_id,omitempty"` // for --undo-dedup; applied runs only
+	Actions []dedupRecord `json:"actions"`
+	Summary dedupSummary  `json:"summary"`
+}
+
+// dedupOutput prints plan lines as they happen in text mode and collects
+// them for a single report otherwise.
+type dedupOutput struct {
+	report  dedupReport
+	podcast string // current --dedup heading; fills records' podcast_title
+}
+
+func newDedupOutput(command string, apply bool) *dedupOutput {
+	return &dedupOutput{report: dedupReport{
+		reportHeader: newReportHeader(command),
+		Applied:      apply,
+		Actions:      make([]dedupRecord, 0),
+	}}
+}
+
+func (o *dedupOutput) add(rec dedupRecord, format string, args ...interface{}) {
+	if rec.PodcastTitle == "" {
+		rec.PodcastTitle = o.podcast
+	}
+	if reportFormat == formatText {
+		if o.podcast != "" {
+			format = "  " + format
+		}
+		fmt.Printf(format, args...)
+		return
+	}
+	o.report.Actions = append(o.report.Actions, rec)
+}
+
+// heading starts a podcast's group of plan lines in text mode.
+func (o *dedupOutput) heading(podcast string) {
+	if reportFormat == formatText && podcast != "" {
+		fmt.Printf("\n%s\n", podcast)
 	}
+}
 
-	fmt.Printf("\n%s%d duplicates and %d stubs (%.1f GiB), %d keeper renames, %d skipped, %d same-name, %d manual\n",
-		map[bool]string{true: "Applied: ", false: "Dry run: "}[apply],
-		counts[actDelete], counts[actStub], float64(reclaimed)/1073741824.0,
-		counts[actRename], counts[actSkip], counts[actSameName], counts[actManual])
-	if !apply {
-		fmt.Printf("Re-run with %s to apply.\n", applyFlag)
+// finish prints the text summary, or writes the collected report.
+func (o *dedupOutput) finish(textSummary func()) error {
+	switch reportFormat {
+	case formatJSON:
+		return writeJSONReport(os.Stdout, o.report)
+	case formatCSV:
+		rows := make([]csvRecord, len(o.report.Actions))
+		for i := range o.report.Actions {
+			rows[i] = o.report.Actions[i]
+		}
+		return writeCSVReport(os.Stdout, dedupRecordCSVHeader, rows)
 	}
+	textSummary()
 	return nil
 }
 
@@ -607,81 +795,126 @@ func executeDedupPlan(actions []dedupAction, scanPaths []string, apply bool, app
 // legacy-named files) and not in the archive registry. Steady state has ~0
 // such rows; they appear when dedup deletes a stale variant's file, and each
 // one costs a wasted wget (or a fresh error stub) nightly.
-func pruneStaleEpisodes(scanPaths []string, apply bool) error {
+func pruneStaleEpisodes(s *store, scanPaths []string, apply bool) error {
 	files, err := gatherDedupFiles(scanPaths)
 	if err != nil {
 		return err
 	}
-	have := make(map[string]bool)
-	for _, f := range files {
-		have[f.hash] = true
-	}
-	for _, v := range fetchArchivedHashes().ToSlice() {
-		have[fmt.Sprintf("%v", v)] = true
-	}
-
-	db, err := sql.Open(sqlite3, dbFileName)
+	archived, err := s.archivedHashSet()
 	if err != nil {
 		return err
 	}
-	defer db.Close()
-
-	rows, err := db.Query(`SELECT podcastname_episodename_hash, IFNULL(file_url_hash, ''), podcast_title, title, last_seen
-		FROM episodes WHERE file != '' AND file IS NOT NULL;`)
+	liveness, err := s.episodeLiveness()
 	if err != nil {
 		return err
 	}
-
-	now := time.Now()
-	type staleRow struct{ epHash, podcast, title string }
-	toPrune := make([]staleRow, 0)
-	for rows.Next() {
-		var epHash, urlHash, podcast, title, lastSeen string
-		if err := rows.Scan(&epHash, &urlHash, &podcast, &title, &lastSeen); err != nil {
-			rows.Close()
-			return err
-		}
-		t, err := time.Parse(time.RFC3339, lastSeen)
-		if err != nil || now.Sub(t) <= dedupLivenessWindow {
-			continue
-		}
-		if have[epHash] || (urlHash != "" && have[urlHash]) {
-			continue
-		}
-		toPrune = append(toPrune, staleRow{epHash, podcast, title})
-	}
-	rows.Close()
+	toPrune := planStalePrune(files, archived, liveness, time.Now())
 
 	would := "would "
 	if apply {
 		would = ""
 	}
+	out := newDedupOutput("prune-stale-episodes", apply)
 	for _, r := range toPrune {
-		fmt.Printf("%sprune stale episodes row %s (%s: %s)\n", would, r.epHash, r.podcast, r.title)
+		out.add(dedupRecord{Action: "prune_row", EpisodeHash: r.epHash, PodcastTitle: r.podcast, Title: r.title},
+			"%sprune stale episodes row %s (%s: %s)\n", would, r.epHash, r.podcast, r.title)
 	}
 
 	if apply && len(toPrune) > 0 {
-		tx, err := db.Begin()
+		err := s.inTx(func(tx *store) error {
+			j, err := newDedupJournal(tx, "prune-stale-episodes", time.Now())
+			if err != nil {
+				return err
+			}
+			out.report.RunID = j.runID
+			for _, r := range toPrune {
+				if err := j.saveRows("episodes", r.epHash); err != nil {
+					return err
+				}
+				if err := tx.deleteEpisode(r.epHash); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 		if err != nil {
 			return err
 		}
-		defer tx.Rollback()
-		for _, r := range toPrune {
-			if _, err := tx.Exec(`DELETE FROM episodes WHERE podcastname_episodename_hash = ?;`, r.epHash); err != nil {
-				return err
-			}
+	}
+
+	out.report.Summary.PrunedRows = len(toPrune)
+	return out.finish(func() {
+		fmt.Printf("\n%s%d stale fileless episodes row(s)\n",
+			map[bool]string{true: "Pruned ", false: "Dry run: would prune "}[apply], len(toPrune))
+		if !apply {
+			fmt.Println("Re-run with --prune-stale-episodes-delete to apply.")
 		}
-		if err := tx.Commit(); err != nil {
-			return err
+		printUndoHint(out.report.RunID, false)
+	})
+}
+
+// planStalePrune picks the liveness rows pruneStaleEpisodes removes: not
+// refreshed within their podcast's liveness window, and with no copy in files (by
+// episode hash or file_url_hash) or in the archive registry. Pure.
+func planStalePrune(files []dedupFile, archived map[string]bool, liveness []episodeLivenessRow, now time.Time) []episodeLivenessRow {
+	have := make(map[string]bool, len(files)+len(archived))
+	for _, f := range files {
+		have[f.hash] = true
+	}
+	for h := range archived {
+		have[h] = true
+	}
+	toPrune := make([]episodeLivenessRow, 0)
+	for _, r := range liveness {
+		t, err := time.Parse(time.RFC3339, r.lastSeen)
+		if err != nil || now.Sub(t) <= heuristicsFor(r.podcast).livenessWindow {
+			continue
 		}
+		if have[r.epHash] || (r.urlHash != "" && have[r.urlHash]) {
+			continue
+		}
+		toPrune = append(toPrune, r)
 	}
+	return toPrune
+}
 
-	fmt.Printf("\n%s%d stale fileless episodes row(s)\n",
-		map[bool]string{true: "Pruned ", false: "Dry run: would prune "}[apply], len(toPrune))
-	if !apply {
-		fmt.Println("Re-run with --prune-stale-episodes-delete to apply.")
+// archivedHashSet is archivedHashes as a plain map, for the pure planners.
+func (s *store) archivedHashSet() (map[string]bool, error) {
+	archived, err := s.archivedHashes()
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	out := make(map[string]bool, archived.Cardinality())
+	for _, v := range archived.ToSlice() {
+		out[fmt.Sprintf("%v", v)] = true
+	}
+	return out, nil
+}
+
+// episodeLivenessRow is a downloadable episodes row with what
+// pruneStaleEpisodes needs to judge whether it is still fed and still owned.
+type episodeLivenessRow struct {
+	epHash, urlHash, podcast, title, lastSeen string
+}
+
+// episodeLiveness lists every episodes row that carries a download URL.
+func (s *store) episodeLiveness() ([]episodeLivenessRow, error) {
+	rows, err := s.q.Query(`SELECT podcastname_episodename_hash, IFNULL(file_url_hash, ''), podcast_title, title, last_seen
+		FROM episodes WHERE file != '' AND file IS NOT NULL;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]episodeLivenessRow, 0)
+	for rows.Next() {
+		var r episodeLivenessRow
+		if err := rows.Scan(&r.epHash, &r.urlHash, &r.podcast, &r.title, &r.lastSeen); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
 }
 
 // Retitle pass: merge duplicate copies of episodes that a podcast rename
@@ -694,21 +927,17 @@ func pruneStaleEpisodes(scanPaths []string, apply bool) error {
 // podcasts-table last_seen no longer refreshed — podcast rows are updated by
 // podcast title, so they are immune to the historical episode-row
 // contamination) is paired with the live podcast that shares at least
-// retitleMinMatches episodes matching on published date + sameEpisodeTitles.
-// Each matched episode pair is then merged exactly like a twin group, with
-// the live row's hash and canonical filename as the target.
+// retitleMinMatches (the live podcast's setting) episodes matching on
+// published date + sameEpisodeTitles. Each matched episode pair is then
+// merged exactly like a twin group, with the live row's hash and canonical
+// filename as the target.
 
 const retitleMinMatches = 5
 
 // loadPodcastLastSeen returns podcasts.title -> last_seen.
-func loadPodcastLastSeen(dbFile string) (map[string]string, error) {
+func (s *store) loadPodcastLastSeen() (map[string]string, error) {
 	out := make(map[string]string)
-	db, err := sql.Open(sqlite3, dbFile)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-	rows, err := db.Query(`SELECT title, last_seen FROM podcasts;`)
+	rows, err := s.q.Query(`SELECT title, last_seen FROM podcasts;`)
 	if err != nil {
 		return nil, err
 	}
@@ -723,12 +952,12 @@ func loadPodcastLastSeen(dbFile string) (map[string]string, error) {
 	return out, rows.Err()
 }
 
-func lastSeenIsLive(lastSeen string, now time.Time) bool {
+func lastSeenIsLive(podcast, lastSeen string, now time.Time) bool {
 	t, err := time.Parse(time.RFC3339, lastSeen)
 	if err != nil {
 		return true // err on the safe side
 	}
-	return now.Sub(t) <= dedupLivenessWindow
+	return now.Sub(t) <= heuristicsFor(podcast).livenessWindow
 }
 
 // planRetitles builds the merge plan for podcast-retitle duplicates. Pure,
@@ -747,7 +976,7 @@ func planRetitles(files []dedupFile, owners map[string]dedupOwner, url2ep map[st
 		if !known {
 			continue
 		}
-		if lastSeenIsLive(ls, now) {
+		if lastSeenIsLive(o.podcastTitle, ls, now) {
 			liveByPod[o.podcastTitle] = append(liveByPod[o.podcastTitle], o)
 		} else {
 			staleByPod[o.podcastTitle] = append(staleByPod[o.podcastTitle], o)
@@ -824,7 +1053,7 @@ func planRetitles(files []dedupFile, owners map[string]dedupOwner, url2ep map[st
 					ms = append(ms, epMatch{old: old, matches: hits})
 				}
 			}
-			if matched >= retitleMinMatches && (bestPod == "" || matched > len(bestMatches)) {
+			if matched >= heuristicsFor(lp).retitleMinMatches && (bestPod == "" || matched > len(bestMatches)) {
 				bestPod = lp
 				bestMatches = ms
 			}
@@ -897,19 +1126,19 @@ func planRetitles(files []dedupFile, owners map[string]dedupOwner, url2ep map[st
 			if len(group) < 2 {
 				continue
 			}
-			dedupCopies(group, live.epHash, canonicalNameFor(live), &actions)
+			dedupCopies(group, live.epHash, canonicalNameFor(live), heuristicsFor(live.podcastTitle), &actions)
 		}
 	}
 	return actions
 }
 
 // runDedupRetitles gathers files, plans the retitle merges, and executes.
-func runDedupRetitles(scanPaths []string, apply bool) error {
-	owners, url2ep, err := loadDedupOwners(dbFileName)
+func runDedupRetitles(s *store, scanPaths []string, apply bool) error {
+	owners, url2ep, err := s.loadDedupOwners()
 	if err != nil {
 		return err
 	}
-	podLastSeen, err := loadPodcastLastSeen(dbFileName)
+	podLastSeen, err := s.loadPodcastLastSeen()
 	if err != nil {
 		return err
 	}
@@ -917,8 +1146,12 @@ func runDedupRetitles(scanPaths []string, apply bool) error {
 	if err != nil {
 		return err
 	}
+	if files, err = s.withAudioHashes(files); err != nil {
+		return err
+	}
 	actions := planRetitles(files, owners, url2ep, podLastSeen, time.Now())
-	return executeDedupPlan(actions, scanPaths, apply, "--dedup-retitles-delete")
+	actions = resolveByAudio(actions, files, owners, url2ep, time.Now())
+	return executeDedupPlan(s, actions, scanPaths, apply, "--dedup-retitles-delete")
 }
 
 // GUID pass: merge duplicate copies of episodes that a podcast retitled
@@ -995,7 +1228,7 @@ func planGuidDedup(files []dedupFile, owners map[string]dedupOwner, url2ep map[s
 		for _, o := range rows[1:] {
 			corroborated := date10(o.published) == date10(target.published) ||
 				sameEpisodeTitles(o.title, target.title) ||
-				materialTitleOverlap(o.title, target.title)
+				heuristicsFor(target.podcastTitle).materialTitleOverlap(o.title, target.title)
 			if !corroborated {
 				for _, f := range filesByEp[o.epHash] {
 					actions = append(actions, dedupAction{kind: actManual, file: f,
@@ -1013,14 +1246,14 @@ func planGuidDedup(files []dedupFile, owners map[string]dedupOwner, url2ep map[s
 		if len(group) == 0 {
 			continue
 		}
-		dedupCopies(group, target.epHash, canonicalNameFor(target), &actions)
+		dedupCopies(group, target.epHash, canonicalNameFor(target), heuristicsFor(target.podcastTitle), &actions)
 	}
 	return actions
 }
 
 // runDedupGuid gathers files, plans the guid merges, and executes.
-func runDedupGuid(scanPaths []string, apply bool) error {
-	owners, url2ep, err := loadDedupOwners(dbFileName)
+func runDedupGuid(s *store, scanPaths []string, apply bool) error {
+	owners, url2ep, err := s.loadDedupOwners()
 	if err != nil {
 		return err
 	}
@@ -1028,6 +1261,169 @@ func runDedupGuid(scanPaths []string, apply bool) error {
 	if err != nil {
 		return err
 	}
+	if files, err = s.withAudioHashes(files); err != nil {
+		return err
+	}
 	actions := planGuidDedup(files, owners, url2ep)
-	return executeDedupPlan(actions, scanPaths, apply, "--dedup-guid-delete")
+	actions = resolveByAudio(actions, files, owners, url2ep, time.Now())
+	return executeDedupPlan(s, actions, scanPaths, apply, "--dedup-guid-delete")
+}
+
+// Unified pass: --dedup runs every planner over one scan and applies the
+// merged plan in one transaction with --apply. The planners run in the order
+// the separate commands had to be run by hand — guid (per-episode retitles),
+// retitles (podcast renames), twins (same filename prefix), then the stale
+// row prune — and each one plans against the files and rows the earlier
+// plans leave: deleted copies are gone, renamed keepers carry their new
+// names, and pruned rows no longer own anything. Two planners therefore never
+// act on the same file; a later destructive action replaces an earlier
+// MANUAL, SKIP or same-name verdict for that file.
+
+// planAllDedup merges the planners' plans, grouped by podcast. Pure.
+func planAllDedup(files []dedupFile, owners map[string]dedupOwner, url2ep map[string]string,
+	podLastSeen map[string]string, archived map[string]bool, liveness []episodeLivenessRow, now time.Time) []dedupAction {
+	titles := make(map[string]string, len(owners))
+	for h, o := range owners {
+		titles[h] = o.podcastTitle
+	}
+	owners = maps.Clone(owners)
+	url2ep = maps.Clone(url2ep)
+	archived = maps.Clone(archived)
+	pruned := make(map[string]bool)
+
+	actions := make([]dedupAction, 0)
+	verdictAt := make(map[string]int) // path -> index of a non-destructive verdict
+	dropped := make(map[int]bool)
+	merge := func(planned []dedupAction) {
+		for _, a := range planned {
+			switch a.kind {
+			case actDelete, actStub, actRename:
+				if i, ok := verdictAt[a.file.path]; ok {
+					dropped[i] = true
+					delete(verdictAt, a.file.path)
+				}
+			default:
+				if _, ok := verdictAt[a.file.path]; ok {
+					continue
+				}
+				verdictAt[a.file.path] = len(actions)
+			}
+			actions = append(actions, a)
+		}
+		files = applyPlanToFiles(files, planned, archived)
+		for _, a := range planned {
+			if a.pruneEp != "" {
+				pruned[a.pruneEp] = true
+				delete(owners, a.pruneEp)
+			}
+		}
+		for u, ep := range url2ep {
+			if pruned[ep] {
+				delete(url2ep, u)
+			}
+		}
+	}
+
+	merge(resolveByAudio(planGuidDedup(files, owners, url2ep), files, owners, url2ep, now))
+	merge(resolveByAudio(planRetitles(files, owners, url2ep, podLastSeen, now), files, owners, url2ep, now))
+	merge(resolveByAudio(planDedup(files, owners, url2ep, now), files, owners, url2ep, now))
+	for _, r := range planStalePrune(files, archived, liveness, now) {
+		if !pruned[r.epHash] {
+			actions = append(actions, dedupAction{kind: actPruneRow, pruneEp: r.epHash, reason: r.title})
+			titles[r.epHash] = r.podcast
+		}
+	}
+
+	out := make([]dedupAction, 0, len(actions))
+	for i, a := range actions {
+		if dropped[i] {
+			continue
+		}
+		a.podcast = dedupPodcastOf(a, titles, url2ep)
+		out = append(out, a)
+	}
+	// Stable, so a file's actions keep their order within its podcast
+	sort.SliceStable(out, func(i, j int) bool { return out[i].podcast < out[j].podcast })
+	return out
+}
+
+// dedupPodcastOf is the podcast an action is grouped under: its episode's,
+// or the podcast part of its filename.
+func dedupPodcastOf(a dedupAction, titles map[string]string, url2ep map[string]string) string {
+	for _, h := range []string{a.file.epHash, a.file.hash, url2ep[a.file.hash], a.pruneEp} {
+		if t := titles[h]; h != "" && t != "" {
+			return t
+		}
+	}
+	return strings.SplitN(path.Base(a.file.name), "-", 2)[0]
+}
+
+// applyPlanToFiles is the file list (and archive registry) as it would be
+// after planned ran: deleted copies dropped, renamed ones under their new
+// names.
+func applyPlanToFiles(files []dedupFile, planned []dedupAction, archived map[string]bool) []dedupFile {
+	gone := make(map[string]bool)
+	renamed := make(map[string]string)
+	for _, a := range planned {
+		switch a.kind {
+		case actDelete, actStub:
+			gone[a.file.path] = true
+			delete(archived, a.file.hash)
+		case actRename:
+			renamed[a.file.path] = a.newPath
+		}
+	}
+	out := make([]dedupFile, 0, len(files))
+	for _, f := range files {
+		if gone[f.path] {
+			continue
+		}
+		if to, ok := renamed[f.path]; ok {
+			name, err := filepath.Rel(f.dir, to)
+			if err != nil {
+				name = filepath.Base(to)
+			}
+			name = filepath.ToSlash(name)
+			hash, _, err := hashFromFilename(name)
+			prefix, ok := nameMinusHash(name)
+			if err == nil && ok {
+				if archived[f.hash] {
+					delete(archived, f.hash)
+					archived[hash] = true
+				}
+				f.path, f.name, f.hash, f.prefix = to, name, hash, prefix
+			}
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// runDedupAll runs --dedup.
+func runDedupAll(s *store, scanPaths []string, apply bool) error {
+	owners, url2ep, err := s.loadDedupOwners()
+	if err != nil {
+		return err
+	}
+	podLastSeen, err := s.loadPodcastLastSeen()
+	if err != nil {
+		return err
+	}
+	archived, err := s.archivedHashSet()
+	if err != nil {
+		return err
+	}
+	liveness, err := s.episodeLiveness()
+	if err != nil {
+		return err
+	}
+	files, err := gatherDedupFiles(scanPaths)
+	if err != nil {
+		return err
+	}
+	if files, err = s.withAudioHashes(files); err != nil {
+		return err
+	}
+	actions := planAllDedup(files, owners, url2ep, podLastSeen, archived, liveness, time.Now())
+	return executeDedupPlan(s, actions, scanPaths, apply, "--dedup --apply")
 }
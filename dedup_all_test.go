@@ -0,0 +1,112 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The passes see each other's results: the guid pass renames a lone stale
+// copy to its canonical name, which puts it next to an unattributable legacy
+// copy the twin pass then removes; the prune pass drops a fileless stale
+// row. Output is grouped by podcast.
+func TestPlanAllDedupSequencesPasses(t *testing.T) {
+	pod, pub := "P", "2026-05-01T00:00:00Z"
+	oldHash := strings.Repeat("c", 32)
+	newHash := strings.Repeat("d", 32)
+	legacyHash := strings.Repeat("e", 32)
+	goneHash := strings.Repeat("f", 32)
+	live := dedupNow.Add(-time.Hour).Format(time.RFC3339)
+	stale := dedupNow.Add(-60 * 24 * time.Hour).Format(time.RFC3339)
+	owners := map[string]dedupOwner{
+		oldHash: guidOwner(oldHash, pod, "Old Title Words", pub, stale, "g1"),
+		newHash: guidOwner(newHash, pod, "New Title Words", pub, live, "g1"),
+	}
+	url2ep := map[string]string{} // the legacy copy's URL hash is long rotated out
+
+	oldName := buildNonInteractiveFilename(pod, "Old Title Words", pub, oldHash)
+	canonical := buildNonInteractiveFilename(pod, "New Title Words", pub, newHash)
+	legacyName := buildNonInteractiveFilename(pod, "New Title Words", pub, legacyHash)
+	files := []dedupFile{
+		guidFile(oldName, oldHash, 50000000),
+		guidFile(legacyName, legacyHash, 40000000),
+	}
+	liveness := []episodeLivenessRow{
+		{epHash: goneHash, podcast: "Another", title: "Fell out of the feed", lastSeen: stale},
+		{epHash: oldHash, podcast: pod, title: "Old Title Words", lastSeen: stale},
+	}
+
+	// On their own, neither pass finds the twin
+	if a := planDedup(files, owners, url2ep, dedupNow); len(actionsByKind(a)[actDelete]) != 0 {
+		t.Fatalf("setup: the twin pass alone should not see a duplicate, got %+v", a)
+	}
+
+	actions := planAllDedup(files, owners, url2ep, nil, map[string]bool{}, liveness, dedupNow)
+	byKind := actionsByKind(actions)
+	if len(byKind[actRename]) != 1 || filepath.Base(byKind[actRename][0].newPath) != canonical {
+		t.Fatalf("expected the stale copy renamed to %s, got %+v", canonical, actions)
+	}
+	if len(byKind[actDelete]) != 1 || byKind[actDelete][0].file.name != legacyName ||
+		byKind[actDelete][0].keeperPath != "/pods/"+canonical {
+		t.Fatalf("expected the legacy copy deleted in favour of the renamed keeper, got %+v", actions)
+	}
+	if len(byKind[actPruneRow]) != 1 || byKind[actPruneRow][0].pruneEp != goneHash {
+		t.Fatalf("expected only the fileless row pruned (the guid pass already prunes %s), got %+v", oldHash, byKind[actPruneRow])
+	}
+
+	touched := make(map[string]string)
+	for _, a := range actions {
+		switch a.kind {
+		case actDelete, actStub, actRename:
+			if prev, ok := touched[a.file.path]; ok {
+				t.Fatalf("%s acted on twice (%s and %s)", a.file.path, prev, a.kind)
+			}
+			touched[a.file.path] = a.kind
+		}
+	}
+	podcasts := make([]string, 0, len(actions))
+	for _, a := range actions {
+		podcasts = append(podcasts, a.podcast)
+	}
+	if strings.Join(podcasts, ",") != "Another,P,P" {
+		t.Fatalf("expected the plan grouped by podcast, got %v", podcasts)
+	}
+}
+
+// A later pass's decision replaces an earlier pass's MANUAL for that file.
+func TestPlanAllDedupLaterPassReplacesManual(t *testing.T) {
+	pod := "P"
+	a1 := strings.Repeat("a", 32)
+	a2 := strings.Repeat("b", 32)
+	// Same guid, different dates, unrelated titles: the guid pass says MANUAL
+	owners := map[string]dedupOwner{
+		a1: guidOwner(a1, pod, "Alpha", "2026-01-01T00:00:00Z", dedupNow.Add(-2*time.Hour).Format(time.RFC3339), "g"),
+		a2: guidOwner(a2, pod, "Omega", "2026-03-01T00:00:00Z", dedupNow.Add(-time.Hour).Format(time.RFC3339), "g"),
+	}
+	f1 := guidFile(buildNonInteractiveFilename(pod, "Alpha", "2026-01-01", a1), a1, 30000000)
+	// A stub of Alpha under its legacy URL hash: the twin pass removes it
+	legacy := strings.Repeat("9", 32)
+	url2ep := map[string]string{legacy: a1}
+	stub := guidFile(buildNonInteractiveFilename(pod, "Alpha", "2026-01-01", legacy), legacy, 150)
+	f2 := guidFile(buildNonInteractiveFilename(pod, "Omega", "2026-03-01", a2), a2, 30000000)
+	files := []dedupFile{f1, stub, f2}
+
+	stubManual := false
+	for _, a := range planGuidDedup(files, owners, url2ep) {
+		stubManual = stubManual || (a.kind == actManual && a.file.path == stub.path)
+	}
+	if !stubManual {
+		t.Fatal("setup: expected the guid pass to report the stub MANUAL")
+	}
+	actions := planAllDedup(files, owners, url2ep, nil, map[string]bool{}, nil, dedupNow)
+	byKind := actionsByKind(actions)
+	if len(byKind[actStub]) != 1 || byKind[actStub][0].file.path != stub.path {
+		t.Fatalf("expected the twin pass to remove the stub, got %+v", actions)
+	}
+	for _, a := range byKind[actManual] {
+		if a.file.path == stub.path {
+			t.Fatalf("the stub should not also be reported MANUAL: %+v", actions)
+		}
+	}
+}
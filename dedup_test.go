@@ -207,7 +207,7 @@ func TestPlanDedupUnattributableWithLiveSiblingsManual(t *testing.T) {
 // archived_episodes inside one transaction.
 func TestRunDedupTwinsApply(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	archDir := t.TempDir()
 
@@ -248,7 +248,7 @@ func TestRunDedupTwinsApply(t *testing.T) {
 		t.Fatalf("insert archive row: %v", err)
 	}
 
-	if err := runDedupTwins([]string{tmpDir, archDir}, true); err != nil {
+	if err := runDedupTwins(st, []string{tmpDir, archDir}, true); err != nil {
 		t.Fatalf("runDedupTwins: %v", err)
 	}
 
@@ -372,7 +372,7 @@ func TestPlanDedupRenumberedKeepsLargerCopy(t *testing.T) {
 // registry are kept, as are live rows.
 func TestPruneStaleEpisodes(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -408,7 +408,7 @@ func TestPruneStaleEpisodes(t *testing.T) {
 	ins("Live Missing", strings.Repeat("2", 32), strings.Repeat("d", 32), nowStr)
 	ins("Stale Orphan", strings.Repeat("3", 32), strings.Repeat("e", 32), oldStr)
 
-	if err := pruneStaleEpisodes([]string{tmpDir}, true); err != nil {
+	if err := pruneStaleEpisodes(st, []string{tmpDir}, true); err != nil {
 		t.Fatalf("pruneStaleEpisodes: %v", err)
 	}
 
@@ -548,7 +548,7 @@ func TestPlanRetitlesAmbiguousMatchManual(t *testing.T) {
 // (Patreon)" rows looking live years after the feed became "Bungacast").
 func TestEpisodeLastSeenUpdateScopedToPodcast(t *testing.T) {
 	useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -575,7 +575,7 @@ func TestEpisodeLastSeenUpdateScopedToPodcast(t *testing.T) {
 	pod := map[string]string{"title": "Bungacast (Patreon feed)", "author": "a", "category": "c",
 		"description": "d", "language": "l", "link": "k"}
 	episodes := []M{{"title": title, "file": "https://x/new.mp3", "guid": "g1", "published": "2021-11-02T00:00:00Z"}}
-	podEpisodesIntoDatabase(db, pod, episodes)
+	podEpisodesIntoDatabase(st, pod, episodes)
 
 	var abSeen, bcSeen string
 	if err := db.QueryRow(`SELECT last_seen FROM episodes WHERE podcastname_episodename_hash=?;`, abHash).Scan(&abSeen); err != nil {
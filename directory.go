@@ -0,0 +1,371 @@
+package main
+
+// Podcast directory search for the TUI: find a feed by name rather than
+// pasting its RSS URL. The directory is a provider behind
+// directoryProvider; the iTunes Search API (no key needed, the default) and
+// the Podcast Index API (free key and secret) are built in, chosen with a
+// "directory = itunes|podcastindex" line in gopodder.conf.
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// gopodder.conf settings choosing and configuring the directory.
+const (
+	directorySetting          = "directory"
+	podcastIndexKeySetting    = "podcastindex_key"
+	podcastIndexSecretSetting = "podcastindex_secret"
+)
+
+// directoryResultLimit caps the results asked of a directory.
+const directoryResultLimit = 25
+
+const (
+	itunesSearchURL       = "https://itunes.apple.com/search"
+	podcastIndexSearchURL = "https://api.podcastindex.org/api/1.0/search/byterm"
+)
+
+// directoryResult is one podcast found in a directory.
+type directoryResult struct {
+	title    string
+	author   string
+	feedURL  string
+	episodes int // 0 when the directory doesn't say
+}
+
+// directoryProvider searches a podcast directory.
+type directoryProvider interface {
+	name() string
+	search(ctx context.Context, query string, limit int) ([]directoryResult, error)
+}
+
+// podcastDirectory is the directory the TUI searches, set once in main.
+// Like feedFetcher, it is a process-wide switch.
+var podcastDirectory directoryProvider = itunesDirectory{baseURL: itunesSearchURL}
+
+// directoryClient bounds a whole directory query.
+var directoryClient = &http.Client{Timeout: 20 * time.Second}
+
+// newDirectory builds the provider the gopodder.conf settings ask for.
+func newDirectory(settings map[string]string) (directoryProvider, error) {
+	switch strings.ToLower(strings.TrimSpace(settings[directorySetting])) {
+	case "", "itunes":
+		return itunesDirectory{baseURL: itunesSearchURL}, nil
+	case "podcastindex":
+		key := strings.TrimSpace(settings[podcastIndexKeySetting])
+		secret := strings.TrimSpace(settings[podcastIndexSecretSetting])
+		if key == "" || secret == "" {
+			return nil, fmt.Errorf("%s = podcastindex needs %s and %s", directorySetting, podcastIndexKeySetting, podcastIndexSecretSetting)
+		}
+		return podcastIndexDirectory{baseURL: podcastIndexSearchURL, key: key, secret: secret, now: time.Now}, nil
+	default:
+		return nil, fmt.Errorf("%s = %q: want itunes or podcastindex", directorySetting, settings[directorySetting])
+	}
+}
+
+// unconfiguredDirectory stands in for a directory the settings got wrong.
+// Only the TUI's directory search needs one, so the error waits for it
+// rather than stopping every other command at start-up.
+type unconfiguredDirectory struct {
+	err error
+}
+
+func (unconfiguredDirectory) name() string { return "not configured" }
+
+func (d unconfiguredDirectory) search(ctx context.Context, query string, limit int) ([]directoryResult, error) {
+	return nil, d.err
+}
+
+// getDirectoryJSON runs a directory query and decodes its JSON reply.
+func getDirectoryJSON(req *http.Request, out interface{}) error {
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", feedUserAgent)
+	}
+	resp, err := directoryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// itunesDirectory is Apple's iTunes Search API.
+type itunesDirectory struct {
+	baseURL string
+}
+
+func (itunesDirectory) name() string { return "iTunes" }
+
+func (d itunesDirectory) search(ctx context.Context, query string, limit int) ([]directoryResult, error) {
+	params := url.Values{
+		"media":  {"podcast"},
+		"entity": {"podcast"},
+		"term":   {query},
+		"limit":  {strconv.Itoa(limit)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.baseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var reply struct {
+		Results []struct {
+			CollectionName string `json:"collectionName"`
+			ArtistName     string `json:"artistName"`
+			FeedURL        string `json:"feedUrl"`
+			TrackCount     int    `json:"trackCount"`
+		} `json:"results"`
+	}
+	if err := getDirectoryJSON(req, &reply); err != nil {
+		return nil, fmt.Errorf("iTunes search: %w", err)
+	}
+	results := make([]directoryResult, 0, len(reply.Results))
+	for _, r := range reply.Results {
+		// Some podcasts are listed without a public feed
+		if strings.TrimSpace(r.FeedURL) == "" {
+			continue
+		}
+		results = append(results, directoryResult{title: r.CollectionName, author: r.ArtistName,
+			feedURL: strings.TrimSpace(r.FeedURL), episodes: r.TrackCount})
+	}
+	return results, nil
+}
+
+// podcastIndexDirectory is the Podcast Index API. Each request is signed
+// with the key, the secret and the time.
+type podcastIndexDirectory struct {
+	baseURL     string
+	key, secret string
+	now         func() time.Time
+}
+
+func (podcastIndexDirectory) name() string { return "Podcast Index" }
+
+func (d podcastIndexDirectory) search(ctx context.Context, query string, limit int) ([]directoryResult, error) {
+	params := url.Values{"q": {query}, "max": {strconv.Itoa(limit)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.baseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	date := strconv.FormatInt(d.now().Unix(), 10)
+	req.Header.Set("User-Agent", gopodder)
+	req.Header.Set("X-Auth-Key", d.key)
+	req.Header.Set("X-Auth-Date", date)
+	req.Header.Set("Authorization", podcastIndexAuth(d.key, d.secret, date))
+	var reply struct {
+		Feeds []struct {
+			Title        string `json:"title"`
+			Author       string `json:"author"`
+			URL          string `json:"url"`
+			EpisodeCount int    `json:"episodeCount"`
+		} `json:"feeds"`
+	}
+	if err := getDirectoryJSON(req, &reply); err != nil {
+		return nil, fmt.Errorf("Podcast Index search: %w", err)
+	}
+	results := make([]directoryResult, 0, len(reply.Feeds))
+	for _, f := range reply.Feeds {
+		if strings.TrimSpace(f.URL) == "" {
+			continue
+		}
+		results = append(results, directoryResult{title: f.Title, author: f.Author,
+			feedURL: strings.TrimSpace(f.URL), episodes: f.EpisodeCount})
+	}
+	return results, nil
+}
+
+// podcastIndexAuth is the Authorization header: the hex SHA-1 of the key,
+// the secret and the X-Auth-Date.
+func podcastIndexAuth(key, secret, date string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(key+secret+date)))
+}
+
+type directoryResultsMsg struct {
+	query   string
+	results []directoryResult
+	err     error
+}
+
+func searchDirectoryCmd(dir directoryProvider, query string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		results, err := dir.search(ctx, query, directoryResultLimit)
+		return directoryResultsMsg{query: query, results: results, err: err}
+	}
+}
+
+// previewDirectoryFeedCmd loads a directory result's feed into the
+// episode picker, whose b then comes back to the results.
+func previewDirectoryFeedCmd(s *store, feedURL string) tea.Cmd {
+	fetch := fetchFeedCmd(s, feedURL)
+	return func() tea.Msg {
+		msg := fetch().(feedParsedMsg)
+		msg.fromDirectory = true
+		return msg
+	}
+}
+
+// openDirectory shows the directory search; esc there comes back to the
+// current screen.
+func (m *interactiveModel) openDirectory() tea.Cmd {
+	m.directoryFrom = m.step
+	m.step = stepDirectory
+	m.errMsg = ""
+	if d, ok := podcastDirectory.(unconfiguredDirectory); ok {
+		m.errMsg = d.err.Error()
+	}
+	return m.directoryInput.Focus()
+}
+
+func (m interactiveModel) updateDirectory(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.updateWindowSize(msg)
+		return m, nil
+	case directoryResultsMsg:
+		m.directorySearching = false
+		if msg.err != nil {
+			m.errMsg = msg.err.Error()
+			return m, nil
+		}
+		m.directoryQuery = msg.query
+		m.directoryResults = msg.results
+		m.directoryCursor = 0
+		if len(msg.results) == 0 {
+			m.errMsg = fmt.Sprintf("No podcasts with a feed found for %q.", msg.query)
+			return m, nil
+		}
+		m.errMsg = ""
+		m.directoryInput.Blur()
+		return m, nil
+	case tea.KeyMsg:
+		if m.directoryInput.Focused() {
+			switch msg.String() {
+			case "esc":
+				if len(m.directoryResults) > 0 {
+					m.directoryInput.Blur()
+					m.errMsg = ""
+					return m, nil
+				}
+				return m.leaveDirectory(), nil
+			case "enter":
+				query := strings.TrimSpace(m.directoryInput.Value())
+				if query == "" {
+					m.errMsg = "Enter a podcast name to search for."
+					return m, nil
+				}
+				m.errMsg = ""
+				m.directorySearching = true
+				return m, searchDirectoryCmd(podcastDirectory, query)
+			}
+			var cmd tea.Cmd
+			m.directoryInput, cmd = m.directoryInput.Update(msg)
+			return m, cmd
+		}
+
+		switch {
+		case key.Matches(msg, m.keys.global.back):
+			return m.leaveDirectory(), nil
+		case key.Matches(msg, m.keys.directory.search):
+			m.errMsg = ""
+			return m, m.directoryInput.Focus()
+		case key.Matches(msg, m.keys.global.up):
+			if m.directoryCursor > 0 {
+				m.directoryCursor--
+			}
+		case key.Matches(msg, m.keys.global.down):
+			if m.directoryCursor < len(m.directoryResults)-1 {
+				m.directoryCursor++
+			}
+		case key.Matches(msg, m.keys.directory.preview):
+			if len(m.directoryResults) == 0 {
+				return m, nil
+			}
+			m.errMsg = ""
+			m.step = stepLoading
+			return m, previewDirectoryFeedCmd(m.store, m.directoryResults[m.directoryCursor].feedURL)
+		}
+	}
+	return m, nil
+}
+
+func (m interactiveModel) leaveDirectory() interactiveModel {
+	m.errMsg = ""
+	m.directoryInput.Blur()
+	m.step = m.directoryFrom
+	switch m.step {
+	case stepURL:
+		m.urlInput.Focus()
+	case stepFeedSelect:
+		m.ensureFeedVisible()
+	}
+	return m
+}
+
+func (m interactiveModel) viewDirectory() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Find a podcast (%s)\n\n", podcastDirectory.name()))
+	b.WriteString(m.directoryInput.View())
+	b.WriteString("\n\n")
+	if m.directorySearching {
+		b.WriteString("Searching...\n")
+		return b.String()
+	}
+	if m.errMsg != "" {
+		b.WriteString(m.errMsg)
+		b.WriteString("\n\n")
+	}
+	if m.directoryInput.Focused() {
+		b.WriteString("Enter: search  Esc: back\n")
+		return b.String()
+	}
+
+	rows := m.windowSize
+	if rows < 3 {
+		rows = 3
+	}
+	start := 0
+	if m.directoryCursor >= rows {
+		start = m.directoryCursor - rows + 1
+	}
+	end := start + rows
+	if end > len(m.directoryResults) {
+		end = len(m.directoryResults)
+	}
+	b.WriteString(fmt.Sprintf("%d podcasts match %q\n", len(m.directoryResults), m.directoryQuery))
+	for i := start; i < end; i++ {
+		r := m.directoryResults[i]
+		cursor := " "
+		if i == m.directoryCursor {
+			cursor = ">"
+		}
+		line := fmt.Sprintf("%s %s", cursor, r.title)
+		if r.author != "" {
+			line += " — " + r.author
+		}
+		if r.episodes > 0 {
+			line += fmt.Sprintf(" (%d episodes)", r.episodes)
+		}
+		b.WriteString(line + "\n")
+	}
+	if len(m.directoryResults) > 0 && m.directoryCursor < len(m.directoryResults) {
+		b.WriteString("\n" + m.directoryResults[m.directoryCursor].feedURL + "\n")
+	}
+	b.WriteString("\n" + keyHints(m.keys.directory.preview, m.keys.directory.search, m.keys.global.back,
+		m.keys.global.quit, m.keys.global.help) + "\n")
+	return b.String()
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// setPodcastDirectory swaps the global directory for one test.
+func setPodcastDirectory(t *testing.T, dir directoryProvider) {
+	t.Helper()
+	old := podcastDirectory
+	podcastDirectory = dir
+	t.Cleanup(func() { podcastDirectory = old })
+}
+
+func TestNewDirectory(t *testing.T) {
+	if d, err := newDirectory(map[string]string{}); err != nil || d.name() != "iTunes" {
+		t.Fatalf("default directory = %v, %v", d, err)
+	}
+	if _, err := newDirectory(map[string]string{directorySetting: "podcastindex"}); err == nil {
+		t.Fatal("podcastindex accepted without a key and secret")
+	}
+	d, err := newDirectory(map[string]string{directorySetting: "PodcastIndex",
+		podcastIndexKeySetting: "k", podcastIndexSecretSetting: "s"})
+	if err != nil || d.name() != "Podcast Index" {
+		t.Fatalf("podcastindex directory = %v, %v", d, err)
+	}
+	if _, err := newDirectory(map[string]string{directorySetting: "gpodder"}); err == nil {
+		t.Fatal("unknown directory accepted")
+	}
+}
+
+func TestITunesDirectory(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("term") != "in our time" || q.Get("media") != "podcast" || q.Get("limit") != "5" {
+			t.Errorf("query = %v", q)
+		}
+		fmt.Fprint(w, `{"resultCount": 3, "results": [
+			{"collectionName": "In Our Time", "artistName": "BBC Radio 4", "feedUrl": "https://x/iot.rss", "trackCount": 1000},
+			{"collectionName": "No Feed", "artistName": "Nobody"},
+			{"collectionName": "In Our Time: History", "artistName": "BBC", "feedUrl": " https://x/hist.rss ", "trackCount": 300}]}`)
+	}))
+	defer srv.Close()
+
+	results, err := itunesDirectory{baseURL: srv.URL}.search(context.Background(), "in our time", 5)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	want := []directoryResult{
+		{title: "In Our Time", author: "BBC Radio 4", feedURL: "https://x/iot.rss", episodes: 1000},
+		{title: "In Our Time: History", author: "BBC", feedURL: "https://x/hist.rss", episodes: 300},
+	}
+	if fmt.Sprint(results) != fmt.Sprint(want) {
+		t.Fatalf("results = %+v, want %+v", results, want)
+	}
+}
+
+func TestPodcastIndexDirectory(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Key") != "key" || r.Header.Get("X-Auth-Date") != "1700000000" {
+			t.Errorf("auth headers = %v", r.Header)
+		}
+		if r.Header.Get("Authorization") != podcastIndexAuth("key", "secret", "1700000000") {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("q") != "history" {
+			t.Errorf("query = %v", r.URL.Query())
+		}
+		fmt.Fprint(w, `{"status": "true", "feeds": [
+			{"title": "History Extra", "author": "Immediate Media", "url": "https://x/he.rss", "episodeCount": 900}]}`)
+	}))
+	defer srv.Close()
+
+	dir := podcastIndexDirectory{baseURL: srv.URL, key: "key", secret: "secret", now: func() time.Time { return now }}
+	results, err := dir.search(context.Background(), "history", 10)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(results) != 1 || results[0].title != "History Extra" || results[0].episodes != 900 {
+		t.Fatalf("results = %+v", results)
+	}
+
+	dir.secret = "wrong"
+	if _, err := dir.search(context.Background(), "history", 10); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("search with a bad secret = %v", err)
+	}
+}
+
+// A directory search from the TUI previews a feed in the episode picker,
+// and b comes back to the results.
+func TestDirectorySearchScreen(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search":
+			fmt.Fprintf(w, `{"results": [{"collectionName": "Found Show", "artistName": "Host",
+				"feedUrl": "http://%s/feed.rss", "trackCount": 3}]}`, r.Host)
+		case "/feed.rss":
+			fmt.Fprint(w, snapshotTestFeed("Found Show", 3))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	setPodcastDirectory(t, itunesDirectory{baseURL: srv.URL + "/search"})
+
+	m := newInteractiveModel(st, t.TempDir(), "", "")
+	if m.step != stepURL {
+		t.Fatalf("start step = %v, want URL entry", m.step)
+	}
+	update := func(msg tea.Msg) tea.Cmd {
+		t.Helper()
+		next, cmd := m.Update(msg)
+		m = next.(interactiveModel)
+		return cmd
+	}
+
+	update(tea.KeyMsg{Type: tea.KeyTab})
+	if m.step != stepDirectory {
+		t.Fatalf("tab went to step %v", m.step)
+	}
+	for _, r := range "found" {
+		update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	update(update(tea.KeyMsg{Type: tea.KeyEnter})())
+	if len(m.directoryResults) != 1 || !strings.Contains(m.View(), "Found Show — Host (3 episodes)") {
+		t.Fatalf("results view:\n%s", m.View())
+	}
+
+	update(update(tea.KeyMsg{Type: tea.KeyEnter})())
+	if m.step != stepSelect || m.podTitle != "Found Show" || len(m.allItems) != 3 {
+		t.Fatalf("step=%v podTitle=%q items=%d err=%q", m.step, m.podTitle, len(m.allItems), m.errMsg)
+	}
+
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("b")})
+	if m.step != stepDirectory || len(m.directoryResults) != 1 {
+		t.Fatalf("b went to step %v", m.step)
+	}
+	update(tea.KeyMsg{Type: tea.KeyEsc})
+	if m.step != stepURL {
+		t.Fatalf("esc went to step %v, want URL entry", m.step)
+	}
+}
+
+// A directory the settings got wrong only matters to the directory search,
+// which shows why it can't search.
+func TestUnconfiguredDirectory(t *testing.T) {
+	useTempWorkingDir(t)
+	_, err := newDirectory(map[string]string{directorySetting: "podcastindex"})
+	if err == nil {
+		t.Fatal("podcastindex accepted without a key and secret")
+	}
+	setPodcastDirectory(t, unconfiguredDirectory{err: err})
+
+	m := newInteractiveModel(openTestStore(t), t.TempDir(), "", "")
+	update := func(msg tea.Msg) tea.Cmd {
+		t.Helper()
+		next, cmd := m.Update(msg)
+		m = next.(interactiveModel)
+		return cmd
+	}
+	update(tea.KeyMsg{Type: tea.KeyTab})
+	if m.step != stepDirectory || !strings.Contains(m.View(), "needs podcastindex_key and podcastindex_secret") {
+		t.Fatalf("step=%v view:\n%s", m.step, m.View())
+	}
+	for _, r := range "found" {
+		update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	update(update(tea.KeyMsg{Type: tea.KeyEnter})())
+	if len(m.directoryResults) != 0 || m.errMsg != err.Error() {
+		t.Fatalf("search errMsg = %q", m.errMsg)
+	}
+}
@@ -0,0 +1,521 @@
+package main
+
+// The interactive download manager. Episodes picked in the TUI download in
+// process, parallelDownloads at a time, each with its own progress, speed
+// and ETA; any one can be paused, cancelled or retried, and the user can go
+// back to browsing while they run.
+//
+// The model owns the jobs and only touches them from Update. A job runs as
+// a tea.Cmd whose result is its downloadFinishedMsg; progress on the way
+// comes back through the manager's events channel, which one listener Cmd
+// at a time drains.
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// parallelDownloadsSetting is the gopodder.conf line setting how many
+// interactive downloads run at once.
+const parallelDownloadsSetting = "parallel_downloads"
+
+const defaultParallelDownloads = 3
+
+// parallelDownloads is how many interactive downloads run at once.
+var parallelDownloads = defaultParallelDownloads
+
+// partSuffix marks a download in progress; a paused one resumes from it.
+const partSuffix = ".part"
+
+// progressInterval throttles progress messages from each download.
+const progressInterval = 200 * time.Millisecond
+
+// parseParallelDownloads validates a parallel_downloads setting.
+func parseParallelDownloads(raw string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || n < 1 || n > 16 {
+		return 0, fmt.Errorf("%s = %q: want a number from 1 to 16", parallelDownloadsSetting, raw)
+	}
+	return n, nil
+}
+
+// downloadClient fetches episode audio. No overall timeout: episodes can
+// take a long time, and a stuck one can be cancelled. Certificates aren't
+// checked, as with the wget --no-check-certificate this replaced.
+var downloadClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 60 * time.Second,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+	},
+}
+
+type downloadState int
+
+const (
+	dlQueued downloadState = iota
+	dlRunning
+	dlPaused
+	dlDone
+	dlFailed
+	dlCancelled
+)
+
+func (s downloadState) String() string {
+	return [...]string{"queued", "downloading", "paused", "done", "failed", "cancelled"}[s]
+}
+
+// downloadJob is one episode in the manager.
+type downloadJob struct {
+	id      int
+	item    episodeItem
+	album   string // podcast title for the tags
+	path    string
+	state   downloadState
+	got     int64 // bytes so far
+	total   int64 // -1 when the server doesn't say
+	speed   float64
+	err     error
+	run     int  // bumped per start, so a stopped run's late messages are ignored
+	working bool // a run's goroutine hasn't reported back yet
+	cancel  context.CancelFunc
+	lastAt  time.Time
+	lastGot int64
+}
+
+// eta estimates the time left, or 0 when it can't.
+func (j *downloadJob) eta() time.Duration {
+	if j.state != dlRunning || j.total <= 0 || j.speed <= 0 || j.got >= j.total {
+		return 0
+	}
+	return time.Duration(float64(j.total-j.got) / j.speed * float64(time.Second))
+}
+
+type downloadProgressMsg struct {
+	id, run    int
+	got, total int64
+	at         time.Time
+}
+
+type downloadFinishedMsg struct {
+	id, run int
+	err     error
+}
+
+// downloadManager holds the interactive downloads. It lives behind a
+// pointer so every copy of the model shares it.
+type downloadManager struct {
+	jobs       []*downloadJob
+	parallel   int
+	events     chan tea.Msg
+	listening  bool
+	store      *store
+	pythonPath string
+	eyeD3Dir   string
+}
+
+func newDownloadManager(s *store, parallel int, pythonPath, eyeD3Dir string) *downloadManager {
+	if parallel < 1 {
+		parallel = 1
+	}
+	return &downloadManager{
+		parallel:   parallel,
+		events:     make(chan tea.Msg, 64),
+		store:      s,
+		pythonPath: pythonPath,
+		eyeD3Dir:   eyeD3Dir,
+	}
+}
+
+// add queues items for download into folder, skipping any already queued
+// for the same path, and starts what it can. It returns how many it
+// queued.
+func (dm *downloadManager) add(items []episodeItem, folder, podTitle string) (int, tea.Cmd) {
+	queued := make(map[string]bool, len(dm.jobs))
+	for _, j := range dm.jobs {
+		if j.state != dlCancelled && j.state != dlFailed {
+			queued[j.path] = true
+		}
+	}
+	added := 0
+	for _, item := range items {
+		path := filepath.Join(folder, filepath.FromSlash(item.filename))
+		if queued[path] {
+			continue
+		}
+		queued[path] = true
+		album := podTitle
+		if item.podcastTitle != "" {
+			album = item.podcastTitle
+		}
+		dm.jobs = append(dm.jobs, &downloadJob{id: len(dm.jobs), item: item, album: album, path: path, total: -1})
+		added++
+	}
+	return added, dm.schedule()
+}
+
+// schedule starts queued jobs while there are free slots, and the events
+// listener if it isn't running.
+func (dm *downloadManager) schedule() tea.Cmd {
+	var cmds []tea.Cmd
+	working := 0
+	for _, j := range dm.jobs {
+		if j.working {
+			working++
+		}
+	}
+	for _, j := range dm.jobs {
+		if working >= dm.parallel {
+			break
+		}
+		// A stopped run still winding down starts again once it has
+		// reported back, so two runs never write the same file
+		if j.state == dlQueued && !j.working {
+			cmds = append(cmds, dm.start(j))
+			working++
+		}
+	}
+	if len(cmds) > 0 && !dm.listening {
+		dm.listening = true
+		cmds = append(cmds, dm.listen())
+	}
+	return tea.Batch(cmds...)
+}
+
+func (dm *downloadManager) start(j *downloadJob) tea.Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
+	j.run++
+	j.state, j.working, j.cancel, j.err = dlRunning, true, cancel, nil
+	j.speed, j.lastAt, j.lastGot = 0, time.Now(), j.got
+	id, run, url, path, item, album := j.id, j.run, j.item.url, j.path, j.item, j.album
+	s, pythonPath, eyeD3Dir, events := dm.store, dm.pythonPath, dm.eyeD3Dir, dm.events
+	return func() tea.Msg {
+		err := fetchEpisode(ctx, url, path, func(got, total int64) {
+			select {
+			case events <- downloadProgressMsg{id: id, run: run, got: got, total: total, at: time.Now()}:
+			default: // the UI is behind; the next report will do
+			}
+		})
+		if err == nil {
+			err = finishEpisode(s, path, item.title, album, pythonPath, eyeD3Dir)
+		}
+		return downloadFinishedMsg{id: id, run: run, err: err}
+	}
+}
+
+func (dm *downloadManager) listen() tea.Cmd {
+	events := dm.events
+	return func() tea.Msg {
+		return <-events
+	}
+}
+
+// pending counts the jobs still to finish: running, queued or paused.
+func (dm *downloadManager) pending() (running, queued, paused int) {
+	for _, j := range dm.jobs {
+		switch j.state {
+		case dlRunning:
+			running++
+		case dlQueued:
+			queued++
+		case dlPaused:
+			paused++
+		}
+	}
+	return running, queued, paused
+}
+
+// active reports whether an episode, by its relative filename, is queued,
+// downloading or paused.
+func (dm *downloadManager) active(filename string) bool {
+	for _, j := range dm.jobs {
+		if j.item.filename == filename && (j.state == dlQueued || j.state == dlRunning || j.state == dlPaused) {
+			return true
+		}
+	}
+	return false
+}
+
+func (dm *downloadManager) count(state downloadState) int {
+	n := 0
+	for _, j := range dm.jobs {
+		if j.state == state {
+			n++
+		}
+	}
+	return n
+}
+
+// progress records a progress report.
+func (dm *downloadManager) progress(msg downloadProgressMsg) tea.Cmd {
+	if msg.id < len(dm.jobs) {
+		j := dm.jobs[msg.id]
+		if j.run == msg.run && j.state == dlRunning {
+			if dt := msg.at.Sub(j.lastAt).Seconds(); dt > 0 {
+				rate := float64(msg.got-j.lastGot) / dt
+				if j.speed == 0 {
+					j.speed = rate
+				} else {
+					j.speed = 0.7*j.speed + 0.3*rate
+				}
+			}
+			j.got, j.total, j.lastAt, j.lastGot = msg.got, msg.total, msg.at, msg.got
+		}
+	}
+	return dm.listen()
+}
+
+// finished records the end of a run; ok is true when it downloaded the
+// episode.
+func (dm *downloadManager) finished(msg downloadFinishedMsg) (ok bool, cmd tea.Cmd) {
+	if msg.id >= len(dm.jobs) {
+		return false, nil
+	}
+	j := dm.jobs[msg.id]
+	if j.run != msg.run {
+		return false, dm.schedule()
+	}
+	j.working = false
+	j.cancel = nil
+	switch {
+	case msg.err == nil:
+		// Done even if paused or cancelled while it was being tagged and
+		// recorded: the file is in place and in downloads, and a rerun
+		// would only find it there
+		j.state, j.err = dlDone, nil
+		if j.total < 0 {
+			j.total = j.got
+		}
+		ok = true
+	case j.state == dlCancelled:
+		os.Remove(j.path + partSuffix)
+	case j.state != dlRunning:
+		// paused, or queued again while stopping: keep the partial file
+	default:
+		j.state, j.err = dlFailed, msg.err
+	}
+	return ok, dm.schedule()
+}
+
+// pause stops a running or queued job, keeping what it has; on a paused
+// job it resumes.
+func (dm *downloadManager) pause(id int) tea.Cmd {
+	j := dm.jobs[id]
+	switch j.state {
+	case dlRunning:
+		j.state = dlPaused
+		j.cancel()
+	case dlQueued:
+		j.state = dlPaused
+	case dlPaused:
+		j.state = dlQueued
+		return dm.schedule()
+	}
+	return nil
+}
+
+// cancelJob stops a job and drops its partial file.
+func (dm *downloadManager) cancelJob(id int) {
+	j := dm.jobs[id]
+	switch j.state {
+	case dlRunning:
+		j.state = dlCancelled
+		j.cancel()
+	case dlQueued, dlPaused:
+		j.state = dlCancelled
+		if !j.working {
+			os.Remove(j.path + partSuffix)
+		}
+	}
+}
+
+// retry queues a failed or cancelled job again.
+func (dm *downloadManager) retry(id int) tea.Cmd {
+	j := dm.jobs[id]
+	if j.state != dlFailed && j.state != dlCancelled {
+		return nil
+	}
+	j.state, j.err = dlQueued, nil
+	if _, err := os.Stat(j.path + partSuffix); err != nil {
+		j.got = 0
+	}
+	return dm.schedule()
+}
+
+// fetchEpisode downloads url to path through path.part, resuming a partial
+// file left by a pause. report is called with the bytes so far and the
+// total (-1 if unknown), at most every progressInterval.
+func fetchEpisode(ctx context.Context, url, path string, report func(got, total int64)) error {
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		return errors.New("file already exists, skipping")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	part := path + partSuffix
+	var have int64
+	if info, err := os.Stat(part); err == nil {
+		have = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", feedUserAgent)
+	if have > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", have))
+	}
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	total := int64(-1)
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && have > 0:
+		flags |= os.O_APPEND
+		if resp.ContentLength >= 0 {
+			total = have + resp.ContentLength
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && have > 0:
+		// The partial file already has everything
+		report(have, have)
+		return os.Rename(part, path)
+	case resp.StatusCode == http.StatusOK:
+		// A fresh start, or a server that ignores Range
+		flags |= os.O_TRUNC
+		have = 0
+		total = resp.ContentLength
+	default:
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+
+	f, err := os.OpenFile(part, flags, 0666)
+	if err != nil {
+		return err
+	}
+	got := have
+	last := time.Now()
+	report(got, total)
+	buf := make([]byte, 64*1024)
+	for {
+		n, rerr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := f.Write(buf[:n]); err != nil {
+				f.Close()
+				return err
+			}
+			got += int64(n)
+			if time.Since(last) >= progressInterval {
+				last = time.Now()
+				report(got, total)
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			f.Close()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return rerr
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if total >= 0 && got != total {
+		return fmt.Errorf("short download: got %d of %d bytes", got, total)
+	}
+	report(got, got)
+	return os.Rename(part, path)
+}
+
+// finishEpisode tags a downloaded episode and records it, as the batch
+// pipeline does for its downloads.
+func finishEpisode(s *store, path, title, album, pythonPath, eyeD3Dir string) error {
+	if err := os.Chmod(path, 0666); err != nil {
+		return err
+	}
+	if err := tagSinglePod(path, title, album, pythonPath, eyeD3Dir); err != nil {
+		return fmt.Errorf("downloaded, but tagging failed: %w", err)
+	}
+	if err := s.recordInteractiveDownload(path); err != nil {
+		return fmt.Errorf("downloaded and tagged, but failed to update downloads table: %w", err)
+	}
+	return nil
+}
+
+// progressBar draws frac (0..1) as a width-character bar.
+func progressBar(frac float64, width int) string {
+	if frac < 0 {
+		frac = 0
+	}
+	if frac > 1 {
+		frac = 1
+	}
+	filled := int(frac*float64(width) + 0.5)
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+}
+
+// formatRate shows bytes per second in MB/s.
+func formatRate(bps float64) string {
+	return fmt.Sprintf("%.1f MB/s", bps/1e6)
+}
+
+// formatETA shows a time left as M:SS or H:MM:SS.
+func formatETA(d time.Duration) string {
+	return formatEpisodeDuration(strconv.Itoa(int(d.Round(time.Second).Seconds())))
+}
+
+// viewJob renders one job's line and, while it is underway, its progress.
+func viewJob(j *downloadJob, cursor bool) string {
+	var b strings.Builder
+	mark := " "
+	if cursor {
+		mark = ">"
+	}
+	name := j.item.title
+	if j.item.podcastTitle != "" {
+		name = j.item.podcastTitle + " / " + j.item.title
+	}
+	b.WriteString(fmt.Sprintf("%s %-11s %s\n", mark, j.state, name))
+	switch j.state {
+	case dlRunning, dlPaused:
+		frac := 0.0
+		size := fmt.Sprintf("%.1f MB", float64(j.got)/1e6)
+		if j.total > 0 {
+			frac = float64(j.got) / float64(j.total)
+			size = fmt.Sprintf("%.1f/%.1f MB", float64(j.got)/1e6, float64(j.total)/1e6)
+		}
+		line := fmt.Sprintf("    %s %3.0f%%  %s", progressBar(frac, 20), frac*100, size)
+		if j.state == dlRunning && j.speed > 0 {
+			line += "  " + formatRate(j.speed)
+			if eta := j.eta(); eta > 0 {
+				line += "  ETA " + formatETA(eta)
+			}
+		}
+		b.WriteString(line + "\n")
+	case dlFailed:
+		b.WriteString(fmt.Sprintf("    %v\n", j.err))
+	case dlDone:
+		b.WriteString("    " + j.path + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestParseParallelDownloads(t *testing.T) {
+	for raw, want := range map[string]int{"1": 1, " 4 ": 4, "16": 16} {
+		if got, err := parseParallelDownloads(raw); err != nil || got != want {
+			t.Errorf("parseParallelDownloads(%q) = %d, %v, want %d", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"", "0", "17", "two"} {
+		if _, err := parseParallelDownloads(raw); err == nil {
+			t.Errorf("parseParallelDownloads(%q) accepted", raw)
+		}
+	}
+}
+
+// episodeServer serves audio with Range support, recording each request's
+// Range header.
+func episodeServer(t *testing.T, audio []byte) (*httptest.Server, *[]string) {
+	t.Helper()
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ep.mp3" {
+			http.NotFound(w, r)
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "ep.mp3", time.Time{}, bytes.NewReader(audio))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &ranges
+}
+
+func TestFetchEpisodeResumesPartialFile(t *testing.T) {
+	audio := bytes.Repeat([]byte("0123456789"), 10000)
+	srv, ranges := episodeServer(t, audio)
+	path := filepath.Join(t.TempDir(), "Pod", "ep.mp3")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A pause left the first 30000 bytes
+	if err := os.WriteFile(path+partSuffix, audio[:30000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var lastGot, lastTotal int64
+	err := fetchEpisode(context.Background(), srv.URL+"/ep.mp3", path, func(got, total int64) {
+		lastGot, lastTotal = got, total
+	})
+	if err != nil {
+		t.Fatalf("fetchEpisode: %v", err)
+	}
+	if len(*ranges) != 1 || (*ranges)[0] != "bytes=30000-" {
+		t.Fatalf("Range headers = %q, want one resume from 30000", *ranges)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil || !bytes.Equal(got, audio) {
+		t.Fatalf("downloaded %d bytes (%v), want the %d byte episode", len(got), err, len(audio))
+	}
+	if _, err := os.Stat(path + partSuffix); !os.IsNotExist(err) {
+		t.Fatalf("partial file left behind: %v", err)
+	}
+	if lastGot != int64(len(audio)) || lastTotal != int64(len(audio)) {
+		t.Fatalf("last progress = %d/%d, want %d", lastGot, lastTotal, len(audio))
+	}
+}
+
+func TestFetchEpisodeErrors(t *testing.T) {
+	srv, _ := episodeServer(t, []byte("audio"))
+	dir := t.TempDir()
+
+	missing := filepath.Join(dir, "missing.mp3")
+	err := fetchEpisode(context.Background(), srv.URL+"/nope.mp3", missing, func(int64, int64) {})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("fetchEpisode of a 404 = %v", err)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Fatalf("a failed download left a file: %v", err)
+	}
+
+	existing := filepath.Join(dir, "existing.mp3")
+	if err := os.WriteFile(existing, []byte("have it"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fetchEpisode(context.Background(), srv.URL+"/ep.mp3", existing, func(int64, int64) {}); err == nil {
+		t.Fatal("fetchEpisode overwrote an existing file")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := fetchEpisode(ctx, srv.URL+"/ep.mp3", filepath.Join(dir, "cancelled.mp3"), func(int64, int64) {}); err == nil {
+		t.Fatal("fetchEpisode ignored a cancelled context")
+	}
+}
+
+// The manager runs parallel jobs at a time, starts the next as one ends,
+// and pauses, cancels and retries single jobs.
+func TestDownloadManagerScheduling(t *testing.T) {
+	dir := t.TempDir()
+	dm := newDownloadManager(nil, 2, "", "")
+	items := []episodeItem{
+		{title: "One", filename: "one.mp3"},
+		{title: "Two", filename: "two.mp3"},
+		{title: "Three", filename: "three.mp3"},
+	}
+	added, _ := dm.add(items, dir, "Pod")
+	if added != 3 {
+		t.Fatalf("added %d, want 3", added)
+	}
+	states := func() string {
+		var s []string
+		for _, j := range dm.jobs {
+			s = append(s, j.state.String())
+		}
+		return strings.Join(s, ",")
+	}
+	if got := states(); got != "downloading,downloading,queued" {
+		t.Fatalf("after add: %s", got)
+	}
+	if again, _ := dm.add(items[:1], dir, "Pod"); again != 0 {
+		t.Fatalf("re-adding a queued episode added %d", again)
+	}
+
+	dm.finished(downloadFinishedMsg{id: 0, run: 1})
+	if got := states(); got != "done,downloading,downloading" {
+		t.Fatalf("after one finished: %s", got)
+	}
+
+	// A pause keeps the job; its late report doesn't finish it
+	dm.pause(1)
+	dm.finished(downloadFinishedMsg{id: 1, run: 1, err: context.Canceled})
+	if got := states(); got != "done,paused,downloading" {
+		t.Fatalf("after pause: %s", got)
+	}
+	dm.pause(1)
+	if got := states(); got != "done,downloading,downloading" || dm.jobs[1].run != 2 {
+		t.Fatalf("after resume: %s (run %d)", got, dm.jobs[1].run)
+	}
+
+	// Progress from the stopped run is ignored
+	dm.progress(downloadProgressMsg{id: 1, run: 1, got: 99, total: 100, at: time.Now()})
+	if dm.jobs[1].got != 0 {
+		t.Fatalf("stale progress recorded: %d", dm.jobs[1].got)
+	}
+
+	dm.cancelJob(2)
+	dm.finished(downloadFinishedMsg{id: 2, run: 1, err: context.Canceled})
+	dm.finished(downloadFinishedMsg{id: 1, run: 2, err: os.ErrPermission})
+	if got := states(); got != "done,failed,cancelled" {
+		t.Fatalf("after cancel and failure: %s", got)
+	}
+	dm.retry(2)
+	if got := states(); got != "done,failed,downloading" {
+		t.Fatalf("after retry: %s", got)
+	}
+}
+
+// A pause or cancel that lands after the fetch, while the file is being
+// tagged and recorded, doesn't undo a finished download.
+func TestDownloadManagerStopAfterFetch(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	srv, _ := episodeServer(t, bytes.Repeat([]byte{0}, 4096))
+	dir := t.TempDir()
+	dm := newDownloadManager(st, 2, "", "")
+	dm.add([]episodeItem{
+		{title: "One", url: srv.URL + "/ep.mp3", filename: buildEpisodeFilename("Pod", "One", "2024-01-05")},
+		{title: "Two", url: srv.URL + "/ep.mp3", filename: buildEpisodeFilename("Pod", "Two", "2024-01-06")},
+	}, dir, "Pod")
+
+	for id, stop := range []func(int){func(id int) { dm.pause(id) }, dm.cancelJob} {
+		j := dm.jobs[id]
+		// The run completes and its report is on its way when the key lands
+		msg := dm.start(j)().(downloadFinishedMsg)
+		if msg.err != nil {
+			t.Fatalf("job %d: %v", id, msg.err)
+		}
+		stop(id)
+		if ok, _ := dm.finished(msg); !ok || j.state != dlDone {
+			t.Fatalf("job %d: ok=%v state=%v, want done", id, ok, j.state)
+		}
+		if _, err := os.Stat(j.path); err != nil {
+			t.Fatalf("job %d: %v", id, err)
+		}
+		if dm.retry(id) != nil || j.state != dlDone {
+			t.Fatalf("job %d: retried a finished download (state %v)", id, j.state)
+		}
+	}
+	var n int
+	if err := st.q.QueryRow(`SELECT COUNT(*) FROM downloads;`).Scan(&n); err != nil || n != 2 {
+		t.Fatalf("downloads rows = %d, %v", n, err)
+	}
+}
+
+// A download through the manager is tagged, recorded in downloads and
+// marked in the episode list.
+func TestDownloadManagerDownloadsAndRecords(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	srv, _ := episodeServer(t, bytes.Repeat([]byte{0}, 4096))
+
+	m := newInteractiveModel(st, t.TempDir(), "", "")
+	filename := buildEpisodeFilename("Pod", "Episode", "2024-01-05")
+	m.allItems = []episodeItem{{title: "Episode", url: srv.URL + "/ep.mp3", filename: filename, selected: true}}
+	m.podTitle = "Pod"
+	m.rebuildVisibleItems()
+	m.step = stepFolder
+	folder := t.TempDir()
+	m.folderInput.SetValue(folder)
+
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(interactiveModel)
+	if m.step != stepDownloading || len(m.downloads.jobs) != 1 || m.selectedCount() != 0 {
+		t.Fatalf("step=%v jobs=%d selected=%d", m.step, len(m.downloads.jobs), m.selectedCount())
+	}
+
+	// Back to browsing while it runs
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("b")})
+	m = next.(interactiveModel)
+	if m.step != stepSelect || !strings.Contains(m.View(), "↓") {
+		t.Fatalf("step=%v, want the list with the episode marked downloading:\n%s", m.step, m.View())
+	}
+
+	// Run the job here rather than through the Bubble Tea runtime
+	msg := m.downloads.start(m.downloads.jobs[0])()
+	next, _ = m.Update(msg)
+	m = next.(interactiveModel)
+	if j := m.downloads.jobs[0]; j.state != dlDone {
+		t.Fatalf("job state = %v, err %v", j.state, j.err)
+	}
+	if !m.allItems[0].downloaded || !strings.Contains(m.View(), "✓") {
+		t.Fatalf("episode not marked downloaded:\n%s", m.View())
+	}
+	if _, err := os.Stat(filepath.Join(folder, filename)); err != nil {
+		t.Fatalf("downloaded file: %v", err)
+	}
+	var n int
+	if err := st.q.QueryRow(`SELECT COUNT(*) FROM downloads WHERE filename = ?;`, filename).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("downloads rows = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,454 @@
+package main
+
+// --explain: why an episode is queued, skipped or considered downloaded.
+//
+// An episode's fate in the download pass is decided in several places: the
+// "already have" scan (seeWhatPodsWeAlreadyHave: files named with the episode
+// hash, legacy files named with the file-URL hash, the archive registry, and
+// the transformed-title fallback), the prefix-owner twin backstop, and the
+// retitle rules in skip.go. explainEpisodes runs the same scan and plan the
+// download pass does (scanHave, planDownloadsFrom), then walks each check for
+// the requested episodes, reporting what it found and which one decided.
+// Nothing is written.
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// explainMaxEpisodes caps how many title matches --explain traces.
+const explainMaxEpisodes = 10
+
+// Verdicts, in the order the download pass reaches them.
+const (
+	verdictNoAudio     = "never queued: no audio enclosure"
+	verdictHave        = "already downloaded"
+	verdictTwinSkip    = "skipped: copy on disk under another hash"
+	verdictRetitleSkip = "skipped: retitle duplicate"
+	verdictNeverSkip   = "skipped: never-download override"
+	verdictQueued      = "queued for download"
+)
+
+var episodeHashRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// explainTarget is an episodes row --explain was asked about.
+type explainTarget struct {
+	episodeHash  string
+	podcastTitle string
+	title        string
+	published    string // IFNULL(published, first_seen)
+	guid         string
+	file         string
+	urlHash      string
+	season       string
+	episode      string
+}
+
+// explainStep is one check and what it found. decided marks the check that
+// settled the episode's fate; info steps are context, not checks.
+type explainStep struct {
+	check   string
+	result  string
+	decided bool
+	info    bool
+}
+
+// episodeExplanation is the trace for one episode.
+type episodeExplanation struct {
+	target  explainTarget
+	steps   []explainStep
+	verdict string
+}
+
+// findEpisodesForExplain resolves an --explain argument: an exact episode
+// hash, or else a case-insensitive substring of the episode title. Returns
+// at most limit rows.
+func (s *store) findEpisodesForExplain(query string, limit int) ([]explainTarget, error) {
+	const cols = `podcastname_episodename_hash, IFNULL(podcast_title, ''), IFNULL(title, ''),
+		IFNULL(published, IFNULL(first_seen, '')), IFNULL(guid, ''), IFNULL(file, ''),
+		IFNULL(file_url_hash, ''), IFNULL(season, ''), IFNULL(episode, '')`
+	q := strings.TrimSpace(query)
+	if q == "" {
+		return nil, fmt.Errorf("empty --explain query")
+	}
+	var sqlText string
+	var arg interface{}
+	if episodeHashRe.MatchString(strings.ToLower(q)) {
+		sqlText = `SELECT ` + cols + ` FROM episodes WHERE podcastname_episodename_hash = ? LIMIT ?;`
+		arg = strings.ToLower(q)
+	} else {
+		sqlText = `SELECT ` + cols + ` FROM episodes WHERE title LIKE ? ESCAPE '\'
+			ORDER BY IFNULL(published, first_seen) DESC LIMIT ?;`
+		arg = "%" + likeEscaper.Replace(q) + "%"
+	}
+	rows, err := s.q.Query(sqlText, arg, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]explainTarget, 0)
+	for rows.Next() {
+		var t explainTarget
+		if err := rows.Scan(&t.episodeHash, &t.podcastTitle, &t.title, &t.published, &t.guid, &t.file, &t.urlHash,
+			&t.season, &t.episode); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// downloadsForEpisode lists the downloads rows recorded for an episode hash,
+// as "filename" or "filename (tagged <when>)".
+func (s *store) downloadsForEpisode(episodeHash string) ([]string, error) {
+	rows, err := s.q.Query(`
+		SELECT filename, IFNULL(tagged_at, '')
+		FROM downloads
+		WHERE hash = ?
+		ORDER BY filename
+		;`, episodeHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]string, 0)
+	for rows.Next() {
+		var filename, taggedAt string
+		if err := rows.Scan(&filename, &taggedAt); err != nil {
+			return nil, err
+		}
+		if taggedAt != "" {
+			filename += " (tagged " + taggedAt + ")"
+		}
+		out = append(out, filename)
+	}
+	return out, rows.Err()
+}
+
+// explainEvidence is the shared state every trace reads.
+type explainEvidence struct {
+	have          haveScan
+	plan          downloadPlan
+	filesByHash   map[string][]string // hash in filename -> paths on the scan paths
+	filesByPrefix map[string][]string // name minus hash -> paths and archived basenames
+	prefixOwners  map[string]int      // name minus hash -> pending episodes owning it
+	archivedPaths map[string]string
+	skipped       map[string]skippedEpisodeRow
+	overrides     map[string]string // hash -> download override action
+	nScanPaths    int
+}
+
+// explainEpisodes traces the download decision for every episode matching
+// query (see findEpisodesForExplain).
+func explainEpisodes(s *store, query string, scanPaths []string) ([]episodeExplanation, error) {
+	targets, err := s.findEpisodesForExplain(query, explainMaxEpisodes+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no episode matches %q", query)
+	}
+	if len(targets) > explainMaxEpisodes {
+		return nil, fmt.Errorf("more than %d episodes match %q; use a longer title or the episode hash", explainMaxEpisodes, query)
+	}
+
+	ev := explainEvidence{
+		filesByHash:   make(map[string][]string),
+		filesByPrefix: make(map[string][]string),
+		prefixOwners:  make(map[string]int),
+		skipped:       make(map[string]skippedEpisodeRow),
+		nScanPaths:    len(scanPaths),
+	}
+	ev.have = scanHave(s, scanPaths)
+	ev.plan = planDownloadsFrom(s, ev.have.missing, scanPaths)
+	if ev.overrides, err = s.downloadOverrides(); err != nil {
+		return nil, err
+	}
+
+	for _, dir := range scanPaths {
+		names, err := archiveCandidatesInDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if hash, _, err := hashFromFilename(name); err == nil {
+				ev.filesByHash[hash] = append(ev.filesByHash[hash], path)
+			}
+			if nmh, ok := nameMinusHash(name); ok {
+				ev.filesByPrefix[nmh] = append(ev.filesByPrefix[nmh], path)
+			}
+		}
+	}
+	archivedNames, err := s.archivedBasenames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range archivedNames {
+		if nmh, ok := nameMinusHash(name); ok {
+			ev.filesByPrefix[nmh] = append(ev.filesByPrefix[nmh], name+" (archive registry)")
+		}
+	}
+	if ev.archivedPaths, err = s.archivedPaths(); err != nil {
+		return nil, err
+	}
+
+	queue, err := s.downloadQueue()
+	if err != nil {
+		return nil, err
+	}
+	owners := make(map[string]map[string]bool)
+	for _, row := range queue {
+		if !ev.have.missing.Contains(row.episodeHash) {
+			continue
+		}
+		canonical := row.filename()
+		if nmh, ok := nameMinusHash(canonical); ok {
+			if owners[nmh] == nil {
+				owners[nmh] = make(map[string]bool)
+			}
+			owners[nmh][row.episodeHash] = true
+		}
+	}
+	for nmh, hashes := range owners {
+		ev.prefixOwners[nmh] = len(hashes)
+	}
+
+	skipped, err := s.skippedEpisodes()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range skipped {
+		ev.skipped[r.episodeHash] = r
+	}
+
+	out := make([]episodeExplanation, 0, len(targets))
+	for _, t := range targets {
+		downloads, err := s.downloadsForEpisode(t.episodeHash)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, explainEpisode(t, ev, downloads))
+	}
+	return out, nil
+}
+
+// forcedSkip is the heuristic skip a force-download override overrode for
+// hash, if any.
+func forcedSkip(plan downloadPlan, hash string) *plannedSkip {
+	for i := range plan.forced {
+		if plan.forced[i].episodeHash == hash {
+			return &plan.forced[i]
+		}
+	}
+	return nil
+}
+
+// explainEpisode walks the checks for one episode in the order the download
+// pass applies them.
+func explainEpisode(t explainTarget, ev explainEvidence, downloads []string) episodeExplanation {
+	e := episodeExplanation{target: t}
+	add := func(check, result string, decided bool) {
+		e.steps = append(e.steps, explainStep{check: check, result: result, decided: decided})
+	}
+	info := func(check, result string) {
+		e.steps = append(e.steps, explainStep{check: check, result: result, info: true})
+	}
+	hash := t.episodeHash
+	h := ev.have
+
+	// Enclosure: rows without one never reach the queue
+	noAudio := strings.TrimSpace(t.file) == ""
+	if noAudio {
+		add("audio enclosure", "none in the feed", true)
+		e.verdict = verdictNoAudio
+	} else {
+		add("audio enclosure", t.file, false)
+	}
+	decided := noAudio
+	had := !noAudio && !h.missing.Contains(hash)
+
+	// "Already have" checks, in scanHave's order; the first hit decides
+	decide := func(hit bool) bool {
+		if hit && had && !decided {
+			decided = true
+			e.verdict = verdictHave
+			return true
+		}
+		return false
+	}
+	if paths := ev.filesByHash[hash]; len(paths) > 0 {
+		add("file named with episode hash", strings.Join(paths, ", "), decide(true))
+	} else {
+		add("file named with episode hash", fmt.Sprintf("none on %d scan path(s)", ev.nScanPaths), false)
+	}
+
+	legacyPaths := ev.filesByHash[t.urlHash]
+	legacyOwned := t.urlHash != "" && h.urlHashToEpisodeHash[t.urlHash] == hash
+	switch {
+	case t.urlHash == "":
+		add("file named with legacy file-URL hash", "no file_url_hash", false)
+	case len(legacyPaths) > 0 && legacyOwned:
+		add("file named with legacy file-URL hash "+t.urlHash, strings.Join(legacyPaths, ", "), decide(true))
+	case len(legacyPaths) > 0:
+		add("file named with legacy file-URL hash "+t.urlHash, strings.Join(legacyPaths, ", ")+
+			" (ignored: that URL hash maps to episode "+h.urlHashToEpisodeHash[t.urlHash]+")", false)
+	default:
+		add("file named with legacy file-URL hash "+t.urlHash, "none", false)
+	}
+
+	if h.archivedHashes.Contains(hash) {
+		where := ev.archivedPaths[hash]
+		if where == "" && legacyOwned {
+			where = ev.archivedPaths[t.urlHash]
+		}
+		if where == "" {
+			where = "registered (no path recorded)"
+		}
+		add("archive registry", where, decide(true))
+	} else {
+		add("archive registry", "not registered", false)
+	}
+
+	switch {
+	case !h.titleFallback:
+		add("transformed-title fallback", "not used (files on disk match db hashes)", false)
+	case had && !decided:
+		tt := h.dbHashesToTT[hash]
+		match := ""
+		for _, v := range h.filenames {
+			if fn := fmt.Sprintf("%v", v); strings.Contains(fn, tt) {
+				match = fn
+				break
+			}
+		}
+		if match == "" {
+			match = "transformed title " + tt + " matches a filename"
+		}
+		add("transformed-title fallback", match, decide(true))
+	default:
+		add("transformed-title fallback", "no filename matches "+h.dbHashesToTT[hash], false)
+	}
+
+	// Overrides come before the heuristics, and only for episodes we don't have
+	override := ev.overrides[hash]
+	switch {
+	case override == "":
+		add("download override", "none", false)
+	case override == overrideNever && !decided:
+		decided = true
+		e.verdict = verdictNeverSkip
+		add("download override", "never-download", true)
+	case !decided:
+		add("download override", "force-download: the twin backstop and retitle rules cannot skip it", false)
+	default:
+		add("download override", override+"-download (not reached)", false)
+	}
+	forced := override == overrideForce && !decided
+
+	// Twin backstop and retitle rules only see episodes we don't have
+	var overridden *plannedSkip
+	if forced {
+		overridden = forcedSkip(ev.plan, hash)
+	}
+	canonical := ""
+	if !noAudio && len(t.published) >= 10 {
+		canonical = episodeFilename(episodeNaming{podcast: t.podcastTitle, title: t.title,
+			date: shortDate(t.published), hash: hash, season: t.season, episode: t.episode})
+	}
+	nmh, nmhOK := nameMinusHash(canonical)
+	switch {
+	case !nmhOK:
+		add("twin backstop", "no canonical filename", false)
+	case len(ev.filesByPrefix[nmh]) == 0:
+		add("twin backstop", "no copy shares the prefix "+nmh, false)
+	default:
+		twin := false
+		for _, ts := range ev.plan.twinSkips {
+			if ts.episodeHash == hash {
+				twin = true
+			}
+		}
+		result := "copy shares the prefix: " + strings.Join(ev.filesByPrefix[nmh], ", ")
+		if n := ev.prefixOwners[nmh]; n > 1 {
+			result += fmt.Sprintf(" (ignored: %d pending episodes share the prefix)", n)
+		} else if overridden != nil && overridden.rule == "twin" {
+			result += " (overridden by force-download)"
+		}
+		if twin && !decided {
+			decided = true
+			e.verdict = verdictTwinSkip
+		}
+		add("twin backstop", result, twin)
+	}
+
+	var retitle *plannedSkip
+	for i := range ev.plan.retitleSkips {
+		if ev.plan.retitleSkips[i].episodeHash == hash {
+			retitle = &ev.plan.retitleSkips[i]
+		}
+	}
+	switch {
+	case overridden != nil && overridden.rule != "twin":
+		add("retitle rules (skip.go)", fmt.Sprintf("rule %s: %s (%q), overridden by force-download",
+			overridden.rule, overridden.reason, overridden.matchedTitle), false)
+	case retitle != nil && !decided:
+		decided = true
+		e.verdict = fmt.Sprintf("%s (rule %s)", verdictRetitleSkip, retitle.rule)
+		add("retitle rules (skip.go)", fmt.Sprintf("rule %s: %s (%q)", retitle.rule, retitle.reason, retitle.matchedTitle), true)
+	case had || noAudio:
+		add("retitle rules (skip.go)", "not reached", false)
+	default:
+		add("retitle rules (skip.go)", "no rule matched", false)
+	}
+
+	for _, q := range ev.plan.queued {
+		if q.episodeHash == hash && !decided {
+			decided = true
+			e.verdict = verdictQueued
+			add("download queue", "would be queued as "+q.filename, true)
+		}
+	}
+	if !decided {
+		// Defensive: every path above should have decided
+		e.verdict = "undecided"
+	}
+
+	if len(downloads) > 0 {
+		info("downloads table", strings.Join(downloads, ", "))
+	}
+	if r, ok := ev.skipped[hash]; ok {
+		result := fmt.Sprintf("last skipped %s: %s", r.lastSkipped, r.reason)
+		if r.override != "" {
+			result += " [override: " + r.override + "]"
+		}
+		info("skipped_episodes audit", result)
+	}
+	return e
+}
+
+// printExplanations writes --explain traces.
+func printExplanations(w io.Writer, explanations []episodeExplanation) {
+	for i, e := range explanations {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		t := e.target
+		fmt.Fprintf(w, "%s / %s / %s\n", publishedDate10(t.published), t.podcastTitle, t.title)
+		fmt.Fprintf(w, "  episode hash %s, guid %q\n", t.episodeHash, t.guid)
+		for _, st := range e.steps {
+			mark := "   "
+			switch {
+			case st.decided:
+				mark = "=> "
+			case st.info:
+				mark = " i "
+			}
+			fmt.Fprintf(w, "  %s%s: %s\n", mark, st.check, st.result)
+		}
+		fmt.Fprintf(w, "  verdict: %s\n", e.verdict)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExplainEpisodes(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	podDir := t.TempDir()
+
+	hashOf := func(ep string) string {
+		return fmt.Sprintf("%x", md5.Sum([]byte("Explained"+ep)))
+	}
+	podEpisodesIntoDatabase(st, map[string]string{"title": "Explained"}, []M{
+		{"title": "On disk", "guid": "g-disk", "published": "2026-01-01T10:00:00Z", "file": "https://example.com/disk.mp3"},
+		{"title": "Still pending", "guid": "g-pending", "published": "2026-01-02T10:00:00Z", "file": "https://example.com/pending.mp3"},
+		{"title": "Transcript only", "guid": "g-text", "published": "2026-01-03T10:00:00Z", "file": ""},
+		{"title": "Completely different words", "guid": "g-disk", "published": "2026-03-01T10:00:00Z", "file": "https://example.com/disk2.mp3"},
+		{"title": "Put away", "guid": "g-archived", "published": "2026-01-04T10:00:00Z", "file": "https://example.com/archived.mp3"},
+		{"title": "Old hash", "guid": "g-twin", "published": "2026-01-05T10:00:00Z", "file": "https://example.com/twin.mp3"},
+	})
+
+	touch := func(name string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(podDir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	touch(buildNonInteractiveFilename("Explained", "On disk", "2026-01-01", hashOf("On disk")))
+	twin, _ := nameMinusHash(buildNonInteractiveFilename("Explained", "Old hash", "2026-01-05", hashOf("Old hash")))
+	touch(twin + "-0123456789abcdef0123456789abcdef.mp3")
+	if err := st.upsertArchived(hashOf("Put away"), "/archive/put-away.mp3"); err != nil {
+		t.Fatalf("upsertArchived: %v", err)
+	}
+
+	cases := []struct {
+		query, verdict, decidedBy string
+	}{
+		{hashOf("On disk"), verdictHave, "file named with episode hash"},
+		{"still pend", verdictQueued, "download queue"},
+		{"transcript", verdictNoAudio, "audio enclosure"},
+		{"completely different", verdictRetitleSkip + " (rule 1)", "retitle rules (skip.go)"},
+		{"put away", verdictHave, "archive registry"},
+		{"old hash", verdictTwinSkip, "twin backstop"},
+	}
+	for _, c := range cases {
+		explanations, err := explainEpisodes(st, c.query, []string{podDir})
+		if err != nil {
+			t.Fatalf("explainEpisodes(%q): %v", c.query, err)
+		}
+		if len(explanations) != 1 {
+			t.Fatalf("%q matched %d episodes, want 1", c.query, len(explanations))
+		}
+		e := explanations[0]
+		decided := make([]string, 0)
+		for _, s := range e.steps {
+			if s.decided {
+				decided = append(decided, s.check)
+			}
+		}
+		if e.verdict != c.verdict || len(decided) != 1 || decided[0] != c.decidedBy {
+			var buf bytes.Buffer
+			printExplanations(&buf, explanations)
+			t.Fatalf("%q: verdict %q decided by %v, want %q by %q\n%s", c.query, e.verdict, decided, c.verdict, c.decidedBy, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	explanations, _ := explainEpisodes(st, "completely different", []string{podDir})
+	printExplanations(&buf, explanations)
+	if !strings.Contains(buf.String(), `"On disk"`) || !strings.Contains(buf.String(), "=> retitle rules") {
+		t.Fatalf("trace should name the matched sibling and mark the deciding rule:\n%s", buf.String())
+	}
+
+	if _, err := explainEpisodes(st, "no such episode", []string{podDir}); err == nil {
+		t.Fatal("expected an error for an unmatched query")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+// Feed snapshots: recording the feed bodies a parse fetched, and replaying
+// them later with no network.
+//
+// Reproducing an incident (the 2026-07-09 podcast rename, the 2026-07-20
+// cross-edition re-issues) needs the feeds as they were that day. With
+// --record-feeds <dir>, every feed parseFeed fetches is also saved under
+// <dir>/<run timestamp>/. With --replay-feeds <that dir>, parseFeed reads the
+// saved bodies instead of the network, so a parse, --simulate or a test can
+// re-run against the historical feeds offline.
+//
+// A snapshot dir holds one <md5 of url>.xml per feed and a feeds.tsv index
+// of "<file>\t<url>" lines for humans and for replay to report what is
+// there. Bodies are saved exactly as served, before any parsing, so replay
+// exercises the same parser code as a live run.
+
+import (
+	"bufio"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// feedSnapshotIndex names the index file in a snapshot dir.
+const feedSnapshotIndex = "feeds.tsv"
+
+// feedSnapshotFile is the file a feed's body is saved under.
+func feedSnapshotFile(url string) string {
+	return fmt.Sprintf("%x.xml", md5.Sum([]byte(url)))
+}
+
+// recordingFeedSource fetches through another source and saves each body it
+// gets into dir. A failed save is logged, not returned: recording must never
+// cost a feed its parse.
+type recordingFeedSource struct {
+	inner feedSource
+	dir   string
+	mu    sync.Mutex // serialises creating dir and appending to the index
+}
+
+// newRecordingFeedSource records into a timestamped snapshot dir under root,
+// created on the first save so a run that fetches nothing leaves no trace.
+func newRecordingFeedSource(inner feedSource, root string, now time.Time) *recordingFeedSource {
+	return &recordingFeedSource{inner: inner, dir: filepath.Join(root, now.Format("20060102-150405"))}
+}
+
+func (r *recordingFeedSource) fetch(url string) ([]byte, error) {
+	body, err := r.inner.fetch(url)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.save(url, body); err != nil {
+		log.Printf("warning: could not record feed %s: %v", url, err)
+	}
+	return body, nil
+}
+
+func (r *recordingFeedSource) save(url string, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+	name := feedSnapshotFile(url)
+	if err := os.WriteFile(filepath.Join(r.dir, name), body, 0644); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(r.dir, feedSnapshotIndex), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%s\t%s\n", name, url); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replayFeedSource serves feeds from a snapshot dir. A URL that was not
+// recorded is an error, as a failed fetch would be; it never falls back to
+// the network.
+type replayFeedSource struct {
+	dir string
+}
+
+// newReplayFeedSource checks dir is a snapshot dir and logs how many feeds
+// it holds.
+func newReplayFeedSource(dir string) (*replayFeedSource, error) {
+	f, err := os.Open(filepath.Join(dir, feedSnapshotIndex))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a feed snapshot dir: %w", dir, err)
+	}
+	defer f.Close()
+	n := 0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if strings.TrimSpace(sc.Text()) != "" {
+			n++
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	log.Printf("Replaying %d recorded feed(s) from %s", n, dir)
+	return &replayFeedSource{dir: dir}, nil
+}
+
+func (r *replayFeedSource) fetch(url string) ([]byte, error) {
+	body, err := os.ReadFile(filepath.Join(r.dir, feedSnapshotFile(url)))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no recorded snapshot of %s in %s", url, r.dir)
+	}
+	return body, err
+}
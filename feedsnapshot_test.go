@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// snapshotTestFeed renders a small RSS feed whose episodes keep their guids
+// whatever the podcast is called.
+func snapshotTestFeed(podTitle string, n int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<?xml version="1.0"?><rss version="2.0"><channel><title>%s</title><link>https://example.com</link><description>d</description>`, podTitle)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `<item><title>Episode number %d with a distinctive name</title><guid>urn:test:guid-%d</guid>`+
+			`<pubDate>Mon, %02d Jun 2026 10:00:00 GMT</pubDate><enclosure url="https://example.com/audio/%d.mp3" type="audio/mpeg" length="1"/></item>`,
+			i, i, i+1, i)
+	}
+	b.WriteString(`</channel></rss>`)
+	return b.String()
+}
+
+// setFeedFetcher swaps the global feed source for one test.
+func setFeedFetcher(t *testing.T, src feedSource) {
+	t.Helper()
+	old := feedFetcher
+	feedFetcher = src
+	t.Cleanup(func() { feedFetcher = old })
+}
+
+// Feeds recorded on one day replay offline: a rename recorded across two
+// runs is detected again from the snapshots alone.
+func TestRecordAndReplayFeeds(t *testing.T) {
+	useTempWorkingDir(t)
+	root := t.TempDir()
+
+	feedTitle := "Arts & Ideas"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/feed.rss" {
+			http.NotFound(w, r)
+			return
+		}
+		if ua := r.Header.Get("User-Agent"); ua != feedUserAgent {
+			t.Errorf("unexpected user agent %q", ua)
+		}
+		fmt.Fprint(w, snapshotTestFeed(feedTitle, 5))
+	}))
+	url := srv.URL + "/feed.rss"
+
+	day1 := time.Date(2026, 7, 8, 9, 55, 0, 0, time.UTC)
+	rec1 := newRecordingFeedSource(httpFeedSource{}, root, day1)
+	setFeedFetcher(t, rec1)
+	if _, _, err := parseFeed(url); err != nil {
+		t.Fatalf("parseFeed: %v", err)
+	}
+	if _, _, err := parseFeed(srv.URL + "/gone.rss"); err == nil || !isHttpError(err) {
+		t.Fatalf("a 404 should be an http error, got %v", err)
+	}
+
+	feedTitle = "Free Thinking"
+	rec2 := newRecordingFeedSource(httpFeedSource{}, root, day1.Add(24*time.Hour))
+	setFeedFetcher(t, rec2)
+	if _, _, err := parseFeed(url); err != nil {
+		t.Fatalf("parseFeed: %v", err)
+	}
+	srv.Close()
+
+	if rec1.dir != filepath.Join(root, "20260708-095500") {
+		t.Fatalf("unexpected snapshot dir %s", rec1.dir)
+	}
+	index, err := os.ReadFile(filepath.Join(rec1.dir, feedSnapshotIndex))
+	if err != nil {
+		t.Fatalf("read index: %v", err)
+	}
+	if string(index) != feedSnapshotFile(url)+"\t"+url+"\n" {
+		t.Fatalf("index should list only the fetched feed, got %q", index)
+	}
+
+	// Offline from here on
+	st := openTestStore(t)
+	for _, dir := range []string{rec1.dir, rec2.dir} {
+		src, err := newReplayFeedSource(dir)
+		if err != nil {
+			t.Fatalf("newReplayFeedSource: %v", err)
+		}
+		setFeedFetcher(t, src)
+		pod, episodes, err := parseFeed(url)
+		if err != nil {
+			t.Fatalf("replay parseFeed: %v", err)
+		}
+		podEpisodesIntoDatabase(st, pod, episodes)
+	}
+	titles, err := st.episodePodcastTitles()
+	if err != nil {
+		t.Fatalf("episodePodcastTitles: %v", err)
+	}
+	if len(titles) != 1 || titles[0] != "Free Thinking" {
+		t.Fatalf("replayed rename not applied in place: %v", titles)
+	}
+
+	if _, _, err := parseFeed(srv.URL + "/never-recorded.rss"); err == nil || !strings.Contains(err.Error(), "no recorded snapshot") {
+		t.Fatalf("expected a missing-snapshot error, got %v", err)
+	}
+	if _, err := newReplayFeedSource(root); err == nil {
+		t.Fatal("a dir without an index should not replay")
+	}
+}
@@ -8,12 +8,14 @@
 package main
 
 import (
-	"database/sql"
 	"errors"
 	"fmt"
 	logger "log"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -30,6 +32,7 @@ const confFile = gopodder + ".conf"
 const dbFileName = gopodder + ".sqlite"
 const confVarEnvName = "GOPODCONF"
 const pathVarEnvName = "GOPODDIR"
+const dbVarEnvName = "GOPODDB"
 const archivesVarEnvName = "GOPODDIR_ARCHIVES"
 const sqlite3 = "sqlite3" // Used with sql.Open
 const author = "author"
@@ -39,6 +42,9 @@ const language_ = "language"
 const link = "link"
 const title = "title"
 const episode = "episode"
+const season = "season"
+const duration = "duration"
+const fileSize = "file_size"
 const file = "file"
 const format = "format"
 const guid = "guid"
@@ -95,8 +101,14 @@ func readConfig(confFilePath string) ([]string, error) {
 
 	s := strings.Split(string(content), "\n")
 
-	// Want to look through the slices and only keep those that have http in them
+	// Want to look through the slices and only keep those that have http in them;
+	// "name = value" settings lines (see readConfigSettings) are not feeds even
+	// if the value happens to be a URL, and nor are comments (which is how a
+	// feed is paused; see subscriptions.go)
 	for i := range s {
+		if configSettingRe.MatchString(s[i]) || strings.HasPrefix(strings.TrimSpace(s[i]), "#") {
+			continue
+		}
 		if strings.Contains(s[i], "http") {
 			validated = append(validated, s[i])
 		}
@@ -110,10 +122,97 @@ func readConfig(confFilePath string) ([]string, error) {
 	return validated, nil
 }
 
+// configSettingRe matches a "name = value" settings line in the config file,
+// e.g. "db = /home/user/podcasts/gopodder.sqlite".
+var configSettingRe = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_.]*)\s*=\s*(.*?)\s*$`)
+
+// readConfigSettings returns the "name = value" lines of the config file as a
+// map. Feed URL lines are ignored, as are lines starting with #. A missing
+// config file is not an error: every setting has a default.
+func readConfigSettings(confFilePath string) (map[string]string, error) {
+	settings := make(map[string]string)
+	content, err := os.ReadFile(confFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if m := configSettingRe.FindStringSubmatch(line); m != nil {
+			settings[m[1]] = m[2]
+		}
+	}
+	return settings, nil
+}
+
+// resolveDbPath decides, once per run, which database every subsystem uses:
+// the --db flag, else $GOPODDB, else a "db = <path>" line in the config file
+// (relative paths are taken relative to the config dir), else gopodder.sqlite
+// next to the config file. Returns the absolute path and where it came from.
+//
+// Previously every function opened gopodder.sqlite relative to the current
+// directory, so running from the wrong directory silently created a fresh
+// empty db and queued every episode in every feed for download. A db left
+// there by an older version is still used, with a notice, as long as there
+// is none next to the config file.
+func resolveDbPath(flagPath, envPath string, settings map[string]string, confFilePath string) (string, string, error) {
+	var path, source string
+	switch {
+	case strings.TrimSpace(flagPath) != "":
+		path, source = strings.TrimSpace(flagPath), "--db"
+	case strings.TrimSpace(envPath) != "":
+		path, source = strings.TrimSpace(envPath), "$"+dbVarEnvName
+	case strings.TrimSpace(settings["db"]) != "":
+		path, source = expandHome(strings.TrimSpace(settings["db"])), confFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(confFilePath, path)
+		}
+	default:
+		path, source = filepath.Join(confFilePath, dbFileName), "default"
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			if _, err := os.Stat(dbFileName); err == nil {
+				path, source = dbFileName, "working directory"
+				log.Printf("Note: using ./%s; the default is now %s, move it there or set db in %s", dbFileName, filepath.Join(confFilePath, dbFileName), confFile)
+			}
+		}
+	}
+	abs, err := filepath.Abs(expandHome(path))
+	if err != nil {
+		return "", source, err
+	}
+	return abs, source, nil
+}
+
+// checkDbExists refuses to run against a database file that isn't there
+// unless init is set: sql.Open would happily create an empty one, and an empty
+// db makes every episode in every feed look new.
+func checkDbExists(dbFile string, init bool) error {
+	info, err := os.Stat(dbFile)
+	if err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("database path %s is a directory", dbFile)
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if init {
+		log.Printf("database %s does not exist; creating it (--init)", dbFile)
+		return nil
+	}
+	return fmt.Errorf("database %s does not exist; pass --init to create a new one (or set --db / $%s)", dbFile, dbVarEnvName)
+}
+
 // hashFromFilename returns the hash and transformed title parts from the filename.
 // Example filename: "My_Podcast-2024-01-02-Episode_Title-abc123def.mp3"
+// Any directories a filename template added are ignored.
 func hashFromFilename(filename string) (string, string, error) {
-	parsedA := strings.ReplaceAll(filename, ".", "-")
+	parsedA := strings.ReplaceAll(path.Base(filepath.ToSlash(filename)), ".", "-")
 	parsedB := strings.Split(parsedA, "-")
 	nParsedB := len(parsedB)
 	if nParsedB < 3 {
@@ -127,7 +226,10 @@ func hashFromFilename(filename string) (string, string, error) {
 // nameMinusHash strips the trailing -<hash>.mp3 from a podcast filename,
 // returning the Podcast-YYYY-MM-DD-Title prefix that identifies an episode
 // regardless of which hash scheme (file-URL era or episode) named the file.
+// Directories are dropped, so the prefix is the same whichever layout the
+// file sits in.
 func nameMinusHash(filename string) (string, bool) {
+	filename = path.Base(filepath.ToSlash(filename))
 	base := strings.TrimSuffix(filename, "."+mp3)
 	if base == filename {
 		return "", false
@@ -146,7 +248,7 @@ func nameMinusHash(filename string) (string, bool) {
 // shares with the canonical filename. Prefix equality includes podcast and
 // publication date, so the digit-stripping in titleTransformation cannot
 // conflate e.g. "Part 1"/"Part 2" episodes published on different days.
-func fetchHaveNamesMinusHash(scanPaths []string) mapset.Set {
+func fetchHaveNamesMinusHash(s *store, scanPaths []string) mapset.Set {
 	out := mapset.NewSet()
 	add := func(name string) {
 		if nmh, ok := nameMinusHash(name); ok {
@@ -160,29 +262,24 @@ func fetchHaveNamesMinusHash(scanPaths []string) mapset.Set {
 			add(name)
 		}
 	}
-	for _, name := range fetchArchivedBasenames() {
+	archived, err := s.archivedBasenames()
+	checkErr(err)
+	for _, name := range archived {
 		add(name)
 	}
 	return out
 }
 
-// sensibleFilesInDir returns a set of filenames that we identify as podcasts
-// Assumes .mp3 only
+// sensibleFilesInDir returns a set of filenames that we identify as podcasts,
+// relative to path (see archiveCandidatesInDir). Assumes .mp3 only
 func sensibleFilesInDir(path string) mapset.Set {
 	filenamesSet := mapset.NewSet()
 
-	files, err := os.ReadDir(path)
+	files, err := archiveCandidatesInDir(path)
 	checkErr(err)
 
-	// Put all the filenames into a set
-	for _, file := range files {
-		filename := file.Name()
-		if filename[:2] != "._" {
-			// Count the number of '-' occurrences because if not (5 and filename contains mp3) then not a well formed filename
-			if strings.Count(filename, "-") == 5 && strings.Contains(filename, mp3) {
-				filenamesSet.Add(filename)
-			}
-		}
+	for _, filename := range files {
+		filenamesSet.Add(filename)
 	}
 
 	return filenamesSet
@@ -202,93 +299,48 @@ func scanLocalPodFiles(paths []string) (hashSet, filenamesSet, ttsInFileNames ma
 	ttToHashes = make(map[string]string)
 
 	for _, path := range paths {
-		files, err := os.ReadDir(path)
+		files, err := archiveCandidatesInDir(path)
 		checkErr(err)
 
-		for _, file := range files {
-			filename := file.Name()
-			if len(filename) < 2 || filename[:2] == "._" {
+		for _, filename := range files {
+			hash, transformedTitle, err := hashFromFilename(filename)
+			if err != nil {
+				log.Printf("skipping file %s: %v", filename, err)
 				continue
 			}
-			if strings.Count(filename, "-") == 5 && strings.Contains(filename, mp3) {
-				hash, transformedTitle, err := hashFromFilename(filename)
-				if err != nil {
-					log.Printf("skipping file %s: %v", filename, err)
-					continue
-				}
-				hashSet.Add(hash)
-				filenamesSet.Add(filename)
-				hashesToTT[hash] = transformedTitle
-				ttToHashes[transformedTitle] = hash
-				ttsInFileNames.Add(transformedTitle)
-			}
+			hashSet.Add(hash)
+			filenamesSet.Add(filename)
+			hashesToTT[hash] = transformedTitle
+			ttToHashes[transformedTitle] = hash
+			ttsInFileNames.Add(transformedTitle)
 		}
 	}
 	return
 }
 
 // fetchDbEpisodeHashes queries the database for episode hashes and returns sets/maps for comparison.
-func fetchDbEpisodeHashes(dbFile string) (dbHashSet, transformedTitlesSet mapset.Set, hashesToEpInfo, ttToHashes, hashesToTT map[string]string) {
+func fetchDbEpisodeHashes(s *store) (dbHashSet, transformedTitlesSet mapset.Set, hashesToEpInfo, ttToHashes, hashesToTT map[string]string) {
 	dbHashSet = mapset.NewSet()
 	transformedTitlesSet = mapset.NewSet()
 	hashesToEpInfo = make(map[string]string)
 	ttToHashes = make(map[string]string)
 	hashesToTT = make(map[string]string)
 
-	db, err := sql.Open(sqlite3, dbFile)
-	checkErr(err)
-
-	if err == nil {
-		defer db.Close()
-	}
-
-	query := `SELECT podcast_title, title, podcastname_episodename_hash FROM episodes WHERE file IS NOT NULL AND file !='';`
-	rows, err := db.Query(query)
+	episodes, err := s.episodesWithFiles()
 	checkErr(err)
 
-	for rows.Next() {
-		var podcastTitle, title, episodeHash string
-		err = rows.Scan(&podcastTitle, &title, &episodeHash)
-		checkErr(err)
-
-		transformedTitle := titleTransformation(title)
+	for _, e := range episodes {
+		transformedTitle := titleTransformation(e.title)
 		transformedTitlesSet.Add(transformedTitle)
-		ttToHashes[transformedTitle] = episodeHash
-		hashesToTT[episodeHash] = transformedTitle
+		ttToHashes[transformedTitle] = e.episodeHash
+		hashesToTT[e.episodeHash] = transformedTitle
 
-		dbHashSet.Add(episodeHash)
-		hashesToEpInfo[episodeHash] = fmt.Sprintf("%s: %s", podcastTitle, title)
+		dbHashSet.Add(e.episodeHash)
+		hashesToEpInfo[e.episodeHash] = fmt.Sprintf("%s: %s", e.podcastTitle, e.title)
 	}
 	return
 }
 
-// fetchLegacyURLHashMap returns a map from file_url_hash to
-// podcastname_episodename_hash for every episode in the db. Files downloaded
-// under the legacy filename scheme carry the file-URL hash in their name, so
-// this map lets us recognise them as already-downloaded episodes.
-func fetchLegacyURLHashMap(dbFile string) map[string]string {
-	urlHashToEpisodeHash := make(map[string]string)
-
-	db, err := sql.Open(sqlite3, dbFile)
-	checkErr(err)
-
-	if err == nil {
-		defer db.Close()
-	}
-
-	query := `SELECT file_url_hash, podcastname_episodename_hash FROM episodes WHERE file_url_hash IS NOT NULL AND file_url_hash != '';`
-	rows, err := db.Query(query)
-	checkErr(err)
-
-	for rows.Next() {
-		var urlHash, episodeHash string
-		err = rows.Scan(&urlHash, &episodeHash)
-		checkErr(err)
-		urlHashToEpisodeHash[urlHash] = episodeHash
-	}
-	return urlHashToEpisodeHash
-}
-
 // addEpisodeHashesForLegacyFiles adds the corresponding episode hash for any
 // member of hashes that is actually a legacy file-URL hash, so that files
 // named under the legacy scheme count as having their episode present.
@@ -332,27 +384,47 @@ func matchByTransformedTitle(candidates mapset.Set, ttToHashes map[string]string
 	}
 }
 
-// seeWhatPodsWeAlreadyHave will check the db against files we already have.
-// scanPaths is the list of directories to scan: typically [podcastsDir] plus
-// any extras from $GOPODDIR_ARCHIVES. Hashes registered in archived_episodes
-// (see Option B / --register-archive) are also treated as "already have".
-func seeWhatPodsWeAlreadyHave(dbFile string, scanPaths []string) mapset.Set {
+// haveScan is what the download pass knows about the episodes we already
+// have. seeWhatPodsWeAlreadyHave reports it; --explain reads the same
+// evidence.
+type haveScan struct {
+	fileHashes           mapset.Set        // hashes named on the scan paths, legacy URL hashes translated
+	archivedHashes       mapset.Set        // archived_episodes, legacy URL hashes translated
+	dbHashes             mapset.Set        // episodes rows with a file
+	hashesToEpInfo       map[string]string // hash -> "podcast: title"
+	dbHashesToTT         map[string]string // hash -> transformed title, db first
+	titleFallback        bool              // the transformed-title fallback ran
+	filenames            []interface{}     // podcast filenames on the scan paths
+	urlHashToEpisodeHash map[string]string
+	missing              mapset.Set // in the db and not had: the download candidates
+}
+
+// scanHave checks the db against files we already have. scanPaths is the
+// list of directories to scan: typically [podcastsDir] plus any extras from
+// $GOPODDIR_ARCHIVES. Hashes registered in archived_episodes (see Option B /
+// --register-archive) are also treated as "already have".
+func scanHave(s *store, scanPaths []string) haveScan {
+	var h haveScan
+
 	// Scan local files (across primary + archive scan paths)
 	fileHashSet, filenamesSet, ttsInFileNames, localHashesToTT, localTTToHashes := scanLocalPodFiles(scanPaths)
-	filenamesSlice := filenamesSet.ToSlice()
+	h.filenames = filenamesSet.ToSlice()
 
 	// DB-backed archive registry: hashes here count as "already have" even if
 	// the corresponding file isn't visible on any current scan path.
-	archivedHashSet := fetchArchivedHashes()
+	archivedHashSet, err := s.archivedHashes()
+	checkErr(err)
 
 	// Fetch DB episode hashes
-	dbHashSet, _, hashesToEpInfo, dbTTToHashes, dbHashesToTT := fetchDbEpisodeHashes(dbFile)
+	dbHashSet, _, hashesToEpInfo, dbTTToHashes, dbHashesToTT := fetchDbEpisodeHashes(s)
 
 	// Files downloaded before the episode-hash filename scheme are named with
 	// the md5 of the file URL instead. Translate any such hash (on disk or in
 	// the archive registry) to its episode hash so those episodes count as
-	// already downloaded rather than being fetched again.
-	urlHashToEpisodeHash := fetchLegacyURLHashMap(dbFile)
+	// already downloaded rather than being fetched again. Legacy files carry
+	// the file-URL hash in their name; legacyURLHashes maps it back.
+	urlHashToEpisodeHash, err := s.legacyURLHashes()
+	checkErr(err)
 	addEpisodeHashesForLegacyFiles(fileHashSet, urlHashToEpisodeHash)
 	addEpisodeHashesForLegacyFiles(archivedHashSet, urlHashToEpisodeHash)
 
@@ -368,26 +440,43 @@ func seeWhatPodsWeAlreadyHave(dbFile string, scanPaths []string) mapset.Set {
 		}
 	}
 
-	fmt.Printf(
-		"\n%d db hashes %d filename hashes %d archived hashes %d map between the two\n",
-		dbHashSet.Cardinality(),
-		fileHashSet.Cardinality(),
-		archivedHashSet.Cardinality(),
-		len(hashesToEpInfo),
-	)
-
 	// Whatever is in the db that we do not have on disk and is not registered as archived
 	haveHashSet := fileHashSet.Union(archivedHashSet)
 	inDbNotInFileSet := dbHashSet.Difference(haveHashSet)
-	fmt.Printf("\n%d in db and not on disk or registered as archived\n\n", inDbNotInFileSet.Cardinality())
 
 	// Backwards-compatibility fallback: only use title matching if there are
 	// local new-scheme files but none of them matched a db hash.
 	if fileHashSet.Cardinality() > 0 && inDbNotInFileSet.Cardinality() == dbHashSet.Cardinality() {
-		matchByTransformedTitle(inDbNotInFileSet, dbHashesToTT, filenamesSlice, ttsInFileNames)
-	}
+		h.titleFallback = true
+		matchByTransformedTitle(inDbNotInFileSet, dbHashesToTT, h.filenames, ttsInFileNames)
+	}
+
+	h.fileHashes = fileHashSet
+	h.archivedHashes = archivedHashSet
+	h.dbHashes = dbHashSet
+	h.hashesToEpInfo = hashesToEpInfo
+	h.dbHashesToTT = dbHashesToTT
+	h.urlHashToEpisodeHash = urlHashToEpisodeHash
+	h.missing = inDbNotInFileSet
+	return h
+}
+
+// seeWhatPodsWeAlreadyHave runs scanHave and reports what it found,
+// returning the pod episodes we want to download.
+func seeWhatPodsWeAlreadyHave(s *store, scanPaths []string) mapset.Set {
+	h := scanHave(s, scanPaths)
+
+	fmt.Printf(
+		"\n%d db hashes %d filename hashes %d archived hashes %d map between the two\n",
+		h.dbHashes.Cardinality(),
+		h.fileHashes.Cardinality(),
+		h.archivedHashes.Cardinality(),
+		len(h.hashesToEpInfo),
+	)
+	fmt.Printf("\n%d in db and not on disk or registered as archived\n\n",
+		h.dbHashes.Difference(h.fileHashes.Union(h.archivedHashes)).Cardinality())
 
-	inDbNotInFileSlice := inDbNotInFileSet.ToSlice()
+	inDbNotInFileSlice := h.missing.ToSlice()
 	nInDbNotInFileSlice := len(inDbNotInFileSlice)
 
 	if nInDbNotInFileSlice > 0 {
@@ -399,8 +488,8 @@ func seeWhatPodsWeAlreadyHave(dbFile string, scanPaths []string) mapset.Set {
 	counter := 0
 	for _, v := range inDbNotInFileSlice {
 		hash := fmt.Sprintf("%v", v)
-		title := hashesToEpInfo[hash]
-		tTitle := dbHashesToTT[hash]
+		title := h.hashesToEpInfo[hash]
+		tTitle := h.dbHashesToTT[hash]
 
 		fmt.Printf("%s (%s) (db hash %s)\n", title, tTitle, hash)
 
@@ -416,38 +505,77 @@ func seeWhatPodsWeAlreadyHave(dbFile string, scanPaths []string) mapset.Set {
 	}
 
 	// Return the pod episodes we want to download
-	return inDbNotInFileSet
+	return h.missing
 }
 
-// generateDownloadList generates download script based on the pods to download.
-// podcastsDir is the primary podcasts directory (and where download_pods.sh is
-// written). scanPaths is the full set of directories to scan when deciding
-// what's already downloaded — typically [podcastsDir, ...archives].
-// Returns true if there are podcasts to download, false otherwise.
-func generateDownloadList(podcastsDir string, scanPaths []string) bool {
-	hashes := seeWhatPodsWeAlreadyHave(dbFileName, scanPaths)
-
-	log.Println("Pods for download are")
+// queuedDownload is an episode the download plan would fetch.
+type queuedDownload struct {
+	episodeHash string
+	filename    string
+	url         string
+}
 
-	// Some entries have no associated file
-	// e.g. RSS feed for Risky Talk podcast includes transcripts where the file tag is empty
+// twinSkip is an episode the download plan leaves out because a copy is
+// already on disk under another hash.
+type twinSkip struct {
+	episodeHash string
+	filename    string
+}
 
-	// The ifnull takes first_seen if published is null
-	// this sensibly handles the case where the published tag is not provided in the feed
-	query := `SELECT podcast_title, IFNULL(published, first_seen), title, podcastname_episodename_hash, file_url_hash, file, IFNULL(guid, ''), IFNULL(first_seen, ''), IFNULL(last_seen, '') FROM episodes WHERE file != '' AND file IS NOT NULL;`
+// plannedSkip is a skipped_episodes audit entry the download plan makes: a
+// retitle duplicate (see skip.go), a never-download override, or a heuristic
+// skip that a force-download override overrode.
+type plannedSkip struct {
+	skippedEpisodeRecord
+	rule     string // the skip.go rule, or "twin" for the twin backstop
+	filename string
+}
 
-	db, err := sql.Open(sqlite3, dbFileName)
-	checkErr(err)
+// twinSkipReason is the audit reason for a forced twin-backstop skip.
+const twinSkipReason = "twin: copy on disk under another hash"
+
+// downloadPlan is what generateDownloadList would queue and skip, worked out
+// without writing anything.
+type downloadPlan struct {
+	queued        []queuedDownload
+	twinSkips     []twinSkip
+	retitleSkips  []plannedSkip
+	overrideSkips []plannedSkip // never-download overrides
+	forced        []plannedSkip // queued by a force-download override despite a heuristic skip
+}
 
-	if err == nil {
-		defer db.Close()
+// auditRecords is everything the plan records in skipped_episodes.
+func (p downloadPlan) auditRecords() []skippedEpisodeRecord {
+	out := make([]skippedEpisodeRecord, 0, len(p.retitleSkips)+len(p.overrideSkips)+len(p.forced))
+	for _, group := range [][]plannedSkip{p.retitleSkips, p.overrideSkips, p.forced} {
+		for _, r := range group {
+			out = append(out, r.skippedEpisodeRecord)
+		}
 	}
+	return out
+}
+
+// planDownloads decides which pending episodes to download. scanPaths is the
+// full set of directories to scan when deciding what's already downloaded —
+// typically [podcastsDir, ...archives]. It reads the db and the scan paths
+// only; generateDownloadList and --simulate act on the result.
+func planDownloads(s *store, scanPaths []string) downloadPlan {
+	return planDownloadsFrom(s, seeWhatPodsWeAlreadyHave(s, scanPaths), scanPaths)
+}
 
-	rows, err := db.Query(query)
+// planDownloadsFrom plans from an already-computed set of missing episode
+// hashes (see scanHave).
+func planDownloadsFrom(s *store, hashes mapset.Set, scanPaths []string) downloadPlan {
+	episodeRows, err := s.downloadQueue()
 	checkErr(err)
 
-	filenames := make([]string, 0)
-	urls := make([]string, 0)
+	plan := downloadPlan{
+		queued:        make([]queuedDownload, 0),
+		twinSkips:     make([]twinSkip, 0),
+		retitleSkips:  make([]plannedSkip, 0),
+		overrideSkips: make([]plannedSkip, 0),
+		forced:        make([]plannedSkip, 0),
+	}
 
 	// Twin backstop: episodes whose only surviving copy sits under an old
 	// hash (a rotated file URL, or a keeper the dedup script left legacy-
@@ -461,31 +589,16 @@ func generateDownloadList(podcastsDir string, scanPaths []string) bool {
 	// ambiguous prefix would silently never download one of the parts. Two
 	// passes: first count distinct episodes per prefix, then skip only on
 	// prefixes with exactly one owner.
-	haveNamesMinusHash := fetchHaveNamesMinusHash(scanPaths)
+	haveNamesMinusHash := fetchHaveNamesMinusHash(s, scanPaths)
 
-	type episodeRow struct {
-		podcastTitle, published, title, episodeHash, file string
-		guid, firstSeen, lastSeen                         string
-	}
-	episodeRows := make([]episodeRow, 0)
 	prefixOwners := make(map[string]map[string]bool)
-
-	for rows.Next() {
-		// Data from db
-		var podcastTitle, published, title, podcastNameEpisodenameHash, fileUrlHash, file string
-		var guid, firstSeen, lastSeen string
-		err = rows.Scan(&podcastTitle, &published, &title, &podcastNameEpisodenameHash, &fileUrlHash, &file, &guid, &firstSeen, &lastSeen)
-		checkErr(err)
-		_ = fileUrlHash
-
-		episodeRows = append(episodeRows, episodeRow{podcastTitle, published, title, podcastNameEpisodenameHash, file, guid, firstSeen, lastSeen})
-
-		canonical := buildNonInteractiveFilename(podcastTitle, title, published, podcastNameEpisodenameHash)
+	for _, row := range episodeRows {
+		canonical := row.filename()
 		if nmh, ok := nameMinusHash(canonical); ok {
 			if prefixOwners[nmh] == nil {
 				prefixOwners[nmh] = make(map[string]bool)
 			}
-			prefixOwners[nmh][podcastNameEpisodenameHash] = true
+			prefixOwners[nmh][row.episodeHash] = true
 		}
 	}
 
@@ -510,48 +623,102 @@ func generateDownloadList(podcastsDir string, scanPaths []string) bool {
 		})
 	}
 	retitleSkips := planDownloadSkips(skipCands)
-	skipRecords := make([]skippedEpisodeRecord, 0)
 
-	twinsSkipped := 0
-	retitlesSkipped := 0
+	// Manual overrides come before the heuristics: never beats everything,
+	// force beats the twin backstop and the retitle rules (see overrides.go).
+	overrides, err := s.downloadOverrides()
+	checkErr(err)
+
 	for _, row := range episodeRows {
 		// If file_url_hash in hashes ...
 		if hashes.Contains(row.episodeHash) {
-			newFilename := buildNonInteractiveFilename(row.podcastTitle, row.title, row.published, row.episodeHash)
-			if nmh, ok := nameMinusHash(newFilename); ok && haveNamesMinusHash.Contains(nmh) && len(prefixOwners[nmh]) == 1 {
-				log.Printf("skipping %s: already have a copy under another hash", newFilename)
-				twinsSkipped++
+			newFilename := row.filename()
+			record := skippedEpisodeRecord{
+				episodeHash:  row.episodeHash,
+				podcastTitle: row.podcastTitle,
+				title:        row.title,
+				guid:         row.guid,
+			}
+			action := overrides[row.episodeHash]
+			if action == overrideNever {
+				record.reason = overrideNeverReason
+				record.override = overrideNever
+				plan.overrideSkips = append(plan.overrideSkips, plannedSkip{skippedEpisodeRecord: record, filename: newFilename})
 				continue
 			}
-			if s, ok := retitleSkips[row.episodeHash]; ok {
-				log.Printf("skipping %s: %s (%q)", newFilename, s.reason, s.matchedTitle)
-				retitlesSkipped++
-				skipRecords = append(skipRecords, skippedEpisodeRecord{
-					episodeHash:  row.episodeHash,
-					podcastTitle: row.podcastTitle,
-					title:        row.title,
-					guid:         row.guid,
-					matchedHash:  s.matchedHash,
-					matchedTitle: s.matchedTitle,
-					reason:       s.reason,
+
+			nmh, ok := nameMinusHash(newFilename)
+			twin := ok && haveNamesMinusHash.Contains(nmh) && len(prefixOwners[nmh]) == 1
+			skip, retitle := retitleSkips[row.episodeHash]
+			switch {
+			case action == overrideForce && (twin || retitle):
+				// Queue it anyway; the audit keeps what the heuristic said
+				record.override = overrideForce
+				forced := plannedSkip{skippedEpisodeRecord: record, rule: "twin", filename: newFilename}
+				forced.reason = twinSkipReason
+				if !twin {
+					forced.rule = skip.rule
+					forced.matchedHash = skip.matchedHash
+					forced.matchedTitle = skip.matchedTitle
+					forced.reason = skip.reason
+				}
+				plan.forced = append(plan.forced, forced)
+			case twin:
+				plan.twinSkips = append(plan.twinSkips, twinSkip{episodeHash: row.episodeHash, filename: newFilename})
+				continue
+			case retitle:
+				record.matchedHash = skip.matchedHash
+				record.matchedTitle = skip.matchedTitle
+				record.reason = skip.reason
+				plan.retitleSkips = append(plan.retitleSkips, plannedSkip{
+					skippedEpisodeRecord: record,
+					rule:                 skip.rule,
+					filename:             newFilename,
 				})
 				continue
 			}
-			filenames = append(filenames, newFilename)
-			urls = append(urls, row.file)
+			plan.queued = append(plan.queued, queuedDownload{episodeHash: row.episodeHash, filename: newFilename, url: row.file})
 		}
 	}
+	return plan
+}
+
+// generateDownloadList generates download script based on the pods to download.
+// podcastsDir is the primary podcasts directory (and where download_pods.sh is
+// written); scanPaths is as for planDownloads.
+// Returns true if there are podcasts to download, false otherwise.
+func generateDownloadList(s *store, podcastsDir string, scanPaths []string) bool {
+	plan := planDownloads(s, scanPaths)
+
+	log.Println("Pods for download are")
 
-	if twinsSkipped > 0 {
-		log.Printf("skipped %d episode(s) already present under another hash", twinsSkipped)
+	for _, t := range plan.twinSkips {
+		log.Printf("skipping %s: already have a copy under another hash", t.filename)
+	}
+	for _, r := range plan.retitleSkips {
+		log.Printf("skipping %s: %s (%q)", r.filename, r.reason, r.matchedTitle)
+	}
+	for _, r := range plan.overrideSkips {
+		log.Printf("skipping %s: never-download override", r.filename)
+	}
+	for _, r := range plan.forced {
+		log.Printf("queueing %s despite %q: force-download override", r.filename, r.reason)
+	}
+	if n := len(plan.twinSkips); n > 0 {
+		log.Printf("skipped %d episode(s) already present under another hash", n)
 	}
-	if retitlesSkipped > 0 {
-		log.Printf("skipped %d episode(s) as retitle duplicates (recorded in skipped_episodes)", retitlesSkipped)
+	if n := len(plan.retitleSkips); n > 0 {
+		log.Printf("skipped %d episode(s) as retitle duplicates (recorded in skipped_episodes)", n)
 	}
-	if err := recordSkippedEpisodes(skipRecords); err != nil {
+	if err := s.recordSkippedEpisodes(plan.auditRecords()); err != nil {
 		log.Printf("warning: could not record skipped episodes: %v", err)
 	}
 
+	filenames := make([]string, 0, len(plan.queued))
+	for _, q := range plan.queued {
+		filenames = append(filenames, q.filename)
+	}
+
 	// some output to keep user informed
 	printSome(filenames)
 
@@ -560,8 +727,8 @@ func generateDownloadList(podcastsDir string, scanPaths []string) bool {
 
 	// slice of strings for the script lines
 	lines := make([]string, 0)
-	for i := range filenames {
-		lines = append(lines, genScriptLine(urls[i], filenames[i]))
+	for _, q := range plan.queued {
+		lines = append(lines, genScriptLine(q.url, q.filename))
 	}
 
 	if len(lines) == 0 {
@@ -578,7 +745,7 @@ func generateDownloadList(podcastsDir string, scanPaths []string) bool {
 	linesJoined := strings.Join(lines, "\n")
 
 	// Potential addition: permissions should probably be narrower
-	err = os.WriteFile(filename, []byte(linesJoined), 0666)
+	err := os.WriteFile(filename, []byte(linesJoined), 0666)
 	checkErr(err)
 
 	log.Printf("Written script to %s", filename)
@@ -586,13 +753,16 @@ func generateDownloadList(podcastsDir string, scanPaths []string) bool {
 }
 
 func buildNonInteractiveFilename(podcastTitle, episodeTitle, publishedOrFirstSeen, podcastHash string) string {
-	shortDateA := []rune(publishedOrFirstSeen)
-	shortDate := string(shortDateA[:10])
-	return buildEpisodeFilenameWithHash(podcastTitle, episodeTitle, shortDate, podcastHash)
+	return buildEpisodeFilenameWithHash(podcastTitle, episodeTitle, shortDate(publishedOrFirstSeen), podcastHash)
+}
+
+// shortDate is the YYYY-MM-DD part of a published or first_seen timestamp.
+func shortDate(publishedOrFirstSeen string) string {
+	return string([]rune(publishedOrFirstSeen)[:10])
 }
 
 // stripTagsWithEyeD3 runs the eyeD3 command to strip tags from the mp3 file
-func stripTagsWithEyeD3(filename string, pythonInterpreterPath string, eyeD3Path string) {
+func stripTagsWithEyeD3(filename string, pythonInterpreterPath string, eyeD3Path string) error {
 	// string with path to 'binary'
 	t := eyeD3Path + "/" + eyeD3
 	eyeD3Path = t
@@ -605,15 +775,15 @@ func stripTagsWithEyeD3(filename string, pythonInterpreterPath string, eyeD3Path
 	// eyeD3 writes informational messages (e.g. "No ID3 v1.x/v2.x tag found!")
 	// to stderr; route them to stdout so they're captured when stdout is redirected
 	cmd.Stderr = os.Stdout
-	err := cmd.Run()
-	checkErr(err)
+	if err := cmd.Run(); err != nil {
+		return err
+	}
 
 	fmt.Printf("Removing tags with %s:", eyeD3)
 	cmd = exec.Command(pythonInterpreterPath, eyeD3Path, "--remove-all", filename)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stdout
-	err = cmd.Run()
-	checkErr(err)
+	return cmd.Run()
 }
 
 // runDownloadScript run the download script with the wget commands to download the pods
@@ -634,7 +804,7 @@ func runDownloadScript(podcasts_dir string) {
 }
 
 // tagSinglePod tags the file at filename with the title and album metadata
-func tagSinglePod(filename string, title string, album string, pythonPath string, eyeD3Dir string) {
+func tagSinglePod(filename string, title string, album string, pythonPath string, eyeD3Dir string) error {
 
 	// title tag is title
 	// album is podcast title
@@ -647,13 +817,16 @@ func tagSinglePod(filename string, title string, album string, pythonPath string
 	// if we fail to open we run eyeD3 to remove any tags and try again
 	if err != nil {
 		fmt.Printf("%s is a file where reading the tags has been problematic %s\n", filename, err)
-		stripTagsWithEyeD3(filename, pythonPath, eyeD3Dir)
+		if err := stripTagsWithEyeD3(filename, pythonPath, eyeD3Dir); err != nil {
+			return fmt.Errorf("strip tags from %s: %w", filename, err)
+		}
 		parse = false
 		tag, err = id3v2.Open(filename, id3v2.Options{Parse: parse})
-		checkErr(err)
-	} else {
-		defer tag.Close()
+		if err != nil {
+			return err
+		}
 	}
+	defer tag.Close()
 
 	// If we get to here then we're writing
 	asciiTitle := cleanText(title, len(title))
@@ -692,84 +865,49 @@ func tagSinglePod(filename string, title string, album string, pythonPath string
 	if err != nil {
 		fmt.Println("Title:", asciiTitle, "Album:", asciiAlbum, "Genre:", asciiGenre)
 	}
-	checkErr(err)
+	return err
 }
 
 // tagThosePods tag all the podcasts
-func tagThosePods(podcasts_dir string, pythonPath string, eyeD3Dir string) int {
+func tagThosePods(s *store, podcasts_dir string, pythonPath string, eyeD3Dir string) int {
 	fmt.Printf("Note: will tag pods in current working directory %s\n", getCwd())
 
-	filenames_set := mapset.NewSet()
-
 	// Get the metadata for those files in the download table
-	query := `
-	SELECT
-		filename,
-		COALESCE(podcast_title, 'title missing') AS podcast_title,
-		COALESCE(title, 'title missing') AS title,
-		COALESCE(description, 'description missing') AS description
-	FROM downloads AS d
-	JOIN episodes AS e ON d.hash = e.podcastname_episodename_hash
-	WHERE tagged_at IS null
-	ORDER BY filename
-	;
-	`
-	// Open db
-	db, err := sql.Open(sqlite3, dbFileName)
-	checkErr(err)
-	if err == nil {
-		defer db.Close()
-	}
-
-	rows, err := db.Query(query)
+	pending, err := s.untaggedDownloads()
 	checkErr(err)
 
-	// If it is, update last_seen
-	// count tracks the number of rows / loop iterations
-	var count int = 0
-	for rows.Next() {
-		var ns_filename, ns_podcast_title, ns_title, ns_description sql.NullString
-		err = rows.Scan(&ns_filename, &ns_podcast_title, &ns_title, &ns_description)
-		checkErr(err)
-
-		filename := ns_filename.String
-		podcast_title := ns_podcast_title.String
-		title := ns_title.String
-		log.Printf("%s: %s / %s", filename, podcast_title, title)
+	// count tracks the number of files tagged. One bad file is logged and
+	// left untagged for the next -t rather than stopping the rest
+	var count, failed int
+	for _, d := range pending {
+		log.Printf("%s: %s / %s", d.filename, d.podcastTitle, d.title)
 
-		// Tag 'em
-		tagSinglePod(filename, title, podcast_title, pythonPath, eyeD3Dir)
+		// Tag 'em, then timestamp the tagged_at column in the download table
+		if err := tagSinglePod(d.filename, d.title, d.podcastTitle, pythonPath, eyeD3Dir); err != nil {
+			log.Printf("not tagging %s: %v", d.filename, err)
+			failed++
+			continue
+		}
+		if err := s.markDownloadTagged(d.filename); err != nil {
+			log.Printf("tagged %s but could not record it: %v", d.filename, err)
+			failed++
+			continue
+		}
 		count += 1
-		// Set of filenames we need to update in the db
-		filenames_set.Add(ns_filename)
 	}
 
 	log.Printf("Been through tagging on %d files", count)
+	if failed > 0 {
+		log.Printf("%d file(s) could not be tagged; see above", failed)
+	}
 
 	if count == 0 {
 		fmt.Println("Did you run -u after downloading with -d ?")
 	} else {
-		// Timestamp the tagged_at column in the download table
-		for _, ind_filename := range filenames_set.ToSlice() {
-			stmt, err := db.Prepare(`
-				UPDATE downloads SET tagged_at = ?
-				WHERE filename = ?
-				;`)
-			checkErr(err)
-
-			res, err := stmt.Exec(ts, ind_filename)
-			checkErr(err)
-
-			affected, err := res.RowsAffected()
-			checkErr(err)
-
-			if affected != 1 {
-				log.Panic("More than one row affected which should not happen")
-			}
-		}
-
 		// Done message
-		if podcasts_dir != cwd {
+		if podcasts_dir != cwd && nameTemplate.nested() {
+			fmt.Printf("Now we are done with tagging you can copy the podcast folders from the current directory to your podcast directory with \nrsync -a --remove-source-files --include='*/' --include='*.%s' --exclude='*' ./ %s\n", mp3, podcasts_dir)
+		} else if podcasts_dir != cwd {
 			fmt.Printf("Now we are done with tagging you can move your podcasts from the current directory to your podcast directory with \nmv ./*%s %s\n", mp3, podcasts_dir)
 		}
 	}
@@ -788,8 +926,9 @@ func tagThosePods(podcasts_dir string, pythonPath string, eyeD3Dir string) int {
 // skipped rather than aborting the whole batch, so one flaky feed can't stop
 // the rest from being downloaded. The "Parsing ..." log lines may interleave;
 // the final DB state is independent of write order because every row is keyed
-// by hash/title and every timestamp uses the single global ts.
-func parseThem(conf_file_path string) {
+// by hash/title and every timestamp uses the single global ts. It returns
+// what each feed changed, in the order feeds finished, for --simulate.
+func parseThem(conf_file_path string, s *store) []feedChanges {
 	urls, err := readConfig(conf_file_path + "/" + confFile)
 	checkErr(err)
 
@@ -831,18 +970,12 @@ func parseThem(conf_file_path string) {
 		close(results)
 	}()
 
-	// One shared DB handle for the whole parse. The consumer below is the only
-	// writer, so cap the pool at a single connection (no SQLite lock contention)
-	// and set a busy timeout as cheap insurance.
-	db, err := sql.Open(sqlite3, dbFileName)
-	checkErr(err)
-	defer db.Close()
-	db.SetMaxOpenConns(1)
-	_, err = db.Exec(`PRAGMA busy_timeout = 5000;`)
-	checkErr(err)
-
 	// Single consumer => DB writes stay serialized, identical to before.
+	changes := make([]feedChanges, 0, len(urls))
 	for r := range results {
+		if err := s.recordFeedFetch(r.url, r.podcast[title], r.err); err != nil {
+			log.Printf("Failed to record the fetch of %s in feed_health: %s", r.url, err)
+		}
 		// A single feed failing to fetch or parse — TLS/handshake timeout,
 		// connection refused, DNS failure, a bad HTTP status, malformed XML —
 		// must never abort the whole batch. (Previously checkErr panicked on
@@ -850,10 +983,14 @@ func parseThem(conf_file_path string) {
 		// killed the entire run.) Log it and move on; the next run retries it.
 		if r.err != nil {
 			log.Printf("Skipping feed %s: %s", r.url, r.err)
+			changes = append(changes, feedChanges{url: r.url, err: r.err})
 			continue
 		}
-		podEpisodesIntoDatabase(db, r.podcast, r.episodes)
+		c := podEpisodesIntoDatabase(s, r.podcast, r.episodes)
+		c.url = r.url
+		changes = append(changes, c)
 	}
+	return changes
 }
 
 // init function is called automatically before main() in Go
@@ -881,53 +1018,21 @@ func cwdCheck(cwd string) {
 	}
 }
 
-// latestPodsFromDb lists the latest pods from the db
-func latestPodsFromDb(path string) {
-	// TODO: other places should also take into account the full path to the db
-	// rather than assuming it will be in cwd/same place as the binary
-
-	newDbFileName := path + "/" + dbFileName
-
-	db, err := sql.Open(sqlite3, newDbFileName)
+// latestPodsFromDb lists the latest pods from the db, narrowed by the -l
+// filters. Each line ends with the episode's status and, when the expected
+// file is in one of scanPaths, where it is.
+func latestPodsFromDb(s *store, f latestFilter, scanPaths []string) {
+	latestRows, err := s.latestEpisodes(f)
 	checkErr(err)
+	if reportFormat != formatText {
+		checkErr(writeEpisodeList(os.Stdout, "latest", "", latestRecords(latestRows, scanPaths)))
+		return
+	}
 
-	if err == nil {
-		fmt.Printf("Connected to db %s\n", newDbFileName)
-		defer db.Close()
-	}
-
-	query := `select
-	  author,
-	  title,
-	  published,
-	  podcast_title,
-	  IFNULL(published, first_seen),
-	  podcastname_episodename_hash,
-	  file
-	from episodes
-	order by published desc
-	limit 100;`
-
-	rows, err := db.Query(query)
-	checkErr(err)
+	fmt.Printf("Connected to db %s\n", s.path)
 
-	var count int
-	var latest latestPodResult
 	var tsStr string
-
-	for rows.Next() {
-		err = rows.Scan(
-			&latest.author,
-			&latest.title,
-			&latest.published,
-			&latest.podcast_title,
-			&latest.dateForFilename,
-			&latest.hash,
-			&latest.file,
-		)
-		checkErr(err)
-		count += 1
-
+	for _, latest := range latestRows {
 		if latest.published.Valid {
 			tt, err := time.Parse(time.RFC3339, latest.published.String)
 			checkErr(err)
@@ -936,14 +1041,85 @@ func latestPodsFromDb(path string) {
 			tsStr = "?"
 		}
 
-		fmt.Printf("%s / %s / %s / %s / %s\n",
+		filename := expectedFilenameForLatest(latest)
+		fmt.Printf("%s / %s / %s / %s / %s [%s]\n",
 			tsStr,
 			nullStrToStr(latest.author),
 			nullStrToStr(latest.podcast_title),
 			nullStrToStr(latest.title),
-			expectedFilenameForLatest(latest),
+			filename,
+			latest.status,
 		)
+		if p := onDiskPath(scanPaths, filename); p != "" {
+			fmt.Printf("\ton disk: %s\n", p)
+		}
+	}
+}
+
+// printSkippedEpisodes runs --skipped: the audit of episodes the download
+// pass refused as retitle duplicates (see skip.go).
+func printSkippedEpisodes(s *store) error {
+	rows, err := s.skippedEpisodes()
+	if err != nil {
+		return err
+	}
+	if reportFormat != formatText {
+		records := make([]skipRecord, 0, len(rows))
+		for _, r := range rows {
+			records = append(records, skipRecord{
+				EpisodeHash:        r.episodeHash,
+				PodcastTitle:       r.podcastTitle,
+				Title:              r.title,
+				GUID:               r.guid,
+				MatchedEpisodeHash: r.matchedHash,
+				MatchedTitle:       r.matchedTitle,
+				Reason:             r.reason,
+				FirstSkipped:       r.firstSkipped,
+				LastSkipped:        r.lastSkipped,
+				Override:           r.override,
+			})
+		}
+		return writeSkipReport(os.Stdout, records)
+	}
+	if len(rows) == 0 {
+		fmt.Println("No skipped episodes")
+		return nil
+	}
+	for _, r := range rows {
+		fmt.Printf("%s / %s / %s\n", publishedDate10(r.lastSkipped), r.podcastTitle, r.title)
+		switch r.override {
+		case overrideNever:
+			fmt.Printf("\t%s\n", r.reason)
+		case overrideForce:
+			fmt.Printf("\t%s (kept %q) [override: force, downloaded anyway]\n", r.reason, r.matchedTitle)
+		default:
+			fmt.Printf("\t%s (kept %q)\n", r.reason, r.matchedTitle)
+		}
+	}
+	return nil
+}
+
+// latestRecords converts -l rows for the json/csv report. Unknown values are
+// empty strings there rather than the "?" of the text listing.
+func latestRecords(rows []latestPodResult, scanPaths []string) []episodeRecord {
+	out := make([]episodeRecord, 0, len(rows))
+	for _, latest := range rows {
+		filename := expectedFilenameForLatest(latest)
+		if filename == "?" {
+			filename = ""
+		}
+		out = append(out, episodeRecord{
+			Published:    latest.published.String,
+			PodcastTitle: latest.podcast_title.String,
+			Title:        latest.title.String,
+			Author:       latest.author.String,
+			EpisodeHash:  latest.hash.String,
+			Filename:     filename,
+			Status:       latest.status,
+			Path:         onDiskPath(scanPaths, filename),
+		})
 	}
+	return out
 }
 
 // expectedFilenameForLatest derives the filename gopodder would give this
@@ -957,12 +1133,14 @@ func expectedFilenameForLatest(latest latestPodResult) string {
 	if !latest.dateForFilename.Valid || len([]rune(latest.dateForFilename.String)) < 10 {
 		return "?"
 	}
-	return buildNonInteractiveFilename(
-		nullStrToStr(latest.podcast_title),
-		nullStrToStr(latest.title),
-		latest.dateForFilename.String,
-		latest.hash.String,
-	)
+	return episodeFilename(episodeNaming{
+		podcast: nullStrToStr(latest.podcast_title),
+		title:   nullStrToStr(latest.title),
+		date:    shortDate(latest.dateForFilename.String),
+		hash:    latest.hash.String,
+		season:  latest.season,
+		episode: latest.episode,
+	})
 }
 
 // buildScanPaths returns the deduplicated list of directories that
@@ -990,6 +1168,7 @@ func main() {
 	// Get conf file path from env
 	confFilePath, confVarIsSet := os.LookupEnv(confVarEnvName)
 	podcastsDir, pathVarIsSet := os.LookupEnv(pathVarEnvName)
+	dbEnv := os.Getenv(dbVarEnvName)
 	archivesEnv, archivesVarIsSet := os.LookupEnv(archivesVarEnvName)
 
 	// Use default if not set
@@ -1018,10 +1197,59 @@ Typical use:
 	-t to tag
 
 	-a will do each of the above in order
+	--simulate will do -p and -s against a snapshot of the db and print
+	   what would be inserted, renamed, refreshed, queued and skipped,
+	   without writing the db, the script or any podcast files
+	--record-feeds <dir>        While parsing, also save every fetched feed
+	                            under <dir>/<YYYYMMDD-HHMMSS>/.
+	--replay-feeds <snapshot>   Parse from a recorded snapshot dir instead
+	                            of the network (e.g. with --simulate to
+	                            replay an incident offline).
 
 	Utility:
-	-l will list the (up to) 100 latest podcasts from the db
-	-i will launch interactive mode
+	-l will list the (up to) 100 latest podcasts from the db, with each
+	   one's status and on-disk path. Narrow it with:
+	--podcast <glob|/regex/>    Podcasts matching a glob ("In Our*") or a
+	                            regex ("/^(bbc|npr)/"); case-insensitive.
+	--since / --until <date>    Published (or first seen) on or after /
+	                            on or before YYYY-MM-DD.
+	--status <status>           downloaded, archived, skipped or pending.
+	--match <words>             Title or description contains every word.
+	--unplayed                  Not marked played in interactive mode.
+	--limit <n>                 At most n episodes (default 100; 0 for all).
+	--sort <order>              newest (default), oldest, podcast or title.
+	-i will launch interactive mode (s on the podcast list searches)
+	--search <query>            Search episode titles, descriptions, authors
+	                            and podcast titles; prints the best matches
+	                            with their status (downloaded, archived,
+	                            skipped, not downloaded).
+	--explain <hash|title>      Trace every download-pass check for an
+	                            episode (files by hash, legacy URL hash,
+	                            archive registry, title fallback, twin
+	                            backstop, retitle rules) and say which one
+	                            decided whether it is queued or skipped.
+	--check-filenames           List files named before titles in other
+	                            scripts (Greek, Cyrillic, Japanese, ...) and
+	                            accented Latin were kept in file names, which
+	                            would be named differently today.
+	--skipped                   List episodes the download pass skipped as
+	                            retitle duplicates of ones already held.
+	--force-download <hash>     Always queue this episode, even when the twin
+	                            backstop or a retitle rule would skip it.
+	--never-download <hash>     Never queue this episode.
+	--clear-download-override <hash>
+	                            Drop a force or never override again.
+	--format text|json|csv      Output of -l, --search, --skipped, the
+	                            archive commands and the dedup/prune passes.
+	                            json and csv are stable, documented schemas
+	                            (see README); logging then goes to stderr.
+
+	Database:
+	--db <path>                 Database to use. Otherwise $GOPODDB, else a
+	                            "db = <path>" line in gopodder.conf, else
+	                            gopodder.sqlite next to gopodder.conf.
+	--init                      Create the database if it does not exist;
+	                            without it a missing database is an error.
 
 	Archiving (off-load older pods to another volume):
 	--register-archive <dir>    Mark files in <dir> as archived; -s will not
@@ -1034,6 +1262,11 @@ Typical use:
 	                            registry above).
 
 	Deduplication (same episode under different filename hashes):
+	--dedup                     Dry run: every pass below (guid, retitles,
+	                            twins, then stale-row prune) over one scan,
+	                            as one plan grouped by podcast.
+	--apply                     With --dedup: apply the plan in one
+	                            transaction.
 	--dedup-twins               Dry run: plan removal of duplicate copies
 	                            across the podcasts dir and archive scan
 	                            paths, keeping one copy per episode under
@@ -1053,6 +1286,20 @@ Typical use:
 	                            episode hash), which changes the filename
 	                            prefix and so hides them from the twin pass.
 	--dedup-guid-delete         Apply it.
+	The -delete passes move removed files into .gopodder-trash/<run id> in
+	their scan path and journal every change, so a run can be taken back:
+	--undo-dedup <run id>       Restore a run's files and database rows.
+	--purge-trash               Delete trashed files for good, for runs
+	                            older than --older-than (default 30d; also
+	                            takes Go durations such as 12h).
+	Per-podcast tuning of the retitle and dedup thresholds:
+	--heuristics                List the settings, their defaults and every
+	                            podcast's overrides.
+	--set-heuristic <key=value> --podcast <title>
+	                            Override one setting for one podcast, e.g.
+	                            near_date_window_days=2 for a daily feed.
+	--clear-heuristic <key> --podcast <title>
+	                            Back to the default.
 
 Note:
 	Will look in %s for configuration file (set $GOPODCONF to change);
@@ -1077,10 +1324,37 @@ Note:
 	verboseOpt := parser.Flag("v", "verbose", &argparse.Options{Required: false, Help: "Verbose"})
 	listLatestPods := parser.Flag("l", "list", &argparse.Options{Required: false, Help: "List latest pods"})
 	interactiveMode := parser.Flag("i", "interactive", &argparse.Options{Required: false, Help: "Interactive episode picker"})
+	dbOpt := parser.String("", "db", &argparse.Options{Required: false, Help: "Path to the database (overrides $GOPODDB and the db setting in gopodder.conf)"})
+	initOpt := parser.Flag("", "init", &argparse.Options{Required: false, Help: "Create the database if it does not exist"})
+	searchOpt := parser.String("", "search", &argparse.Options{Required: false, Help: "Search episodes and print the best matches with their status"})
+	podcastFilterOpt := parser.String("", "podcast", &argparse.Options{Required: false, Help: "With -l: only podcasts matching this glob, or /regex/ (case-insensitive); with --set-heuristic/--clear-heuristic: the podcast's exact title"})
+	sinceOpt := parser.String("", "since", &argparse.Options{Required: false, Help: "With -l: only episodes published on or after YYYY-MM-DD"})
+	untilOpt := parser.String("", "until", &argparse.Options{Required: false, Help: "With -l: only episodes published on or before YYYY-MM-DD"})
+	statusOpt := parser.String("", "status", &argparse.Options{Required: false, Help: "With -l: only downloaded, archived, skipped or pending episodes"})
+	unplayedOpt := parser.Flag("", "unplayed", &argparse.Options{Required: false, Help: "With -l: leave out episodes marked played in interactive mode"})
+	matchOpt := parser.String("", "match", &argparse.Options{Required: false, Help: "With -l: only episodes whose title or description contains every word"})
+	limitOpt := parser.Int("", "limit", &argparse.Options{Required: false, Help: "With -l: list at most this many episodes (0 for all)", Default: defaultLatestLimit})
+	sortOpt := parser.String("", "sort", &argparse.Options{Required: false, Help: "With -l: newest (default), oldest, podcast or title", Default: sortNewest})
+	simulateOpt := parser.Flag("", "simulate", &argparse.Options{Required: false, Help: "Parse feeds and plan downloads against a snapshot of the db; print what would change without writing anything"})
+	recordFeedsOpt := parser.String("", "record-feeds", &argparse.Options{Required: false, Help: "Also save every fetched feed under a timestamped snapshot dir in <dir>"})
+	replayFeedsOpt := parser.String("", "replay-feeds", &argparse.Options{Required: false, Help: "Read feeds from a snapshot dir written by --record-feeds instead of the network"})
+	explainOpt := parser.String("", "explain", &argparse.Options{Required: false, Help: "Trace why an episode (hash or title substring) is queued, skipped or considered downloaded"})
+	forceDownloadOpt := parser.String("", "force-download", &argparse.Options{Required: false, Help: "Always queue the episode with this hash, even when a skip heuristic would skip it"})
+	neverDownloadOpt := parser.String("", "never-download", &argparse.Options{Required: false, Help: "Never queue the episode with this hash"})
+	clearOverrideOpt := parser.String("", "clear-download-override", &argparse.Options{Required: false, Help: "Remove the force/never download override for the episode with this hash"})
+	heuristicsOpt := parser.Flag("", "heuristics", &argparse.Options{Required: false, Help: "List the tunable skip/dedup heuristics with their defaults and every per-podcast override"})
+	setHeuristicOpt := parser.String("", "set-heuristic", &argparse.Options{Required: false, Help: "With --podcast: override a heuristic for that podcast, as key=value"})
+	clearHeuristicOpt := parser.String("", "clear-heuristic", &argparse.Options{Required: false, Help: "With --podcast: drop that podcast's override of this heuristic"})
+	checkFilenamesOpt := parser.Flag("", "check-filenames", &argparse.Options{Required: false, Help: "List files on the scan paths whose names would change under the current title transformation"})
+	skippedOpt := parser.Flag("", "skipped", &argparse.Options{Required: false, Help: "List episodes the download pass skipped as retitle duplicates"})
+	formatOpt := parser.String("", "format", &argparse.Options{Required: false, Help: "Output format for list and report commands: text (default), json or csv", Default: formatText})
 
 	registerArchiveOpt := parser.String("", "register-archive", &argparse.Options{Required: false, Help: "Register podcast files in <dir> as archived (won't be re-downloaded even if dir is unmounted)"})
 	unregisterArchiveOpt := parser.String("", "unregister-archive", &argparse.Options{Required: false, Help: "Remove archive registrations matching files currently in <dir>"})
 	reconcileArchiveOpt := parser.Flag("", "reconcile-archive", &argparse.Options{Required: false, Help: "Drop archive registrations whose archived path no longer resolves on disk"})
+	dedupOpt := parser.Flag("", "dedup", &argparse.Options{Required: false, Help: "Dry run: plan every dedup pass (guid, retitles, twins, stale-row prune) over one scan as one merged plan"})
+	applyOpt := parser.Flag("", "apply", &argparse.Options{Required: false, Help: "With --dedup or --relayout: apply the plan in one transaction"})
+	relayoutOpt := parser.Flag("", "relayout", &argparse.Options{Required: false, Help: "Dry run: plan moving the files on the scan paths to the filename template's layout"})
 	dedupTwinsOpt := parser.Flag("", "dedup-twins", &argparse.Options{Required: false, Help: "Dry run: plan removal of duplicate copies of episodes across podcasts dir and archive scan paths"})
 	dedupTwinsDeleteOpt := parser.Flag("", "dedup-twins-delete", &argparse.Options{Required: false, Help: "Apply the --dedup-twins plan (deletes files; updates downloads and archived_episodes)"})
 	pruneStaleOpt := parser.Flag("", "prune-stale-episodes", &argparse.Options{Required: false, Help: "Dry run: list stale fileless episodes rows that would re-queue deleted twin variants for download"})
@@ -1089,6 +1363,9 @@ Note:
 	dedupRetitlesDeleteOpt := parser.Flag("", "dedup-retitles-delete", &argparse.Options{Required: false, Help: "Apply the --dedup-retitles plan"})
 	dedupGuidOpt := parser.Flag("", "dedup-guid", &argparse.Options{Required: false, Help: "Dry run: plan merging duplicate copies of episodes a feed retitled (same guid, different episode hash)"})
 	dedupGuidDeleteOpt := parser.Flag("", "dedup-guid-delete", &argparse.Options{Required: false, Help: "Apply the --dedup-guid plan"})
+	undoDedupOpt := parser.String("", "undo-dedup", &argparse.Options{Required: false, Help: "Undo an applied dedup or prune run: restore its trashed files and database rows"})
+	purgeTrashOpt := parser.Flag("", "purge-trash", &argparse.Options{Required: false, Help: "Permanently delete dedup trash older than --older-than"})
+	olderThanOpt := parser.String("", "older-than", &argparse.Options{Required: false, Help: "With --purge-trash: minimum age of trash to delete, e.g. 30d or 12h", Default: defaultTrashAge})
 
 	// Parser for shell args
 	err := parser.Parse(os.Args)
@@ -1098,6 +1375,17 @@ Note:
 		verbose = true
 	}
 
+	// json/csv reports own stdout; progress logging moves to stderr
+	if f, ferr := parseReportFormat(*formatOpt); ferr != nil {
+		fmt.Println(ferr)
+		os.Exit(1)
+	} else {
+		reportFormat = f
+	}
+	if reportFormat != formatText {
+		log.SetOutput(os.Stderr)
+	}
+
 	// In case of error print error and print usage
 	// this can also be done by passing -h or --help flags
 	if err != nil {
@@ -1119,6 +1407,21 @@ Note:
 		log.Printf(tmp_fmt, pathVarEnvName, podcastsDir)
 	}
 
+	// Where feeds come from: the network, optionally recorded, or a replayed
+	// snapshot.
+	if r, rec := strings.TrimSpace(*replayFeedsOpt), strings.TrimSpace(*recordFeedsOpt); r != "" && rec != "" {
+		fmt.Println("--record-feeds and --replay-feeds cannot be combined")
+		os.Exit(1)
+	} else if r != "" {
+		src, err := newReplayFeedSource(r)
+		checkErr(err)
+		feedFetcher = src
+	} else if rec != "" {
+		src := newRecordingFeedSource(feedFetcher, rec, time.Now())
+		log.Printf("Recording fetched feeds to %s", src.dir)
+		feedFetcher = src
+	}
+
 	// Build the list of directories to scan when deciding what's already
 	// downloaded: primary dir first, then any extras from GOPODDIR_ARCHIVES.
 	scanPaths := buildScanPaths(podcastsDir, archivesEnv)
@@ -1138,49 +1441,202 @@ Note:
 		log.Panic("Exiting as we do not have dependancies")
 	}
 
+	// Resolve the database once and open the one store everything below
+	// shares. A missing db is an error unless --init: running from the
+	// wrong directory must not silently start from an empty db.
+	settings, err := readConfigSettings(filepath.Join(confFilePath, confFile))
+	checkErr(err)
+	if raw, ok := settings[filenameTemplateSetting]; ok {
+		nameTemplate, err = parseFilenameTemplate(raw)
+		checkErr(err)
+		log.Printf("Using filename template %s", nameTemplate.raw)
+	}
+	if podcastDirectory, err = newDirectory(settings); err != nil {
+		log.Printf("podcast directory search disabled: %v", err)
+		podcastDirectory = unconfiguredDirectory{err: err}
+	}
+	if raw, ok := settings[parallelDownloadsSetting]; ok {
+		parallelDownloads, err = parseParallelDownloads(raw)
+		checkErr(err)
+	}
+	if raw, ok := settings[playerSetting]; ok {
+		playerCommand, err = parsePlayer(raw)
+		checkErr(err)
+	}
+	tuiKeys, err = loadKeyMap(settings)
+	checkErr(err)
+	dbFile, dbSource, err := resolveDbPath(*dbOpt, dbEnv, settings, confFilePath)
+	checkErr(err)
+	log.Printf("Using database %s (from %s)", dbFile, dbSource)
+	if err := checkDbExists(dbFile, *initOpt); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	// Before openStore: a simulation must not migrate or even reopen the
+	// real database in WAL mode
+	if *simulateOpt {
+		checkErr(simulateDatabase(dbFile, confFilePath, scanPaths))
+		return
+	}
+
+	s, err := openStore(dbFile)
+	checkErr(err)
+	defer s.Close()
+
 	// First let's get the tables ready to go and create them if not
-	createTablesIfNotExist()
+	checkErr(s.createTablesIfNotExist())
+	podcastHeuristics, err = s.loadPodcastHeuristics()
+	checkErr(err)
+	libraryNested, err = s.libraryWasNested()
+	checkErr(err)
+
+	if q := strings.TrimSpace(*searchOpt); q != "" {
+		checkErr(printSearchResults(s, q))
+		return
+	}
+	if *skippedOpt {
+		checkErr(printSkippedEpisodes(s))
+		return
+	}
+	if q := strings.TrimSpace(*explainOpt); q != "" {
+		explanations, err := explainEpisodes(s, q, scanPaths)
+		checkErr(err)
+		printExplanations(os.Stdout, explanations)
+		return
+	}
+	if *checkFilenamesOpt {
+		changes, err := checkFilenames(s, scanPaths)
+		checkErr(err)
+		printFilenameChanges(os.Stdout, changes)
+		return
+	}
+
+	// Download overrides: set or clear one and exit
+	if h := strings.TrimSpace(*forceDownloadOpt); h != "" {
+		checkErr(s.setDownloadOverride(h, overrideForce))
+		log.Printf("%s will always be queued when missing", h)
+		return
+	}
+	if h := strings.TrimSpace(*neverDownloadOpt); h != "" {
+		checkErr(s.setDownloadOverride(h, overrideNever))
+		log.Printf("%s will never be queued", h)
+		return
+	}
+	if h := strings.TrimSpace(*clearOverrideOpt); h != "" {
+		cleared, err := s.clearDownloadOverride(h)
+		checkErr(err)
+		if cleared {
+			log.Printf("cleared the download override for %s", h)
+		} else {
+			log.Printf("no download override for %s", h)
+		}
+		return
+	}
+
+	// Per-podcast heuristics: list, set or clear and exit
+	if *heuristicsOpt {
+		rows, err := s.podcastSettings()
+		checkErr(err)
+		printHeuristics(os.Stdout, rows)
+		return
+	}
+	if kv := strings.TrimSpace(*setHeuristicOpt); kv != "" {
+		pod := strings.TrimSpace(*podcastFilterOpt)
+		if pod == "" {
+			log.Println("--set-heuristic needs --podcast")
+			os.Exit(1)
+		}
+		key, value, err := parseSettingAssignment(kv)
+		checkErr(err)
+		checkErr(s.setPodcastSetting(pod, key, value))
+		log.Printf("%s: %s = %s", pod, key, value)
+		return
+	}
+	if key := strings.TrimSpace(*clearHeuristicOpt); key != "" {
+		pod := strings.TrimSpace(*podcastFilterOpt)
+		if pod == "" {
+			log.Println("--clear-heuristic needs --podcast")
+			os.Exit(1)
+		}
+		cleared, err := s.clearPodcastSetting(pod, key)
+		checkErr(err)
+		if cleared {
+			log.Printf("%s: %s back to the default", pod, key)
+		} else {
+			log.Printf("%s has no override of %s", pod, key)
+		}
+		return
+	}
 
 	// Archive-registry commands are independent of the parse/download pipeline.
 	// Each one runs and exits — chaining with -p/-s/-d/-u/-t isn't supported.
 	if r := strings.TrimSpace(*registerArchiveOpt); r != "" {
-		n, err := registerArchiveDir(r)
+		n, err := registerArchiveDir(s, r)
 		checkErr(err)
-		log.Printf("registered %d archived episode(s) from %s", n, r)
+		checkErr(writeCountReport(os.Stdout, "register-archive", r, n,
+			fmt.Sprintf("registered %d archived episode(s) from %s", n, r)))
 		return
 	}
 	if u := strings.TrimSpace(*unregisterArchiveOpt); u != "" {
-		n, err := unregisterArchiveDir(u)
+		n, err := unregisterArchiveDir(s, u)
 		checkErr(err)
-		log.Printf("unregistered %d archived episode(s) matching %s", n, u)
+		checkErr(writeCountReport(os.Stdout, "unregister-archive", u, n,
+			fmt.Sprintf("unregistered %d archived episode(s) matching %s", n, u)))
 		return
 	}
 	if *reconcileArchiveOpt {
-		n, err := reconcileArchiveRegistry()
+		n, err := reconcileArchiveRegistry(s)
 		checkErr(err)
-		log.Printf("removed %d stale archive registration(s)", n)
+		checkErr(writeCountReport(os.Stdout, "reconcile-archive", "", n,
+			fmt.Sprintf("removed %d stale archive registration(s)", n)))
+		return
+	}
+	if *applyOpt && !*dedupOpt && !*relayoutOpt {
+		log.Println("--apply only applies to --dedup and --relayout")
+		os.Exit(1)
+	}
+	if *dedupOpt {
+		checkErr(runDedupAll(s, scanPaths, *applyOpt))
+		return
+	}
+	if *relayoutOpt {
+		checkErr(runRelayout(s, scanPaths, *applyOpt))
 		return
 	}
 	if *dedupTwinsOpt || *dedupTwinsDeleteOpt {
-		checkErr(runDedupTwins(scanPaths, *dedupTwinsDeleteOpt))
+		checkErr(runDedupTwins(s, scanPaths, *dedupTwinsDeleteOpt))
 		return
 	}
 	if *pruneStaleOpt || *pruneStaleDeleteOpt {
-		checkErr(pruneStaleEpisodes(scanPaths, *pruneStaleDeleteOpt))
+		checkErr(pruneStaleEpisodes(s, scanPaths, *pruneStaleDeleteOpt))
 		return
 	}
 	if *dedupRetitlesOpt || *dedupRetitlesDeleteOpt {
-		checkErr(runDedupRetitles(scanPaths, *dedupRetitlesDeleteOpt))
+		checkErr(runDedupRetitles(s, scanPaths, *dedupRetitlesDeleteOpt))
 		return
 	}
 	if *dedupGuidOpt || *dedupGuidDeleteOpt {
-		checkErr(runDedupGuid(scanPaths, *dedupGuidDeleteOpt))
+		checkErr(runDedupGuid(s, scanPaths, *dedupGuidDeleteOpt))
+		return
+	}
+	if runID := strings.TrimSpace(*undoDedupOpt); runID != "" {
+		res, err := undoDedupRun(s, runID)
+		checkErr(err)
+		log.Printf("undid dedup run %s: restored %d file(s), %d database change(s)", runID, res.files, res.rows)
+		return
+	}
+	if *purgeTrashOpt {
+		age, err := parseTrashAge(*olderThanOpt)
+		checkErr(err)
+		res, err := purgeTrash(s, scanPaths, age, time.Now())
+		checkErr(err)
+		log.Printf("purged %d dedup run(s) from the trash: %d file(s), %.1f GiB", res.runs, res.files, float64(res.bytes)/1073741824.0)
 		return
 	}
 
 	// Interactive mode is exclusive from the parse/script pipeline
 	if *interactiveMode {
-		if err := runInteractive(podcastsDir, pythonPath, eyeD3Dir); err != nil {
+		if err := runInteractive(s, confFilePath, podcastsDir, scanPaths, pythonPath, eyeD3Dir); err != nil {
 			log.Panic(err)
 		}
 		return
@@ -1193,20 +1649,22 @@ Note:
 	}
 
 	if *doAll {
-		parseThem(confFilePath)
-		hasDownloads := generateDownloadList(podcastsDir, scanPaths)
+		parseThem(confFilePath, s)
+		hasDownloads := generateDownloadList(s, podcastsDir, scanPaths)
 		if hasDownloads {
 			runDownloadScript(podcastsDir)
-			updateDatabaseForDownloads()
-			tagThosePods(podcastsDir, pythonPath, eyeD3Dir)
+			updateDatabaseForDownloads(s)
+			tagThosePods(s, podcastsDir, pythonPath, eyeD3Dir)
 		}
+		warnFilenameChanges(s, scanPaths)
 	} else {
 		if *parseOptPtr {
-			parseThem(confFilePath)
+			parseThem(confFilePath, s)
 		}
 
 		if *seeOptPtr {
-			_ = generateDownloadList(podcastsDir, scanPaths)
+			_ = generateDownloadList(s, podcastsDir, scanPaths)
+			warnFilenameChanges(s, scanPaths)
 		}
 
 		if *downloadPods {
@@ -1214,15 +1672,29 @@ Note:
 		}
 
 		if *postDlUpdate {
-			updateDatabaseForDownloads()
+			updateDatabaseForDownloads(s)
 		}
 
 		if *tagPods {
-			tagThosePods(podcastsDir, pythonPath, eyeD3Dir)
+			tagThosePods(s, podcastsDir, pythonPath, eyeD3Dir)
 		}
 
 		if *listLatestPods {
-			latestPodsFromDb(confFilePath)
+			lf, err := buildLatestFilter(s, latestFilterOptions{
+				podcast:  strings.TrimSpace(*podcastFilterOpt),
+				since:    strings.TrimSpace(*sinceOpt),
+				until:    strings.TrimSpace(*untilOpt),
+				status:   *statusOpt,
+				match:    *matchOpt,
+				unplayed: *unplayedOpt,
+				sort:     strings.TrimSpace(*sortOpt),
+				limit:    *limitOpt,
+			})
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			latestPodsFromDb(s, lf, scanPaths)
 		}
 	}
 }
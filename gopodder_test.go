@@ -275,7 +275,7 @@ func TestMatchByTransformedTitleEmptyCandidates(t *testing.T) {
 
 func TestGenerateDownloadListKeepsNewEpisodesWithCollidingTransformedTitles(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -314,7 +314,7 @@ func TestGenerateDownloadListKeepsNewEpisodesWithCollidingTransformedTitles(t *t
 		t.Fatalf("insert episodes: %v", err)
 	}
 
-	generateDownloadList(tmpDir, []string{tmpDir})
+	generateDownloadList(st, tmpDir, []string{tmpDir})
 
 	scriptPath := filepath.Join(tmpDir, "download_pods.sh")
 	script, err := os.ReadFile(scriptPath)
@@ -333,7 +333,7 @@ func TestGenerateDownloadListKeepsNewEpisodesWithCollidingTransformedTitles(t *t
 
 func TestLegacyURLHashFilenamesExcludedFromDownloadList(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -387,7 +387,7 @@ func TestLegacyURLHashFilenamesExcludedFromDownloadList(t *testing.T) {
 		t.Fatalf("insert episodes: %v", err)
 	}
 
-	generateDownloadList(tmpDir, []string{tmpDir})
+	generateDownloadList(st, tmpDir, []string{tmpDir})
 
 	script, err := os.ReadFile(filepath.Join(tmpDir, "download_pods.sh"))
 	if err != nil {
@@ -404,7 +404,7 @@ func TestLegacyURLHashFilenamesExcludedFromDownloadList(t *testing.T) {
 
 func TestLegacyURLHashInArchiveRegistryExcludedFromDownloadList(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -446,7 +446,7 @@ func TestLegacyURLHashInArchiveRegistryExcludedFromDownloadList(t *testing.T) {
 		t.Fatalf("insert archived row: %v", err)
 	}
 
-	generateDownloadList(tmpDir, []string{tmpDir})
+	generateDownloadList(st, tmpDir, []string{tmpDir})
 
 	script, err := os.ReadFile(filepath.Join(tmpDir, "download_pods.sh"))
 	if err != nil {
@@ -514,9 +514,119 @@ func TestBuildScanPaths(t *testing.T) {
 	}
 }
 
+func TestResolveDbPath(t *testing.T) {
+	useTempWorkingDir(t)
+	cases := []struct {
+		name       string
+		flag       string
+		env        string
+		settings   map[string]string
+		want       string
+		wantSource string
+	}{
+		{"default next to config", "", "", nil, "/conf/gopodder.sqlite", "default"},
+		{"config setting absolute", "", "", map[string]string{"db": "/data/pods.sqlite"}, "/data/pods.sqlite", confFile},
+		{"config setting relative to conf dir", "", "", map[string]string{"db": "db/pods.sqlite"}, "/conf/db/pods.sqlite", confFile},
+		{"env beats config", "", "/env/pods.sqlite", map[string]string{"db": "/data/pods.sqlite"}, "/env/pods.sqlite", "$" + dbVarEnvName},
+		{"flag beats env", "/flag/pods.sqlite", "/env/pods.sqlite", nil, "/flag/pods.sqlite", "--db"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, source, err := resolveDbPath(tc.flag, tc.env, tc.settings, "/conf")
+			if err != nil {
+				t.Fatalf("resolveDbPath: %v", err)
+			}
+			if got != tc.want || source != tc.wantSource {
+				t.Fatalf("got (%q, %q), want (%q, %q)", got, source, tc.want, tc.wantSource)
+			}
+		})
+	}
+}
+
+// A db an older version left in the working directory is still found, unless
+// there is one next to the config file.
+func TestResolveDbPathWorkingDirFallback(t *testing.T) {
+	tmpDir := useTempWorkingDir(t)
+	confDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, dbFileName), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, source, err := resolveDbPath("", "", nil, confDir)
+	if err != nil {
+		t.Fatalf("resolveDbPath: %v", err)
+	}
+	if want := filepath.Join(tmpDir, dbFileName); got != want || source != "working directory" {
+		t.Fatalf("got (%q, %q), want (%q, working directory)", got, source, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(confDir, dbFileName), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, source, err = resolveDbPath("", "", nil, confDir)
+	if err != nil {
+		t.Fatalf("resolveDbPath: %v", err)
+	}
+	if want := filepath.Join(confDir, dbFileName); got != want || source != "default" {
+		t.Fatalf("got (%q, %q), want (%q, default)", got, source, want)
+	}
+}
+
+func TestCheckDbExistsRequiresInit(t *testing.T) {
+	tmpDir := useTempWorkingDir(t)
+	dbFile := filepath.Join(tmpDir, dbFileName)
+
+	if err := checkDbExists(dbFile, false); err == nil {
+		t.Fatal("expected an error for a missing db without --init")
+	}
+	if err := checkDbExists(dbFile, true); err != nil {
+		t.Fatalf("expected --init to allow a missing db, got %v", err)
+	}
+	s, err := openStore(dbFile)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	s.Close()
+	if err := checkDbExists(dbFile, false); err != nil {
+		t.Fatalf("expected existing db to pass, got %v", err)
+	}
+	if err := checkDbExists(tmpDir, false); err == nil {
+		t.Fatal("expected an error for a directory")
+	}
+}
+
+func TestReadConfigSettingsSeparateFromFeeds(t *testing.T) {
+	tmpDir := useTempWorkingDir(t)
+	confPath := filepath.Join(tmpDir, confFile)
+	content := "https://example.com/a.rss\n# a comment = ignored\ndb = /data/pods.sqlite\nsearch_url = https://example.com/search\nhttps://example.com/b.rss\n"
+	if err := os.WriteFile(confPath, []byte(content), 0666); err != nil {
+		t.Fatalf("write conf: %v", err)
+	}
+
+	urls, err := readConfig(confPath)
+	if err != nil {
+		t.Fatalf("readConfig: %v", err)
+	}
+	if len(urls) != 2 || urls[0] != "https://example.com/a.rss" || urls[1] != "https://example.com/b.rss" {
+		t.Fatalf("expected only the two feed URLs, got %v", urls)
+	}
+
+	settings, err := readConfigSettings(confPath)
+	if err != nil {
+		t.Fatalf("readConfigSettings: %v", err)
+	}
+	if len(settings) != 2 || settings["db"] != "/data/pods.sqlite" || settings["search_url"] != "https://example.com/search" {
+		t.Fatalf("unexpected settings %v", settings)
+	}
+
+	missing, err := readConfigSettings(filepath.Join(tmpDir, "nope.conf"))
+	if err != nil || len(missing) != 0 {
+		t.Fatalf("expected empty settings for a missing file, got %v, %v", missing, err)
+	}
+}
+
 func TestArchivedEpisodesExcludedFromDownloadList(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -557,7 +667,7 @@ func TestArchivedEpisodesExcludedFromDownloadList(t *testing.T) {
 	}
 
 	// Neither episode has a local file in tmpDir.
-	generateDownloadList(tmpDir, []string{tmpDir})
+	generateDownloadList(st, tmpDir, []string{tmpDir})
 
 	scriptText, err := os.ReadFile(filepath.Join(tmpDir, "download_pods.sh"))
 	if err != nil {
@@ -574,7 +684,7 @@ func TestArchivedEpisodesExcludedFromDownloadList(t *testing.T) {
 
 func TestRegisterAndUnregisterArchiveDir(t *testing.T) {
 	useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	archiveDir := t.TempDir()
 	for _, name := range []string{
@@ -588,7 +698,7 @@ func TestRegisterAndUnregisterArchiveDir(t *testing.T) {
 		}
 	}
 
-	n, err := registerArchiveDir(archiveDir)
+	n, err := registerArchiveDir(st, archiveDir)
 	if err != nil {
 		t.Fatalf("registerArchiveDir: %v", err)
 	}
@@ -596,7 +706,7 @@ func TestRegisterAndUnregisterArchiveDir(t *testing.T) {
 		t.Fatalf("registered %d, want 2", n)
 	}
 
-	hashes := fetchArchivedHashes()
+	hashes := mustArchivedHashes(t, st)
 	if !hashes.Contains("aaa111") || !hashes.Contains("bbb222") {
 		t.Fatalf("expected both hashes registered, got %v", hashes)
 	}
@@ -605,40 +715,40 @@ func TestRegisterAndUnregisterArchiveDir(t *testing.T) {
 	}
 
 	// Re-running register on the same dir should refresh, not duplicate.
-	n, err = registerArchiveDir(archiveDir)
+	n, err = registerArchiveDir(st, archiveDir)
 	if err != nil {
 		t.Fatalf("second registerArchiveDir: %v", err)
 	}
 	if n != 2 {
 		t.Fatalf("re-registered %d, want 2", n)
 	}
-	if fetchArchivedHashes().Cardinality() != 2 {
+	if mustArchivedHashes(t, st).Cardinality() != 2 {
 		t.Fatalf("expected still 2 archived hashes after re-register")
 	}
 
 	// Unregister.
-	n, err = unregisterArchiveDir(archiveDir)
+	n, err = unregisterArchiveDir(st, archiveDir)
 	if err != nil {
 		t.Fatalf("unregisterArchiveDir: %v", err)
 	}
 	if n != 2 {
 		t.Fatalf("unregistered %d, want 2", n)
 	}
-	if fetchArchivedHashes().Cardinality() != 0 {
+	if mustArchivedHashes(t, st).Cardinality() != 0 {
 		t.Fatalf("expected 0 archived hashes after unregister")
 	}
 }
 
 func TestReconcileArchiveRegistry(t *testing.T) {
 	useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	archiveDir := t.TempDir()
 	stillThere := "PodA-2020-01-02-Still_There-aaa111.mp3"
 	if err := os.WriteFile(filepath.Join(archiveDir, stillThere), []byte("x"), 0666); err != nil {
 		t.Fatalf("write file: %v", err)
 	}
-	if _, err := registerArchiveDir(archiveDir); err != nil {
+	if _, err := registerArchiveDir(st, archiveDir); err != nil {
 		t.Fatalf("register: %v", err)
 	}
 
@@ -656,14 +766,14 @@ func TestReconcileArchiveRegistry(t *testing.T) {
 		t.Fatalf("insert ghost: %v", err)
 	}
 
-	removed, err := reconcileArchiveRegistry()
+	removed, err := reconcileArchiveRegistry(st)
 	if err != nil {
 		t.Fatalf("reconcile: %v", err)
 	}
 	if removed != 1 {
 		t.Fatalf("removed %d, want 1", removed)
 	}
-	hashes := fetchArchivedHashes()
+	hashes := mustArchivedHashes(t, st)
 	if hashes.Contains("ghost123") {
 		t.Fatalf("ghost row should have been removed")
 	}
@@ -721,7 +831,7 @@ func TestNameMinusHash(t *testing.T) {
 // This is the 2026-07-05 incident scenario.
 func TestRotatedURLHashTwinOnDiskExcludedFromDownloadList(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -771,7 +881,7 @@ func TestRotatedURLHashTwinOnDiskExcludedFromDownloadList(t *testing.T) {
 		t.Fatalf("insert episodes: %v", err)
 	}
 
-	generateDownloadList(tmpDir, []string{tmpDir})
+	generateDownloadList(st, tmpDir, []string{tmpDir})
 
 	script, err := os.ReadFile(filepath.Join(tmpDir, "download_pods.sh"))
 	if err != nil {
@@ -791,7 +901,7 @@ func TestRotatedURLHashTwinOnDiskExcludedFromDownloadList(t *testing.T) {
 // unmounted volume and no scan path can see it.
 func TestRotatedURLHashTwinInRegistryExcludedFromDownloadList(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -829,7 +939,7 @@ func TestRotatedURLHashTwinInRegistryExcludedFromDownloadList(t *testing.T) {
 		t.Fatalf("insert episode: %v", err)
 	}
 
-	generateDownloadList(tmpDir, []string{tmpDir})
+	generateDownloadList(st, tmpDir, []string{tmpDir})
 
 	script, err := os.ReadFile(filepath.Join(tmpDir, "download_pods.sh"))
 	if err == nil && strings.Contains(string(script), currentURL) {
@@ -845,7 +955,7 @@ func TestRotatedURLHashTwinInRegistryExcludedFromDownloadList(t *testing.T) {
 // "The Deobandis" pair the 2026-07-04 dedup run conflated.
 func TestSameDayDigitCollidingEpisodesStillDownloaded(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -894,7 +1004,7 @@ func TestSameDayDigitCollidingEpisodesStillDownloaded(t *testing.T) {
 		t.Fatalf("insert episodes: %v", err)
 	}
 
-	generateDownloadList(tmpDir, []string{tmpDir})
+	generateDownloadList(st, tmpDir, []string{tmpDir})
 
 	script, err := os.ReadFile(filepath.Join(tmpDir, "download_pods.sh"))
 	if err != nil {
@@ -908,3 +1018,36 @@ func TestSameDayDigitCollidingEpisodesStillDownloaded(t *testing.T) {
 		t.Fatalf("expected Part 2 (present on disk) to be excluded, got %q", text)
 	}
 }
+
+// One file that can't be tagged is logged and left for the next -t; the
+// rest are tagged.
+func TestTagThosePodsSkipsBadFile(t *testing.T) {
+	tmpDir := useTempWorkingDir(t)
+	st := openTestStore(t)
+	names := map[string]string{"good": "Pod-2024-01-01-Good-aaa.mp3", "bad": "Pod-2024-01-02-Bad-bbb.mp3"}
+	for title, name := range names {
+		hash := "h-" + title
+		if _, err := st.q.Exec(`INSERT INTO episodes (title, first_seen, last_seen, podcast_title, podcastname_episodename_hash)
+			VALUES (?, ?, ?, 'Pod', ?);`, title, ts, ts, hash); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.recordDownloadSeen(name, hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The bad one is missing, and there is no eyeD3 to strip its tags with
+	if err := os.WriteFile(filepath.Join(tmpDir, names["good"]), make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := tagThosePods(st, tmpDir, "", ""); n != 1 {
+		t.Fatalf("tagged %d file(s), want 1", n)
+	}
+	pending, err := st.untaggedDownloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].filename != names["bad"] {
+		t.Fatalf("still untagged: %+v", pending)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+// Per-podcast tuning of the retitle and dedup heuristics.
+//
+// The thresholds in skip.go and dedup.go were tuned on the library as a
+// whole, but a daily news feed and a weekly interview show want different
+// values: a daily feed's recurring topic titles need a tighter near-date
+// window, a feed that re-encodes needs more size slack. podcast_settings
+// holds per-podcast overrides, keyed by podcast title; every podcast without
+// one gets the built-in defaults (the constants in skip.go and dedup.go), so
+// tightening one noisy feed changes nothing for the others.
+//
+// The overrides are loaded once per run into podcastHeuristics, like the
+// verbose flag, so the pure planners can look them up by podcast title with
+// heuristicsFor.
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// heuristics is one podcast's set of thresholds.
+type heuristics struct {
+	retitleContainMinRunes int
+	retitleJaccardMin      float64
+	retitleMinWordsHits    int
+	nearDateWindowDays     int
+	livenessWindow         time.Duration
+	retitleMinMatches      int
+	stubMaxBytes           int64
+	bigKeeperMinBytes      int64
+	sizeSlackBytes         int64
+}
+
+var defaultHeuristics = heuristics{
+	retitleContainMinRunes: retitleContainMinRunes,
+	retitleJaccardMin:      retitleJaccardMin,
+	retitleMinWordsHits:    retitleMinWordsHits,
+	nearDateWindowDays:     nearDateSkipWindowDays,
+	livenessWindow:         dedupLivenessWindow,
+	retitleMinMatches:      retitleMinMatches,
+	stubMaxBytes:           dedupStubMaxBytes,
+	bigKeeperMinBytes:      dedupBigKeeperMinBytes,
+	sizeSlackBytes:         dedupSizeSlackBytes,
+}
+
+// podcastHeuristics maps podcast title to its tuned heuristics; podcasts
+// without overrides are absent. Set at startup by loadPodcastHeuristics.
+var podcastHeuristics = map[string]heuristics{}
+
+// heuristicsFor returns the thresholds for podcast.
+func heuristicsFor(podcast string) heuristics {
+	if h, ok := podcastHeuristics[podcast]; ok {
+		return h
+	}
+	return defaultHeuristics
+}
+
+// heuristicSetting is one tunable, as named in podcast_settings.
+type heuristicSetting struct {
+	key  string
+	help string
+	get  func(h heuristics) string
+	set  func(h *heuristics, v string) error
+}
+
+func intSetting(key, help string, field func(h *heuristics) *int) heuristicSetting {
+	return heuristicSetting{key: key, help: help,
+		get: func(h heuristics) string { return strconv.Itoa(*field(&h)) },
+		set: func(h *heuristics, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%s wants a whole number >= 0, not %q", key, v)
+			}
+			*field(h) = n
+			return nil
+		}}
+}
+
+func bytesSetting(key, help string, field func(h *heuristics) *int64) heuristicSetting {
+	return heuristicSetting{key: key, help: help,
+		get: func(h heuristics) string { return strconv.FormatInt(*field(&h), 10) },
+		set: func(h *heuristics, v string) error {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%s wants a byte count >= 0, not %q", key, v)
+			}
+			*field(h) = n
+			return nil
+		}}
+}
+
+// heuristicSettings lists every tunable in display order.
+var heuristicSettings = []heuristicSetting{
+	intSetting("retitle_contain_min_runes", "shortest title that counts as a truncation retitle when contained in another",
+		func(h *heuristics) *int { return &h.retitleContainMinRunes }),
+	{key: "retitle_jaccard_min", help: "minimum content-word Jaccard similarity for a reworded retitle (0-1)",
+		get: func(h heuristics) string { return strconv.FormatFloat(h.retitleJaccardMin, 'f', -1, 64) },
+		set: func(h *heuristics, v string) error {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 || f > 1 {
+				return fmt.Errorf("retitle_jaccard_min wants a number from 0 to 1, not %q", v)
+			}
+			h.retitleJaccardMin = f
+			return nil
+		}},
+	intSetting("retitle_min_word_hits", "minimum shared content words for a reworded retitle",
+		func(h *heuristics) *int { return &h.retitleMinWordsHits }),
+	intSetting("near_date_window_days", "rule 3a: days either side within which a same-titled episode is a re-issue",
+		func(h *heuristics) *int { return &h.nearDateWindowDays }),
+	{key: "liveness_window_days", help: "days since the feed last listed an episode before dedup treats its row as stale",
+		get: func(h heuristics) string { return strconv.Itoa(int(h.livenessWindow / (24 * time.Hour))) },
+		set: func(h *heuristics, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return fmt.Errorf("liveness_window_days wants a whole number of days >= 1, not %q", v)
+			}
+			h.livenessWindow = time.Duration(n) * 24 * time.Hour
+			return nil
+		}},
+	intSetting("retitle_min_matches", "dedup-retitles: matching episodes needed to pair a renamed podcast",
+		func(h *heuristics) *int { return &h.retitleMinMatches }),
+	bytesSetting("stub_max_bytes", "largest file dedup treats as a failed-download stub",
+		func(h *heuristics) *int64 { return &h.stubMaxBytes }),
+	bytesSetting("big_keeper_min_bytes", "smallest keeper next to which a stub is removed",
+		func(h *heuristics) *int64 { return &h.bigKeeperMinBytes }),
+	bytesSetting("size_slack_bytes", "size gap (and >5%) beyond which a smaller keeper is suspicious",
+		func(h *heuristics) *int64 { return &h.sizeSlackBytes }),
+}
+
+func heuristicSettingNamed(key string) (heuristicSetting, bool) {
+	for _, hs := range heuristicSettings {
+		if hs.key == key {
+			return hs, true
+		}
+	}
+	return heuristicSetting{}, false
+}
+
+// parseSettingAssignment splits "key=value".
+func parseSettingAssignment(s string) (string, string, error) {
+	key, value, ok := strings.Cut(s, "=")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !ok || key == "" || value == "" {
+		return "", "", fmt.Errorf("want key=value, not %q", s)
+	}
+	return key, value, nil
+}
+
+// setPodcastSetting stores one override after checking the podcast exists
+// and the value parses.
+func (s *store) setPodcastSetting(podcast, key, value string) error {
+	hs, ok := heuristicSettingNamed(key)
+	if !ok {
+		return fmt.Errorf("unknown setting %q (see --heuristics)", key)
+	}
+	h := defaultHeuristics
+	if err := hs.set(&h, value); err != nil {
+		return err
+	}
+	var n int
+	if err := s.q.QueryRow(`SELECT count(*) FROM podcasts WHERE title = ?;`, podcast).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no podcast titled %q", podcast)
+	}
+	_, err := s.q.Exec(`
+		INSERT INTO podcast_settings (podcast_title, key, value, updated)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(podcast_title, key) DO UPDATE SET
+			value = excluded.value,
+			updated = excluded.updated
+		;`, podcast, key, value, ts)
+	return err
+}
+
+// clearPodcastSetting removes one override, reporting whether there was one.
+func (s *store) clearPodcastSetting(podcast, key string) (bool, error) {
+	res, err := s.q.Exec(`DELETE FROM podcast_settings WHERE podcast_title = ? AND key = ?;`, podcast, key)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// podcastSettingRow is a podcast_settings row.
+type podcastSettingRow struct {
+	podcast, key, value string
+}
+
+func (s *store) podcastSettings() ([]podcastSettingRow, error) {
+	rows, err := s.q.Query(`SELECT podcast_title, key, value FROM podcast_settings ORDER BY podcast_title, key;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]podcastSettingRow, 0)
+	for rows.Next() {
+		var r podcastSettingRow
+		if err := rows.Scan(&r.podcast, &r.key, &r.value); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// loadPodcastHeuristics builds the per-podcast thresholds from
+// podcast_settings. A row that no longer parses is an error rather than a
+// silent fallback to the default.
+func (s *store) loadPodcastHeuristics() (map[string]heuristics, error) {
+	rows, err := s.podcastSettings()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]heuristics)
+	for _, r := range rows {
+		hs, ok := heuristicSettingNamed(r.key)
+		if !ok {
+			return nil, fmt.Errorf("podcast_settings: unknown setting %q for %q", r.key, r.podcast)
+		}
+		h, seen := out[r.podcast]
+		if !seen {
+			h = defaultHeuristics
+		}
+		if err := hs.set(&h, r.value); err != nil {
+			return nil, fmt.Errorf("podcast_settings for %q: %w", r.podcast, err)
+		}
+		out[r.podcast] = h
+	}
+	return out, nil
+}
+
+// printHeuristics lists every setting with its default, then each podcast's
+// overrides.
+func printHeuristics(w io.Writer, rows []podcastSettingRow) {
+	fmt.Fprintln(w, "Settings (default):")
+	for _, hs := range heuristicSettings {
+		fmt.Fprintf(w, "  %-26s %-8s %s\n", hs.key, hs.get(defaultHeuristics), hs.help)
+	}
+	byPodcast := make(map[string][]podcastSettingRow)
+	for _, r := range rows {
+		byPodcast[r.podcast] = append(byPodcast[r.podcast], r)
+	}
+	podcasts := make([]string, 0, len(byPodcast))
+	for p := range byPodcast {
+		podcasts = append(podcasts, p)
+	}
+	sort.Strings(podcasts)
+	if len(podcasts) == 0 {
+		fmt.Fprintln(w, "\nNo per-podcast overrides")
+		return
+	}
+	for _, p := range podcasts {
+		fmt.Fprintf(w, "\n%s:\n", p)
+		for _, r := range byPodcast[p] {
+			fmt.Fprintf(w, "  %-26s %s\n", r.key, r.value)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// setPodcastHeuristics installs per-podcast overrides for one test.
+func setPodcastHeuristics(t *testing.T, m map[string]heuristics) {
+	t.Helper()
+	old := podcastHeuristics
+	podcastHeuristics = m
+	t.Cleanup(func() { podcastHeuristics = old })
+}
+
+func TestPodcastSettingsRoundTrip(t *testing.T) {
+	st := searchTestStore(t)
+
+	if err := st.setPodcastSetting("In Our Time", "near_date_window_days", "2"); err != nil {
+		t.Fatalf("setPodcastSetting: %v", err)
+	}
+	if err := st.setPodcastSetting("In Our Time", "size_slack_bytes", "5000000"); err != nil {
+		t.Fatalf("setPodcastSetting: %v", err)
+	}
+	for _, bad := range []struct{ podcast, key, value string }{
+		{"No Such Show", "near_date_window_days", "2"},
+		{"In Our Time", "no_such_setting", "2"},
+		{"In Our Time", "near_date_window_days", "-1"},
+		{"In Our Time", "retitle_jaccard_min", "1.5"},
+		{"In Our Time", "liveness_window_days", "0"},
+	} {
+		if err := st.setPodcastSetting(bad.podcast, bad.key, bad.value); err == nil {
+			t.Errorf("setPodcastSetting(%q, %s=%s) should fail", bad.podcast, bad.key, bad.value)
+		}
+	}
+
+	loaded, err := st.loadPodcastHeuristics()
+	if err != nil {
+		t.Fatalf("loadPodcastHeuristics: %v", err)
+	}
+	want := defaultHeuristics
+	want.nearDateWindowDays = 2
+	want.sizeSlackBytes = 5000000
+	if len(loaded) != 1 || loaded["In Our Time"] != want {
+		t.Fatalf("loaded %+v, want only In Our Time as %+v", loaded, want)
+	}
+
+	if cleared, err := st.clearPodcastSetting("In Our Time", "near_date_window_days"); err != nil || !cleared {
+		t.Fatalf("clearPodcastSetting = %v, %v", cleared, err)
+	}
+	if cleared, _ := st.clearPodcastSetting("In Our Time", "near_date_window_days"); cleared {
+		t.Fatal("clearing twice should report nothing cleared")
+	}
+	loaded, _ = st.loadPodcastHeuristics()
+	if loaded["In Our Time"].nearDateWindowDays != nearDateSkipWindowDays {
+		t.Fatalf("expected the default window back, got %+v", loaded["In Our Time"])
+	}
+
+	if _, _, err := parseSettingAssignment("near_date_window_days"); err == nil {
+		t.Error("parseSettingAssignment without = should fail")
+	}
+}
+
+// A tightened near-date window stops rule 3a for that podcast only.
+func TestPerPodcastNearDateWindow(t *testing.T) {
+	tight := defaultHeuristics
+	tight.nearDateWindowDays = 1
+	setPodcastHeuristics(t, map[string]heuristics{"Daily": tight})
+
+	cands := make([]downloadCandidate, 0, 4)
+	for _, pod := range []string{"Daily", "Weekly"} {
+		cands = append(cands,
+			downloadCandidate{podcastTitle: pod, published: "2015-12-08T00:00:00Z",
+				title: "WS MoreOrLess: Climate Change", episodeHash: pod + "-ws", guid: "g-ws", have: true},
+			downloadCandidate{podcastTitle: pod, published: "2015-12-05T00:00:00Z",
+				title: "Climate Change", episodeHash: pod + "-r4", guid: "g-r4"})
+	}
+	skips := planDownloadSkips(cands)
+	if _, ok := skips["Daily-r4"]; ok {
+		t.Errorf("a 3-day re-issue is outside Daily's 1-day window, got %+v", skips)
+	}
+	if s, ok := skips["Weekly-r4"]; !ok || s.rule != "3a" {
+		t.Errorf("Weekly keeps the default window and should skip by rule 3a, got %+v", skips)
+	}
+}
+
+// Size slack and liveness are looked up by the owning podcast.
+func TestPerPodcastDedupThresholds(t *testing.T) {
+	loose := defaultHeuristics
+	loose.sizeSlackBytes = 5000000
+	loose.livenessWindow = 30 * 24 * time.Hour
+	setPodcastHeuristics(t, map[string]heuristics{"Reencoder": loose})
+
+	// The canonical copy is 3MB smaller than a legacy one: suspicious under
+	// the default slack, so the larger copy is kept and renamed
+	hash := strings.Repeat("a", 32)
+	keeperOf := func(pod string) string {
+		canonical := mkFile("/pods", pod, "Ep", "2020-01-01", hash, 30000000)
+		legacy := mkFile("/arch", pod, "Ep", "2020-01-01", strings.Repeat("9", 32), 33000000)
+		actions := make([]dedupAction, 0, 2)
+		dedupCopies([]dedupFile{canonical, legacy}, hash, canonical.name, heuristicsFor(pod), &actions)
+		for _, a := range actions {
+			if a.kind == actDelete {
+				return a.keeperPath
+			}
+		}
+		t.Fatalf("%s: expected a delete, got %+v", pod, actions)
+		return ""
+	}
+	if k := keeperOf("Strict"); !strings.HasPrefix(k, "/arch/") {
+		t.Errorf("default slack should keep the larger legacy copy, kept %s", k)
+	}
+	if k := keeperOf("Reencoder"); !strings.HasPrefix(k, "/pods/") {
+		t.Errorf("Reencoder's slack should keep the canonical copy, kept %s", k)
+	}
+
+	tenDays := dedupNow.Add(-10 * 24 * time.Hour).Format(time.RFC3339)
+	if ownerIsLive(dedupOwner{podcastTitle: "Strict", lastSeen: tenDays}, dedupNow) {
+		t.Error("10 days unseen is stale under the default window")
+	}
+	if !ownerIsLive(dedupOwner{podcastTitle: "Reencoder", lastSeen: tenDays}, dedupNow) {
+		t.Error("10 days unseen is live under Reencoder's 30-day window")
+	}
+}
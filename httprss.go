@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -126,6 +128,7 @@ func parseLogic(feed *gofeed.Feed) (map[string]string, []M, error) {
 		if len(item.Enclosures) == 1 {
 			i[file] = strings.TrimSpace(item.Enclosures[0].URL)
 			i[format] = strings.TrimSpace(item.Enclosures[0].Type)
+			i[fileSize] = strings.TrimSpace(item.Enclosures[0].Length)
 		} else {
 			if len(item.Enclosures) == 0 {
 				// Enclosures is empty
@@ -143,16 +146,20 @@ func parseLogic(feed *gofeed.Feed) (map[string]string, []M, error) {
 				i[author] = strings.TrimSpace(item.ITunesExt.Author)
 			}
 
-			// Pick up itunes episode while we are at in
+			// Pick up itunes episode and season while we are at in
 			i[episode] = strings.TrimSpace(item.ITunesExt.Episode)
+			i[season] = strings.TrimSpace(item.ITunesExt.Season)
+			i[duration] = strings.TrimSpace(item.ITunesExt.Duration)
 
 			// If desc is empty use itunes summary
 			if i[description] == "" {
 				i[description] = strings.TrimSpace(item.ITunesExt.Summary)
 			}
 		} else {
-			// Set episode to empty string if we have not picked it up
+			// Set episode and season to empty strings if we have not picked them up
 			i[episode] = ""
+			i[season] = ""
+			i[duration] = ""
 		}
 
 		sItems = append(sItems, i)
@@ -161,15 +168,48 @@ func parseLogic(feed *gofeed.Feed) (map[string]string, []M, error) {
 	return pod, sItems, err
 }
 
-// parseFeed a function to to parse an individual RSS feed
+// parseFeed a function to to parse an individual RSS feed. The body comes
+// from feedFetcher: the network normally, or a snapshot dir with
+// --record-feeds / --replay-feeds (see feedsnapshot.go).
 func parseFeed(url string) (map[string]string, []M, error) {
+	log.Println("Parsing " + url)
+
+	body, err := feedFetcher.fetch(url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+
+	// If there is an error parsing the feed then return with the error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return parseLogic(feed)
+}
+
+// feedSource supplies raw feed bodies by URL.
+type feedSource interface {
+	fetch(url string) ([]byte, error)
+}
+
+// feedFetcher is where parseFeed gets feeds, set once in main. Like verbose,
+// it is a process-wide switch rather than a parameter threaded through the
+// parse workers and the TUI.
+var feedFetcher feedSource = httpFeedSource{}
+
+// httpFeedSource fetches feeds over the network.
+type httpFeedSource struct{}
+
+// feedUserAgent looks like Chrome/Brave; some hosts refuse obvious bots.
+const feedUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36"
+
+func (httpFeedSource) fetch(url string) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	log.Println("Parsing " + url)
-	fp := gofeed.NewParser()
-
-	fp.Client = &http.Client{
+	client := &http.Client{
 		// Extend the timeout a bit. See also: https://github.com/mmcdole/gofeed/issues/83#issuecomment-355485788
 		Timeout: 60 * time.Second,
 		// Allow various ciphers. See also: https://github.com/golang/go/issues/44267#issuecomment-819278575
@@ -188,15 +228,21 @@ func parseFeed(url string) (map[string]string, []M, error) {
 			},
 		}}
 
-	// Change the user agent to something that looks like Chrome/Brave
-	fp.UserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36"
-
-	feed, err := fp.ParseURLWithContext(url, ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", feedUserAgent)
 
-	// If there is an error parsing the feed then return with the error
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	return parseLogic(feed)
+	// Same error gofeed's ParseURL gives, so isHttpError still recognises it
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, gofeed.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return io.ReadAll(resp.Body)
 }
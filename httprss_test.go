@@ -75,3 +75,26 @@ func TestParseLogic(t *testing.T) {
 		// UPTO
 	}
 }
+
+// itunes:duration and the enclosure length are kept for the TUI detail pane.
+func TestParseLogicDurationAndSize(t *testing.T) {
+	feed, err := gofeed.NewParser().ParseString(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"><channel><title>Pod</title>
+<item><title>Ep</title><itunes:duration>58:12</itunes:duration>
+<enclosure url="https://example.com/ep.mp3" type="audio/mpeg" length="52428800"/></item>
+<item><title>Bare</title><enclosure url="https://example.com/bare.mp3" type="audio/mpeg"/></item>
+</channel></rss>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, items, err := parseLogic(feed)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("parseLogic = %d items, %v", len(items), err)
+	}
+	if items[0][duration] != "58:12" || items[0][fileSize] != "52428800" {
+		t.Errorf("Ep: duration %v size %v", items[0][duration], items[0][fileSize])
+	}
+	if items[1][duration] != "" || items[1][fileSize] != "" {
+		t.Errorf("Bare: duration %v size %v", items[1][duration], items[1][fileSize])
+	}
+}
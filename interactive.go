@@ -1,19 +1,16 @@
 package main
 
 import (
-	"bufio"
 	"crypto/md5"
-	"database/sql"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -26,17 +23,20 @@ We are aiming for the filename treatment to be the same in both modes, such that
 
 const initialListLimit = 10
 const extraConfName = "gopodder-extra.conf"
-const downloadOutputLimit = 12
 
 // runInteractive launches the Bubble Tea UI and downloads selected episodes.
-func runInteractive(defaultFolder string, pythonPath string, eyeD3Dir string) error {
+// confDir holds gopodder.conf, for the subscriptions screen; scanPaths are
+// the podcasts dir then the archive dirs, for the library.
+func runInteractive(s *store, confDir string, defaultFolder string, scanPaths []string, pythonPath string, eyeD3Dir string) error {
 	if log != nil {
 		prev := log.Writer()
 		log.SetOutput(io.Discard)
 		defer log.SetOutput(prev)
 	}
 
-	model := newInteractiveModel(defaultFolder, pythonPath, eyeD3Dir)
+	model := newInteractiveModel(s, defaultFolder, pythonPath, eyeD3Dir)
+	model.subFiles.batch = filepath.Join(confDir, confFile)
+	model.scanPaths = scanPaths
 	_, err := tea.NewProgram(model).Run()
 	return err
 }
@@ -50,41 +50,58 @@ const (
 	stepSelect
 	stepFolder
 	stepDownloading
-	stepDone
+	stepSearch
+	stepSubscriptions
+	stepDirectory
+	stepLibrary
+	stepSkipReview
 )
 
 type episodeItem struct {
-	title      string
-	date       time.Time
-	dateStr    string
-	url        string
-	filename   string
-	selected   bool
-	downloaded bool
+	podcastTitle string // set on lists that span podcasts (search, what's new)
+	title        string
+	date         time.Time
+	dateStr      string
+	url          string
+	filename     string
+	hash         string // podcastname_episodename_hash; "" for a fresh feed
+	description  string
+	status       string // a search status; "" when not known (a fresh feed)
+	selected     bool
+	downloaded   bool
+	play         playState
 }
 
 type feedParsedMsg struct {
-	podTitle string
-	episodes []episodeItem
-	skipped  int
-	err      error
-}
-
-type downloadResultMsg struct {
-	index    int
-	filename string
-	err      error
-}
-
-type downloadOutputMsg struct {
-	line string
-	done bool
+	podTitle      string
+	searchQuery   string
+	whatsNew      bool
+	fromDirectory bool // previewing a podcast directory result
+	episodes      []episodeItem
+	skipped       int
+	err           error
 }
 
 type interactiveModel struct {
 	step               interactiveStep
+	store              *store
 	urlInput           textinput.Model
 	folderInput        textinput.Model
+	searchInput        textinput.Model
+	searchQuery        string
+	whatsNew           bool // the list is the what's new screen
+	fromDirectory      bool // the list previews a podcast directory result
+	directoryInput     textinput.Model
+	directoryQuery     string
+	directoryResults   []directoryResult
+	directoryCursor    int
+	directorySearching bool
+	directoryFrom      interactiveStep // where esc on the directory search goes back to
+	filterInput        textinput.Model
+	filtering          bool
+	filter             episodeFilter
+	showDetail         bool
+	details            map[string]episodeDetail // by episode hash
 	feedFile           string
 	feedOptions        []string
 	feedOptionsAreURLs bool
@@ -97,24 +114,31 @@ type interactiveModel struct {
 	cursor             int
 	viewOffset         int
 	windowSize         int
+	width              int
+	height             int
 	showAll            bool
 	skipped            int
 	errMsg             string
-	outPath            string
-	outputCount        int
-	downloadIdx        int
-	downloadTo         string
-	downloadSet        []episodeItem
-	downloadErr        []string
-	downloadOK         int
-	downloadOKFiles    []string
-	downloadOut        []string
-	downloadCh         chan string
+	downloads          *downloadManager
+	downloadCursor     int
+	downloadsFrom      interactiveStep // where b on the download manager goes back to
+	subFiles           subscriptionFiles
+	subs               []subscription
+	subCursor          int
+	scanPaths          []string
+	library            []libraryEntry
+	libraryCursor      int
+	libraryConfirm     string // the action key pressed once, awaiting a second press
+	skipReviews        []skipReview
+	skipCursor         int
+	keys               keyMap
+	showHelp           bool // the ? overlay is up
+	quitConfirm        bool // quit was pressed with something to lose
 	pythonPath         string
 	eyeD3Dir           string
 }
 
-func newInteractiveModel(defaultFolder string, pythonPath string, eyeD3Dir string) interactiveModel {
+func newInteractiveModel(s *store, defaultFolder string, pythonPath string, eyeD3Dir string) interactiveModel {
 	urlInput := textinput.New()
 	urlInput.Placeholder = "https://example.com/feed.rss"
 	urlInput.Focus()
@@ -127,25 +151,50 @@ func newInteractiveModel(defaultFolder string, pythonPath string, eyeD3Dir strin
 	folderInput.CharLimit = 1024
 	folderInput.Width = 60
 
-	model := interactiveModel{
-		step:        stepURL,
-		urlInput:    urlInput,
-		folderInput: folderInput,
-		windowSize:  10,
-		pythonPath:  pythonPath,
-		eyeD3Dir:    eyeD3Dir,
-	}
+	searchInput := textinput.New()
+	searchInput.Placeholder = "words from a title, description or author"
+	searchInput.CharLimit = 256
+	searchInput.Width = 60
+
+	directoryInput := textinput.New()
+	directoryInput.Placeholder = "podcast name"
+	directoryInput.CharLimit = 256
+	directoryInput.Width = 60
 
-	dbTitles, err := loadPodcastTitlesFromDatabase()
+	filterInput := textinput.New()
+	filterInput.Placeholder = "words since:YYYY-MM-DD until:YYYY-MM-DD status:pending played:no"
+	filterInput.CharLimit = 256
+	filterInput.Width = 60
+
+	model := interactiveModel{
+		step:           stepURL,
+		store:          s,
+		urlInput:       urlInput,
+		folderInput:    folderInput,
+		searchInput:    searchInput,
+		directoryInput: directoryInput,
+		filterInput:    filterInput,
+		details:        make(map[string]episodeDetail),
+		downloads:      newDownloadManager(s, parallelDownloads, pythonPath, eyeD3Dir),
+		subFiles:       subscriptionFiles{batch: confFile, extra: filepath.Join(defaultFolder, extraConfName)},
+		scanPaths:      []string{defaultFolder},
+		keys:           tuiKeys,
+		windowSize:     10,
+		pythonPath:     pythonPath,
+		eyeD3Dir:       eyeD3Dir,
+	}
+
+	dbTitles, err := s.loadPodcastTitlesFromDatabase()
 	if err == nil && len(dbTitles) > 0 {
-		model.step = stepFeedSelect
-		model.feedFile = dbFileName
+		// Start on what's new; Init loads it, and the podcast list is a b away
+		model.step = stepLoading
+		model.feedFile = s.path
 		model.feedOptions = dbTitles
 		model.feedOptionsAreURLs = false
 		return model
 	}
 	if err != nil {
-		model.errMsg = fmt.Sprintf("Failed to read podcast titles from %s; enter URL manually.", dbFileName)
+		model.errMsg = fmt.Sprintf("Failed to read podcast titles from %s; enter URL manually.", s.path)
 	}
 
 	feedFile, feedOptions, feedErr, exists := loadExtraFeeds(defaultFolder)
@@ -168,10 +217,42 @@ func newInteractiveModel(defaultFolder string, pythonPath string, eyeD3Dir strin
 }
 
 func (m interactiveModel) Init() tea.Cmd {
+	if m.step == stepLoading {
+		return loadWhatsNewCmd(m.store)
+	}
 	return textinput.Blink
 }
 
 func (m interactiveModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	// Downloads carry on whichever screen is showing
+	switch msg := msg.(type) {
+	case downloadProgressMsg:
+		return m, m.downloads.progress(msg)
+	case downloadFinishedMsg:
+		ok, cmd := m.downloads.finished(msg)
+		if ok {
+			m.markDownloaded(m.downloads.jobs[msg.id].item.filename)
+		}
+		return m, cmd
+	case playStateMsg:
+		if msg.err != nil {
+			m.errMsg = msg.err.Error()
+			return m, nil
+		}
+		m.setPlayState(msg.hash, msg.state)
+		m.errMsg = msg.note
+		if m.step == stepSelect && m.filter.played != "" {
+			m.rebuildVisibleItems()
+		}
+		return m, nil
+	case tea.KeyMsg:
+		next, cmd, handled := m.updateGlobalKeys(msg)
+		if handled {
+			return next, cmd
+		}
+		m = next
+	}
+
 	switch m.step {
 	case stepURL:
 		return m.updateURL(msg)
@@ -180,13 +261,25 @@ func (m interactiveModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case stepLoading:
 		return m.updateLoading(msg)
 	case stepSelect:
-		return m.updateSelect(msg)
+		next, cmd := m.updateSelect(msg)
+		if nm, ok := next.(interactiveModel); ok {
+			return nm, tea.Batch(cmd, nm.detailCmd())
+		}
+		return next, cmd
 	case stepFolder:
 		return m.updateFolder(msg)
 	case stepDownloading:
 		return m.updateDownloading(msg)
-	case stepDone:
-		return m.updateDone(msg)
+	case stepSearch:
+		return m.updateSearch(msg)
+	case stepSubscriptions:
+		return m.updateSubscriptions(msg)
+	case stepDirectory:
+		return m.updateDirectory(msg)
+	case stepLibrary:
+		return m.updateLibrary(msg)
+	case stepSkipReview:
+		return m.updateSkipReview(msg)
 	default:
 		return m, nil
 	}
@@ -199,14 +292,15 @@ func (m interactiveModel) updateURL(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 	case tea.KeyMsg:
 		switch msg.String() {
-		case "ctrl+c", "q":
-			return m, tea.Quit
-		case "b", "esc":
+		case "esc":
 			if len(m.feedOptions) > 0 {
 				m.step = stepFeedSelect
 				m.ensureFeedVisible()
 				return m, nil
 			}
+		case "tab":
+			m.urlInput.Blur()
+			return m, m.openDirectory()
 		case "enter":
 			url := strings.TrimSpace(m.urlInput.Value())
 			if url == "" {
@@ -216,7 +310,7 @@ func (m interactiveModel) updateURL(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			m.errMsg = ""
 			m.step = stepLoading
-			return m, fetchFeedCmd(url)
+			return m, fetchFeedCmd(m.store, url)
 		}
 	}
 
@@ -231,20 +325,19 @@ func (m interactiveModel) updateFeedSelect(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.updateWindowSize(msg)
 		return m, nil
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c", "q":
-			return m, tea.Quit
-		case "up", "k":
+		k := m.keys.feeds
+		switch {
+		case key.Matches(msg, m.keys.global.up):
 			if m.feedCursor > 0 {
 				m.feedCursor--
 				m.ensureFeedVisible()
 			}
-		case "down", "j":
+		case key.Matches(msg, m.keys.global.down):
 			if m.feedCursor < len(m.feedOptions)-1 {
 				m.feedCursor++
 				m.ensureFeedVisible()
 			}
-		case "enter":
+		case key.Matches(msg, k.open):
 			if len(m.feedOptions) == 0 {
 				m.errMsg = "No podcasts available."
 				return m, nil
@@ -261,20 +354,75 @@ func (m interactiveModel) updateFeedSelect(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.errMsg = ""
 			m.step = stepLoading
 			if m.feedOptionsAreURLs {
-				return m, fetchFeedCmd(selected)
+				return m, fetchFeedCmd(m.store, selected)
 			}
-			return m, loadEpisodesForPodcastCmd(selected)
-		case "m":
+			return m, loadEpisodesForPodcastCmd(m.store, selected)
+		case key.Matches(msg, k.manualURL):
 			m.step = stepURL
 			m.urlInput.Focus()
 			m.errMsg = ""
 			return m, nil
+		case key.Matches(msg, k.search):
+			m.step = stepSearch
+			m.searchInput.Focus()
+			m.errMsg = ""
+			return m, textinput.Blink
+		case key.Matches(msg, k.whatsNew):
+			if !m.feedOptionsAreURLs {
+				m.step = stepLoading
+				m.errMsg = ""
+				return m, loadWhatsNewCmd(m.store)
+			}
+		case key.Matches(msg, k.directory):
+			return m, m.openDirectory()
+		case key.Matches(msg, k.library):
+			m.step = stepLibrary
+			m.errMsg = ""
+			return m, loadLibraryCmd(m.store, m.scanPaths, "")
+		case key.Matches(msg, k.reviewSkips):
+			m.step = stepSkipReview
+			m.errMsg = ""
+			return m, loadSkipReviewsCmd(m.store, m.scanPaths, "")
+		case key.Matches(msg, k.subscriptions):
+			m.step = stepSubscriptions
+			m.errMsg = ""
+			return m, loadSubscriptionsCmd(m.store, m.subFiles, "")
 		}
 	}
 
 	return m, nil
 }
 
+func (m interactiveModel) updateSearch(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.updateWindowSize(msg)
+		return m, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc":
+			m.errMsg = ""
+			m.searchQuery = ""
+			m.step = stepFeedSelect
+			m.ensureFeedVisible()
+			return m, nil
+		case "enter":
+			query := strings.TrimSpace(m.searchInput.Value())
+			if len(searchTerms(query)) == 0 {
+				m.errMsg = "Enter words to search for."
+				return m, nil
+			}
+			m.errMsg = ""
+			m.step = stepLoading
+			return m, searchEpisodesCmd(m.store, query)
+		}
+	}
+
+	var cmd tea.Cmd
+	m.searchInput, cmd = m.searchInput.Update(msg)
+	return m, cmd
+}
+
 func (m interactiveModel) updateLoading(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
@@ -283,6 +431,14 @@ func (m interactiveModel) updateLoading(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case feedParsedMsg:
 		if msg.err != nil {
 			m.errMsg = fmt.Sprintf("Failed to load episodes: %v", msg.err)
+			if msg.fromDirectory {
+				m.step = stepDirectory
+				return m, nil
+			}
+			if msg.searchQuery != "" {
+				m.step = stepSearch
+				return m, nil
+			}
 			if len(m.feedOptions) > 0 {
 				m.step = stepFeedSelect
 				return m, nil
@@ -291,18 +447,31 @@ func (m interactiveModel) updateLoading(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
+		if msg.whatsNew && len(msg.episodes) == 0 {
+			m.errMsg = fmt.Sprintf("Nothing new in the last %d days; pick a podcast.", whatsNewDays)
+			m.step = stepFeedSelect
+			return m, nil
+		}
+
 		m.podTitle = msg.podTitle
+		m.searchQuery = msg.searchQuery
+		m.whatsNew = msg.whatsNew
+		m.fromDirectory = msg.fromDirectory
 		m.allItems = msg.episodes
 		m.skipped = msg.skipped
 		m.cursor = 0
 		m.viewOffset = 0
 		m.showAll = false
 		m.hideDownloaded = false
+		m.clearFilter()
 		m.errMsg = ""
 		m.rebuildVisibleItems()
 
 		if len(m.allItems) == 0 {
 			m.errMsg = "No downloadable episodes found."
+			if m.searchQuery != "" {
+				m.errMsg = fmt.Sprintf("No downloadable episodes match %q.", m.searchQuery)
+			}
 		}
 		m.step = stepSelect
 		return m, nil
@@ -316,33 +485,52 @@ func (m interactiveModel) updateSelect(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		m.updateWindowSize(msg)
 		return m, nil
+	case episodeDetailMsg:
+		if msg.err != nil {
+			m.errMsg = fmt.Sprintf("Failed to load episode details: %v", msg.err)
+			return m, nil
+		}
+		if m.details == nil {
+			m.details = make(map[string]episodeDetail)
+		}
+		m.details[msg.hash] = msg.detail
+		return m, nil
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c", "q":
-			return m, tea.Quit
-		case "up", "k":
+		if m.filtering {
+			return m.updateFilter(msg)
+		}
+		k := m.keys.episodes
+		switch {
+		case key.Matches(msg, k.filter):
+			m.filtering = true
+			m.errMsg = ""
+			return m, m.filterInput.Focus()
+		case key.Matches(msg, m.keys.global.up):
 			m.errMsg = ""
 			if m.cursor > 0 {
 				m.cursor--
 				m.ensureCursorVisible()
 			}
-		case "down", "j":
+		case key.Matches(msg, m.keys.global.down):
 			m.errMsg = ""
 			if limit := m.listLimit(); limit > 0 && m.cursor < limit-1 {
 				m.cursor++
 				m.ensureCursorVisible()
 			}
-		case " ":
+		case key.Matches(msg, k.toggle):
 			if len(m.items) > 0 {
 				if m.items[m.cursor].downloaded {
-					m.errMsg = "Already downloaded. Navigate or press d to dismiss."
+					m.errMsg = "Already downloaded. Navigate or press " + k.hideDownloaded.Help().Key + " to hide it."
+				} else if m.downloads.active(m.items[m.cursor].filename) {
+					m.errMsg = "Already downloading. Press " + m.keys.global.downloads.Help().Key + " to see the downloads."
 				} else {
 					m.items[m.cursor].selected = !m.items[m.cursor].selected
+					m.syncSelectionsToAllItems()
 					m.errMsg = ""
 				}
 			}
-		case "enter":
-			if len(m.items) == 0 {
+		case key.Matches(msg, k.next):
+			if len(m.allItems) == 0 {
 				m.errMsg = "Nothing to select."
 				return m, nil
 			}
@@ -355,7 +543,23 @@ func (m interactiveModel) updateSelect(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.step = stepFolder
 			m.folderInput.Focus()
 			return m, nil
-		case "b", "esc":
+		case key.Matches(msg, m.keys.global.back):
+			if msg.String() == "esc" && m.filter.active() {
+				m.clearFilter()
+				m.cursor = 0
+				m.rebuildVisibleItems()
+				m.errMsg = ""
+				return m, nil
+			}
+			if m.fromDirectory {
+				m.step = stepDirectory
+				return m, nil
+			}
+			if m.searchQuery != "" {
+				m.step = stepSearch
+				m.searchInput.Focus()
+				return m, nil
+			}
 			if len(m.feedOptions) > 0 {
 				m.step = stepFeedSelect
 				m.ensureFeedVisible()
@@ -364,18 +568,42 @@ func (m interactiveModel) updateSelect(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.step = stepURL
 			m.urlInput.Focus()
 			return m, nil
-		case "a":
+		case key.Matches(msg, k.details):
+			m.showDetail = !m.showDetail
+			m.resizeList()
+		case key.Matches(msg, k.play):
+			if len(m.items) == 0 {
+				return m, nil
+			}
+			cmd, err := m.playItemCmd(m.items[m.cursor])
+			if err != nil {
+				m.errMsg = err.Error()
+				return m, nil
+			}
+			m.errMsg = ""
+			return m, cmd
+		case key.Matches(msg, k.played):
+			if len(m.items) == 0 {
+				return m, nil
+			}
+			item := m.items[m.cursor]
+			if item.hash == "" {
+				m.errMsg = "This episode isn't in the db yet."
+				return m, nil
+			}
+			return m, togglePlayedCmd(m.store, item.hash, item.play)
+		case key.Matches(msg, k.showAll):
 			if len(m.items) > initialListLimit {
 				m.showAll = !m.showAll
 				m.ensureCursorVisible()
 			}
-		case "d":
+		case key.Matches(msg, k.hideDownloaded):
 			if m.downloadedCount() > 0 {
 				m.hideDownloaded = !m.hideDownloaded
 				m.rebuildVisibleItems()
 				m.errMsg = ""
 				if m.hideDownloaded && len(m.items) == 0 {
-					m.errMsg = "All episodes already downloaded. Press d to show them."
+					m.errMsg = "All episodes already downloaded. Press " + k.hideDownloaded.Help().Key + " to show them."
 				}
 			}
 		}
@@ -384,6 +612,61 @@ func (m interactiveModel) updateSelect(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// updateFilter handles keys while the `/` filter line has focus. The list
+// follows each keystroke; a line that doesn't parse yet (status:dow) keeps
+// the last good filter. Enter keeps the filter, esc drops it.
+func (m interactiveModel) updateFilter(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		m.filtering = false
+		m.filterInput.Blur()
+		if f, err := parseEpisodeFilter(m.filterInput.Value()); err != nil {
+			m.errMsg = err.Error()
+		} else {
+			m.filter = f
+			m.errMsg = ""
+		}
+		m.filterInput.SetValue(m.filter.raw)
+		return m, nil
+	case "esc":
+		m.clearFilter()
+		m.cursor = 0
+		m.rebuildVisibleItems()
+		m.errMsg = ""
+		return m, nil
+	case "up", "down":
+		m.errMsg = ""
+		if msg.String() == "up" && m.cursor > 0 {
+			m.cursor--
+		} else if limit := m.listLimit(); msg.String() == "down" && m.cursor < limit-1 {
+			m.cursor++
+		}
+		m.ensureCursorVisible()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.filterInput, cmd = m.filterInput.Update(msg)
+	f, err := parseEpisodeFilter(m.filterInput.Value())
+	if err != nil {
+		m.errMsg = err.Error()
+		return m, cmd
+	}
+	m.errMsg = ""
+	m.filter = f
+	m.cursor = 0
+	m.rebuildVisibleItems()
+	return m, cmd
+}
+
+// clearFilter drops the `/` filter; the caller rebuilds the list.
+func (m *interactiveModel) clearFilter() {
+	m.filtering = false
+	m.filter = episodeFilter{}
+	m.filterInput.Blur()
+	m.filterInput.SetValue("")
+}
+
 func (m interactiveModel) updateFolder(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
@@ -391,8 +674,6 @@ func (m interactiveModel) updateFolder(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 	case tea.KeyMsg:
 		switch msg.String() {
-		case "ctrl+c", "q":
-			return m, tea.Quit
 		case "enter":
 			folder := strings.TrimSpace(m.folderInput.Value())
 			if folder == "" {
@@ -407,26 +688,30 @@ func (m interactiveModel) updateFolder(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 
-			m.errMsg = ""
-			m.step = stepDownloading
-			m.downloadTo = folder
-			m.downloadSet = m.selectedItems()
-			m.downloadIdx = 0
-			m.downloadOK = 0
-			m.downloadErr = nil
-			m.downloadOKFiles = nil
-			m.downloadOut = nil
-			m.downloadCh = make(chan string, 200)
-			if len(m.downloadSet) == 0 {
+			picked := m.selectedItems()
+			if len(picked) == 0 {
 				m.errMsg = "Select at least one episode."
 				m.step = stepSelect
 				return m, nil
 			}
 
-			return m, tea.Batch(
-				downloadEpisodeCmd(folder, m.podTitle, m.downloadSet[0], 0, m.downloadCh, m.pythonPath, m.eyeD3Dir),
-				listenForDownloadOutput(m.downloadCh),
-			)
+			first := len(m.downloads.jobs)
+			added, cmd := m.downloads.add(picked, folder, m.podTitle)
+			m.clearSelections()
+			m.errMsg = ""
+			if added < len(picked) {
+				m.errMsg = fmt.Sprintf("%d episode(s) already queued.", len(picked)-added)
+			}
+			m.step = stepSelect
+			m.openDownloads()
+			if added > 0 {
+				m.downloadCursor = first
+			}
+			return m, cmd
+		case "esc":
+			m.errMsg = ""
+			m.step = stepSelect
+			return m, nil
 		}
 	}
 
@@ -435,73 +720,91 @@ func (m interactiveModel) updateFolder(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// updateDownloading handles the download manager. The downloads carry on
+// when b takes the user back to browsing.
 func (m interactiveModel) updateDownloading(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m.updateWindowSize(msg)
 		return m, nil
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c", "q":
-			return m, tea.Quit
-		}
-	case downloadResultMsg:
-		if msg.err != nil {
-			m.downloadErr = append(m.downloadErr, fmt.Sprintf("%s: %v", msg.filename, msg.err))
-		} else {
-			m.downloadOK++
-			m.downloadOKFiles = append(m.downloadOKFiles, msg.filename)
+		jobs := m.downloads.jobs
+		k := m.keys.downloads
+		switch {
+		case key.Matches(msg, m.keys.global.up):
+			if m.downloadCursor > 0 {
+				m.downloadCursor--
+			}
+		case key.Matches(msg, m.keys.global.down):
+			if m.downloadCursor < len(jobs)-1 {
+				m.downloadCursor++
+			}
+		case key.Matches(msg, k.pause):
+			if len(jobs) > 0 {
+				return m, m.downloads.pause(m.downloadCursor)
+			}
+		case key.Matches(msg, k.cancel):
+			if len(jobs) > 0 {
+				m.downloads.cancelJob(m.downloadCursor)
+			}
+		case key.Matches(msg, k.retry):
+			if len(jobs) > 0 {
+				return m, m.downloads.retry(m.downloadCursor)
+			}
+		case key.Matches(msg, m.keys.global.back):
+			m.step = m.downloadsFrom
+			if m.step == stepFeedSelect {
+				m.ensureFeedVisible()
+			}
 		}
+	}
 
-		m.downloadIdx++
-		if m.downloadIdx >= len(m.downloadSet) {
-			m.outputCount = m.downloadOK
-			m.outPath = m.downloadTo
-			m.step = stepDone
-			return m, nil
-		}
+	return m, nil
+}
 
-		m.downloadOut = nil
-		m.downloadCh = make(chan string, 200)
-		return m, tea.Batch(
-			downloadEpisodeCmd(m.downloadTo, m.podTitle, m.downloadSet[m.downloadIdx], m.downloadIdx, m.downloadCh, m.pythonPath, m.eyeD3Dir),
-			listenForDownloadOutput(m.downloadCh),
-		)
-	case downloadOutputMsg:
-		if msg.done {
-			return m, nil
-		}
-		line := strings.TrimSpace(msg.line)
-		if line != "" {
-			m.downloadOut = append(m.downloadOut, line)
-			if len(m.downloadOut) > downloadOutputLimit {
-				m.downloadOut = m.downloadOut[len(m.downloadOut)-downloadOutputLimit:]
+// openDownloads shows the download manager, if anything has been queued;
+// b there comes back to the current screen.
+func (m *interactiveModel) openDownloads() {
+	if len(m.downloads.jobs) == 0 {
+		m.errMsg = "Nothing downloading yet."
+		return
+	}
+	m.errMsg = ""
+	m.downloadsFrom = m.step
+	m.step = stepDownloading
+}
+
+// markDownloaded flags a finished download in the episode lists.
+func (m *interactiveModel) markDownloaded(filename string) {
+	for _, items := range [][]episodeItem{m.allItems, m.items} {
+		for i := range items {
+			if items[i].filename == filename {
+				items[i].downloaded = true
+				items[i].selected = false
+				items[i].status = statusDownloaded
 			}
 		}
-		if m.downloadCh != nil {
-			return m, listenForDownloadOutput(m.downloadCh)
+	}
+	for i := range m.skipReviews {
+		if m.skipReviews[i].episode.filename == filename {
+			m.skipReviews[i].episode.downloaded = true
 		}
-		return m, nil
 	}
-
-	return m, nil
 }
 
-func (m interactiveModel) updateDone(msg tea.Msg) (tea.Model, tea.Cmd) {
-	switch msg := msg.(type) {
-	case tea.WindowSizeMsg:
-		m.updateWindowSize(msg)
-		return m, nil
-	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c", "q", "enter":
-			return m, tea.Quit
+// clearSelections drops every selection, once they have been queued.
+func (m *interactiveModel) clearSelections() {
+	for _, items := range [][]episodeItem{m.allItems, m.items} {
+		for i := range items {
+			items[i].selected = false
 		}
 	}
-	return m, nil
 }
 
 func (m interactiveModel) View() string {
+	if m.showHelp {
+		return m.viewHelp()
+	}
 	switch m.step {
 	case stepFeedSelect:
 		return m.viewFeedSelect()
@@ -515,8 +818,16 @@ func (m interactiveModel) View() string {
 		return m.viewFolder()
 	case stepDownloading:
 		return m.viewDownloading()
-	case stepDone:
-		return m.viewDone()
+	case stepSearch:
+		return m.viewSearch()
+	case stepSubscriptions:
+		return m.viewSubscriptions()
+	case stepDirectory:
+		return m.viewDirectory()
+	case stepLibrary:
+		return m.viewLibrary()
+	case stepSkipReview:
+		return m.viewSkipReview()
 	default:
 		return ""
 	}
@@ -535,12 +846,12 @@ func (m interactiveModel) viewURL() string {
 	}
 	if len(m.feedOptions) > 0 {
 		if m.feedOptionsAreURLs {
-			b.WriteString("\nPress b to choose from gopodder-extra.conf.\n")
+			b.WriteString("\nPress Esc to choose from gopodder-extra.conf.\n")
 		} else {
-			b.WriteString("\nPress b to choose a podcast title from the database.\n")
+			b.WriteString("\nPress Esc to choose a podcast title from the database.\n")
 		}
 	}
-	b.WriteString("\nPress Enter to continue.\n")
+	b.WriteString("\nPress Enter to continue, or Tab to find a podcast by name.\n")
 	return b.String()
 }
 
@@ -554,7 +865,7 @@ func (m interactiveModel) viewFeedSelect() string {
 		}
 	} else {
 		b.WriteString("Select a podcast\n")
-		b.WriteString(fmt.Sprintf("Source: %s (database)\n", dbFileName))
+		b.WriteString(fmt.Sprintf("Source: %s (database)\n", m.store.path))
 		if len(m.feedOptions) > 0 {
 			b.WriteString(fmt.Sprintf("%d podcasts available\n", len(m.feedOptions)))
 		}
@@ -567,7 +878,7 @@ func (m interactiveModel) viewFeedSelect() string {
 	}
 
 	if len(m.feedOptions) == 0 {
-		b.WriteString("No podcasts available. Press m to enter a URL manually.\n")
+		b.WriteString("No podcasts available. Press " + m.keys.feeds.manualURL.Help().Key + " to enter a URL manually.\n")
 		return b.String()
 	}
 
@@ -581,7 +892,30 @@ func (m interactiveModel) viewFeedSelect() string {
 		b.WriteString(fmt.Sprintf("%s %s\n", cursor, option))
 	}
 
-	b.WriteString("\nEnter: select  m: manual URL  q: quit\n")
+	k := m.keys.feeds
+	if m.feedOptionsAreURLs {
+		b.WriteString("\n" + keyHints(k.open, k.search, k.directory, k.manualURL, k.subscriptions, k.library,
+			k.reviewSkips, m.keys.global.quit, m.keys.global.help) + "\n")
+	} else {
+		b.WriteString("\n" + keyHints(k.open, k.whatsNew, k.search, k.directory, k.manualURL, k.subscriptions,
+			k.library, k.reviewSkips, m.keys.global.quit, m.keys.global.help) + "\n")
+	}
+	b.WriteString(m.downloadsFooter())
+	return b.String()
+}
+
+func (m interactiveModel) viewSearch() string {
+	var b strings.Builder
+	b.WriteString("Search episodes\n")
+	b.WriteString(fmt.Sprintf("Source: %s (%s)\n\n", m.store.path, m.store.searchBackend()))
+	b.WriteString(m.searchInput.View())
+	b.WriteString("\n")
+	if m.errMsg != "" {
+		b.WriteString("\n")
+		b.WriteString(m.errMsg)
+		b.WriteString("\n")
+	}
+	b.WriteString(fmt.Sprintf("\nEnter: search (best %d matches)  Esc: back\n", searchResultLimit))
 	return b.String()
 }
 
@@ -591,12 +925,27 @@ func (m interactiveModel) viewLoading() string {
 
 func (m interactiveModel) viewSelect() string {
 	var b strings.Builder
-	b.WriteString("Select episodes (most recent first)\n")
+	if m.searchQuery != "" {
+		b.WriteString("Select episodes (best match first)\n")
+		b.WriteString(fmt.Sprintf("Search: %s\n", m.searchQuery))
+	} else if m.whatsNew {
+		b.WriteString(fmt.Sprintf("What's new: episodes from the last %d days not yet downloaded\n", whatsNewDays))
+		b.WriteString("Podcast with the newest episode first. Pick from as many shows as you like.\n")
+	} else {
+		b.WriteString("Select episodes (most recent first)\n")
+	}
 	if m.podTitle != "" {
 		b.WriteString("Podcast: ")
 		b.WriteString(m.podTitle)
 		b.WriteString("\n")
 	}
+	if m.filtering {
+		b.WriteString("Filter: ")
+		b.WriteString(m.filterInput.View())
+		b.WriteString("\n")
+	} else if m.filter.active() {
+		b.WriteString(fmt.Sprintf("Filter: %s (%d of %d episodes match)\n", m.filter.raw, len(m.items), len(m.allItems)))
+	}
 	b.WriteString("\n")
 
 	if m.errMsg != "" {
@@ -605,10 +954,13 @@ func (m interactiveModel) viewSelect() string {
 	}
 
 	if len(m.items) == 0 {
-		if m.hideDownloaded && m.downloadedCount() > 0 {
-			b.WriteString("All episodes already downloaded. Press d to show them.\n")
+		if m.filter.active() {
+			b.WriteString("No episodes match the filter. Press / to change it or esc to clear it.\n")
+		} else if m.hideDownloaded && m.downloadedCount() > 0 {
+			b.WriteString("All episodes already downloaded. Press " + m.keys.episodes.hideDownloaded.Help().Key + " to show them.\n")
 		} else {
-			b.WriteString("No items available. Press b to choose another podcast or q to quit.\n")
+			b.WriteString("No items available. Press " + m.keys.global.back.Help().Key + " to choose another podcast or " +
+				m.keys.global.quit.Help().Key + " to quit.\n")
 		}
 		return b.String()
 	}
@@ -627,25 +979,51 @@ func (m interactiveModel) viewSelect() string {
 		dlMark := " "
 		if item.downloaded {
 			dlMark = "✓"
+		} else if m.downloads.active(item.filename) {
+			dlMark = "↓"
+		}
+		name := item.title
+		if m.whatsNew {
+			// Grouped by podcast: a heading where each group starts
+			if i == start || m.items[i-1].podcastTitle != item.podcastTitle {
+				b.WriteString(item.podcastTitle + "\n")
+			}
+		} else if item.podcastTitle != "" {
+			name = item.podcastTitle + " / " + item.title
 		}
-		b.WriteString(fmt.Sprintf("%s [%s] %s %s %s\n", cursor, check, dlMark, item.dateStr, item.title))
+		b.WriteString(fmt.Sprintf("%s [%s] %s %s %s%s\n", cursor, check, dlMark, item.dateStr, name, playedNote(item.play)))
+	}
+	if m.showDetail && m.cursor < len(m.items) {
+		b.WriteString(m.viewDetail(m.items[m.cursor]))
 	}
 
-	b.WriteString("\nSpace: select  Enter: continue  b: back  q: quit")
+	if m.filtering {
+		b.WriteString("\nType to filter  ↑/↓: move  Enter: keep filter  Esc: clear filter\n")
+		return b.String()
+	}
+	k, g := m.keys.episodes, m.keys.global
+	b.WriteString("\n" + keyHints(k.toggle, k.next, k.filter, k.details, k.play, k.played, g.back, g.quit, g.help))
+	if m.filter.active() {
+		b.WriteString("  Esc: clear filter")
+	}
 	if len(m.items) > initialListLimit {
-		b.WriteString("  a: toggle full list")
+		b.WriteString("  " + keyHints(k.showAll))
 	}
-	if m.downloadedCount() > 0 {
+	if m.downloadedCount() > 0 && k.hideDownloaded.Enabled() {
 		if m.hideDownloaded {
-			b.WriteString("  d: show downloaded")
+			b.WriteString("  " + k.hideDownloaded.Help().Key + ": show downloaded")
 		} else {
-			b.WriteString("  d: hide downloaded")
+			b.WriteString("  " + k.hideDownloaded.Help().Key + ": hide downloaded")
 		}
 	}
 	b.WriteString("\n")
+	b.WriteString(m.downloadsFooter())
 	if m.skipped > 0 {
 		b.WriteString(fmt.Sprintf("Skipped %d items without downloadable audio.\n", m.skipped))
 	}
+	if hidden := m.selectedCount() - m.visibleSelectedCount(); hidden > 0 {
+		b.WriteString(fmt.Sprintf("%d selected episode(s) hidden by the filter.\n", hidden))
+	}
 	if m.hideDownloaded {
 		hidden := m.downloadedCount()
 		if hidden == 1 {
@@ -666,8 +1044,21 @@ func (m interactiveModel) viewSelect() string {
 }
 
 func (m *interactiveModel) updateWindowSize(msg tea.WindowSizeMsg) {
+	m.width, m.height = msg.Width, msg.Height
+	m.resizeList()
+}
+
+// resizeList fits the list to the terminal, less the detail pane when it
+// is open. Before the first WindowSizeMsg the default size stands.
+func (m *interactiveModel) resizeList() {
+	if m.height <= 0 {
+		return
+	}
 	// Leave space for header + footer lines in select view.
-	usable := msg.Height - 8
+	usable := m.height - 8
+	if m.showDetail {
+		usable -= detailPaneHeight
+	}
 	if usable < 5 {
 		usable = 5
 	}
@@ -707,15 +1098,17 @@ func (m *interactiveModel) ensureCursorVisible() {
 	}
 }
 
+// syncSelectionsToAllItems copies the selections made on the visible items
+// back to allItems. Items hidden by d or the filter keep theirs.
 func (m *interactiveModel) syncSelectionsToAllItems() {
 	selected := make(map[string]bool, len(m.items))
 	for _, item := range m.items {
-		if item.selected {
-			selected[item.filename] = true
-		}
+		selected[item.filename] = item.selected
 	}
 	for i := range m.allItems {
-		m.allItems[i].selected = selected[m.allItems[i].filename]
+		if sel, shown := selected[m.allItems[i].filename]; shown {
+			m.allItems[i].selected = sel
+		}
 	}
 }
 
@@ -726,6 +1119,9 @@ func (m *interactiveModel) rebuildVisibleItems() {
 		if m.hideDownloaded && item.downloaded {
 			continue
 		}
+		if !m.filter.matches(item) {
+			continue
+		}
 		m.items = append(m.items, item)
 	}
 	if m.cursor >= len(m.items) {
@@ -832,73 +1228,72 @@ func (m interactiveModel) viewFolder() string {
 		b.WriteString(m.errMsg)
 		b.WriteString("\n")
 	}
-	b.WriteString("\nPress Enter to start downloads.\n")
+	b.WriteString("\nEnter: queue the downloads  Esc: back\n")
 	return b.String()
 }
 
 func (m interactiveModel) viewDownloading() string {
 	var b strings.Builder
-	total := len(m.downloadSet)
-	if total == 0 {
-		return "No episodes selected.\n"
+	running, queued, paused := m.downloads.pending()
+	b.WriteString(fmt.Sprintf("Downloads: %d running, %d queued, %d paused, %d done, %d failed (%d at a time)\n\n",
+		running, queued, paused, m.downloads.count(dlDone), m.downloads.count(dlFailed), m.downloads.parallel))
+	if m.errMsg != "" {
+		b.WriteString(m.errMsg)
+		b.WriteString("\n\n")
 	}
-	current := m.downloadIdx + 1
-	if current > total {
-		current = total
+
+	// Each job takes two lines
+	jobs := m.downloads.jobs
+	rows := m.windowSize / 2
+	if rows < 3 {
+		rows = 3
 	}
-	item := m.downloadSet[current-1]
-	b.WriteString(fmt.Sprintf("Downloading %d of %d\n\n", current, total))
-	b.WriteString(item.title)
-	b.WriteString("\n")
-	if len(m.downloadOKFiles) > 0 {
-		last := m.downloadOKFiles[len(m.downloadOKFiles)-1]
-		b.WriteString("\nLast downloaded:\n")
-		b.WriteString(last)
-		b.WriteString("\n")
+	start := 0
+	if m.downloadCursor >= rows {
+		start = m.downloadCursor - rows + 1
 	}
-	if len(m.downloadOut) > 0 {
-		b.WriteString("\nWget output:\n")
-		for _, line := range m.downloadOut {
-			b.WriteString(line)
-			b.WriteString("\n")
-		}
+	end := start + rows
+	if end > len(jobs) {
+		end = len(jobs)
 	}
-	if len(m.downloadErr) > 0 {
-		b.WriteString("\nErrors so far:\n")
-		for _, msg := range m.downloadErr {
-			b.WriteString(msg)
-			b.WriteString("\n")
-		}
+	for i := start; i < end; i++ {
+		b.WriteString(viewJob(jobs[i], i == m.downloadCursor))
 	}
+	if len(jobs) > rows {
+		b.WriteString(fmt.Sprintf("\nShowing %d-%d of %d downloads.\n", start+1, end, len(jobs)))
+	}
+
+	k := m.keys.downloads
+	b.WriteString("\n" + keyHints(k.pause, k.cancel, k.retry, m.keys.global.back, m.keys.global.quit, m.keys.global.help) + "\n")
 	return b.String()
 }
 
-func (m interactiveModel) viewDone() string {
-	var b strings.Builder
-	b.WriteString("Done.\n\n")
-	total := len(m.downloadSet)
-	b.WriteString(fmt.Sprintf("Downloaded %d of %d episodes to %s\n", m.outputCount, total, m.outPath))
-	if len(m.downloadOKFiles) > 0 {
-		b.WriteString("\nDownloaded files:\n")
-		for _, file := range m.downloadOKFiles {
-			b.WriteString(file)
-			b.WriteString("\n")
-		}
+// downloadsFooter summarises the downloads for the browsing screens' footers.
+func (m interactiveModel) downloadsFooter() string {
+	if len(m.downloads.jobs) == 0 {
+		return ""
 	}
-	if len(m.downloadErr) > 0 {
-		b.WriteString("\nErrors:\n")
-		for _, msg := range m.downloadErr {
-			b.WriteString(msg)
-			b.WriteString("\n")
+	running, queued, _ := m.downloads.pending()
+	return fmt.Sprintf("%s: downloads (%d running, %d queued, %d done)\n", m.keys.global.downloads.Help().Key,
+		running, queued, m.downloads.count(dlDone))
+}
+
+// visibleSelectedCount counts the selections on the visible items.
+func (m interactiveModel) visibleSelectedCount() int {
+	count := 0
+	for _, item := range m.items {
+		if item.selected {
+			count++
 		}
 	}
-	b.WriteString("\nPress Enter or q to quit.\n")
-	return b.String()
+	return count
 }
 
+// selectedCount counts selections across allItems, so ones hidden by a
+// filter still count.
 func (m interactiveModel) selectedCount() int {
 	count := 0
-	for _, item := range m.items {
+	for _, item := range m.allItems {
 		if item.selected {
 			count++
 		}
@@ -908,7 +1303,7 @@ func (m interactiveModel) selectedCount() int {
 
 func (m interactiveModel) selectedItems() []episodeItem {
 	items := make([]episodeItem, 0, m.selectedCount())
-	for _, item := range m.items {
+	for _, item := range m.allItems {
 		if item.selected {
 			items = append(items, item)
 		}
@@ -916,13 +1311,16 @@ func (m interactiveModel) selectedItems() []episodeItem {
 	return items
 }
 
-func fetchFeedCmd(url string) tea.Cmd {
+func fetchFeedCmd(s *store, url string) tea.Cmd {
 	return func() tea.Msg {
 		pod, episodes, err := parseFeed(url)
+		if recErr := s.recordFeedFetch(url, pod[title], err); recErr != nil && err == nil {
+			return feedParsedMsg{err: fmt.Errorf("failed to record the fetch in feed_health: %w", recErr)}
+		}
 		if err != nil {
 			return feedParsedMsg{err: err}
 		}
-		if err := storeParsedFeedInInteractiveTable(pod, episodes); err != nil {
+		if err := s.storeParsedFeedInInteractiveTable(pod, episodes); err != nil {
 			return feedParsedMsg{err: fmt.Errorf("failed to store parsed feed in database: %w", err)}
 		}
 
@@ -934,7 +1332,7 @@ func fetchFeedCmd(url string) tea.Cmd {
 			}
 		}
 
-		items, err := loadEpisodeItemsFromDatabase(pod[title])
+		items, err := s.loadEpisodeItemsFromDatabase(pod[title])
 		if err != nil {
 			return feedParsedMsg{err: err}
 		}
@@ -947,9 +1345,9 @@ func fetchFeedCmd(url string) tea.Cmd {
 	}
 }
 
-func loadEpisodesForPodcastCmd(podcastTitle string) tea.Cmd {
+func loadEpisodesForPodcastCmd(s *store, podcastTitle string) tea.Cmd {
 	return func() tea.Msg {
-		items, err := loadEpisodeItemsFromDatabase(podcastTitle)
+		items, err := s.loadEpisodeItemsFromDatabase(podcastTitle)
 		if err != nil {
 			return feedParsedMsg{err: err}
 		}
@@ -962,30 +1360,61 @@ func loadEpisodesForPodcastCmd(podcastTitle string) tea.Cmd {
 	}
 }
 
-func loadPodcastTitlesFromDatabase() ([]string, error) {
-	if _, err := os.Stat(dbFileName); err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
+func searchEpisodesCmd(s *store, query string) tea.Cmd {
+	return func() tea.Msg {
+		results, err := s.searchEpisodes(query, searchResultLimit)
+		if err != nil {
+			return feedParsedMsg{searchQuery: query, err: err}
+		}
+		items := searchResultItems(results, time.Now())
+		if err := s.annotatePlayed(items); err != nil {
+			return feedParsedMsg{searchQuery: query, err: err}
+		}
+		return feedParsedMsg{
+			searchQuery: query,
+			episodes:    items,
 		}
-		return nil, err
 	}
+}
 
-	db, err := sql.Open(sqlite3, dbFileName)
-	if err != nil {
-		return nil, err
+// searchResultItems turns search results into picker items, keeping the
+// search ranking. Results without an enclosure can't be downloaded and are
+// dropped; archived episodes count as downloaded.
+func searchResultItems(results []searchResult, now time.Time) []episodeItem {
+	items := make([]episodeItem, 0, len(results))
+	for _, r := range results {
+		fileURL := strings.TrimSpace(r.file)
+		if fileURL == "" {
+			continue
+		}
+		timestamp := episodeTimestamp(strings.TrimSpace(r.published), "", now)
+		dateStr := timestamp.Format("2006-01-02")
+		filename := episodeFilename(episodeNaming{podcast: r.podcastTitle, title: r.title,
+			date: dateStr, hash: r.episodeHash, season: r.season, episode: r.episode})
+		items = append(items, episodeItem{
+			podcastTitle: r.podcastTitle,
+			title:        strings.TrimSpace(r.title),
+			date:         timestamp,
+			dateStr:      dateStr,
+			url:          fileURL,
+			filename:     filename,
+			hash:         r.episodeHash,
+			description:  r.description,
+			status:       r.status,
+			downloaded:   r.status == statusDownloaded || r.status == statusArchived,
+		})
 	}
-	defer db.Close()
+	return items
+}
 
-	rows, err := db.Query(`
+func (s *store) loadPodcastTitlesFromDatabase() ([]string, error) {
+	rows, err := s.q.Query(`
 		SELECT DISTINCT podcast_title
 		FROM interactive_episodes
 		WHERE podcast_title IS NOT NULL AND TRIM(podcast_title) != ''
 		ORDER BY LOWER(podcast_title);
 	`)
 	if err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "no such table") {
-			return nil, nil
-		}
 		return nil, err
 	}
 	defer rows.Close()
@@ -1008,25 +1437,18 @@ func loadPodcastTitlesFromDatabase() ([]string, error) {
 	return titles, nil
 }
 
-func loadEpisodeItemsFromDatabase(podcastTitle string) ([]episodeItem, error) {
-	db, err := sql.Open(sqlite3, dbFileName)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	rows, err := db.Query(`
+func (s *store) loadEpisodeItemsFromDatabase(podcastTitle string) ([]episodeItem, error) {
+	rows, err := s.q.Query(`
 		SELECT
 			COALESCE(i.title, ''),
 			COALESCE(i.published, ''),
 			COALESCE(e.first_seen, i.first_seen, ''),
 			COALESCE(i.file, ''),
 			COALESCE(i.podcastname_episodename_hash, ''),
-			CASE WHEN EXISTS (
-				SELECT 1 FROM downloads AS d WHERE d.hash = i.podcastname_episodename_hash
-			) OR EXISTS (
-				SELECT 1 FROM archived_episodes AS ar WHERE ar.podcastname_episodename_hash = i.podcastname_episodename_hash
-			) THEN 1 ELSE 0 END
+			COALESCE(i.season, ''),
+			COALESCE(i.episode, ''),
+			COALESCE(i.description, ''),
+			`+statusCaseSQL("i")+`
 		FROM interactive_episodes AS i
 		LEFT JOIN episodes AS e
 			ON e.podcastname_episodename_hash = i.podcastname_episodename_hash
@@ -1043,9 +1465,8 @@ func loadEpisodeItemsFromDatabase(podcastTitle string) ([]episodeItem, error) {
 	items := make([]episodeItem, 0)
 	now := time.Now()
 	for rows.Next() {
-		var titleStr, publishedStr, firstSeenStr, fileURL, hash string
-		var downloadedInt int
-		if err := rows.Scan(&titleStr, &publishedStr, &firstSeenStr, &fileURL, &hash, &downloadedInt); err != nil {
+		var titleStr, publishedStr, firstSeenStr, fileURL, hash, seasonStr, episodeStr, descStr, status string
+		if err := rows.Scan(&titleStr, &publishedStr, &firstSeenStr, &fileURL, &hash, &seasonStr, &episodeStr, &descStr, &status); err != nil {
 			return nil, err
 		}
 
@@ -1057,28 +1478,33 @@ func loadEpisodeItemsFromDatabase(podcastTitle string) ([]episodeItem, error) {
 
 		timestamp := episodeTimestamp(strings.TrimSpace(publishedStr), strings.TrimSpace(firstSeenStr), now)
 		dateStr := timestamp.Format("2006-01-02")
-		filename := buildEpisodeFilenameWithHash(podcastTitle, titleStr, dateStr, strings.TrimSpace(hash))
+		filename := episodeFilename(episodeNaming{podcast: podcastTitle, title: titleStr, date: dateStr,
+			hash: strings.TrimSpace(hash), season: seasonStr, episode: episodeStr})
 
 		items = append(items, episodeItem{
-			title:      titleStr,
-			date:       timestamp,
-			dateStr:    dateStr,
-			url:        fileURL,
-			filename:   filename,
-			selected:   false,
-			downloaded: downloadedInt == 1,
+			title:       titleStr,
+			date:        timestamp,
+			dateStr:     dateStr,
+			url:         fileURL,
+			filename:    filename,
+			hash:        strings.TrimSpace(hash),
+			description: strings.TrimSpace(descStr),
+			status:      status,
+			selected:    false,
+			downloaded:  status == statusDownloaded || status == statusArchived,
 		})
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	rows.Close()
 
 	sort.Slice(items, func(i, j int) bool {
 		return items[i].date.After(items[j].date)
 	})
 
-	return items, nil
+	return items, s.annotatePlayed(items)
 }
 
 func buildEpisodeItems(pod map[string]string, episodes []M) ([]episodeItem, int) {
@@ -1100,14 +1526,16 @@ func buildEpisodeItems(pod map[string]string, episodes []M) ([]episodeItem, int)
 		timestamp := episodeTimestamp(pub, firstSeen, now)
 		dateStr := timestamp.Format("2006-01-02")
 
-		filename := buildEpisodeFilename(podTitle, name, dateStr)
+		filename := episodeFilename(episodeNaming{podcast: podTitle, title: name, date: dateStr,
+			season: getMapString(ep, season), episode: getMapString(ep, episode)})
 		items = append(items, episodeItem{
-			title:    name,
-			date:     timestamp,
-			dateStr:  dateStr,
-			url:      fileURL,
-			filename: filename,
-			selected: false,
+			title:       name,
+			date:        timestamp,
+			dateStr:     dateStr,
+			url:         fileURL,
+			filename:    filename,
+			description: strings.TrimSpace(getMapString(ep, description)),
+			selected:    false,
 		})
 	}
 
@@ -1123,24 +1551,21 @@ func buildEpisodeFilename(podcastTitle, episodeTitle, dateStr string) string {
 	return buildEpisodeFilenameWithHash(podcastTitle, episodeTitle, dateStr, podcastHash)
 }
 
+// buildEpisodeFilenameWithHash names an episode the feed gave no season or
+// episode number for; see episodeFilename.
 func buildEpisodeFilenameWithHash(podcastTitle, episodeTitle, dateStr, podcastHash string) string {
-	podcastTitle = strings.TrimSpace(podcastTitle)
-	episodeTitle = strings.TrimSpace(episodeTitle)
+	return episodeFilename(episodeNaming{podcast: podcastTitle, title: episodeTitle, date: dateStr, hash: podcastHash})
+}
 
-	if podcastHash == "" {
-		podcastHash = fmt.Sprintf("%x", md5.Sum([]byte(podcastTitle+episodeTitle)))
+// episodeFilename is the path, relative to the podcasts dir, the filename
+// template gives an episode. An empty hash is computed from the titles.
+func episodeFilename(n episodeNaming) string {
+	n.podcast = strings.TrimSpace(n.podcast)
+	n.title = strings.TrimSpace(n.title)
+	if n.hash == "" {
+		n.hash = fmt.Sprintf("%x", md5.Sum([]byte(n.podcast+n.title)))
 	}
-
-	transformedPodcastTitle := titleTransformation(podcastTitle)
-	transformedTitle := titleTransformation(episodeTitle)
-
-	return fmt.Sprintf("%s-%s-%s-%s.%s",
-		transformedPodcastTitle,
-		dateStr,
-		transformedTitle,
-		podcastHash,
-		mp3,
-	)
+	return nameTemplate.render(n)
 }
 
 func episodeTimestamp(publishedStr, firstSeenStr string, fallback time.Time) time.Time {
@@ -1169,92 +1594,6 @@ func getMapString(m M, key string) string {
 	return str
 }
 
-func downloadEpisodeCmd(folder, podTitle string, item episodeItem, index int, outputCh chan string, pythonPath string, eyeD3Dir string) tea.Cmd {
-	return func() tea.Msg {
-		defer close(outputCh)
-
-		filename := filepath.Join(folder, item.filename)
-		if info, err := os.Stat(filename); err == nil && !info.IsDir() {
-			return downloadResultMsg{index: index, filename: filename, err: fmt.Errorf("file already exists, skipping")}
-		} else if err != nil && !os.IsNotExist(err) {
-			return downloadResultMsg{index: index, filename: filename, err: err}
-		}
-
-		cmd := exec.Command(
-			"wget",
-			"--no-clobber",
-			"--continue",
-			"--no-check-certificate",
-			"--progress=dot:giga",
-			item.url,
-			"-O",
-			filename,
-		)
-
-		stdout, err := cmd.StdoutPipe()
-		if err != nil {
-			return downloadResultMsg{index: index, filename: filename, err: err}
-		}
-		stderr, err := cmd.StderrPipe()
-		if err != nil {
-			return downloadResultMsg{index: index, filename: filename, err: err}
-		}
-
-		if err := cmd.Start(); err != nil {
-			return downloadResultMsg{index: index, filename: filename, err: err}
-		}
-
-		var wg sync.WaitGroup
-		wg.Add(2)
-		go scanOutputLines(stdout, outputCh, &wg)
-		go scanOutputLines(stderr, outputCh, &wg)
-
-		err = cmd.Wait()
-		wg.Wait()
-		if err == nil {
-			err = os.Chmod(filename, 0666)
-		}
-		if err == nil {
-			tagSinglePod(filename, item.title, podTitle, pythonPath, eyeD3Dir)
-		}
-		if err == nil {
-			if dbErr := recordInteractiveDownload(filename); dbErr != nil {
-				err = fmt.Errorf("downloaded and tagged, but failed to update downloads table: %w", dbErr)
-			}
-		}
-		return downloadResultMsg{index: index, filename: filename, err: err}
-	}
-}
-
-func listenForDownloadOutput(ch <-chan string) tea.Cmd {
-	return func() tea.Msg {
-		line, ok := <-ch
-		if !ok {
-			return downloadOutputMsg{done: true}
-		}
-		return downloadOutputMsg{line: line}
-	}
-}
-
-func scanOutputLines(r io.Reader, ch chan<- string, wg *sync.WaitGroup) {
-	defer wg.Done()
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := scanner.Text()
-		select {
-		case ch <- line:
-		default:
-			// Drop output to avoid blocking the download if buffer fills.
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		select {
-		case ch <- fmt.Sprintf("output error: %v", err):
-		default:
-		}
-	}
-}
-
 // expandHome only expands a leading "~" or "~/" and leaves other paths untouched.
 // Example: "/home/mike/~/tmp" is returned unchanged.
 func expandHome(path string) string {
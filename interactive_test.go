@@ -119,7 +119,7 @@ func TestLoadExtraFeeds(t *testing.T) {
 func TestLoadPodcastTitlesFromDatabase(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
 	_ = tmpDir
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -158,7 +158,7 @@ func TestLoadPodcastTitlesFromDatabase(t *testing.T) {
 		}
 	}
 
-	gotTitles, err := loadPodcastTitlesFromDatabase()
+	gotTitles, err := st.loadPodcastTitlesFromDatabase()
 	if err != nil {
 		t.Fatalf("loadPodcastTitlesFromDatabase error: %v", err)
 	}
@@ -177,7 +177,7 @@ func TestLoadPodcastTitlesFromDatabase(t *testing.T) {
 func TestLoadEpisodeItemsFromDatabase(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
 	_ = tmpDir
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -242,7 +242,7 @@ func TestLoadEpisodeItemsFromDatabase(t *testing.T) {
 		}
 	}
 
-	items, err := loadEpisodeItemsFromDatabase("DB Podcast")
+	items, err := st.loadEpisodeItemsFromDatabase("DB Podcast")
 	if err != nil {
 		t.Fatalf("loadEpisodeItemsFromDatabase error: %v", err)
 	}
@@ -264,7 +264,7 @@ func TestLoadEpisodeItemsFromDatabase(t *testing.T) {
 func TestLoadEpisodeItemsUsesEpisodesFirstSeen(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
 	_ = tmpDir
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -318,7 +318,7 @@ func TestLoadEpisodeItemsUsesEpisodesFirstSeen(t *testing.T) {
 		t.Fatalf("insert episodes row: %v", err)
 	}
 
-	items, err := loadEpisodeItemsFromDatabase(podTitle)
+	items, err := st.loadEpisodeItemsFromDatabase(podTitle)
 	if err != nil {
 		t.Fatalf("loadEpisodeItemsFromDatabase error: %v", err)
 	}
@@ -335,15 +335,15 @@ func TestLoadEpisodeItemsUsesEpisodesFirstSeen(t *testing.T) {
 func TestRecordInteractiveDownload(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
 	_ = tmpDir
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	baseFilename := buildEpisodeFilename("DB Podcast", "Interactive Download", "2024-01-05")
 	fullPath := filepath.Join("/tmp", baseFilename)
 
-	if err := recordInteractiveDownload(fullPath); err != nil {
+	if err := st.recordInteractiveDownload(fullPath); err != nil {
 		t.Fatalf("recordInteractiveDownload first call: %v", err)
 	}
-	if err := recordInteractiveDownload(fullPath); err != nil {
+	if err := st.recordInteractiveDownload(fullPath); err != nil {
 		t.Fatalf("recordInteractiveDownload second call: %v", err)
 	}
 
@@ -382,7 +382,7 @@ func TestRecordInteractiveDownload(t *testing.T) {
 func TestStoreParsedFeedInInteractiveTable(t *testing.T) {
 	tmpDir := useTempWorkingDir(t)
 	_ = tmpDir
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	pod := map[string]string{
 		title: "Stored From Interactive URL",
@@ -403,11 +403,11 @@ func TestStoreParsedFeedInInteractiveTable(t *testing.T) {
 		},
 	}
 
-	if err := storeParsedFeedInInteractiveTable(pod, episodes); err != nil {
+	if err := st.storeParsedFeedInInteractiveTable(pod, episodes); err != nil {
 		t.Fatalf("storeParsedFeedInInteractiveTable error: %v", err)
 	}
 
-	titles, err := loadPodcastTitlesFromDatabase()
+	titles, err := st.loadPodcastTitlesFromDatabase()
 	if err != nil {
 		t.Fatalf("loadPodcastTitlesFromDatabase error: %v", err)
 	}
@@ -423,7 +423,7 @@ func TestStoreParsedFeedInInteractiveTable(t *testing.T) {
 		t.Fatalf("expected podcast title %q in %v", pod[title], titles)
 	}
 
-	items, err := loadEpisodeItemsFromDatabase(pod[title])
+	items, err := st.loadEpisodeItemsFromDatabase(pod[title])
 	if err != nil {
 		t.Fatalf("loadEpisodeItemsFromDatabase error: %v", err)
 	}
@@ -437,7 +437,7 @@ func TestStoreParsedFeedInInteractiveTable(t *testing.T) {
 
 func TestLoadEpisodeItemsDownloadedFlag(t *testing.T) {
 	_ = useTempWorkingDir(t)
-	createTablesIfNotExist()
+	st := openTestStore(t)
 
 	db, err := sql.Open(sqlite3, dbFileName)
 	if err != nil {
@@ -477,7 +477,7 @@ func TestLoadEpisodeItemsDownloadedFlag(t *testing.T) {
 		t.Fatalf("insert download: %v", err)
 	}
 
-	items, err := loadEpisodeItemsFromDatabase("DL Podcast")
+	items, err := st.loadEpisodeItemsFromDatabase("DL Podcast")
 	if err != nil {
 		t.Fatalf("loadEpisodeItemsFromDatabase error: %v", err)
 	}
@@ -0,0 +1,404 @@
+package main
+
+// The TUI's keys. Each list screen's keys are key.Bindings here, and the
+// ? help overlay and the screens' footers are generated from them, so they
+// show whatever the keys are. gopodder.conf can rebind any of them with
+// "key.<screen>.<action> = <keys>" lines, e.g.
+//
+//	key.global.down = z, down
+//	key.episodes.toggle = x
+//	key.global.quit =
+//
+// (an empty value unbinds the key). ctrl+c always quits, and the text
+// fields (URL, search, folder and the / filter) keep Enter, Esc and Tab.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// keySettingPrefix starts a gopodder.conf line rebinding a key.
+const keySettingPrefix = "key."
+
+type globalKeys struct {
+	up, down, back, quit, help, downloads key.Binding
+}
+
+type feedKeys struct {
+	open, whatsNew, search, directory, manualURL, subscriptions, library, reviewSkips key.Binding
+}
+
+type episodeKeys struct {
+	toggle, next, filter, details, play, played, showAll, hideDownloaded key.Binding
+}
+
+type downloadKeys struct {
+	pause, cancel, retry key.Binding
+}
+
+type subscriptionKeys struct {
+	subscribe, unsubscribe, pause, move key.Binding
+}
+
+type directoryKeys struct {
+	preview, search key.Binding
+}
+
+type libraryKeys struct {
+	path, play, played, remove, archive, retag key.Binding
+}
+
+type skipKeys struct {
+	accept, override, clear key.Binding
+}
+
+// keyMap is every screen's keys.
+type keyMap struct {
+	global        globalKeys
+	feeds         feedKeys
+	episodes      episodeKeys
+	downloads     downloadKeys
+	subscriptions subscriptionKeys
+	directory     directoryKeys
+	library       libraryKeys
+	skips         skipKeys
+}
+
+// bind is a binding whose help names its first key.
+func bind(desc string, keys ...string) key.Binding {
+	return key.NewBinding(key.WithKeys(keys...), key.WithHelp(keyNames(keys), desc))
+}
+
+// keyNames is how keys read in the help and footers.
+func keyNames(keys []string) string {
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		switch k {
+		case " ":
+			k = "Space"
+		case "enter":
+			k = "Enter"
+		case "esc":
+			k = "Esc"
+		case "up":
+			k = "↑"
+		case "down":
+			k = "↓"
+		}
+		names = append(names, k)
+	}
+	return strings.Join(names, "/")
+}
+
+func defaultKeyMap() keyMap {
+	return keyMap{
+		global: globalKeys{
+			up:        bind("up", "up", "k"),
+			down:      bind("down", "down", "j"),
+			back:      key.NewBinding(key.WithKeys("b", "esc"), key.WithHelp("b", "back")),
+			quit:      bind("quit", "q"),
+			help:      bind("help", "?"),
+			downloads: bind("downloads", "D"),
+		},
+		feeds: feedKeys{
+			open:          bind("select", "enter"),
+			whatsNew:      bind("what's new", "n"),
+			search:        bind("search episodes", "s"),
+			directory:     bind("find a podcast", "d"),
+			manualURL:     bind("manual URL", "m"),
+			subscriptions: bind("subscriptions", "f"),
+			library:       bind("library", "l"),
+			reviewSkips:   bind("review skips", "r"),
+		},
+		episodes: episodeKeys{
+			toggle:         bind("select", " "),
+			next:           bind("continue", "enter"),
+			filter:         bind("filter", "/"),
+			details:        bind("details", "i"),
+			play:           bind("play", "p"),
+			played:         bind("played/unplayed", "m"),
+			showAll:        bind("toggle full list", "a"),
+			hideDownloaded: bind("hide/show downloaded", "d"),
+		},
+		downloads: downloadKeys{
+			pause:  bind("pause/resume", "p"),
+			cancel: bind("cancel", "x"),
+			retry:  bind("retry", "r"),
+		},
+		subscriptions: subscriptionKeys{
+			subscribe:   bind("subscribe", "s"),
+			unsubscribe: bind("unsubscribe", "u"),
+			pause:       bind("pause/resume", "p"),
+			move:        bind("move between conf files", "v"),
+		},
+		directory: directoryKeys{
+			preview: bind("preview episodes", "enter"),
+			search:  bind("new search", "/"),
+		},
+		library: libraryKeys{
+			path:    key.NewBinding(key.WithKeys("enter", "o"), key.WithHelp("Enter", "show path")),
+			play:    bind("play", "p"),
+			played:  bind("played/unplayed", "m"),
+			remove:  bind("delete", "x"),
+			archive: bind("archive", "A"),
+			retag:   bind("retag", "t"),
+		},
+		skips: skipKeys{
+			accept:   bind("accept the skip", "a"),
+			override: bind("override and download", "o"),
+			clear:    bind("clear override", "c"),
+		},
+	}
+}
+
+// namedKey is a binding with its gopodder.conf name.
+type namedKey struct {
+	name    string
+	binding *key.Binding
+}
+
+// keySection is one screen's keys.
+type keySection struct {
+	name  string
+	title string
+	keys  []namedKey
+}
+
+func (k *keyMap) sections() []keySection {
+	return []keySection{
+		{"global", "Every list", []namedKey{{"up", &k.global.up}, {"down", &k.global.down},
+			{"back", &k.global.back}, {"quit", &k.global.quit}, {"help", &k.global.help},
+			{"downloads", &k.global.downloads}}},
+		{"feeds", "Podcast list", []namedKey{{"open", &k.feeds.open}, {"whats_new", &k.feeds.whatsNew},
+			{"search", &k.feeds.search}, {"directory", &k.feeds.directory}, {"manual_url", &k.feeds.manualURL},
+			{"subscriptions", &k.feeds.subscriptions}, {"library", &k.feeds.library},
+			{"review_skips", &k.feeds.reviewSkips}}},
+		{"episodes", "Episode list", []namedKey{{"toggle", &k.episodes.toggle}, {"continue", &k.episodes.next},
+			{"filter", &k.episodes.filter}, {"details", &k.episodes.details}, {"play", &k.episodes.play},
+			{"played", &k.episodes.played}, {"show_all", &k.episodes.showAll},
+			{"hide_downloaded", &k.episodes.hideDownloaded}}},
+		{"downloads", "Download manager", []namedKey{{"pause", &k.downloads.pause}, {"cancel", &k.downloads.cancel},
+			{"retry", &k.downloads.retry}}},
+		{"subscriptions", "Subscriptions", []namedKey{{"subscribe", &k.subscriptions.subscribe},
+			{"unsubscribe", &k.subscriptions.unsubscribe}, {"pause", &k.subscriptions.pause},
+			{"move", &k.subscriptions.move}}},
+		{"directory", "Podcast directory", []namedKey{{"preview", &k.directory.preview}, {"search", &k.directory.search}}},
+		{"library", "Library", []namedKey{{"path", &k.library.path}, {"play", &k.library.play},
+			{"played", &k.library.played}, {"delete", &k.library.remove}, {"archive", &k.library.archive},
+			{"retag", &k.library.retag}}},
+		{"skips", "Skip review", []namedKey{{"accept", &k.skips.accept}, {"override", &k.skips.override},
+			{"clear", &k.skips.clear}}},
+	}
+}
+
+// tuiKeys is the TUI's keymap, set once in main.
+var tuiKeys = defaultKeyMap()
+
+// loadKeyMap applies the gopodder.conf key settings to the default keys.
+// Keys are separated by commas; "space" is the space bar.
+func loadKeyMap(settings map[string]string) (keyMap, error) {
+	k := defaultKeyMap()
+	byName := make(map[string]*key.Binding)
+	for _, sec := range k.sections() {
+		for _, nk := range sec.keys {
+			byName[sec.name+"."+nk.name] = nk.binding
+		}
+	}
+	for setting, raw := range settings {
+		if !strings.HasPrefix(setting, keySettingPrefix) {
+			continue
+		}
+		b, ok := byName[strings.TrimPrefix(setting, keySettingPrefix)]
+		if !ok {
+			return k, fmt.Errorf("%s: no such key (see ? in interactive mode)", setting)
+		}
+		var keys []string
+		for _, f := range strings.Split(raw, ",") {
+			switch f = strings.TrimSpace(f); f {
+			case "":
+			case "space":
+				keys = append(keys, " ")
+			case "ctrl+c":
+				return k, fmt.Errorf("%s: ctrl+c is kept for quitting", setting)
+			default:
+				keys = append(keys, f)
+			}
+		}
+		if len(keys) == 0 {
+			b.Unbind()
+			continue
+		}
+		b.SetKeys(keys...)
+		b.SetHelp(keyNames(keys), b.Help().Desc)
+	}
+	return k, k.checkConflicts()
+}
+
+// checkConflicts rejects a key bound twice on one screen, or on a screen and
+// globally: the global keys are checked first on every list, so the screen's
+// action would never run.
+func (k *keyMap) checkConflicts() error {
+	sections := k.sections()
+	owners := func(sec keySection, into map[string]string) error {
+		for _, nk := range sec.keys {
+			for _, key := range nk.binding.Keys() {
+				name := keySettingPrefix + sec.name + "." + nk.name
+				if other, ok := into[key]; ok {
+					return fmt.Errorf("%s and %s are both bound to %q", other, name, keyNames([]string{key}))
+				}
+				into[key] = name
+			}
+		}
+		return nil
+	}
+	global := make(map[string]string)
+	if err := owners(sections[0], global); err != nil {
+		return err
+	}
+	for _, sec := range sections[1:] {
+		screen := make(map[string]string, len(global))
+		for key, name := range global {
+			screen[key] = name
+		}
+		if err := owners(sec, screen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyHints is a footer line: each enabled binding's "key: desc".
+func keyHints(bindings ...key.Binding) string {
+	hints := make([]string, 0, len(bindings))
+	for _, b := range bindings {
+		if b.Enabled() {
+			hints = append(hints, b.Help().Key+": "+b.Help().Desc)
+		}
+	}
+	return strings.Join(hints, "  ")
+}
+
+// helpSection is the keymap section for the current screen; ok is false
+// on screens that are text entry.
+func (m interactiveModel) helpSection() (keySection, bool) {
+	name := ""
+	switch m.step {
+	case stepFeedSelect:
+		name = "feeds"
+	case stepSelect:
+		name = "episodes"
+	case stepDownloading:
+		name = "downloads"
+	case stepSubscriptions:
+		name = "subscriptions"
+	case stepDirectory:
+		name = "directory"
+	case stepLibrary:
+		name = "library"
+	case stepSkipReview:
+		name = "skips"
+	}
+	for _, sec := range m.keys.sections() {
+		if sec.name == name {
+			return sec, true
+		}
+	}
+	return keySection{}, false
+}
+
+// typing reports whether keys are going to a text field.
+func (m interactiveModel) typing() bool {
+	switch m.step {
+	case stepURL, stepSearch, stepFolder:
+		return true
+	case stepSelect:
+		return m.filtering
+	case stepDirectory:
+		return m.directoryInput.Focused()
+	}
+	return false
+}
+
+// updateGlobalKeys handles the keys every list screen shares: help, quit
+// and the download manager. handled is false for keys the screen handles.
+func (m interactiveModel) updateGlobalKeys(msg tea.KeyMsg) (interactiveModel, tea.Cmd, bool) {
+	if msg.String() == "ctrl+c" {
+		return m, tea.Quit, true
+	}
+	confirming := m.quitConfirm
+	m.quitConfirm = false
+	if m.showHelp {
+		// Any key closes the help
+		m.showHelp = false
+		return m, nil, true
+	}
+	if m.typing() {
+		return m, nil, false
+	}
+	k := m.keys.global
+	_, listScreen := m.helpSection()
+	switch {
+	case key.Matches(msg, k.help):
+		if listScreen {
+			m.showHelp = true
+			return m, nil, true
+		}
+	case key.Matches(msg, k.quit):
+		if lost := m.unsaved(); lost != "" && !confirming {
+			m.quitConfirm = true
+			m.errMsg = fmt.Sprintf("%s would be lost. Press %s again to quit.", lost, k.quit.Help().Key)
+			return m, nil, true
+		}
+		return m, tea.Quit, true
+	case key.Matches(msg, k.downloads):
+		if listScreen && m.step != stepDownloading {
+			m.openDownloads()
+			return m, nil, true
+		}
+	}
+	return m, nil, false
+}
+
+// unsaved describes what quitting now would lose: selections not yet
+// queued and downloads not yet finished. "" for nothing.
+func (m interactiveModel) unsaved() string {
+	var parts []string
+	if n := m.selectedCount(); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d selected episode(s)", n))
+	}
+	if running, queued, paused := m.downloads.pending(); running+queued+paused > 0 {
+		parts = append(parts, fmt.Sprintf("%d unfinished download(s)", running+queued+paused))
+	}
+	return strings.Join(parts, " and ")
+}
+
+func (m interactiveModel) viewHelp() string {
+	sec, _ := m.helpSection()
+	var global keySection
+	for _, s := range m.keys.sections() {
+		if s.name == "global" {
+			global = s
+		}
+	}
+	group := func(s keySection) []key.Binding {
+		out := make([]key.Binding, 0, len(s.keys))
+		for _, nk := range s.keys {
+			out = append(out, *nk.binding)
+		}
+		return out
+	}
+	h := help.New()
+	h.Width = m.width
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Keys: %s\n\n", sec.title))
+	b.WriteString(h.FullHelpView([][]key.Binding{group(sec)}))
+	b.WriteString("\n\n")
+	b.WriteString(h.FullHelpView([][]key.Binding{group(global)}))
+	b.WriteString("\n\nctrl+c always quits. Rebind keys in gopodder.conf, e.g. key." + sec.name + "." +
+		sec.keys[0].name + " = x\n\nPress any key to close the help.\n")
+	return b.String()
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestLoadKeyMap(t *testing.T) {
+	k, err := loadKeyMap(map[string]string{
+		"key.episodes.toggle": "x",
+		"key.global.down":     "z, down",
+		"key.global.quit":     "",
+		"db":                  "/elsewhere/gopodder.sqlite",
+	})
+	if err != nil {
+		t.Fatalf("loadKeyMap: %v", err)
+	}
+	press := func(s string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)} }
+	if !key.Matches(press("x"), k.episodes.toggle) || key.Matches(tea.KeyMsg{Type: tea.KeySpace}, k.episodes.toggle) {
+		t.Fatalf("toggle keys = %q", k.episodes.toggle.Keys())
+	}
+	if !key.Matches(press("z"), k.global.down) || key.Matches(press("j"), k.global.down) || k.global.down.Help().Key != "z/↓" {
+		t.Fatalf("down keys = %q, help %q", k.global.down.Keys(), k.global.down.Help().Key)
+	}
+	if k.global.quit.Enabled() || keyHints(k.global.back, k.global.quit) != "b: back" {
+		t.Fatalf("quit still bound: %q", keyHints(k.global.back, k.global.quit))
+	}
+	// The default keymap is untouched
+	if !key.Matches(press("j"), defaultKeyMap().global.down) {
+		t.Fatal("defaults changed")
+	}
+
+	for _, bad := range []map[string]string{
+		{"key.episodes.frobnicate": "z"},
+		{"key.nowhere.up": "z"},
+		{"key.global.back": "ctrl+c"},
+	} {
+		if _, err := loadKeyMap(bad); err == nil {
+			t.Errorf("loadKeyMap(%v) accepted", bad)
+		}
+	}
+}
+
+// A key can't do two things on one screen, and a screen can't take a key
+// the global keys would answer first.
+func TestLoadKeyMapConflicts(t *testing.T) {
+	k := defaultKeyMap()
+	if err := k.checkConflicts(); err != nil {
+		t.Fatalf("default keys conflict: %v", err)
+	}
+	for _, tc := range []struct {
+		settings map[string]string
+		want     string
+	}{
+		{map[string]string{"key.episodes.toggle": "q"}, `key.global.quit and key.episodes.toggle are both bound to "q"`},
+		{map[string]string{"key.global.down": "n"}, `key.global.down and key.feeds.whats_new are both bound to "n"`},
+		{map[string]string{"key.library.play": "x"}, `key.library.play and key.library.delete are both bound to "x"`},
+		{map[string]string{"key.skips.accept": "space, c"}, `key.skips.accept and key.skips.clear are both bound to "c"`},
+	} {
+		_, err := loadKeyMap(tc.settings)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("loadKeyMap(%v) = %v, want %q", tc.settings, err, tc.want)
+		}
+	}
+	// The same key on different screens is fine, as is freeing a global key
+	// for a screen
+	if _, err := loadKeyMap(map[string]string{"key.library.play": "r", "key.global.quit": "", "key.episodes.toggle": "q"}); err != nil {
+		t.Fatalf("loadKeyMap: %v", err)
+	}
+}
+
+// newKeyTestModel is an episode list of two episodes with keys k.
+func newKeyTestModel(t *testing.T, k keyMap) interactiveModel {
+	t.Helper()
+	useTempWorkingDir(t)
+	m := newInteractiveModel(openTestStore(t), t.TempDir(), "", "")
+	m.keys = k
+	m.podTitle = "Pod"
+	m.allItems = []episodeItem{
+		{title: "One", dateStr: "2024-01-02", filename: "Pod-2024-01-02-One-aaa.mp3"},
+		{title: "Two", dateStr: "2024-01-01", filename: "Pod-2024-01-01-Two-bbb.mp3"},
+	}
+	m.rebuildVisibleItems()
+	m.step = stepSelect
+	m.feedOptions = []string{"Pod"}
+	return m
+}
+
+func TestReboundKeys(t *testing.T) {
+	k, err := loadKeyMap(map[string]string{"key.episodes.toggle": "x", "key.global.down": "z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newKeyTestModel(t, k)
+	update := func(msg tea.KeyMsg) {
+		t.Helper()
+		next, _ := m.Update(msg)
+		m = next.(interactiveModel)
+	}
+	update(tea.KeyMsg{Type: tea.KeySpace})
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("z")})
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	if m.cursor != 1 || m.allItems[0].selected || !m.allItems[1].selected {
+		t.Fatalf("cursor=%d selected=%v,%v", m.cursor, m.allItems[0].selected, m.allItems[1].selected)
+	}
+	if view := m.View(); !strings.Contains(view, "x: select") || strings.Contains(view, "Space: select") {
+		t.Fatalf("footer doesn't show the rebound key:\n%s", view)
+	}
+}
+
+func TestHelpOverlay(t *testing.T) {
+	m := newKeyTestModel(t, defaultKeyMap())
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("?")})
+	m = next.(interactiveModel)
+	view := m.View()
+	for _, want := range []string{"Keys: Episode list", "Space", "played/unplayed", "quit", "key.episodes.toggle"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("help is missing %q:\n%s", want, view)
+		}
+	}
+	// Any key closes it, and does nothing else
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeySpace})
+	m = next.(interactiveModel)
+	if m.showHelp || m.allItems[0].selected {
+		t.Fatalf("showHelp=%v selected=%v", m.showHelp, m.allItems[0].selected)
+	}
+}
+
+// q with selections asks again rather than losing them; text fields take q
+// as a letter.
+func TestQuitKeepsSelections(t *testing.T) {
+	m := newKeyTestModel(t, defaultKeyMap())
+	q := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("q")}
+	isQuit := func(cmd tea.Cmd) bool {
+		if cmd == nil {
+			return false
+		}
+		_, ok := cmd().(tea.QuitMsg)
+		return ok
+	}
+
+	next, cmd := m.Update(q)
+	m = next.(interactiveModel)
+	if !isQuit(cmd) {
+		t.Fatal("q with nothing selected did not quit")
+	}
+
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeySpace})
+	m = next.(interactiveModel)
+	next, cmd = m.Update(q)
+	m = next.(interactiveModel)
+	if isQuit(cmd) || !strings.Contains(m.errMsg, "1 selected episode(s) would be lost. Press q again") {
+		t.Fatalf("first q: quit=%v errMsg=%q", isQuit(cmd), m.errMsg)
+	}
+	if _, cmd = m.Update(q); !isQuit(cmd) {
+		t.Fatal("second q did not quit")
+	}
+
+	// Another key in between starts over
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+	m = next.(interactiveModel)
+	if _, cmd = m.Update(q); isQuit(cmd) {
+		t.Fatal("q after another key quit without asking")
+	}
+
+	m.step = stepURL
+	m.urlInput.Focus()
+	for _, r := range "qb" {
+		next, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = next.(interactiveModel)
+		if isQuit(cmd) || m.step != stepURL {
+			t.Fatalf("typing %q on the URL screen: quit=%v step=%v", r, isQuit(cmd), m.step)
+		}
+	}
+	if m.urlInput.Value() != "qb" {
+		t.Fatalf("URL = %q", m.urlInput.Value())
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+// Filters for -l. With no filters -l keeps its old behaviour: the 100 most
+// recent episodes across every podcast.
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultLatestLimit is how many episodes -l lists without --limit.
+const defaultLatestLimit = 100
+
+// -l sort orders.
+const (
+	sortNewest  = "newest"
+	sortOldest  = "oldest"
+	sortPodcast = "podcast"
+	sortTitle   = "title"
+)
+
+// statusPending is the -l spelling of statusNotDownloaded.
+const statusPending = "pending"
+
+// latestFilter narrows and orders -l. Zero values mean "no filter".
+type latestFilter struct {
+	podcasts []string  // exact podcast titles, resolved from --podcast
+	since    time.Time // inclusive, by published (or first seen) date
+	until    time.Time // inclusive
+	status   string    // one of the status* constants
+	match    string    // words that must all appear in the title or description
+	unplayed bool      // leave out episodes marked played (see played.go)
+	limit    int       // 0 lists everything
+	sort     string
+}
+
+// latestFilterOptions are the raw -l flags, before validation.
+type latestFilterOptions struct {
+	podcast, since, until, status, match, sort string
+	unplayed                                   bool
+	limit                                      int
+}
+
+// podcastMatcher compiles a --podcast pattern. "/expr/" is a regular
+// expression; anything else is a shell glob (a plain title matches exactly).
+// Both ignore case.
+func podcastMatcher(pattern string) (func(string) bool, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("--podcast %s: %w", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+	glob := strings.ToLower(pattern)
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, fmt.Errorf("--podcast %s: %w", pattern, err)
+	}
+	return func(title string) bool {
+		ok, _ := path.Match(glob, strings.ToLower(title))
+		return ok
+	}, nil
+}
+
+// parseLatestStatus accepts the statuses search reports, with "pending" as
+// an alias for "not downloaded".
+func parseLatestStatus(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "":
+		return "", nil
+	case statusDownloaded:
+		return statusDownloaded, nil
+	case statusArchived:
+		return statusArchived, nil
+	case statusSkipped:
+		return statusSkipped, nil
+	case statusPending, statusNotDownloaded, "not-downloaded":
+		return statusNotDownloaded, nil
+	}
+	return "", fmt.Errorf("unknown --status %q (want downloaded, archived, skipped or pending)", s)
+}
+
+func parseLatestDate(flag, s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s %q: want YYYY-MM-DD", flag, s)
+	}
+	return t, nil
+}
+
+// buildLatestFilter validates the -l flags. A --podcast pattern is resolved
+// against the podcasts in the db here, so a pattern matching nothing is
+// reported rather than silently listing nothing.
+func buildLatestFilter(s *store, o latestFilterOptions) (latestFilter, error) {
+	f := latestFilter{match: strings.TrimSpace(o.match), unplayed: o.unplayed, limit: o.limit, sort: sortNewest}
+	var err error
+	if f.since, err = parseLatestDate("--since", o.since); err != nil {
+		return f, err
+	}
+	if f.until, err = parseLatestDate("--until", o.until); err != nil {
+		return f, err
+	}
+	if !f.since.IsZero() && !f.until.IsZero() && f.until.Before(f.since) {
+		return f, fmt.Errorf("--until %s is before --since %s", o.until, o.since)
+	}
+	if f.status, err = parseLatestStatus(o.status); err != nil {
+		return f, err
+	}
+	if f.limit < 0 {
+		return f, fmt.Errorf("--limit must not be negative")
+	}
+	switch o.sort {
+	case "":
+	case sortNewest, sortOldest, sortPodcast, sortTitle:
+		f.sort = o.sort
+	default:
+		return f, fmt.Errorf("unknown --sort %q (want newest, oldest, podcast or title)", o.sort)
+	}
+
+	if o.podcast != "" {
+		matches, err := podcastMatcher(o.podcast)
+		if err != nil {
+			return f, err
+		}
+		titles, err := s.episodePodcastTitles()
+		if err != nil {
+			return f, err
+		}
+		for _, t := range titles {
+			if matches(t) {
+				f.podcasts = append(f.podcasts, t)
+			}
+		}
+		if len(f.podcasts) == 0 {
+			return f, fmt.Errorf("--podcast %s matches no podcast in the db", o.podcast)
+		}
+	}
+	return f, nil
+}
+
+// onDiskPath returns where filename exists in the first scan path that has
+// it, or "" if none does.
+func onDiskPath(scanPaths []string, filename string) string {
+	if filename == "" || filename == "?" {
+		return ""
+	}
+	for _, dir := range scanPaths {
+		p := filepath.Join(dir, filename)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPodcastMatcher(t *testing.T) {
+	cases := []struct {
+		pattern string
+		title   string
+		want    bool
+	}{
+		{"In Our Time", "in our time", true},
+		{"In Our", "In Our Time", false},
+		{"in our*", "In Our Time", true},
+		{"*extra", "History Extra", true},
+		{"/^(history|science) /", "History Extra", true},
+		{"/^(history|science) /", "In Our Time", false},
+	}
+	for _, c := range cases {
+		m, err := podcastMatcher(c.pattern)
+		if err != nil {
+			t.Fatalf("podcastMatcher(%q): %v", c.pattern, err)
+		}
+		if got := m(c.title); got != c.want {
+			t.Errorf("%q matching %q = %v, want %v", c.pattern, c.title, got, c.want)
+		}
+	}
+	for _, bad := range []string{"/(/", "[a"} {
+		if _, err := podcastMatcher(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func latestTitles(rows []latestPodResult) []string {
+	out := make([]string, len(rows))
+	for i, r := range rows {
+		out[i] = r.title.String
+	}
+	return out
+}
+
+func TestLatestEpisodesFilters(t *testing.T) {
+	st := searchTestStore(t)
+
+	list := func(o latestFilterOptions) []string {
+		t.Helper()
+		f, err := buildLatestFilter(st, o)
+		if err != nil {
+			t.Fatalf("buildLatestFilter(%+v): %v", o, err)
+		}
+		rows, err := st.latestEpisodes(f)
+		if err != nil {
+			t.Fatalf("latestEpisodes: %v", err)
+		}
+		return latestTitles(rows)
+	}
+
+	// No filters: everything, newest first
+	if got := list(latestFilterOptions{}); len(got) != 5 || got[0] != "The plague of Justinian" {
+		t.Fatalf("unfiltered got %v", got)
+	}
+	if got := list(latestFilterOptions{limit: 2}); len(got) != 2 {
+		t.Fatalf("limit 2 got %v", got)
+	}
+	if got := list(latestFilterOptions{podcast: "history*", sort: sortOldest}); !reflect.DeepEqual(got,
+		[]string{"Tudor queens", "Medieval medicine", "The fall of Byzantium"}) {
+		t.Fatalf("podcast glob, oldest first got %v", got)
+	}
+	if got := list(latestFilterOptions{since: "2026-01-02", until: "2026-02-01"}); !reflect.DeepEqual(got,
+		[]string{"Byzantine art", "The fall of Byzantium", "Medieval medicine"}) {
+		t.Fatalf("date range got %v", got)
+	}
+	if got := list(latestFilterOptions{status: "pending"}); !reflect.DeepEqual(got,
+		[]string{"The plague of Justinian", "Tudor queens"}) {
+		t.Fatalf("pending got %v", got)
+	}
+	if got := list(latestFilterOptions{status: "archived"}); !reflect.DeepEqual(got, []string{"Byzantine art"}) {
+		t.Fatalf("archived got %v", got)
+	}
+	if got := list(latestFilterOptions{match: "plague"}); !reflect.DeepEqual(got,
+		[]string{"The plague of Justinian", "Medieval medicine"}) {
+		t.Fatalf("match got %v", got)
+	}
+	if got := list(latestFilterOptions{sort: sortTitle, limit: 1}); !reflect.DeepEqual(got, []string{"Byzantine art"}) {
+		t.Fatalf("title sort got %v", got)
+	}
+
+	for _, bad := range []latestFilterOptions{
+		{podcast: "nothing like it"},
+		{since: "01/02/2026"},
+		{since: "2026-02-01", until: "2026-01-01"},
+		{status: "lost"},
+		{sort: "random"},
+		{limit: -1},
+	} {
+		if _, err := buildLatestFilter(st, bad); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+}
+
+func TestOnDiskPath(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(b, "Pod-2026-01-01-Ep-h.mp3"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := onDiskPath([]string{a, b}, "Pod-2026-01-01-Ep-h.mp3"); got != filepath.Join(b, "Pod-2026-01-01-Ep-h.mp3") {
+		t.Fatalf("got %q", got)
+	}
+	if got := onDiskPath([]string{a, b}, "?"); got != "" {
+		t.Fatalf("unnameable episode got %q", got)
+	}
+}
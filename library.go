@@ -0,0 +1,454 @@
+package main
+
+// The interactive library: every file gopodder has recorded, from
+// downloads (in the podcasts dir) and archived_episodes (on an archive
+// volume), joined to its episode and grouped by podcast, with its size,
+// tag state and location. Files can be deleted, moved to the archive,
+// retagged, played (see played.go) or have their full path shown.
+//
+// The actions keep the db the way the CLI does. Delete and archive run as
+// a journalled dedup run (see trash.go), so --undo-dedup takes them back:
+// a deleted file goes to the trash with a never-download override (or the
+// next -s would fetch it again), and an archived one is moved, across
+// volumes if need be, and registered with the --register-archive code.
+// Retagging is -t's tag-and-stamp for one file.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// libraryEntry is one recorded file.
+type libraryEntry struct {
+	podcast  string
+	title    string
+	hash     string
+	dir      string // the scan path it lives under
+	name     string // path relative to dir; the downloads key for a primary file
+	path     string
+	archived bool   // an archived_episodes row, rather than a downloads one
+	taggedAt string // downloads.tagged_at; "" if untagged or archived
+	size     int64
+	missing  bool // not on disk (an unmounted archive, or deleted by hand)
+	play     playState
+}
+
+// loadLibrary lists the recorded files, grouped by podcast then newest
+// file name first. Primary files are looked for in the podcasts dir,
+// scanPaths[0]; archived ones under whichever archive scan path holds them.
+func loadLibrary(s *store, scanPaths []string) ([]libraryEntry, error) {
+	const titles = `
+		LEFT JOIN episodes AS e ON e.podcastname_episodename_hash = %[1]s
+		LEFT JOIN interactive_episodes AS i ON i.podcastname_episodename_hash = %[1]s`
+	rows, err := s.q.Query(`
+		SELECT d.filename, d.hash, IFNULL(d.tagged_at, ''),
+			COALESCE(e.podcast_title, i.podcast_title, ''), COALESCE(e.title, i.title, '')
+		FROM downloads AS d` + fmt.Sprintf(titles, "d.hash") + `;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []libraryEntry
+	for rows.Next() {
+		var e libraryEntry
+		if err := rows.Scan(&e.name, &e.hash, &e.taggedAt, &e.podcast, &e.title); err != nil {
+			return nil, err
+		}
+		e.dir = scanPaths[0]
+		e.path = filepath.Join(e.dir, filepath.FromSlash(e.name))
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = s.q.Query(`
+		SELECT a.podcastname_episodename_hash, IFNULL(a.archived_path, ''),
+			COALESCE(e.podcast_title, i.podcast_title, ''), COALESCE(e.title, i.title, '')
+		FROM archived_episodes AS a` + fmt.Sprintf(titles, "a.podcastname_episodename_hash") + `
+		WHERE a.archived_path IS NOT NULL AND a.archived_path != '';`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e := libraryEntry{archived: true}
+		if err := rows.Scan(&e.hash, &e.path, &e.podcast, &e.title); err != nil {
+			return nil, err
+		}
+		e.dir, e.name = splitScanPath(e.path, scanPaths[1:])
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	states, err := s.playStates()
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].play = states[out[i].hash]
+		if info, err := os.Stat(out[i].path); err == nil {
+			out[i].size = info.Size()
+		} else {
+			out[i].missing = true
+		}
+		if out[i].podcast == "" {
+			out[i].podcast = "(no episode row)"
+		}
+		if out[i].title == "" {
+			out[i].title = filepath.Base(out[i].path)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].podcast != out[j].podcast {
+			return strings.ToLower(out[i].podcast) < strings.ToLower(out[j].podcast)
+		}
+		return filepath.Base(out[i].path) > filepath.Base(out[j].path)
+	})
+	return out, nil
+}
+
+// splitScanPath splits path into the archive scan path it is under and the
+// name relative to it, falling back to its own dir and base name.
+func splitScanPath(path string, archiveDirs []string) (string, string) {
+	for _, dir := range archiveDirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return dir, filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Dir(path), filepath.Base(path)
+}
+
+// deleteLibraryEntry moves a file to the trash, forgets it in downloads or
+// archived_episodes and records a never-download override for its episode,
+// as a dedup run. Returns the run id for --undo-dedup.
+func deleteLibraryEntry(s *store, e libraryEntry, now time.Time) (string, error) {
+	tx, err := s.begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.rollback()
+	j, err := newDedupJournal(tx, "library-delete", now)
+	if err != nil {
+		return "", err
+	}
+	defer j.close()
+
+	if !e.missing {
+		if err := j.trash(dedupFile{path: e.path, dir: e.dir, name: e.name}); err != nil {
+			return "", err
+		}
+	}
+	if e.archived {
+		if err := j.saveRows("archived_episodes", e.hash); err != nil {
+			return "", err
+		}
+		if _, err := tx.deleteArchived(e.hash); err != nil {
+			return "", err
+		}
+	} else {
+		if err := j.saveRows("downloads", e.name); err != nil {
+			return "", err
+		}
+		if err := tx.deleteDownload(e.name); err != nil {
+			return "", err
+		}
+	}
+	// An episode with a row but no file is what -s downloads
+	if e.hash != "" {
+		var n int
+		if err := tx.q.QueryRow(`SELECT count(*) FROM episodes WHERE podcastname_episodename_hash = ?;`, e.hash).Scan(&n); err != nil {
+			return "", err
+		}
+		if n > 0 {
+			if err := j.replacingRow("download_overrides", e.hash); err != nil {
+				return "", err
+			}
+			if err := tx.setDownloadOverride(e.hash, overrideNever); err != nil {
+				return "", err
+			}
+		}
+	}
+	if err := tx.commit(); err != nil {
+		return "", err
+	}
+	j.done()
+	return j.runID, nil
+}
+
+// archiveLibraryEntry moves a primary file to archiveDir, keeping its name
+// (template folders included), and swaps its downloads row for an
+// archived_episodes one, as a dedup run. Returns the run id.
+func archiveLibraryEntry(s *store, e libraryEntry, archiveDir string, now time.Time) (string, error) {
+	if e.archived {
+		return "", fmt.Errorf("already archived")
+	}
+	if e.missing {
+		return "", fmt.Errorf("%s is not on disk", e.path)
+	}
+	if _, _, err := hashFromFilename(filepath.Base(e.name)); err != nil {
+		return "", fmt.Errorf("%s has no episode hash in its name", e.name)
+	}
+	absDir, err := filepath.Abs(archiveDir)
+	if err != nil {
+		return "", err
+	}
+	dest := filepath.Join(absDir, filepath.FromSlash(e.name))
+	if _, err := os.Stat(dest); err == nil {
+		return "", fmt.Errorf("%s already exists", dest)
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.rollback()
+	j, err := newDedupJournal(tx, "library-archive", now)
+	if err != nil {
+		return "", err
+	}
+	defer j.close()
+
+	// A rename on the same volume, a synced copy and remove across volumes
+	if err := j.move(e.path, dest); err != nil {
+		return "", err
+	}
+	if err := j.saveRows("downloads", e.name); err != nil {
+		return "", err
+	}
+	if err := tx.deleteDownload(e.name); err != nil {
+		return "", err
+	}
+	if err := j.replacingRow("archived_episodes", e.hash); err != nil {
+		return "", err
+	}
+	if _, err := registerArchiveNames(tx, absDir, []string{e.name}); err != nil {
+		return "", err
+	}
+	if err := tx.commit(); err != nil {
+		return "", err
+	}
+	j.done()
+	return j.runID, nil
+}
+
+// retagLibraryEntry rewrites a file's tags from its episode, stamping
+// tagged_at for a primary file as -t does.
+func retagLibraryEntry(s *store, e libraryEntry, pythonPath, eyeD3Dir string) error {
+	if e.missing {
+		return fmt.Errorf("%s is not on disk", e.path)
+	}
+	if err := tagSinglePod(e.path, e.title, e.podcast, pythonPath, eyeD3Dir); err != nil {
+		return err
+	}
+	if e.archived {
+		return nil
+	}
+	return s.markDownloadTagged(e.name)
+}
+
+type libraryMsg struct {
+	entries []libraryEntry
+	note    string // what the action that led here did
+	err     error
+}
+
+func loadLibraryCmd(s *store, scanPaths []string, note string) tea.Cmd {
+	return func() tea.Msg {
+		entries, err := loadLibrary(s, scanPaths)
+		return libraryMsg{entries: entries, note: note, err: err}
+	}
+}
+
+// libraryActionCmd runs one action, then reloads the library.
+func libraryActionCmd(s *store, scanPaths []string, action func() (string, error)) tea.Cmd {
+	return func() tea.Msg {
+		note, err := action()
+		if err != nil {
+			return libraryMsg{err: err}
+		}
+		return loadLibraryCmd(s, scanPaths, note)()
+	}
+}
+
+func (m interactiveModel) updateLibrary(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.updateWindowSize(msg)
+		return m, nil
+	case libraryMsg:
+		if msg.err != nil {
+			m.errMsg = msg.err.Error()
+			return m, nil
+		}
+		m.library = msg.entries
+		m.errMsg = msg.note
+		if m.libraryCursor >= len(m.library) {
+			m.libraryCursor = len(m.library) - 1
+		}
+		if m.libraryCursor < 0 {
+			m.libraryCursor = 0
+		}
+		return m, nil
+	case tea.KeyMsg:
+		k := m.keys.library
+		confirming := m.libraryConfirm
+		m.libraryConfirm = ""
+		switch {
+		case key.Matches(msg, m.keys.global.up):
+			if m.libraryCursor > 0 {
+				m.libraryCursor--
+			}
+			m.errMsg = ""
+			return m, nil
+		case key.Matches(msg, m.keys.global.down):
+			if m.libraryCursor < len(m.library)-1 {
+				m.libraryCursor++
+			}
+			m.errMsg = ""
+			return m, nil
+		case key.Matches(msg, m.keys.global.back):
+			m.errMsg = ""
+			m.step = stepFeedSelect
+			m.ensureFeedVisible()
+			return m, nil
+		}
+		if len(m.library) == 0 {
+			return m, nil
+		}
+		e := m.library[m.libraryCursor]
+		s, scanPaths := m.store, m.scanPaths
+		var action func() (string, error)
+		switch {
+		case key.Matches(msg, k.path):
+			state := "on disk"
+			if e.missing {
+				state = "not on disk"
+			}
+			m.errMsg = fmt.Sprintf("%s (%s)", e.path, state)
+			return m, nil
+		case key.Matches(msg, k.play):
+			if e.missing {
+				m.errMsg = e.path + " is not on disk."
+				return m, nil
+			}
+			m.errMsg = ""
+			return m, playEpisodeCmd(s, e.hash, e.path)
+		case key.Matches(msg, k.played):
+			if e.hash == "" {
+				m.errMsg = "No episode hash for " + filepath.Base(e.path) + "."
+				return m, nil
+			}
+			return m, togglePlayedCmd(s, e.hash, e.play)
+		case key.Matches(msg, k.remove):
+			if confirming != "delete" {
+				m.libraryConfirm = "delete"
+				m.errMsg = "Press " + k.remove.Help().Key + " again to move " + filepath.Base(e.path) +
+					" to the trash. The episode won't be downloaded again."
+				return m, nil
+			}
+			action = func() (string, error) {
+				runID, err := deleteLibraryEntry(s, e, time.Now())
+				return fmt.Sprintf("Moved to the trash and marked never-download; undo with --undo-dedup %s", runID), err
+			}
+		case key.Matches(msg, k.archive):
+			if len(scanPaths) < 2 {
+				m.errMsg = fmt.Sprintf("No archive dir: set $%s.", archivesVarEnvName)
+				return m, nil
+			}
+			if e.archived {
+				m.errMsg = "Already archived."
+				return m, nil
+			}
+			if confirming != "archive" {
+				m.libraryConfirm = "archive"
+				m.errMsg = "Press " + k.archive.Help().Key + " again to move " + filepath.Base(e.path) + " to " + scanPaths[1] + "."
+				return m, nil
+			}
+			action = func() (string, error) {
+				runID, err := archiveLibraryEntry(s, e, scanPaths[1], time.Now())
+				return fmt.Sprintf("Archived; undo with --undo-dedup %s", runID), err
+			}
+		case key.Matches(msg, k.retag):
+			pythonPath, eyeD3Dir := m.pythonPath, m.eyeD3Dir
+			action = func() (string, error) {
+				return "Retagged " + filepath.Base(e.path) + ".", retagLibraryEntry(s, e, pythonPath, eyeD3Dir)
+			}
+		default:
+			return m, nil
+		}
+		m.errMsg = ""
+		return m, libraryActionCmd(s, scanPaths, action)
+	}
+	return m, nil
+}
+
+func (m interactiveModel) viewLibrary() string {
+	var b strings.Builder
+	var total int64
+	for _, e := range m.library {
+		total += e.size
+	}
+	b.WriteString(fmt.Sprintf("Library: %d files, %.1f GiB\n\n", len(m.library), float64(total)/1073741824.0))
+	if m.errMsg != "" {
+		b.WriteString(m.errMsg)
+		b.WriteString("\n\n")
+	}
+	if len(m.library) == 0 {
+		b.WriteString("Nothing downloaded or archived yet.\n\n" + keyHints(m.keys.global.back, m.keys.global.quit) + "\n")
+		return b.String()
+	}
+
+	rows := m.windowSize
+	if rows < 3 {
+		rows = 3
+	}
+	start := 0
+	if m.libraryCursor >= rows {
+		start = m.libraryCursor - rows + 1
+	}
+	end := start + rows
+	if end > len(m.library) {
+		end = len(m.library)
+	}
+	for i := start; i < end; i++ {
+		e := m.library[i]
+		if i == start || m.library[i-1].podcast != e.podcast {
+			b.WriteString(e.podcast + "\n")
+		}
+		cursor := " "
+		if i == m.libraryCursor {
+			cursor = ">"
+		}
+		tag := " "
+		if e.taggedAt != "" {
+			tag = "t"
+		}
+		where := "primary"
+		if e.archived {
+			where = "archive"
+		}
+		size := fmt.Sprintf("%6.1f MB", float64(e.size)/1e6)
+		if e.missing {
+			size = "  missing"
+		}
+		b.WriteString(fmt.Sprintf("%s [%s] %s %-7s %s%s\n", cursor, tag, size, where, e.title, playedNote(e.play)))
+	}
+	if len(m.library) > rows {
+		b.WriteString(fmt.Sprintf("\nShowing %d-%d of %d files.\n", start+1, end, len(m.library)))
+	}
+	k := m.keys.library
+	b.WriteString("\n[t] = tagged.  " + keyHints(k.path, k.play, k.played, k.remove, k.archive, k.retag,
+		m.keys.global.back, m.keys.global.quit, m.keys.global.help) + "\n")
+	return b.String()
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// seedLibrary puts one primary download and one archived episode on disk
+// and in the db. Returns the scan paths.
+func seedLibrary(t *testing.T, st *store) []string {
+	t.Helper()
+	primary, archive := t.TempDir(), t.TempDir()
+	newName := buildEpisodeFilename("Alpha", "New one", "2024-02-01")
+	oldName := buildEpisodeFilename("Alpha", "Old one", "2023-01-01")
+	for _, f := range []struct{ dir, name string }{{primary, newName}, {archive, oldName}} {
+		if err := os.WriteFile(filepath.Join(f.dir, f.name), make([]byte, 2000000), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newHash, _, _ := hashFromFilename(newName)
+	oldHash, _, _ := hashFromFilename(oldName)
+	for _, ep := range []struct{ title, hash string }{{"New one", newHash}, {"Old one", oldHash}} {
+		if _, err := st.q.Exec(`INSERT INTO episodes (title, first_seen, last_seen, podcast_title, podcastname_episodename_hash)
+			VALUES (?, ?, ?, 'Alpha', ?);`, ep.title, ts, ts, ep.hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := st.recordDownloadSeen(newName, newHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.upsertArchived(oldHash, filepath.Join(archive, oldName)); err != nil {
+		t.Fatal(err)
+	}
+	return []string{primary, archive}
+}
+
+func TestLoadLibrary(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	scanPaths := seedLibrary(t, st)
+
+	entries, err := loadLibrary(st, scanPaths)
+	if err != nil {
+		t.Fatalf("loadLibrary: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if e := entries[0]; e.title != "New one" || e.archived || e.dir != scanPaths[0] || e.size != 2000000 || e.missing {
+		t.Fatalf("first entry = %+v", e)
+	}
+	if e := entries[1]; e.title != "Old one" || !e.archived || e.dir != scanPaths[1] || e.missing {
+		t.Fatalf("second entry = %+v", e)
+	}
+}
+
+// Delete and archive move files and rows as a dedup run that undo takes
+// back.
+func TestLibraryDeleteAndArchive(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	scanPaths := seedLibrary(t, st)
+	entries, err := loadLibrary(st, scanPaths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary, archived := entries[0], entries[1]
+	count := func(table, where, key string) int {
+		var n int
+		if err := st.q.QueryRow(`SELECT count(*) FROM `+table+` WHERE `+where+` = ?;`, key).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	runID, err := archiveLibraryEntry(st, primary, scanPaths[1], time.Now())
+	if err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	dest := filepath.Join(scanPaths[1], primary.name)
+	if _, err := os.Stat(dest); err != nil {
+		t.Fatalf("archived file: %v", err)
+	}
+	if count("downloads", "filename", primary.name) != 0 || count("archived_episodes", "podcastname_episodename_hash", primary.hash) != 1 {
+		t.Fatal("archive left the rows unchanged")
+	}
+	if _, err := undoDedupRun(st, runID); err != nil {
+		t.Fatalf("undo archive: %v", err)
+	}
+	if _, err := os.Stat(primary.path); err != nil {
+		t.Fatalf("undo did not move the file back: %v", err)
+	}
+	if count("downloads", "filename", primary.name) != 1 || count("archived_episodes", "podcastname_episodename_hash", primary.hash) != 0 {
+		t.Fatal("undo did not restore the rows")
+	}
+
+	runID, err = deleteLibraryEntry(st, archived, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := os.Stat(archived.path); !os.IsNotExist(err) {
+		t.Fatalf("deleted file still there: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(scanPaths[1], trashDirName, runID, archived.name)); err != nil {
+		t.Fatalf("deleted file not in the trash: %v", err)
+	}
+	if count("archived_episodes", "podcastname_episodename_hash", archived.hash) != 0 {
+		t.Fatal("delete left the archive row")
+	}
+	// Or the next -s would find the episode missing and fetch it again
+	overrides, err := st.downloadOverrides()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overrides[archived.hash] != overrideNever {
+		t.Fatalf("override after delete = %q, want never", overrides[archived.hash])
+	}
+	if _, err := undoDedupRun(st, runID); err != nil {
+		t.Fatalf("undo delete: %v", err)
+	}
+	if overrides, _ := st.downloadOverrides(); overrides[archived.hash] != "" {
+		t.Fatalf("undo left the override %q", overrides[archived.hash])
+	}
+	if _, err := os.Stat(archived.path); err != nil || count("archived_episodes", "podcastname_episodename_hash", archived.hash) != 1 {
+		t.Fatalf("undo did not restore the file and row: %v", err)
+	}
+}
+
+// Archiving to another volume copies, syncs and removes instead of the
+// rename that fails with EXDEV, and undo brings the file back the same way.
+func TestLibraryArchiveAcrossVolumes(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	scanPaths := seedLibrary(t, st)
+	entries, err := loadLibrary(st, scanPaths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := entries[0]
+	old := renameFile
+	renameFile = func(from, to string) error {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: syscall.EXDEV}
+	}
+	t.Cleanup(func() { renameFile = old })
+
+	runID, err := archiveLibraryEntry(st, primary, scanPaths[1], time.Now())
+	if err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	dest := filepath.Join(scanPaths[1], primary.name)
+	if info, err := os.Stat(dest); err != nil || info.Size() != 2000000 {
+		t.Fatalf("archived copy: %v", err)
+	}
+	if _, err := os.Stat(primary.path); !os.IsNotExist(err) {
+		t.Fatalf("original still there: %v", err)
+	}
+	if _, err := undoDedupRun(st, runID); err != nil {
+		t.Fatalf("undo: %v", err)
+	}
+	if _, err := os.Stat(primary.path); err != nil {
+		t.Fatalf("undo did not copy the file back: %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Fatalf("archived copy still there after undo: %v", err)
+	}
+
+	// A name without an episode hash is refused before anything moves
+	unhashed := primary
+	unhashed.name = "notes.mp3"
+	if _, err := archiveLibraryEntry(st, unhashed, scanPaths[1], time.Now().Add(time.Second)); err == nil {
+		t.Fatal("archived a file with no episode hash")
+	}
+	if _, err := os.Stat(primary.path); err != nil {
+		t.Fatalf("refused archive moved the file: %v", err)
+	}
+}
+
+func TestLibraryScreen(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	scanPaths := seedLibrary(t, st)
+
+	m := newInteractiveModel(st, scanPaths[0], "", "")
+	m.scanPaths = scanPaths
+	m.step = stepFeedSelect
+	update := func(msg tea.Msg) {
+		t.Helper()
+		next, cmd := m.Update(msg)
+		m = next.(interactiveModel)
+		if cmd != nil {
+			if msg, ok := cmd().(libraryMsg); ok {
+				next, _ = m.Update(msg)
+				m = next.(interactiveModel)
+			}
+		}
+	}
+	key := func(k string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)} }
+
+	update(key("l"))
+	view := m.View()
+	if m.step != stepLibrary || !strings.Contains(view, "Alpha\n") || !strings.Contains(view, "2.0 MB primary New one") ||
+		!strings.Contains(view, "archive Old one") {
+		t.Fatalf("library view:\n%s", view)
+	}
+
+	// Delete needs a second press
+	update(key("x"))
+	if !strings.Contains(m.errMsg, "Press x again") || len(m.library) != 2 {
+		t.Fatalf("first x: errMsg=%q files=%d", m.errMsg, len(m.library))
+	}
+	update(key("x"))
+	if len(m.library) != 1 || !strings.Contains(m.errMsg, "--undo-dedup") {
+		t.Fatalf("second x: errMsg=%q files=%d", m.errMsg, len(m.library))
+	}
+
+	update(key("b"))
+	if m.step != stepFeedSelect {
+		t.Fatalf("b went to step %v", m.step)
+	}
+}
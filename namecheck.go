@@ -0,0 +1,125 @@
+package main
+
+// --check-filenames: which files on disk were named under the ASCII-only
+// title transformation and would be named differently today.
+//
+// titleTransformation used to keep only [A-Za-z] runs, so non-Latin titles
+// produced empty stems ("Podcast-2026-01-01--<hash>.mp3") and accented Latin
+// ones lost letters ("Caf_Society"). Files are matched by hash, so nothing
+// re-downloads when the scheme changes, but the twin and retitle passes key
+// on the name-minus-hash prefix: an old-scheme file no longer shares a
+// prefix with a freshly named copy of the same episode. This check lists
+// those files so they can be renamed (or left alone) knowingly. -a and -s
+// run it too and warn in one line when there are any, since nothing else
+// would tell a user upgrading that accented titles are now folded.
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// legacyTitleTransformation is titleTransformation as it was before it
+// learned other scripts: [A-Za-z] runs of the first 100 bytes, all-caps
+// words title-cased. Only the filename check uses it.
+func legacyTitleTransformation(s string) string {
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "\"", ""), "'", "")
+	if len(s) > 100 {
+		s = s[:100]
+	}
+	words := asciiWordRe.FindAllString(s, -1)
+	caser := cases.Title(language.English)
+	for i, w := range words {
+		if isUpper(w) {
+			words[i] = caser.String(strings.ToLower(w))
+		}
+	}
+	return strings.Join(words, "_")
+}
+
+var filenameDateRe = regexp.MustCompile(`-(\d{4}-\d{2}-\d{2})-`)
+
+// filenameChange is a file whose name would change under the current
+// transformation.
+type filenameChange struct {
+	path    string
+	newName string
+}
+
+// planFilenameChanges finds files named exactly as the legacy transformation
+// named their episode, where the current one names it differently. Files
+// that can't be attributed to an episode, or were named some other way
+// (retitles, renamed podcasts), are not this check's business. Pure.
+func planFilenameChanges(files []dedupFile, owners map[string]dedupOwner, url2ep map[string]string) []filenameChange {
+	out := make([]filenameChange, 0)
+	for _, f := range files {
+		o, ok := owners[f.hash]
+		if !ok {
+			if o, ok = owners[url2ep[f.hash]]; !ok {
+				continue
+			}
+		}
+		m := filenameDateRe.FindStringSubmatch(f.name)
+		if m == nil {
+			continue
+		}
+		date := m[1]
+		pod, title := strings.TrimSpace(o.podcastTitle), strings.TrimSpace(o.title)
+		legacy := fmt.Sprintf("%s-%s-%s", legacyTitleTransformation(pod), date, legacyTitleTransformation(title))
+		if f.prefix != legacy {
+			continue
+		}
+		// The check is about the title transformation, not the layout, so
+		// compare against the default template's file name
+		newName := defaultNameTemplate.render(episodeNaming{podcast: pod, title: title, date: date, hash: f.hash})
+		if newName != path.Base(f.name) {
+			out = append(out, filenameChange{path: f.path, newName: newName})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].path < out[j].path })
+	return out
+}
+
+// checkFilenames runs --check-filenames over the scan paths.
+func checkFilenames(s *store, scanPaths []string) ([]filenameChange, error) {
+	owners, url2ep, err := s.loadDedupOwners()
+	if err != nil {
+		return nil, err
+	}
+	files, err := gatherDedupFiles(scanPaths)
+	if err != nil {
+		return nil, err
+	}
+	return planFilenameChanges(files, owners, url2ep), nil
+}
+
+// warnFilenameChanges is the check as -a and -s run it: one line if any file
+// names differ, pointing at --check-filenames. A failed check only logs.
+func warnFilenameChanges(s *store, scanPaths []string) {
+	changes, err := checkFilenames(s, scanPaths)
+	if err != nil {
+		log.Printf("could not check file names: %v", err)
+		return
+	}
+	if len(changes) > 0 {
+		log.Printf("%d file name(s) predate the current title naming, so new copies of those episodes won't be seen as twins; --check-filenames lists them", len(changes))
+	}
+}
+
+func printFilenameChanges(w io.Writer, changes []filenameChange) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No file names would change")
+		return
+	}
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s\n  would now be named %s\n", c.path, c.newName)
+	}
+	fmt.Fprintf(w, "\n%d file name(s) differ from the current naming. They are still matched by hash,\n"+
+		"but the dedup passes group copies by name, so new copies of these episodes won't be seen as twins.\n", len(changes))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTitleTransformationScripts(t *testing.T) {
+	// ASCII titles are named exactly as before
+	for _, s := range []string{
+		"The Rest Is History",
+		"BBC Radio 4: In Our Time (2019) - Part 2",
+		"Don't \"Panic\" | WS MoreOrLess",
+		strings.Repeat("Long title words ", 10),
+	} {
+		if got, want := titleTransformation(s), legacyTitleTransformation(s); got != want {
+			t.Errorf("titleTransformation(%q) = %q, want the legacy %q", s, got, want)
+		}
+	}
+
+	for in, want := range map[string]string{
+		"Café Society":      "Cafe_Society",
+		"Straße der Lieder": "Strasse_der_Lieder",
+		"Ελληνική Ιστορία":  "Ελληνική_Ιστορία",
+		"ΝΕΑ Podcast":       "Νεα_Podcast",
+		"Новости дня":       "Новости_дня",
+		"ゆっくり歴史解説 第3回":      "ゆっくり歴史解説_第_回",
+		"ＮＨＫニュース":           "Nhk_ニュース",
+		"Podcastの時間":        "Podcast_の時間",
+		"हिन्दी पॉडकास्ट":   "हिन्दी_पॉडकास्ट",
+	} {
+		if got := titleTransformation(in); got != want {
+			t.Errorf("titleTransformation(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	long := titleTransformation(strings.Repeat("日本語", 50))
+	if !utf8.ValidString(long) || len(long) > 100 || long == "" {
+		t.Errorf("a long CJK title should truncate on a rune boundary, got %q", long)
+	}
+}
+
+func TestPlanFilenameChanges(t *testing.T) {
+	greek := dedupOwner{epHash: strings.Repeat("a", 32), podcastTitle: "Ιστορία", title: "Η μάχη του Μαραθώνα", published: "2026-01-01T00:00:00Z"}
+	cafe := dedupOwner{epHash: strings.Repeat("b", 32), podcastTitle: "Café Society", title: "Opening Night", published: "2026-01-02T00:00:00Z"}
+	plain := dedupOwner{epHash: strings.Repeat("c", 32), podcastTitle: "Plain Show", title: "Ep", published: "2026-01-03T00:00:00Z"}
+	owners := map[string]dedupOwner{greek.epHash: greek, cafe.epHash: cafe, plain.epHash: plain}
+
+	file := func(name string) dedupFile {
+		hash, _, _ := hashFromFilename(name)
+		prefix, _ := nameMinusHash(name)
+		return dedupFile{path: "/pods/" + name, dir: "/pods", name: name, hash: hash, prefix: prefix}
+	}
+	legacyGreek := "-2026-01-01--" + greek.epHash + ".mp3"
+	legacyCafe := "Caf_Society-2026-01-02-Opening_Night-" + cafe.epHash + ".mp3"
+	files := []dedupFile{
+		file(legacyGreek),
+		file(legacyCafe),
+		file(buildNonInteractiveFilename(plain.podcastTitle, plain.title, plain.published, plain.epHash)),
+		// A retitle leftover: named for another title, not this check's concern
+		file("Caf_Society-2026-01-02-Old_Title-" + cafe.epHash + ".mp3"),
+	}
+
+	changes := planFilenameChanges(files, owners, nil)
+	if len(changes) != 2 {
+		t.Fatalf("expected the two legacy-named files, got %+v", changes)
+	}
+	want := map[string]string{
+		"/pods/" + legacyGreek: buildNonInteractiveFilename(greek.podcastTitle, greek.title, greek.published, greek.epHash),
+		"/pods/" + legacyCafe:  "Cafe_Society-2026-01-02-Opening_Night-" + cafe.epHash + ".mp3",
+	}
+	for _, c := range changes {
+		if want[c.path] != c.newName {
+			t.Errorf("%s: new name %q, want %q", c.path, c.newName, want[c.path])
+		}
+	}
+}
+
+// -a and -s warn in one line about files the current naming would rename.
+func TestWarnFilenameChanges(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	dir := t.TempDir()
+	hash := fmt.Sprintf("%x", md5.Sum([]byte("Café Society"+"Opening Night")))
+	if _, err := st.q.Exec(`INSERT INTO episodes (title, published, first_seen, last_seen, podcast_title, podcastname_episodename_hash)
+		VALUES ('Opening Night', '2026-01-02T00:00:00Z', ?, ?, 'Café Society', ?);`, ts, ts, hash); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+
+	warnFilenameChanges(st, []string{dir})
+	if buf.Len() != 0 {
+		t.Fatalf("warned about an empty library: %s", buf.String())
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Caf_Society-2026-01-02-Opening_Night-"+hash+".mp3"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	warnFilenameChanges(st, []string{dir})
+	if out := buf.String(); strings.Count(out, "\n") != 1 || !strings.Contains(out, "1 file name(s) predate") || !strings.Contains(out, "--check-filenames") {
+		t.Fatalf("warning = %q", out)
+	}
+}
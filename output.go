@@ -0,0 +1,184 @@
+package main
+
+// Machine-readable output for the list and report commands (-l, --search,
+// --skipped, the dedup/prune passes and the archive commands).
+//
+// --format text (the default) keeps the human output unchanged. --format
+// json writes one JSON object per run; --format csv writes a header row and
+// one row per item. The shapes are a documented interface (README, "Machine-
+// readable output"): fields may be added, but existing ones are not renamed
+// or retyped without bumping reportSchemaVersion. In json/csv mode the
+// logger moves to stderr so stdout carries only the report.
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+// reportSchemaVersion is stamped on every JSON report.
+const reportSchemaVersion = 1
+
+// reportFormat is the --format in effect, set once in main. Like verbose, it
+// is a process-wide switch rather than a parameter threaded everywhere.
+var reportFormat = formatText
+
+// parseReportFormat validates a --format value.
+func parseReportFormat(s string) (string, error) {
+	switch s {
+	case "", formatText:
+		return formatText, nil
+	case formatJSON, formatCSV:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown --format %q (want text, json or csv)", s)
+}
+
+// reportHeader opens every JSON report.
+type reportHeader struct {
+	SchemaVersion int    `json:"schema_version"`
+	Command       string `json:"command"`
+}
+
+func newReportHeader(command string) reportHeader {
+	return reportHeader{SchemaVersion: reportSchemaVersion, Command: command}
+}
+
+// csvRecord is an item that can be written as a CSV row under a fixed
+// header.
+type csvRecord interface {
+	csvRow() []string
+}
+
+// writeJSONReport writes report as indented JSON.
+func writeJSONReport(w io.Writer, report interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// writeCSVReport writes header then one row per record.
+func writeCSVReport(w io.Writer, header []string, records []csvRecord) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := cw.Write(r.csvRow()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// countReport is the result of the archive commands: how many registry rows
+// a command registered or removed.
+type countReport struct {
+	reportHeader
+	Dir   string `json:"dir,omitempty"`
+	Count int    `json:"count"`
+}
+
+var countReportCSVHeader = []string{"command", "dir", "count"}
+
+func (r countReport) csvRow() []string {
+	return []string{r.Command, r.Dir, strconv.Itoa(r.Count)}
+}
+
+// writeCountReport reports an archive command's result in the current
+// format; text is the caller's log line.
+func writeCountReport(w io.Writer, command, dir string, count int, text string) error {
+	r := countReport{reportHeader: newReportHeader(command), Dir: dir, Count: count}
+	switch reportFormat {
+	case formatJSON:
+		return writeJSONReport(w, r)
+	case formatCSV:
+		return writeCSVReport(w, countReportCSVHeader, []csvRecord{r})
+	}
+	log.Print(text)
+	return nil
+}
+
+// episodeRecord is one episode in the -l and --search reports.
+type episodeRecord struct {
+	Published    string `json:"published"`
+	PodcastTitle string `json:"podcast_title"`
+	Title        string `json:"title"`
+	Author       string `json:"author"`
+	EpisodeHash  string `json:"episode_hash"`
+	Filename     string `json:"filename"`
+	Status       string `json:"status,omitempty"`
+	Path         string `json:"path,omitempty"` // -l only: where the file is on disk
+}
+
+var episodeRecordCSVHeader = []string{"published", "podcast_title", "title", "author", "episode_hash", "filename", "status", "path"}
+
+func (r episodeRecord) csvRow() []string {
+	return []string{r.Published, r.PodcastTitle, r.Title, r.Author, r.EpisodeHash, r.Filename, r.Status, r.Path}
+}
+
+// episodeListReport is the JSON shape of -l and --search.
+type episodeListReport struct {
+	reportHeader
+	Query    string          `json:"query,omitempty"`
+	Episodes []episodeRecord `json:"episodes"`
+}
+
+// writeEpisodeList writes -l or --search results as JSON or CSV.
+func writeEpisodeList(w io.Writer, command, query string, records []episodeRecord) error {
+	if reportFormat == formatCSV {
+		rows := make([]csvRecord, len(records))
+		for i := range records {
+			rows[i] = records[i]
+		}
+		return writeCSVReport(w, episodeRecordCSVHeader, rows)
+	}
+	return writeJSONReport(w, episodeListReport{reportHeader: newReportHeader(command), Query: query, Episodes: records})
+}
+
+// skipRecord is one skipped_episodes row in the --skipped report.
+type skipRecord struct {
+	EpisodeHash        string `json:"episode_hash"`
+	PodcastTitle       string `json:"podcast_title"`
+	Title              string `json:"title"`
+	GUID               string `json:"guid"`
+	MatchedEpisodeHash string `json:"matched_episode_hash"`
+	MatchedTitle       string `json:"matched_title"`
+	Reason             string `json:"reason"`
+	FirstSkipped       string `json:"first_skipped"`
+	LastSkipped        string `json:"last_skipped"`
+	Override           string `json:"override"` // "force", "never" or ""
+}
+
+var skipRecordCSVHeader = []string{"episode_hash", "podcast_title", "title", "guid", "matched_episode_hash", "matched_title", "reason", "first_skipped", "last_skipped", "override"}
+
+func (r skipRecord) csvRow() []string {
+	return []string{r.EpisodeHash, r.PodcastTitle, r.Title, r.GUID, r.MatchedEpisodeHash, r.MatchedTitle, r.Reason, r.FirstSkipped, r.LastSkipped, r.Override}
+}
+
+// skipReport is the JSON shape of --skipped.
+type skipReport struct {
+	reportHeader
+	Skipped []skipRecord `json:"skipped"`
+}
+
+// writeSkipReport writes the --skipped audit as JSON or CSV.
+func writeSkipReport(w io.Writer, records []skipRecord) error {
+	if reportFormat == formatCSV {
+		rows := make([]csvRecord, len(records))
+		for i := range records {
+			rows[i] = records[i]
+		}
+		return writeCSVReport(w, skipRecordCSVHeader, rows)
+	}
+	return writeJSONReport(w, skipReport{reportHeader: newReportHeader("skipped"), Skipped: records})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// setReportFormat switches the global --format for one test.
+func setReportFormat(t *testing.T, f string) {
+	t.Helper()
+	old := reportFormat
+	reportFormat = f
+	t.Cleanup(func() { reportFormat = old })
+}
+
+func TestParseReportFormat(t *testing.T) {
+	for in, want := range map[string]string{"": formatText, "text": formatText, "json": formatJSON, "csv": formatCSV} {
+		if got, err := parseReportFormat(in); err != nil || got != want {
+			t.Fatalf("parseReportFormat(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := parseReportFormat("xml"); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
+
+// The JSON field names are a documented interface; this pins them.
+func TestEpisodeListJSONSchema(t *testing.T) {
+	setReportFormat(t, formatJSON)
+	var buf bytes.Buffer
+	err := writeEpisodeList(&buf, "search", "byzant", []episodeRecord{{
+		Published:    "2026-01-03T10:00:00Z",
+		PodcastTitle: "History Extra",
+		Title:        "The fall of Byzantium",
+		EpisodeHash:  "abc",
+		Filename:     "History_Extra-2026-01-03-The_fall_of_Byzantium-abc.mp3",
+		Status:       statusDownloaded,
+	}})
+	if err != nil {
+		t.Fatalf("writeEpisodeList: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %s: %v", buf.String(), err)
+	}
+	if got["schema_version"] != float64(reportSchemaVersion) || got["command"] != "search" || got["query"] != "byzant" {
+		t.Fatalf("unexpected header in %s", buf.String())
+	}
+	episodes := got["episodes"].([]interface{})
+	if len(episodes) != 1 {
+		t.Fatalf("got %d episodes, want 1", len(episodes))
+	}
+	ep := episodes[0].(map[string]interface{})
+	for _, k := range []string{"published", "podcast_title", "title", "author", "episode_hash", "filename", "status"} {
+		if _, ok := ep[k]; !ok {
+			t.Fatalf("episode is missing %q: %v", k, ep)
+		}
+	}
+
+	// An empty list is [], not null
+	buf.Reset()
+	if err := writeEpisodeList(&buf, "latest", "", []episodeRecord{}); err != nil {
+		t.Fatalf("writeEpisodeList: %v", err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"episodes": []`)) {
+		t.Fatalf("empty list should encode as []: %s", buf.String())
+	}
+}
+
+func TestEpisodeListCSV(t *testing.T) {
+	setReportFormat(t, formatCSV)
+	var buf bytes.Buffer
+	err := writeEpisodeList(&buf, "latest", "", []episodeRecord{
+		{Published: "2026-01-03T10:00:00Z", PodcastTitle: "Pod, the", Title: `Say "hi"`, EpisodeHash: "h1"},
+	})
+	if err != nil {
+		t.Fatalf("writeEpisodeList: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	if len(rows) != 2 || !reflect.DeepEqual(rows[0], episodeRecordCSVHeader) {
+		t.Fatalf("unexpected rows %q", rows)
+	}
+	if rows[1][1] != "Pod, the" || rows[1][2] != `Say "hi"` {
+		t.Fatalf("commas and quotes not preserved: %q", rows[1])
+	}
+}
+
+func TestCountReport(t *testing.T) {
+	setReportFormat(t, formatCSV)
+	var buf bytes.Buffer
+	if err := writeCountReport(&buf, "register-archive", "/mnt/archive", 3, "unused"); err != nil {
+		t.Fatalf("writeCountReport: %v", err)
+	}
+	if buf.String() != "command,dir,count\nregister-archive,/mnt/archive,3\n" {
+		t.Fatalf("got %q", buf.String())
+	}
+}
+
+// In json mode plan lines are collected rather than printed.
+func TestDedupOutputCollects(t *testing.T) {
+	setReportFormat(t, formatJSON)
+	out := newDedupOutput("dedup-twins", false)
+	out.add(dedupRecord{Action: "delete", Path: "a.mp3", Keeper: "b.mp3", Bytes: 10}, "unused %s\n", "a.mp3")
+	out.add(dedupRecord{Action: "prune_row", EpisodeHash: "h"}, "unused\n")
+	if len(out.report.Actions) != 2 || out.report.Actions[1].EpisodeHash != "h" {
+		t.Fatalf("unexpected actions %+v", out.report.Actions)
+	}
+	b, err := json.Marshal(out.report)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var got struct {
+		Command string `json:"command"`
+		Applied bool   `json:"applied"`
+		Actions []map[string]interface{}
+		Summary map[string]interface{}
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got.Command != "dedup-twins" || got.Applied || got.Actions[0]["keeper"] != "b.mp3" {
+		t.Fatalf("unexpected report %s", b)
+	}
+	if _, ok := got.Actions[1]["path"]; ok {
+		t.Fatalf("empty fields should be omitted: %s", b)
+	}
+	if _, ok := got.Summary["reclaimed_bytes"]; !ok {
+		t.Fatalf("summary is missing reclaimed_bytes: %s", b)
+	}
+}
+
+func TestSkippedEpisodesAudit(t *testing.T) {
+	st := searchTestStore(t)
+	rows, err := st.skippedEpisodes()
+	if err != nil {
+		t.Fatalf("skippedEpisodes: %v", err)
+	}
+	if len(rows) != 1 || rows[0].title != "Medieval medicine" || rows[0].reason != "test" || rows[0].firstSkipped == "" {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+// Manual download overrides.
+//
+// The download pass's heuristics (the twin backstop and the retitle rules in
+// skip.go) are deliberately conservative, but when one is wrong — two
+// genuinely different same-day episodes paired as a retitle, say — it is
+// wrong on every run. download_overrides records a human verdict that beats
+// them:
+//
+//   - force: queue the episode even if a heuristic would skip it. It does not
+//     override actually having the file (on disk, legacy-named or archived).
+//   - never: never queue the episode, whatever the heuristics say.
+//
+// planDownloadsFrom consults the table before the heuristics. An applied
+// override is recorded in the skipped_episodes audit (the override column),
+// so --skipped shows both what the heuristic said and who overrode it.
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	overrideForce = "force"
+	overrideNever = "never"
+)
+
+// overrideNeverReason is the skipped_episodes reason for a never-download.
+const overrideNeverReason = "override: never-download"
+
+// setDownloadOverride records action for an episode, replacing any earlier
+// override. The hash must be an existing episode.
+func (s *store) setDownloadOverride(episodeHash, action string) error {
+	if action != overrideForce && action != overrideNever {
+		return fmt.Errorf("unknown download override %q", action)
+	}
+	episodeHash = strings.ToLower(strings.TrimSpace(episodeHash))
+	var n int
+	if err := s.q.QueryRow(`SELECT count(*) FROM episodes WHERE podcastname_episodename_hash = ?;`, episodeHash).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no episode with hash %s (see -l, --search or --explain)", episodeHash)
+	}
+	_, err := s.q.Exec(`
+		INSERT INTO download_overrides (podcastname_episodename_hash, action, created)
+		VALUES (?, ?, ?)
+		ON CONFLICT(podcastname_episodename_hash) DO UPDATE SET
+			action = excluded.action,
+			created = excluded.created
+		;`, episodeHash, action, ts)
+	return err
+}
+
+// clearDownloadOverride removes an episode's override, reporting whether
+// there was one.
+func (s *store) clearDownloadOverride(episodeHash string) (bool, error) {
+	res, err := s.q.Exec(`DELETE FROM download_overrides WHERE podcastname_episodename_hash = ?;`,
+		strings.ToLower(strings.TrimSpace(episodeHash)))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// downloadOverrides maps episode hash to override action.
+func (s *store) downloadOverrides() (map[string]string, error) {
+	rows, err := s.q.Query(`SELECT podcastname_episodename_hash, action FROM download_overrides;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]string)
+	for rows.Next() {
+		var hash, action string
+		if err := rows.Scan(&hash, &action); err != nil {
+			return nil, err
+		}
+		out[hash] = action
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadOverrides(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	podDir := t.TempDir()
+
+	hashOf := func(ep string) string {
+		return fmt.Sprintf("%x", md5.Sum([]byte("Overridden"+ep)))
+	}
+	podEpisodesIntoDatabase(st, map[string]string{"title": "Overridden"}, []M{
+		{"title": "On disk", "guid": "g-disk", "published": "2026-01-01T10:00:00Z", "file": "https://example.com/disk.mp3"},
+		{"title": "Still pending", "guid": "g-pending", "published": "2026-01-02T10:00:00Z", "file": "https://example.com/pending.mp3"},
+		{"title": "Completely different words", "guid": "g-disk", "published": "2026-03-01T10:00:00Z", "file": "https://example.com/disk2.mp3"},
+		{"title": "Old hash", "guid": "g-twin", "published": "2026-01-05T10:00:00Z", "file": "https://example.com/twin.mp3"},
+	})
+	touch := func(name string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(podDir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	touch(buildNonInteractiveFilename("Overridden", "On disk", "2026-01-01", hashOf("On disk")))
+	twin, _ := nameMinusHash(buildNonInteractiveFilename("Overridden", "Old hash", "2026-01-05", hashOf("Old hash")))
+	touch(twin + "-0123456789abcdef0123456789abcdef.mp3")
+
+	// Without overrides: one retitle skip, one twin skip, one queued
+	plan := planDownloads(st, []string{podDir})
+	if len(plan.queued) != 1 || len(plan.retitleSkips) != 1 || len(plan.twinSkips) != 1 {
+		t.Fatalf("baseline plan: %d queued, %d retitle, %d twin", len(plan.queued), len(plan.retitleSkips), len(plan.twinSkips))
+	}
+
+	if err := st.setDownloadOverride("0123456789abcdef0123456789abcdef", overrideForce); err == nil {
+		t.Fatal("expected an error overriding an unknown episode")
+	}
+	for hash, action := range map[string]string{
+		hashOf("Completely different words"): overrideForce,
+		hashOf("Old hash"):                   overrideForce,
+		hashOf("Still pending"):              overrideNever,
+		hashOf("On disk"):                    overrideForce, // already have it: no effect
+	} {
+		if err := st.setDownloadOverride(hash, action); err != nil {
+			t.Fatalf("setDownloadOverride: %v", err)
+		}
+	}
+
+	plan = planDownloads(st, []string{podDir})
+	queued := make(map[string]bool)
+	for _, q := range plan.queued {
+		queued[q.episodeHash] = true
+	}
+	if len(queued) != 2 || !queued[hashOf("Completely different words")] || !queued[hashOf("Old hash")] {
+		t.Fatalf("forced episodes should be queued, got %v", queued)
+	}
+	if len(plan.retitleSkips) != 0 || len(plan.twinSkips) != 0 || len(plan.forced) != 2 {
+		t.Fatalf("force should beat the heuristics: %d retitle, %d twin, %d forced", len(plan.retitleSkips), len(plan.twinSkips), len(plan.forced))
+	}
+	if len(plan.overrideSkips) != 1 || plan.overrideSkips[0].episodeHash != hashOf("Still pending") {
+		t.Fatalf("never should skip the pending episode, got %+v", plan.overrideSkips)
+	}
+
+	// The audit records both kinds, and a forced skip doesn't count as skipped
+	if err := st.recordSkippedEpisodes(plan.auditRecords()); err != nil {
+		t.Fatalf("recordSkippedEpisodes: %v", err)
+	}
+	rows, err := st.skippedEpisodes()
+	if err != nil {
+		t.Fatalf("skippedEpisodes: %v", err)
+	}
+	overrides := make(map[string]string)
+	for _, r := range rows {
+		overrides[r.title] = r.override
+	}
+	want := map[string]string{"Completely different words": overrideForce, "Old hash": overrideForce, "Still pending": overrideNever}
+	if fmt.Sprint(overrides) != fmt.Sprint(want) {
+		t.Fatalf("audit overrides = %v, want %v", overrides, want)
+	}
+	var status string
+	if err := st.q.QueryRow(`SELECT `+episodeStatusSQL+` FROM episodes AS e WHERE podcastname_episodename_hash = ?;`,
+		hashOf("Completely different words")).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != statusNotDownloaded {
+		t.Fatalf("forced episode status = %q, want %q", status, statusNotDownloaded)
+	}
+
+	explanations, err := explainEpisodes(st, hashOf("Still pending"), []string{podDir})
+	if err != nil || explanations[0].verdict != verdictNeverSkip {
+		t.Fatalf("explain never-download: %v %+v", err, explanations)
+	}
+	explanations, err = explainEpisodes(st, hashOf("Completely different words"), []string{podDir})
+	if err != nil || explanations[0].verdict != verdictQueued {
+		t.Fatalf("explain force-download: %v %+v", err, explanations)
+	}
+
+	cleared, err := st.clearDownloadOverride(hashOf("Still pending"))
+	if err != nil || !cleared {
+		t.Fatalf("clearDownloadOverride = %v, %v", cleared, err)
+	}
+	if cleared, _ := st.clearDownloadOverride(hashOf("Still pending")); cleared {
+		t.Fatal("clearing twice should report no override")
+	}
+}
+
+// A database from before overrides gains the audit column on open.
+func TestSkippedEpisodesOverrideColumnMigration(t *testing.T) {
+	useTempWorkingDir(t)
+	s, err := openStore(dbFileName)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	defer s.Close()
+	if _, err := s.q.Exec(`
+		CREATE TABLE skipped_episodes (
+			podcastname_episodename_hash TEXT PRIMARY KEY,
+			podcast_title TEXT, title TEXT, guid TEXT,
+			matched_episode_hash TEXT, matched_title TEXT, reason TEXT,
+			first_skipped TEXT NOT NULL, last_skipped TEXT NOT NULL
+		);
+		INSERT INTO skipped_episodes VALUES ('h', 'P', 'T', 'g', 'm', 'M', 'r', 'x', 'x');`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.createTablesIfNotExist(); err != nil {
+		t.Fatalf("createTablesIfNotExist: %v", err)
+	}
+	if err := s.createTablesIfNotExist(); err != nil {
+		t.Fatalf("second createTablesIfNotExist: %v", err)
+	}
+	rows, err := s.skippedEpisodes()
+	if err != nil || len(rows) != 1 || rows[0].override != "" {
+		t.Fatalf("skippedEpisodes after migration = %+v, %v", rows, err)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+// Playing episodes from the TUI and what has been played. p on the episode
+// list or the library runs the player from gopodder.conf ("player = mpv",
+// the default) on the episode's file, with the TUI suspended until the
+// player exits. played_episodes keeps, by episode hash, how long the player
+// has been open on the episode (summed across plays; the player doesn't
+// report where it stopped, so this is an approximation of the position) and
+// when the episode was marked played.
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// playerSetting is the gopodder.conf line choosing the player. The command
+// is split on spaces; a {file} argument is replaced with the file, which is
+// otherwise added as the last argument.
+const playerSetting = "player"
+
+const defaultPlayer = "mpv"
+
+// playerCommand is the player the TUI runs, set once in main.
+var playerCommand = []string{defaultPlayer}
+
+// parsePlayer validates a player setting.
+func parsePlayer(raw string) ([]string, error) {
+	args := strings.Fields(raw)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s: needs a command, e.g. mpv or vlc", playerSetting)
+	}
+	return args, nil
+}
+
+// playerCmd builds the command playing path.
+func playerCmd(player []string, path string) *exec.Cmd {
+	args := make([]string, 0, len(player))
+	placed := false
+	for _, a := range player[1:] {
+		if strings.Contains(a, "{file}") {
+			a = strings.ReplaceAll(a, "{file}", path)
+			placed = true
+		}
+		args = append(args, a)
+	}
+	if !placed {
+		args = append(args, path)
+	}
+	return exec.Command(player[0], args...)
+}
+
+// playState is an episode's played_episodes row.
+type playState struct {
+	position    int    // seconds the player has been open on it
+	completedAt string // "" until marked played
+}
+
+func (p playState) played() bool { return p.completedAt != "" }
+
+// recordPlayback adds a play of seconds to the episode's position.
+func (s *store) recordPlayback(hash string, seconds int, now time.Time) error {
+	stamp := now.Format(time.RFC3339)
+	_, err := s.q.Exec(`
+		INSERT INTO played_episodes (podcastname_episodename_hash, position, completed_at, updated)
+		VALUES (?, ?, NULL, ?)
+		ON CONFLICT(podcastname_episodename_hash) DO UPDATE SET
+			position = played_episodes.position + excluded.position,
+			updated = excluded.updated
+		;`, hash, seconds, stamp)
+	return err
+}
+
+// setPlayed marks the episode played, keeping its position, or unplayed,
+// which forgets the row.
+func (s *store) setPlayed(hash string, played bool, now time.Time) error {
+	if !played {
+		_, err := s.q.Exec(`DELETE FROM played_episodes WHERE podcastname_episodename_hash = ?;`, hash)
+		return err
+	}
+	stamp := now.Format(time.RFC3339)
+	_, err := s.q.Exec(`
+		INSERT INTO played_episodes (podcastname_episodename_hash, position, completed_at, updated)
+		VALUES (?, 0, ?, ?)
+		ON CONFLICT(podcastname_episodename_hash) DO UPDATE SET
+			completed_at = excluded.completed_at,
+			updated = excluded.updated
+		;`, hash, stamp, stamp)
+	return err
+}
+
+// playStates returns every played_episodes row by episode hash.
+func (s *store) playStates() (map[string]playState, error) {
+	rows, err := s.q.Query(`SELECT podcastname_episodename_hash, position, IFNULL(completed_at, '') FROM played_episodes;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]playState)
+	for rows.Next() {
+		var hash string
+		var p playState
+		if err := rows.Scan(&hash, &p.position, &p.completedAt); err != nil {
+			return nil, err
+		}
+		out[hash] = p
+	}
+	return out, rows.Err()
+}
+
+// annotatePlayed sets the play state on episode list items.
+func (s *store) annotatePlayed(items []episodeItem) error {
+	states, err := s.playStates()
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		if items[i].hash != "" {
+			items[i].play = states[items[i].hash]
+		}
+	}
+	return nil
+}
+
+// episodeFile finds an episode's file: under a scan path by its expected
+// name, then by its downloads or archived_episodes row. "" if it isn't on
+// disk.
+func (s *store) episodeFile(scanPaths []string, hash, filename string) (string, error) {
+	if p := onDiskPath(scanPaths, filename); p != "" {
+		return p, nil
+	}
+	if hash == "" {
+		return "", nil
+	}
+	var candidates []string
+	rows, err := s.q.Query(`SELECT filename FROM downloads WHERE hash = ?;`, hash)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return "", err
+		}
+		if len(scanPaths) > 0 {
+			candidates = append(candidates, filepath.Join(scanPaths[0], filepath.FromSlash(name)))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	rows.Close()
+
+	var archived string
+	err = s.q.QueryRow(`SELECT IFNULL(archived_path, '') FROM archived_episodes WHERE podcastname_episodename_hash = ?;`, hash).Scan(&archived)
+	if err == nil && archived != "" {
+		candidates = append(candidates, archived)
+	}
+	for _, p := range candidates {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", nil
+}
+
+// formatListened is a position for the lists: "12m", "1h30m", or "<1m".
+func formatListened(seconds int) string {
+	if seconds < 60 {
+		return "<1m"
+	}
+	return strings.TrimSuffix((time.Duration(seconds/60) * time.Minute).String(), "0s")
+}
+
+// playedNote is the suffix the lists put after a played or part-played
+// episode.
+func playedNote(p playState) string {
+	switch {
+	case p.played():
+		return " (played)"
+	case p.position > 0:
+		return " (listened " + formatListened(p.position) + ")"
+	}
+	return ""
+}
+
+// playStateMsg carries an episode's new play state, after the player exits
+// or it is marked played or unplayed.
+type playStateMsg struct {
+	hash  string
+	state playState
+	note  string
+	err   error
+}
+
+// playEpisodeCmd suspends the TUI, runs the player on path and records how
+// long it was open against hash.
+func playEpisodeCmd(s *store, hash, path string) tea.Cmd {
+	started := time.Now()
+	return tea.ExecProcess(playerCmd(playerCommand, path), func(err error) tea.Msg {
+		if err != nil {
+			return playStateMsg{err: fmt.Errorf("%s: %w", playerCommand[0], err)}
+		}
+		msg := playStateMsg{hash: hash, note: "Played " + filepath.Base(path) + "."}
+		if hash == "" {
+			return msg
+		}
+		now := time.Now()
+		if err := s.recordPlayback(hash, int(now.Sub(started).Seconds()), now); err != nil {
+			return playStateMsg{err: err}
+		}
+		states, err := s.playStates()
+		if err != nil {
+			return playStateMsg{err: err}
+		}
+		msg.state = states[hash]
+		return msg
+	})
+}
+
+// togglePlayedCmd marks hash played, or unplayed if it is.
+func togglePlayedCmd(s *store, hash string, current playState) tea.Cmd {
+	return func() tea.Msg {
+		now := time.Now()
+		next, note := playState{}, "Marked unplayed."
+		if !current.played() {
+			next = playState{position: current.position, completedAt: now.Format(time.RFC3339)}
+			note = "Marked played."
+		}
+		if err := s.setPlayed(hash, next.played(), now); err != nil {
+			return playStateMsg{err: err}
+		}
+		return playStateMsg{hash: hash, state: next, note: note}
+	}
+}
+
+// playItemCmd plays an episode list item's file, if it has one.
+func (m interactiveModel) playItemCmd(item episodeItem) (tea.Cmd, error) {
+	path, err := m.store.episodeFile(m.scanPaths, item.hash, item.filename)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, fmt.Errorf("%s is not on disk; download it first", item.title)
+	}
+	return playEpisodeCmd(m.store, item.hash, path), nil
+}
+
+// setPlayState updates the play state of hash on the episode list and the
+// library.
+func (m *interactiveModel) setPlayState(hash string, p playState) {
+	if hash == "" {
+		return
+	}
+	for _, items := range [][]episodeItem{m.items, m.allItems} {
+		for i := range items {
+			if items[i].hash == hash {
+				items[i].play = p
+			}
+		}
+	}
+	for i := range m.library {
+		if m.library[i].hash == hash {
+			m.library[i].play = p
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestPlayerCmd(t *testing.T) {
+	if _, err := parsePlayer("  "); err == nil {
+		t.Fatal("empty player accepted")
+	}
+	player, err := parsePlayer("mpv --no-video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := playerCmd(player, "/p/a b.mp3").Args; !reflect.DeepEqual(got, []string{"mpv", "--no-video", "/p/a b.mp3"}) {
+		t.Fatalf("args = %q", got)
+	}
+	player, _ = parsePlayer("vlc --play-and-exit file://{file}")
+	if got := playerCmd(player, "/p/a.mp3").Args; !reflect.DeepEqual(got, []string{"vlc", "--play-and-exit", "file:///p/a.mp3"}) {
+		t.Fatalf("args = %q", got)
+	}
+}
+
+// Plays add up to a position; marking played sets completed_at and
+// unplayed forgets the row. -l --unplayed and played:no leave out played
+// episodes.
+func TestPlayedState(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	scanPaths := seedLibrary(t, st)
+	entries, err := loadLibrary(st, scanPaths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newHash, oldHash := entries[0].hash, entries[1].hash
+	now := time.Now()
+
+	for _, secs := range []int{300, 420} {
+		if err := st.recordPlayback(newHash, secs, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.setPlayed(oldHash, true, now); err != nil {
+		t.Fatal(err)
+	}
+	states, err := st.playStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := states[newHash]; p.position != 720 || p.played() || playedNote(p) != " (listened 12m)" {
+		t.Fatalf("new one = %+v", p)
+	}
+	if p := states[oldHash]; !p.played() || playedNote(p) != " (played)" {
+		t.Fatalf("old one = %+v", p)
+	}
+
+	latest, err := st.latestEpisodes(latestFilter{unplayed: true, sort: sortNewest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest) != 1 || latest[0].title.String != "New one" {
+		t.Fatalf("--unplayed = %+v", latest)
+	}
+
+	f, err := parseEpisodeFilter("played:no")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.matches(episodeItem{play: states[newHash]}) || f.matches(episodeItem{play: states[oldHash]}) {
+		t.Fatal("played:no matched the wrong episodes")
+	}
+	if _, err := parseEpisodeFilter("played:maybe"); err == nil {
+		t.Fatal("played:maybe accepted")
+	}
+
+	if err := st.setPlayed(oldHash, false, now); err != nil {
+		t.Fatal(err)
+	}
+	if states, _ = st.playStates(); states[oldHash].played() {
+		t.Fatal("unplayed episode still played")
+	}
+}
+
+func TestEpisodeFile(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	scanPaths := seedLibrary(t, st)
+	entries, err := loadLibrary(st, scanPaths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		// A name that doesn't match forces the lookup by hash
+		got, err := st.episodeFile(scanPaths, e.hash, "renamed.mp3")
+		if err != nil || got != e.path {
+			t.Fatalf("episodeFile(%s) = %q, %v; want %q", e.title, got, err, e.path)
+		}
+	}
+	if got, _ := st.episodeFile(scanPaths, "", filepath.Base(entries[0].path)); got != entries[0].path {
+		t.Fatalf("episodeFile by name = %q", got)
+	}
+	if got, _ := st.episodeFile(scanPaths, "nohash", "nothing.mp3"); got != "" {
+		t.Fatalf("episodeFile for a missing file = %q", got)
+	}
+}
+
+// m in the library marks the file's episode played and again unplayed.
+func TestLibraryMarkPlayed(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	scanPaths := seedLibrary(t, st)
+
+	m := newInteractiveModel(st, scanPaths[0], "", "")
+	m.scanPaths = scanPaths
+	m.step = stepFeedSelect
+	update := func(msg tea.Msg) {
+		t.Helper()
+		next, cmd := m.Update(msg)
+		m = next.(interactiveModel)
+		if cmd != nil {
+			switch msg := cmd().(type) {
+			case libraryMsg, playStateMsg:
+				next, _ = m.Update(msg)
+				m = next.(interactiveModel)
+			}
+		}
+	}
+	key := func(k string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)} }
+
+	update(key("l"))
+	update(key("m"))
+	if !m.library[0].play.played() || !strings.Contains(m.View(), "New one (played)") {
+		t.Fatalf("after m:\n%s", m.View())
+	}
+	states, err := st.playStates()
+	if err != nil || !states[m.library[0].hash].played() {
+		t.Fatalf("played_episodes = %+v, %v", states, err)
+	}
+	update(key("m"))
+	if m.library[0].play.played() || strings.Contains(m.View(), "(played)") {
+		t.Fatalf("after second m:\n%s", m.View())
+	}
+}
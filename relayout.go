@@ -0,0 +1,248 @@
+package main
+
+// --relayout: move an existing library over to the filename template.
+//
+// Changing filename_template only names new downloads; the files already on
+// the scan paths keep the layout they were downloaded under (they are still
+// found and matched by hash, see archiveCandidatesInDir). --relayout plans
+// where the template puts each file and, with --apply, moves them in one
+// transaction journalled like a dedup run, so --undo-dedup takes it back.
+//
+// Each file keeps its own hash and the date in its current name, so nothing
+// hash-keyed changes and the file is not mistaken for a different episode;
+// the podcast and title come from the episode row that owns the hash. Files
+// no row owns can't be named and are left where they are.
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// relayoutMove is one file and where the template puts it, relative to the
+// file's scan path.
+type relayoutMove struct {
+	file    dedupFile
+	podcast string
+	newName string
+}
+
+func (m relayoutMove) newPath() string {
+	return filepath.Join(m.file.dir, filepath.FromSlash(m.newName))
+}
+
+// relayoutPlan is what --relayout would do.
+type relayoutPlan struct {
+	moves        []relayoutMove
+	blocked      []relayoutMove // another file already has (or would take) the target
+	unattributed []dedupFile    // no episode row owns the hash
+	inPlace      int            // already where the template puts them
+}
+
+// planRelayout works out each file's templated name under t. Pure: no
+// filesystem access, collisions are judged against files.
+func planRelayout(files []dedupFile, owners map[string]dedupOwner, url2ep map[string]string, t filenameTemplate) relayoutPlan {
+	plan := relayoutPlan{
+		moves:        make([]relayoutMove, 0),
+		blocked:      make([]relayoutMove, 0),
+		unattributed: make([]dedupFile, 0),
+	}
+	taken := make(map[string]bool, len(files))
+	for _, f := range files {
+		taken[f.path] = true
+	}
+	for _, f := range files {
+		o, ok := owners[f.hash]
+		if !ok {
+			o, ok = owners[url2ep[f.hash]]
+		}
+		if !ok || len([]rune(o.published)) < 10 {
+			plan.unattributed = append(plan.unattributed, f)
+			continue
+		}
+		date := shortDate(o.published)
+		if m := filenameDateRe.FindStringSubmatch(path.Base(f.name)); m != nil {
+			date = m[1]
+		}
+		m := relayoutMove{file: f, podcast: o.podcastTitle, newName: t.render(episodeNaming{
+			podcast: o.podcastTitle, title: o.title, date: date, hash: f.hash,
+			season: o.season, episode: o.episode})}
+		switch {
+		case m.newName == f.name:
+			plan.inPlace++
+		case taken[m.newPath()]:
+			plan.blocked = append(plan.blocked, m)
+		default:
+			taken[m.newPath()] = true
+			plan.moves = append(plan.moves, m)
+		}
+	}
+	byPath := func(ms []relayoutMove) {
+		sort.Slice(ms, func(i, j int) bool {
+			if ms[i].podcast != ms[j].podcast {
+				return ms[i].podcast < ms[j].podcast
+			}
+			return ms[i].file.path < ms[j].file.path
+		})
+	}
+	byPath(plan.moves)
+	byPath(plan.blocked)
+	sort.Slice(plan.unattributed, func(i, j int) bool { return plan.unattributed[i].path < plan.unattributed[j].path })
+	return plan
+}
+
+// libraryWasNested reports whether a nested template laid out part of the
+// library: a download recorded under a folder, or a relayout still in
+// effect, which may have moved files into folders or out of them.
+func (s *store) libraryWasNested() (bool, error) {
+	var nested bool
+	err := s.q.QueryRow(`SELECT EXISTS (SELECT 1 FROM downloads WHERE filename LIKE '%/%')
+		OR EXISTS (SELECT 1 FROM dedup_runs WHERE command = 'relayout' AND undone IS NULL);`).Scan(&nested)
+	return nested, err
+}
+
+// moveArchivedPath points hash's archive registration at path, if it has
+// one.
+func (s *store) moveArchivedPath(hash, path string) error {
+	_, err := s.q.Exec(`UPDATE archived_episodes SET archived_path = ? WHERE podcastname_episodename_hash = ?;`, path, hash)
+	return err
+}
+
+// renameDownload rekeys a downloads row.
+func (s *store) renameDownload(from, to string) error {
+	_, err := s.q.Exec(`UPDATE downloads SET filename = ? WHERE filename = ?;`, to, from)
+	return err
+}
+
+// runRelayout runs --relayout, moving the files when apply is true.
+func runRelayout(s *store, scanPaths []string, apply bool) error {
+	owners, url2ep, err := s.loadDedupOwners()
+	if err != nil {
+		return err
+	}
+	files, err := gatherDedupFiles(scanPaths)
+	if err != nil {
+		return err
+	}
+	plan := planRelayout(files, owners, url2ep, nameTemplate)
+
+	archiveDirs := make(map[string]bool)
+	for _, d := range scanPaths[1:] {
+		archiveDirs[d] = true
+	}
+
+	// The plan only knows the scanned files; anything else in the way is
+	// found here, before a run is started for nothing
+	inTheWay := make(map[string]bool)
+	for _, m := range plan.moves {
+		if _, err := os.Stat(m.newPath()); err == nil {
+			inTheWay[m.file.path] = true
+		}
+	}
+
+	var tx *store
+	var j *dedupJournal
+	if apply && len(plan.moves) > len(inTheWay) {
+		if tx, err = s.begin(); err != nil {
+			return err
+		}
+		defer tx.rollback()
+		// Deferred after the rollback, so files go back first on failure
+		if j, err = newDedupJournal(tx, "relayout", time.Now()); err != nil {
+			return err
+		}
+		defer j.close()
+	}
+
+	would := "would "
+	if apply {
+		would = ""
+	}
+	out := newDedupOutput("relayout", apply)
+	moved, blocked := 0, len(plan.blocked)
+	for _, m := range plan.blocked {
+		if m.podcast != out.podcast {
+			out.podcast = m.podcast
+			out.heading(m.podcast)
+		}
+		out.add(dedupRecord{Action: "move_blocked", Path: m.file.path, NewPath: m.newPath(), Reason: "target exists"},
+			"NOT moving (target exists): %s -> %s\n", m.file.path, m.newPath())
+	}
+	out.podcast = ""
+	for _, m := range plan.moves {
+		if m.podcast != out.podcast {
+			out.podcast = m.podcast
+			out.heading(m.podcast)
+		}
+		if inTheWay[m.file.path] {
+			out.add(dedupRecord{Action: "move_blocked", Path: m.file.path, NewPath: m.newPath(), Reason: "target exists"},
+				"NOT moving (target exists): %s -> %s\n", m.file.path, m.newPath())
+			blocked++
+			continue
+		}
+		out.add(dedupRecord{Action: "move", Path: m.file.path, NewPath: m.newPath()},
+			"%smove %s -> %s\n", would, m.file.path, m.newPath())
+		moved++
+		if j == nil {
+			continue
+		}
+		if err := j.move(m.file.path, m.newPath()); err != nil {
+			return err
+		}
+		if err := j.saveRows("downloads", m.file.name); err != nil {
+			return err
+		}
+		if err := j.replacingRow("downloads", m.newName); err != nil {
+			return err
+		}
+		if err := tx.deleteDownload(m.newName); err != nil {
+			return err
+		}
+		if err := tx.renameDownload(m.file.name, m.newName); err != nil {
+			return err
+		}
+		if archiveDirs[m.file.dir] {
+			if err := j.replacingRow("archived_episodes", m.file.hash); err != nil {
+				return err
+			}
+			// Archive rows hold absolute paths; the scan path may be relative
+			absPath, err := filepath.Abs(m.newPath())
+			if err != nil {
+				return err
+			}
+			if err := tx.moveArchivedPath(m.file.hash, absPath); err != nil {
+				return err
+			}
+		}
+	}
+	out.podcast = ""
+	for _, f := range plan.unattributed {
+		out.add(dedupRecord{Action: "unattributed", Path: f.path, Reason: "no episode row owns the hash"},
+			"LEAVING (no episode row owns the hash): %s\n", f.path)
+	}
+
+	if j != nil {
+		if err := tx.commit(); err != nil {
+			return err
+		}
+		j.done()
+		out.report.RunID = j.runID
+		for _, m := range plan.moves {
+			pruneEmptyDirs(filepath.Dir(m.file.path), m.file.dir)
+		}
+	}
+
+	return out.finish(func() {
+		fmt.Printf("\n%s%d file(s) %s the %s layout, %d already in place, %d blocked, %d unattributed\n",
+			map[bool]string{true: "Applied: ", false: "Dry run: "}[apply],
+			moved, map[bool]string{true: "moved to", false: "to move to"}[apply],
+			nameTemplate.raw, plan.inPlace, blocked, len(plan.unattributed))
+		if !apply && moved > 0 {
+			fmt.Println("Re-run with --relayout --apply to apply.")
+		}
+		printUndoHint(out.report.RunID, false)
+	})
+}
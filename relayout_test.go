@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanRelayout(t *testing.T) {
+	nested := mustParseFilenameTemplate("{podcast}/{year}/{podcast}-{date}-{title}-{hash}")
+	hash := strings.Repeat("a", 32)
+	urlHash := strings.Repeat("b", 32)
+	owners := map[string]dedupOwner{
+		hash: {epHash: hash, podcastTitle: "Show", title: "Ep", published: "2020-01-01T00:00:00Z"},
+	}
+	url2ep := map[string]string{urlHash: hash}
+	files := []dedupFile{
+		mkFile("/pods", "Show", "Ep", "2020-01-01", hash, 100),
+		// A legacy-hash copy keeps its own hash (and the date it was named with)
+		mkFile("/arch", "Show", "Ep", "2019-12-31", urlHash, 100),
+		mkFile("/pods", "Gone", "Nobody Owns This", "2020-01-01", strings.Repeat("c", 32), 100),
+	}
+	plan := planRelayout(files, owners, url2ep, nested)
+	if len(plan.moves) != 2 || len(plan.unattributed) != 1 || len(plan.blocked) != 0 {
+		t.Fatalf("plan = %+v", plan)
+	}
+	want := map[string]string{
+		"/arch": "Show/2019/Show-2019-12-31-Ep-" + urlHash + ".mp3",
+		"/pods": "Show/2020/Show-2020-01-01-Ep-" + hash + ".mp3",
+	}
+	for _, m := range plan.moves {
+		if m.newName != want[m.file.dir] {
+			t.Errorf("%s -> %s, want %s", m.file.path, m.newName, want[m.file.dir])
+		}
+	}
+
+	// Moving back to the flat layout is the same plan the other way round
+	moved := make([]dedupFile, 0, len(plan.moves))
+	for _, m := range plan.moves {
+		f := m.file
+		f.name, f.path = m.newName, m.newPath()
+		moved = append(moved, f)
+	}
+	back := planRelayout(moved, owners, url2ep, defaultNameTemplate)
+	for i, m := range back.moves {
+		if m.newPath() != plan.moves[i].file.path {
+			t.Errorf("back to flat: %s -> %s, want %s", m.file.path, m.newPath(), plan.moves[i].file.path)
+		}
+	}
+
+	// Already laid out files stay put
+	if again := planRelayout(moved, owners, url2ep, nested); len(again.moves) != 0 || again.inPlace != 2 {
+		t.Fatalf("relayout of a laid-out library = %+v", again)
+	}
+}
+
+// --relayout --apply moves files and rekeys their downloads and archive rows
+// in one journalled run; --undo-dedup puts everything back.
+func TestRelayoutApplyAndUndo(t *testing.T) {
+	tmpDir := useTempWorkingDir(t)
+	st := openTestStore(t)
+	archDir := t.TempDir()
+	setNameTemplate(t, "{podcast}/{year}/{podcast}-{date}-{title}-{hash}")
+
+	podcast, title := "Pat Show", "Some Episode"
+	epHash := fmt.Sprintf("%x", md5.Sum([]byte(podcast+title)))
+	archHash := fmt.Sprintf("%x", md5.Sum([]byte(podcast+"Older")))
+	flatName := defaultNameTemplate.render(episodeNaming{podcast: podcast, title: title, date: "2021-04-05", hash: epHash})
+	archName := defaultNameTemplate.render(episodeNaming{podcast: podcast, title: "Older", date: "2019-02-03", hash: archHash})
+	if err := os.WriteFile(filepath.Join(tmpDir, flatName), []byte("audio"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(archDir, archName), []byte("older audio"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	nowStr := time.Now().Format(time.RFC3339)
+	for _, ep := range []struct{ title, published, hash string }{
+		{title, "2021-04-05T00:00:00Z", epHash},
+		{"Older", "2019-02-03T00:00:00Z", archHash},
+	} {
+		if _, err := st.q.Exec(`INSERT INTO episodes (title, published, first_seen, last_seen, podcast_title,
+			podcastname_episodename_hash, file) VALUES (?, ?, ?, ?, ?, ?, ?);`,
+			ep.title, ep.published, nowStr, nowStr, podcast, ep.hash, "https://x/"+ep.hash+".mp3"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := st.recordDownloadSeen(flatName, epHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.upsertArchived(archHash, filepath.Join(archDir, archName)); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := func() string {
+		t.Helper()
+		var out []string
+		for _, q := range []string{
+			`SELECT filename || '|' || hash FROM downloads ORDER BY filename;`,
+			`SELECT podcastname_episodename_hash || '|' || archived_path FROM archived_episodes ORDER BY 1;`,
+		} {
+			rows, err := st.q.Query(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for rows.Next() {
+				var s string
+				rows.Scan(&s)
+				out = append(out, s)
+			}
+			rows.Close()
+		}
+		return strings.Join(out, "\n")
+	}
+	before := snapshot()
+	// A relative archive scan path still leaves an absolute archived_path
+	relArch, err := filepath.Rel(tmpDir, archDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanPaths := []string{tmpDir, relArch}
+
+	// The dry run touches nothing
+	if err := runRelayout(st, scanPaths, false); err != nil {
+		t.Fatalf("runRelayout dry run: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, flatName)); err != nil || snapshot() != before {
+		t.Fatalf("dry run changed something: %v", err)
+	}
+
+	if err := runRelayout(st, scanPaths, true); err != nil {
+		t.Fatalf("runRelayout: %v", err)
+	}
+	newName := "Pat_Show/2021/" + flatName
+	newArch := filepath.Join(archDir, "Pat_Show", "2019", archName)
+	for _, p := range []string{filepath.Join(tmpDir, filepath.FromSlash(newName)), newArch} {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("expected %s after relayout: %v", p, err)
+		}
+	}
+	want := newName + "|" + epHash + "\n" + archHash + "|" + newArch
+	if got := snapshot(); got != want {
+		t.Fatalf("rows after relayout:\n%s\nwant:\n%s", got, want)
+	}
+	// Moved files are still what the download pass has
+	if plan := planDownloads(st, []string{tmpDir, archDir}); len(plan.queued) != 0 {
+		t.Fatalf("relaid-out files should not be queued again: %+v", plan.queued)
+	}
+
+	// Nothing left to move starts no run
+	runID := latestDedupRun(t, st)
+	if err := runRelayout(st, scanPaths, true); err != nil {
+		t.Fatalf("runRelayout with nothing to move: %v", err)
+	}
+	if again := latestDedupRun(t, st); again != runID {
+		t.Fatalf("a relayout with nothing to move started run %s", again)
+	}
+
+	res, err := undoDedupRun(st, runID)
+	if err != nil {
+		t.Fatalf("undoDedupRun: %v", err)
+	}
+	if res.files != 2 {
+		t.Fatalf("restored %d files, want 2", res.files)
+	}
+	if after := snapshot(); after != before {
+		t.Fatalf("rows after undo:\n%s\nwant:\n%s", after, before)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "Pat_Show")); !os.IsNotExist(err) {
+		t.Fatalf("expected the emptied template dirs tidied away, err=%v", err)
+	}
+}
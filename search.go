@@ -0,0 +1,361 @@
+package main
+
+// Full-text search over episodes.
+//
+// episodes_fts is an FTS5 index over podcast title, episode title,
+// description and author, keyed by episode hash. It is kept in sync from Go
+// (podEpisodesIntoDatabase indexes new rows, a podcast rename re-points its
+// rows, deleteEpisode drops them) rather than with triggers: a trigger that
+// names an FTS5 table makes every episodes write fail on a binary built
+// without FTS5, and the batch must keep working whatever the build.
+//
+// FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag (the
+// makefile sets it). Without it the index is never created and search falls
+// back to LIKE matching, which is slower and ranked more crudely but finds
+// the same episodes. A build without the tag still opens a database a
+// tagged build indexed (the table exists, but any statement reading it fails
+// with "no such module"), so the index is probed before it is used. Such a
+// build can also add, delete or rename episodes behind the index's back, as
+// can an ad-hoc sqlite3 session, so createTablesIfNotExist compares the
+// index with episodes on open and rebuilds it when their contents differ.
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// searchResultLimit caps --search output and the interactive result list.
+const searchResultLimit = 50
+
+// Search-result statuses, most to least "have it".
+const (
+	statusDownloaded    = "downloaded"
+	statusArchived      = "archived"
+	statusSkipped       = "skipped"
+	statusNotDownloaded = "not downloaded"
+)
+
+// searchResult is one episode matched by searchEpisodes.
+type searchResult struct {
+	podcastTitle string
+	title        string
+	published    string // published, or first_seen when the feed gives no date
+	episodeHash  string
+	author       string
+	file         string
+	status       string
+	season       string
+	episode      string
+	description  string
+}
+
+// episodeStatusSQL derives a search result's status for the episodes row
+// aliased e.
+var episodeStatusSQL = statusCaseSQL("e")
+
+// statusCaseSQL derives the status of the row aliased alias, which may be
+// any table keyed on podcastname_episodename_hash.
+func statusCaseSQL(alias string) string {
+	h := alias + `.podcastname_episodename_hash`
+	return `CASE
+	WHEN EXISTS (SELECT 1 FROM downloads AS d WHERE d.hash = ` + h + `) THEN '` + statusDownloaded + `'
+	WHEN EXISTS (SELECT 1 FROM archived_episodes AS ar WHERE ar.podcastname_episodename_hash = ` + h + `) THEN '` + statusArchived + `'
+	WHEN EXISTS (SELECT 1 FROM skipped_episodes AS sk WHERE sk.podcastname_episodename_hash = ` + h + ` AND IFNULL(sk.override, '') != '` + overrideForce + `') THEN '` + statusSkipped + `'
+	ELSE '` + statusNotDownloaded + `' END`
+}
+
+// createSearchIndex creates episodes_fts if this build has FTS5, recording
+// the outcome on the store. A missing module is not an error: search falls
+// back to LIKE.
+func (s *store) createSearchIndex() error {
+	s.fts = false
+	_, err := s.q.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS episodes_fts USING fts5(
+			podcast_title, title, description, author,
+			episode_hash UNINDEXED,
+			tokenize = 'unicode61 remove_diacritics 2'
+		);`)
+	if err == nil {
+		// IF NOT EXISTS succeeds on a table a tagged build made; reading it
+		// is what needs the module
+		var rows *sql.Rows
+		if rows, err = s.q.Query(`SELECT 1 FROM episodes_fts LIMIT 0;`); err == nil {
+			rows.Close()
+		}
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			return nil
+		}
+		return err
+	}
+	s.fts = true
+	return s.syncSearchIndex()
+}
+
+// searchIndexColumns are an episode's indexed values, as episodes_fts holds
+// them.
+const searchIndexColumns = `IFNULL(podcast_title, ''), IFNULL(title, ''), IFNULL(description, ''),
+	IFNULL(author, ''), podcastname_episodename_hash`
+
+// syncSearchIndex rebuilds episodes_fts from episodes when the two differ
+// in row count or content: a fresh index, or one that episodes were added
+// to, deleted from, renamed or retitled in around.
+func (s *store) syncSearchIndex() error {
+	var nEpisodes, nIndexed int
+	if err := s.q.QueryRow(`SELECT count(*) FROM episodes;`).Scan(&nEpisodes); err != nil {
+		return err
+	}
+	if err := s.q.QueryRow(`SELECT count(*) FROM episodes_fts;`).Scan(&nIndexed); err != nil {
+		return err
+	}
+	if nEpisodes == nIndexed {
+		var differ bool
+		if err := s.q.QueryRow(`
+			SELECT EXISTS (
+				SELECT ` + searchIndexColumns + ` FROM episodes
+				EXCEPT
+				SELECT podcast_title, title, description, author, episode_hash FROM episodes_fts
+			);`).Scan(&differ); err != nil {
+			return err
+		}
+		if !differ {
+			return nil
+		}
+	}
+	log.Printf("rebuilding search index (%d episodes, %d indexed, out of step)", nEpisodes, nIndexed)
+	return s.inTx(func(tx *store) error {
+		if _, err := tx.q.Exec(`DELETE FROM episodes_fts;`); err != nil {
+			return err
+		}
+		_, err := tx.q.Exec(`
+			INSERT INTO episodes_fts (podcast_title, title, description, author, episode_hash)
+			SELECT ` + searchIndexColumns + `
+			FROM episodes
+			;`)
+		return err
+	})
+}
+
+// indexEpisodeForSearch adds a newly inserted episode to episodes_fts. No-op
+// without FTS5.
+func (s *store) indexEpisodeForSearch(episodeHash, podcastTitle, episodeTitle, desc, epAuthor string) error {
+	if !s.fts {
+		return nil
+	}
+	_, err := s.q.Exec(`
+		INSERT INTO episodes_fts (podcast_title, title, description, author, episode_hash)
+		VALUES (?, ?, ?, ?, ?)
+		;`, podcastTitle, episodeTitle, desc, epAuthor, episodeHash)
+	return err
+}
+
+// renamePodcastInSearchIndex follows renamePodcastInPlace into episodes_fts.
+func (s *store) renamePodcastInSearchIndex(oldTitle, newTitle string) error {
+	if !s.fts {
+		return nil
+	}
+	_, err := s.q.Exec(`UPDATE episodes_fts SET podcast_title = ? WHERE podcast_title = ?;`, newTitle, oldTitle)
+	return err
+}
+
+// unindexEpisodeForSearch drops an episode from episodes_fts.
+func (s *store) unindexEpisodeForSearch(episodeHash string) error {
+	if !s.fts {
+		return nil
+	}
+	_, err := s.q.Exec(`DELETE FROM episodes_fts WHERE episode_hash = ?;`, episodeHash)
+	return err
+}
+
+// searchTerms splits a user query into words, dropping the double quotes
+// FTS5 would read as syntax.
+func searchTerms(query string) []string {
+	terms := make([]string, 0)
+	for _, f := range strings.Fields(query) {
+		if f = strings.ReplaceAll(f, `"`, ""); f != "" {
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
+
+// ftsMatchExpr turns search terms into an FTS5 query: every term must match,
+// each as a quoted prefix so punctuation is literal and "philos" finds
+// "philosophy".
+func ftsMatchExpr(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = `"` + t + `"*`
+	}
+	return strings.Join(parts, " ")
+}
+
+// searchEpisodes returns up to limit episodes matching every word of query,
+// best match first. Uses the FTS5 index when this build has it, LIKE
+// otherwise.
+func (s *store) searchEpisodes(query string, limit int) ([]searchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty search query")
+	}
+	if s.fts {
+		return s.searchEpisodesFTS(terms, limit)
+	}
+	return s.searchEpisodesLike(terms, limit)
+}
+
+func (s *store) searchEpisodesFTS(terms []string, limit int) ([]searchResult, error) {
+	// Column weights: episode title counts most, then podcast title; the
+	// UNINDEXED hash column gets zero.
+	rows, err := s.q.Query(`
+		SELECT IFNULL(e.podcast_title, ''), IFNULL(e.title, ''),
+			IFNULL(e.published, IFNULL(e.first_seen, '')),
+			e.podcastname_episodename_hash, IFNULL(e.author, ''), IFNULL(e.file, ''),
+			`+episodeStatusSQL+`, IFNULL(e.season, ''), IFNULL(e.episode, ''),
+			IFNULL(e.description, '')
+		FROM episodes_fts AS f
+		JOIN episodes AS e ON e.podcastname_episodename_hash = f.episode_hash
+		WHERE episodes_fts MATCH ?
+		ORDER BY bm25(episodes_fts, 2.0, 4.0, 1.0, 1.0, 0.0)
+		LIMIT ?
+		;`, ftsMatchExpr(terms), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanSearchResults(rows)
+}
+
+func (s *store) searchEpisodesLike(terms []string, limit int) ([]searchResult, error) {
+	where := make([]string, len(terms))
+	args := make([]interface{}, 0, 4*len(terms))
+	for i, t := range terms {
+		where[i] = `(e.podcast_title LIKE ? ESCAPE '\' OR e.title LIKE ? ESCAPE '\' OR e.description LIKE ? ESCAPE '\' OR e.author LIKE ? ESCAPE '\')`
+		pat := "%" + likeEscaper.Replace(t) + "%"
+		args = append(args, pat, pat, pat, pat)
+	}
+	rows, err := s.q.Query(`
+		SELECT IFNULL(e.podcast_title, ''), IFNULL(e.title, ''),
+			IFNULL(e.published, IFNULL(e.first_seen, '')),
+			e.podcastname_episodename_hash, IFNULL(e.author, ''), IFNULL(e.file, ''),
+			`+episodeStatusSQL+`, IFNULL(e.season, ''), IFNULL(e.episode, ''),
+			IFNULL(e.description, '')
+		FROM episodes AS e
+		WHERE `+strings.Join(where, " AND ")+`
+		;`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results, err := scanSearchResults(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Crude stand-in for bm25: a term in the episode title outranks one in
+	// the podcast title, which outranks description/author; newest breaks
+	// ties.
+	score := func(r searchResult) int {
+		n := 0
+		for _, t := range terms {
+			t = strings.ToLower(t)
+			switch {
+			case strings.Contains(strings.ToLower(r.title), t):
+				n += 4
+			case strings.Contains(strings.ToLower(r.podcastTitle), t):
+				n += 2
+			default:
+				n++
+			}
+		}
+		return n
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		si, sj := score(results[i]), score(results[j])
+		if si != sj {
+			return si > sj
+		}
+		return results[i].published > results[j].published
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// likeEscaper escapes LIKE wildcards (with '\' as the ESCAPE character) so a
+// search for "100%" matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func scanSearchResults(rows *sql.Rows) ([]searchResult, error) {
+	out := make([]searchResult, 0)
+	for rows.Next() {
+		var r searchResult
+		if err := rows.Scan(&r.podcastTitle, &r.title, &r.published, &r.episodeHash, &r.author, &r.file, &r.status, &r.season, &r.episode, &r.description); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// searchBackend names the search implementation in use, for --search output.
+func (s *store) searchBackend() string {
+	if s.fts {
+		return "full-text index"
+	}
+	return "LIKE matching (built without sqlite_fts5; slower)"
+}
+
+// printSearchResults runs --search.
+func printSearchResults(s *store, query string) error {
+	results, err := s.searchEpisodes(query, searchResultLimit)
+	if err != nil {
+		return err
+	}
+	if reportFormat != formatText {
+		return writeEpisodeList(os.Stdout, "search", query, searchRecords(results))
+	}
+	fmt.Printf("Searching %s using %s\n\n", s.path, s.searchBackend())
+	if len(results) == 0 {
+		fmt.Printf("No episodes match %q\n", query)
+		return nil
+	}
+	for _, r := range results {
+		date := "?"
+		if d := publishedDate10(r.published); len(d) == 10 {
+			date = d
+		}
+		fmt.Printf("%s / %s / %s [%s]\n", date, r.podcastTitle, r.title, r.status)
+	}
+	if len(results) == searchResultLimit {
+		fmt.Printf("\nShowing the best %d matches; narrow the query to see others.\n", searchResultLimit)
+	}
+	return nil
+}
+
+// searchRecords converts search results for the json/csv report.
+func searchRecords(results []searchResult) []episodeRecord {
+	out := make([]episodeRecord, 0, len(results))
+	for _, r := range results {
+		filename := ""
+		if d := publishedDate10(r.published); strings.TrimSpace(r.file) != "" && len(d) == 10 {
+			filename = episodeFilename(episodeNaming{podcast: r.podcastTitle, title: r.title,
+				date: d, hash: r.episodeHash, season: r.season, episode: r.episode})
+		}
+		out = append(out, episodeRecord{
+			Published:    r.published,
+			PodcastTitle: r.podcastTitle,
+			Title:        r.title,
+			Author:       r.author,
+			EpisodeHash:  r.episodeHash,
+			Filename:     filename,
+			Status:       r.status,
+		})
+	}
+	return out
+}
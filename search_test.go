@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// searchTestStore loads two small podcasts and gives one episode each of
+// the downloaded, archived and skipped statuses.
+func searchTestStore(t *testing.T) *store {
+	t.Helper()
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+
+	podcastNameEpisodeHash := func(pod, ep string) string {
+		return fmt.Sprintf("%x", md5.Sum([]byte(pod+ep)))
+	}
+
+	podEpisodesIntoDatabase(st, map[string]string{"title": "History Extra", "author": "BBC"}, []M{
+		{"title": "The fall of Byzantium", "description": "Constantinople in 1453", "published": "2026-01-03T10:00:00Z", "file": "https://example.com/1.mp3", "author": "Jane Roe"},
+		{"title": "Medieval medicine", "description": "Leeches, humours and the plague", "published": "2026-01-02T10:00:00Z", "file": "https://example.com/2.mp3"},
+		{"title": "Tudor queens", "description": "Six wives and a Byzantine digression", "published": "2026-01-01T10:00:00Z", "file": "https://example.com/3.mp3"},
+	})
+	podEpisodesIntoDatabase(st, map[string]string{"title": "In Our Time", "author": "BBC"}, []M{
+		{"title": "Byzantine art", "description": "Icons and mosaics", "published": "2026-02-01T10:00:00Z", "file": "https://example.com/4.mp3"},
+		{"title": "The plague of Justinian", "description": "Pandemic in the sixth century", "published": "2026-02-02T10:00:00Z", "file": "https://example.com/5.mp3"},
+	})
+
+	if _, err := st.recordDownloadSeen("History_Extra-2026-01-03-The_fall_of_Byzantium-x.mp3", podcastNameEpisodeHash("History Extra", "The fall of Byzantium")); err != nil {
+		t.Fatalf("recordDownloadSeen: %v", err)
+	}
+	if err := st.upsertArchived(podcastNameEpisodeHash("In Our Time", "Byzantine art"), "/archive/x.mp3"); err != nil {
+		t.Fatalf("upsertArchived: %v", err)
+	}
+	if err := st.recordSkippedEpisodes([]skippedEpisodeRecord{{
+		episodeHash:  podcastNameEpisodeHash("History Extra", "Medieval medicine"),
+		podcastTitle: "History Extra",
+		title:        "Medieval medicine",
+		reason:       "test",
+	}}); err != nil {
+		t.Fatalf("recordSkippedEpisodes: %v", err)
+	}
+	return st
+}
+
+func searchTitles(results []searchResult) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = r.title
+	}
+	return out
+}
+
+// The expectations hold for both backends: FTS5 when built with
+// sqlite_fts5, LIKE otherwise.
+func TestSearchEpisodesStatusesAndRanking(t *testing.T) {
+	st := searchTestStore(t)
+	t.Logf("search backend: %s", st.searchBackend())
+
+	results, err := st.searchEpisodes("byzant", 10)
+	if err != nil {
+		t.Fatalf("searchEpisodes: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %v, want the three Byzantine episodes", searchTitles(results))
+	}
+	// Title matches outrank the description-only match
+	if results[2].title != "Tudor queens" {
+		t.Fatalf("description-only match should rank last, got %v", searchTitles(results))
+	}
+	status := make(map[string]string)
+	for _, r := range results {
+		status[r.title] = r.status
+	}
+	if status["The fall of Byzantium"] != statusDownloaded ||
+		status["Byzantine art"] != statusArchived ||
+		status["Tudor queens"] != statusNotDownloaded {
+		t.Fatalf("unexpected statuses %v", status)
+	}
+
+	// Every term must match, across columns
+	results, err = st.searchEpisodes("plague leeches", 10)
+	if err != nil {
+		t.Fatalf("searchEpisodes: %v", err)
+	}
+	if len(results) != 1 || results[0].title != "Medieval medicine" || results[0].status != statusSkipped {
+		t.Fatalf("got %+v, want only the skipped Medieval medicine", results)
+	}
+
+	// Podcast title and author are searchable too
+	results, err = st.searchEpisodes("jane", 10)
+	if err != nil {
+		t.Fatalf("searchEpisodes: %v", err)
+	}
+	if len(results) != 1 || results[0].title != "The fall of Byzantium" {
+		t.Fatalf("author search got %v", searchTitles(results))
+	}
+	results, err = st.searchEpisodes("our time", 10)
+	if err != nil {
+		t.Fatalf("searchEpisodes: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("podcast title search got %v", searchTitles(results))
+	}
+
+	if results, err := st.searchEpisodes("byzant", 1); err != nil || len(results) != 1 {
+		t.Fatalf("limit 1 got %d results (err %v)", len(results), err)
+	}
+	if _, err := st.searchEpisodes(`  "" `, 10); err == nil {
+		t.Fatal("expected an error for an empty query")
+	}
+}
+
+// FTS5 query syntax and LIKE wildcards in user input are literal.
+func TestSearchEpisodesQuotesSyntax(t *testing.T) {
+	st := searchTestStore(t)
+	for _, q := range []string{`byzant OR`, `plague*`, `"justinian`, `100%`, `NEAR(plague`} {
+		if _, err := st.searchEpisodes(q, 10); err != nil {
+			t.Fatalf("searchEpisodes(%q): %v", q, err)
+		}
+	}
+	results, err := st.searchEpisodes("%", 10)
+	if err != nil {
+		t.Fatalf("searchEpisodes: %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("%% should match literally, got %v", searchTitles(results))
+	}
+}
+
+// A podcast rename and a deleted episode are reflected in search.
+func TestSearchFollowsRenameAndDelete(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+
+	oldPod, episodes := renameTestFeed("Arts & Ideas", 5)
+	podEpisodesIntoDatabase(st, oldPod, episodes)
+	newPod, episodes := renameTestFeed("Free Thinking", 5)
+	podEpisodesIntoDatabase(st, newPod, episodes)
+
+	if results, _ := st.searchEpisodes("arts ideas", 10); len(results) != 0 {
+		t.Fatalf("old podcast title still matches: %v", searchTitles(results))
+	}
+	results, err := st.searchEpisodes("free thinking", 10)
+	if err != nil {
+		t.Fatalf("searchEpisodes: %v", err)
+	}
+	if len(results) != 5 {
+		t.Fatalf("got %d results for the renamed podcast, want 5", len(results))
+	}
+
+	if err := st.deleteEpisode(results[0].episodeHash); err != nil {
+		t.Fatalf("deleteEpisode: %v", err)
+	}
+	if results, _ := st.searchEpisodes("free thinking", 10); len(results) != 4 {
+		t.Fatalf("got %d results after a delete, want 4", len(results))
+	}
+}
+
+// Episodes written while the index was out of step are picked up on the
+// next open.
+func TestSearchIndexRebuildsOnDrift(t *testing.T) {
+	st := searchTestStore(t)
+	if !st.fts {
+		t.Skip("built without sqlite_fts5")
+	}
+	if _, err := st.db.Exec(`DELETE FROM episodes_fts;`); err != nil {
+		t.Fatalf("clear index: %v", err)
+	}
+	if results, _ := st.searchEpisodes("byzant", 10); len(results) != 0 {
+		t.Fatalf("expected an empty index, got %v", searchTitles(results))
+	}
+	if err := st.createTablesIfNotExist(); err != nil {
+		t.Fatalf("createTablesIfNotExist: %v", err)
+	}
+	if results, _ := st.searchEpisodes("byzant", 10); len(results) != 3 {
+		t.Fatalf("index not rebuilt, got %v", searchTitles(results))
+	}
+
+	// A retitle in place leaves the row count alone
+	if _, err := st.db.Exec(`UPDATE episodes SET title = 'The sack of Constantinople' WHERE title = 'The fall of Byzantium';`); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.createTablesIfNotExist(); err != nil {
+		t.Fatalf("createTablesIfNotExist: %v", err)
+	}
+	if results, _ := st.searchEpisodes("sack", 10); len(results) != 1 {
+		t.Fatalf("retitle not indexed, got %v", searchTitles(results))
+	}
+}
+
+// A build without FTS5 opens a database a tagged build indexed, and falls
+// back to LIKE instead of failing on the table it can't read.
+func TestSearchIndexFromTaggedBuild(t *testing.T) {
+	st := searchTestStore(t)
+	if st.fts {
+		t.Skip("built with sqlite_fts5")
+	}
+	// What a tagged build leaves behind, as this build sees it
+	for _, stmt := range []string{
+		`PRAGMA writable_schema = ON;`,
+		`INSERT INTO sqlite_master (type, name, tbl_name, rootpage, sql) VALUES ('table', 'episodes_fts', 'episodes_fts', 0,
+			'CREATE VIRTUAL TABLE episodes_fts USING fts5(podcast_title, title, description, author, episode_hash UNINDEXED)');`,
+		`PRAGMA writable_schema = OFF;`,
+	} {
+		if _, err := st.db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	st.Close()
+
+	st, err := openStore(dbFileName)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	defer st.Close()
+	if _, err := st.q.Query(`SELECT 1 FROM episodes_fts;`); err == nil || !strings.Contains(err.Error(), "no such module") {
+		t.Fatalf("expected the index to be unreadable, got %v", err)
+	}
+	if err := st.createTablesIfNotExist(); err != nil {
+		t.Fatalf("createTablesIfNotExist: %v", err)
+	}
+	if st.fts {
+		t.Fatal("fts set without the module")
+	}
+	if results, err := st.searchEpisodes("byzant", 10); err != nil || len(results) != 3 {
+		t.Fatalf("LIKE fallback: %v, %v", searchTitles(results), err)
+	}
+}
+
+func TestSearchResultItems(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	items := searchResultItems([]searchResult{
+		{podcastTitle: "Pod", title: "Second", published: "2026-01-02T10:00:00Z", episodeHash: "h2", file: "https://example.com/2.mp3", status: statusArchived},
+		{podcastTitle: "Pod", title: "No audio", published: "2026-01-03T10:00:00Z", episodeHash: "h3", file: " ", status: statusNotDownloaded},
+		{podcastTitle: "Other", title: "First", published: "", episodeHash: "h1", file: "https://example.com/1.mp3", status: statusNotDownloaded},
+	}, now)
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2 (no-audio result dropped)", len(items))
+	}
+	// Search ranking is kept, not re-sorted by date
+	if items[0].title != "Second" || items[1].title != "First" {
+		t.Fatalf("order changed: %q, %q", items[0].title, items[1].title)
+	}
+	if !items[0].downloaded || items[1].downloaded {
+		t.Fatalf("archived should count as downloaded: %+v", items)
+	}
+	if items[0].podcastTitle != "Pod" || items[0].filename != buildEpisodeFilenameWithHash("Pod", "Second", "2026-01-02", "h2") {
+		t.Fatalf("unexpected item %+v", items[0])
+	}
+	if items[1].dateStr != "2026-03-01" {
+		t.Fatalf("undated result should fall back to now, got %s", items[1].dateStr)
+	}
+}
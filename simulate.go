@@ -0,0 +1,147 @@
+package main
+
+// --simulate: a dry run of -p and -s against a snapshot of the database.
+//
+// Verifying a parse or skip-rule fix used to mean copying the live db by hand
+// and replaying the run against the copy (see WHOOPS.md). runSimulation does
+// that: it snapshots the database into a temp dir, parses every feed into the
+// snapshot, plans the downloads against it and prints what a real run would
+// insert, rename, refresh in place, queue and skip. The real database, the
+// podcasts dir and download_pods.sh are never written; the only network
+// traffic is the feed fetches.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// snapshotTo writes a consistent copy of the database to path with VACUUM
+// INTO, which reads through the WAL, unlike copying the file.
+func (s *store) snapshotTo(path string) error {
+	_, err := s.q.Exec(`VACUUM INTO ?;`, path)
+	return err
+}
+
+// simulateDatabase runs --simulate against the database at dbFile. The
+// database is opened read-only and only snapshotted: the table creation,
+// migrations and heuristics load a real run starts with happen on the
+// snapshot.
+func simulateDatabase(dbFile, confFilePath string, scanPaths []string) error {
+	s, err := openStoreReadOnly(dbFile)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return runSimulation(s, confFilePath, scanPaths)
+}
+
+// runSimulation runs --simulate against a snapshot of s.
+func runSimulation(s *store, confFilePath string, scanPaths []string) error {
+	dir, err := os.MkdirTemp("", "gopodder-simulate-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	snapshot := filepath.Join(dir, "snapshot.sqlite")
+	if err := s.snapshotTo(snapshot); err != nil {
+		return fmt.Errorf("snapshot %s: %w", s.path, err)
+	}
+	sim, err := openStore(snapshot)
+	if err != nil {
+		return err
+	}
+	defer sim.Close()
+	if err := sim.createTablesIfNotExist(); err != nil {
+		return err
+	}
+	if podcastHeuristics, err = sim.loadPodcastHeuristics(); err != nil {
+		return err
+	}
+	if libraryNested, err = sim.libraryWasNested(); err != nil {
+		return err
+	}
+	log.Printf("Simulating against a snapshot of %s in %s", s.path, snapshot)
+
+	changes := parseThem(confFilePath, sim)
+	plan := planDownloads(sim, scanPaths)
+	printSimulation(os.Stdout, s.path, changes, plan)
+	return nil
+}
+
+// printSimulation reports a simulated run, grouped by what would happen.
+func printSimulation(w io.Writer, dbPath string, changes []feedChanges, plan downloadPlan) {
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].podcastTitle != changes[j].podcastTitle {
+			return changes[i].podcastTitle < changes[j].podcastTitle
+		}
+		return changes[i].url < changes[j].url
+	})
+
+	fmt.Fprintf(w, "\nSimulated run against a snapshot of %s (nothing was written)\n", dbPath)
+
+	var failed, renamed, added []feedChanges
+	inserted, refreshed, seen := 0, 0, 0
+	for _, c := range changes {
+		switch {
+		case c.err != nil:
+			failed = append(failed, c)
+			continue
+		case c.renamedFrom != "":
+			renamed = append(renamed, c)
+		case c.newPodcast:
+			added = append(added, c)
+		}
+		inserted += len(c.inserted)
+		refreshed += len(c.refreshed)
+		seen += c.seen
+	}
+
+	fmt.Fprintf(w, "\nNew podcasts (%d):\n", len(added))
+	for _, c := range added {
+		fmt.Fprintf(w, "  %s\n", c.podcastTitle)
+	}
+	fmt.Fprintf(w, "\nRenamed podcasts (%d):\n", len(renamed))
+	for _, c := range renamed {
+		fmt.Fprintf(w, "  %q -> %q\n", c.renamedFrom, c.podcastTitle)
+	}
+	fmt.Fprintf(w, "\nNew episodes rows (%d):\n", inserted)
+	for _, c := range changes {
+		for _, t := range c.inserted {
+			fmt.Fprintf(w, "  %s / %s\n", c.podcastTitle, t)
+		}
+	}
+	fmt.Fprintf(w, "\nRefreshed in place by guid or title (%d):\n", refreshed)
+	for _, c := range changes {
+		for _, r := range c.refreshed {
+			fmt.Fprintf(w, "  %s / %s (row %s)\n", c.podcastTitle, r.title, r.existingHash)
+		}
+	}
+	fmt.Fprintf(w, "\nWould queue for download (%d):\n", len(plan.queued))
+	for _, q := range plan.queued {
+		fmt.Fprintf(w, "  %s\n", q.filename)
+	}
+	for _, f := range plan.forced {
+		fmt.Fprintf(w, "  %s: force-download override (despite %s)\n", f.filename, f.reason)
+	}
+	fmt.Fprintf(w, "\nWould skip (%d):\n", len(plan.twinSkips)+len(plan.retitleSkips)+len(plan.overrideSkips))
+	for _, t := range plan.twinSkips {
+		fmt.Fprintf(w, "  %s: already have a copy under another hash\n", t.filename)
+	}
+	for _, r := range plan.retitleSkips {
+		fmt.Fprintf(w, "  %s: %s (%q)\n", r.filename, r.reason, r.matchedTitle)
+	}
+	for _, r := range plan.overrideSkips {
+		fmt.Fprintf(w, "  %s: never-download override\n", r.filename)
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(w, "\nFeeds that failed to fetch or parse (%d):\n", len(failed))
+		for _, c := range failed {
+			fmt.Fprintf(w, "  %s: %v\n", c.url, c.err)
+		}
+	}
+	fmt.Fprintf(w, "\n%d feed(s), %d episode(s) already known\n", len(changes), seen-refreshed)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A simulation works on a snapshot: writes to it never reach the original,
+// and the feed changes report inserts, renames and in-place refreshes.
+func TestSimulationSnapshotIsolated(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+
+	oldPod, episodes := renameTestFeed("Arts & Ideas", 5)
+	podEpisodesIntoDatabase(st, oldPod, episodes)
+
+	snapshot := filepath.Join(t.TempDir(), "snapshot.sqlite")
+	if err := st.snapshotTo(snapshot); err != nil {
+		t.Fatalf("snapshotTo: %v", err)
+	}
+	sim, err := openStore(snapshot)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	defer sim.Close()
+	if err := sim.createTablesIfNotExist(); err != nil {
+		t.Fatalf("createTablesIfNotExist: %v", err)
+	}
+
+	// The feed renames the show and retitles one episode under its old guid
+	newPod, episodes := renameTestFeed("Free Thinking", 6)
+	episodes[0]["title"] = "Episode number 0 with a distinctive name (repeat)"
+	changes := podEpisodesIntoDatabase(sim, newPod, episodes)
+
+	if changes.renamedFrom != "Arts & Ideas" || changes.newPodcast {
+		t.Fatalf("expected a rename, got %+v", changes)
+	}
+	if len(changes.inserted) != 1 || changes.inserted[0] != "Episode number 5 with a distinctive name" {
+		t.Fatalf("inserted %v, want only episode 5", changes.inserted)
+	}
+	// After a rename every hash misses, so all five known episodes (the
+	// retitled one included) are matched back by guid
+	if len(changes.refreshed) != 5 || changes.refreshed[0].title != episodes[0]["title"] {
+		t.Fatalf("refreshed %+v, want episodes 0-4", changes.refreshed)
+	}
+	if changes.seen != 5 {
+		t.Fatalf("seen %d, want 5", changes.seen)
+	}
+
+	titles, err := st.episodePodcastTitles()
+	if err != nil {
+		t.Fatalf("episodePodcastTitles: %v", err)
+	}
+	if len(titles) != 1 || titles[0] != "Arts & Ideas" {
+		t.Fatalf("original db changed: %v", titles)
+	}
+	rows, err := st.latestEpisodes(latestFilter{})
+	if err != nil {
+		t.Fatalf("latestEpisodes: %v", err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("original db has %d episodes, want 5", len(rows))
+	}
+
+	var buf bytes.Buffer
+	printSimulation(&buf, st.path, []feedChanges{changes}, downloadPlan{
+		queued: []queuedDownload{{filename: "Free_Thinking-2026-06-06-Episode_number_with_a_distinctive_name-h.mp3"}},
+	})
+	for _, want := range []string{
+		`"Arts & Ideas" -> "Free Thinking"`,
+		"New episodes rows (1):",
+		"Refreshed in place by guid or title (5):",
+		"Would queue for download (1):",
+		"Would skip (0):",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("report is missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+// --simulate leaves the real database byte-identical, even when it predates
+// tables the snapshot has to be migrated to.
+func TestSimulateLeavesDatabaseUntouched(t *testing.T) {
+	useTempWorkingDir(t)
+	dbPath := filepath.Join(t.TempDir(), "gopodder.sqlite")
+	st, err := openStore(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.createTablesIfNotExist(); err != nil {
+		t.Fatal(err)
+	}
+	oldPod, episodes := renameTestFeed("Arts & Ideas", 3)
+	podEpisodesIntoDatabase(st, oldPod, episodes)
+	if _, err := st.q.Exec(`DROP TABLE played_episodes;`); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+	before, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, snapshotTestFeed("Free Thinking", 4))
+	}))
+	defer srv.Close()
+	confDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(confDir, confFile), []byte(srv.URL+"/feed.rss\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setFeedFetcher(t, httpFeedSource{})
+
+	if err := simulateDatabase(dbPath, confDir, []string{t.TempDir()}); err != nil {
+		t.Fatalf("simulateDatabase: %v", err)
+	}
+	after, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatal("--simulate changed the database file")
+	}
+	// A read-only reader of a WAL db may create the -wal file, but must
+	// never write to it
+	if fi, err := os.Stat(dbPath + "-wal"); err == nil && fi.Size() != 0 {
+		t.Fatalf("--simulate wrote %d bytes to the WAL", fi.Size())
+	}
+}
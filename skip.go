@@ -49,8 +49,11 @@ import (
 	"sort"
 	"strings"
 	"time"
+	"unicode"
 )
 
+// Defaults; podcast_settings can override any of them per podcast (see
+// heuristics.go).
 const (
 	// Containment path: a normalized title fully contained in the other is a
 	// truncation retitle, but only when it is long enough that containment
@@ -105,18 +108,21 @@ type downloadCandidate struct {
 // downloadSkip says why a candidate should not be downloaded and which
 // sibling episode it duplicates.
 type downloadSkip struct {
+	rule         string // "1", "1b", "2", "3", "3a" or "3b", as numbered below
 	matchedHash  string
 	matchedTitle string
 	reason       string
 }
 
-var nonAlnumRe = regexp.MustCompile(`[^a-z0-9]+`)
+var nonAlnumRe = regexp.MustCompile(`[^\p{L}\p{M}\p{Nd}]+`)
 
 // normalizeTitleForOverlap lowercases and collapses punctuation/whitespace so
 // cosmetic retitle churn ("Ai Goes  Parabolic") doesn't break the overlap,
-// and maps spelled-out numbers to digits.
+// and maps spelled-out numbers to digits. Latin letters are folded to ASCII
+// ("Café" equals "Cafe") and letters of every other script are kept, so
+// Greek or Japanese titles normalize to something rather than nothing.
 func normalizeTitleForOverlap(s string) string {
-	fields := strings.Fields(nonAlnumRe.ReplaceAllString(strings.ToLower(s), " "))
+	fields := strings.Fields(nonAlnumRe.ReplaceAllString(strings.ToLower(foldLatin(s)), " "))
 	for i, w := range fields {
 		if d, ok := numberWordDigits[w]; ok {
 			fields[i] = d
@@ -128,7 +134,8 @@ func normalizeTitleForOverlap(s string) string {
 // titlePrefixRe matches a short leading "Label: " — the shape broadcasters
 // use for edition prefixes ("WS MoreOrLess: Climate Change"). Bounded so a
 // colon in the middle of a long sentence-title doesn't count as a label.
-var titlePrefixRe = regexp.MustCompile(`^[^:]{1,40}:\s*`)
+// CJK titles use the fullwidth colon.
+var titlePrefixRe = regexp.MustCompile(`^[^:：]{1,40}[:：]\s*`)
 
 // Prefixes that mark genuinely different content, not another edition of the
 // same episode: a "Preview: X" on disk must never suppress the later full
@@ -194,6 +201,11 @@ func longestCommonSubstringLen(a, b string) int {
 // distinct. This is the evidence bar for cross-date matching (rule 3a),
 // deliberately tighter than materialTitleOverlap: no word-set path.
 func strictTitleEquivalent(a, b string) bool {
+	return defaultHeuristics.strictTitleEquivalent(a, b)
+}
+
+// strictTitleEquivalent is the package-level check under h's thresholds.
+func (h heuristics) strictTitleEquivalent(a, b string) bool {
 	if editionMarkerMismatch(a, b) {
 		return false
 	}
@@ -208,7 +220,7 @@ func strictTitleEquivalent(a, b string) bool {
 	if len([]rune(nb)) < len([]rune(na)) {
 		shorter, longer = nb, na
 	}
-	if len([]rune(shorter)) >= retitleContainMinRunes && strings.Contains(longer, shorter) {
+	if len([]rune(shorter)) >= h.retitleContainMinRunes && strings.Contains(longer, shorter) {
 		return true
 	}
 	nsa := normalizeTitleForOverlap(stripTitlePrefix(a))
@@ -228,10 +240,15 @@ func strictTitleEquivalent(a, b string) bool {
 // deliberately NOT the criterion: series episodes share long title templates
 // ("The Rise and Fall of ...") while being different episodes.
 func materialTitleOverlap(a, b string) bool {
+	return defaultHeuristics.materialTitleOverlap(a, b)
+}
+
+// materialTitleOverlap is the package-level check under h's thresholds.
+func (h heuristics) materialTitleOverlap(a, b string) bool {
 	if editionMarkerMismatch(a, b) {
 		return false
 	}
-	if strictTitleEquivalent(a, b) {
+	if h.strictTitleEquivalent(a, b) {
 		return true
 	}
 	na, nb := normalizeTitleForOverlap(a), normalizeTitleForOverlap(b)
@@ -246,17 +263,59 @@ func materialTitleOverlap(a, b string) bool {
 		}
 	}
 	union := len(wa) + len(wb) - inter
-	return union > 0 && inter >= retitleMinWordsHits &&
-		float64(inter)/float64(union) >= retitleJaccardMin
+	return union > 0 && inter >= h.retitleMinWordsHits &&
+		float64(inter)/float64(union) >= h.retitleJaccardMin
 }
 
+// contentWordSet is the stopword-filtered word set of a normalized title.
+// Scripts written without spaces (Chinese, Japanese, Thai, ...) would make a
+// whole title one "word", so their runs contribute overlapping character
+// bigrams instead.
 func contentWordSet(normalized string) map[string]bool {
 	out := make(map[string]bool)
 	for _, w := range strings.Fields(normalized) {
-		if !retitleStopwords[w] {
-			out[w] = true
+		for _, tok := range scriptTokens(w) {
+			if !retitleStopwords[tok] {
+				out[tok] = true
+			}
+		}
+	}
+	return out
+}
+
+// Scripts that don't separate words with spaces.
+var unspacedScripts = []*unicode.RangeTable{
+	unicode.Han, unicode.Hiragana, unicode.Katakana,
+	unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar,
+}
+
+// scriptTokens splits one whitespace-free field: unspaced-script runs into
+// character bigrams (a lone character stands alone), everything else whole.
+func scriptTokens(field string) []string {
+	out := make([]string, 0, 1)
+	var run []rune
+	runUnspaced := false
+	flush := func() {
+		switch {
+		case len(run) == 0:
+		case !runUnspaced || len(run) == 1:
+			out = append(out, string(run))
+		default:
+			for i := 0; i+1 < len(run); i++ {
+				out = append(out, string(run[i:i+2]))
+			}
+		}
+		run = run[:0]
+	}
+	for _, r := range field {
+		unspaced := unicode.In(r, unspacedScripts...) || (runUnspaced && unicode.Is(unicode.M, r))
+		if len(run) > 0 && unspaced != runUnspaced {
+			flush()
 		}
+		runUnspaced = unspaced
+		run = append(run, r)
 	}
+	flush()
 	return out
 }
 
@@ -357,6 +416,7 @@ func planDownloadSkips(cands []downloadCandidate) map[string]downloadSkip {
 			}
 			if haveSib != nil {
 				skips[c.episodeHash] = downloadSkip{
+					rule:         "1",
 					matchedHash:  haveSib.episodeHash,
 					matchedTitle: haveSib.title,
 					reason:       "retitle: same guid as downloaded episode " + haveSib.episodeHash,
@@ -375,7 +435,7 @@ func planDownloadSkips(cands []downloadCandidate) map[string]downloadSkip {
 				if sib.podcastTitle == c.podcastTitle || sib.episodeHash == c.episodeHash {
 					continue
 				}
-				if !materialTitleOverlap(c.title, sib.title) {
+				if !heuristicsFor(c.podcastTitle).materialTitleOverlap(c.title, sib.title) {
 					continue
 				}
 				if renameSib == nil || newerCandidate(sib, *renameSib) {
@@ -384,6 +444,7 @@ func planDownloadSkips(cands []downloadCandidate) map[string]downloadSkip {
 			}
 			if renameSib != nil {
 				skips[c.episodeHash] = downloadSkip{
+					rule:         "1b",
 					matchedHash:  renameSib.episodeHash,
 					matchedTitle: renameSib.title,
 					reason: "rename: same guid and title as downloaded episode " +
@@ -396,6 +457,7 @@ func planDownloadSkips(cands []downloadCandidate) map[string]downloadSkip {
 			// feed currently uses, gets downloaded.
 			if pendingWinner.episodeHash != c.episodeHash {
 				skips[c.episodeHash] = downloadSkip{
+					rule:         "2",
 					matchedHash:  pendingWinner.episodeHash,
 					matchedTitle: pendingWinner.title,
 					reason:       "retitle: superseded by fresher pending row " + pendingWinner.episodeHash,
@@ -409,7 +471,7 @@ func planDownloadSkips(cands []downloadCandidate) map[string]downloadSkip {
 		// overlaps materially. Pick the strongest overlap.
 		matches := make([]downloadCandidate, 0, 1)
 		for _, h := range haveByPodDate[dateKey(c)] {
-			if h.episodeHash != c.episodeHash && materialTitleOverlap(c.title, h.title) {
+			if h.episodeHash != c.episodeHash && heuristicsFor(c.podcastTitle).materialTitleOverlap(c.title, h.title) {
 				matches = append(matches, h)
 			}
 		}
@@ -423,6 +485,7 @@ func planDownloadSkips(cands []downloadCandidate) map[string]downloadSkip {
 				return matches[i].episodeHash < matches[j].episodeHash
 			})
 			skips[c.episodeHash] = downloadSkip{
+				rule:         "3",
 				matchedHash:  matches[0].episodeHash,
 				matchedTitle: matches[0].title,
 				reason:       "retitle: same date and overlapping title as downloaded episode " + matches[0].episodeHash,
@@ -455,7 +518,7 @@ func planDownloadSkips(cands []downloadCandidate) map[string]downloadSkip {
 				if delta < 0 {
 					delta = -delta
 				}
-				if delta > nearDateSkipWindowDays || !strictTitleEquivalent(c.title, sib.title) {
+				if h := heuristicsFor(c.podcastTitle); delta > h.nearDateWindowDays || !h.strictTitleEquivalent(c.title, sib.title) {
 					continue
 				}
 				if nearSib == nil || delta < nearDelta ||
@@ -466,6 +529,7 @@ func planDownloadSkips(cands []downloadCandidate) map[string]downloadSkip {
 			}
 			if nearSib != nil {
 				skips[c.episodeHash] = downloadSkip{
+					rule:         "3a",
 					matchedHash:  nearSib.episodeHash,
 					matchedTitle: nearSib.title,
 					reason: fmt.Sprintf("retitle: published %dd apart with equivalent title to downloaded episode %s",
@@ -494,6 +558,7 @@ func planDownloadSkips(cands []downloadCandidate) map[string]downloadSkip {
 		}
 		if repeatSib != nil {
 			skips[c.episodeHash] = downloadSkip{
+				rule:         "3b",
 				matchedHash:  repeatSib.episodeHash,
 				matchedTitle: repeatSib.title,
 				reason:       "repeat: identical title as downloaded episode " + repeatSib.episodeHash,
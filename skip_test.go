@@ -102,6 +102,44 @@ func TestMaterialTitleOverlap(t *testing.T) {
 			"The Fall of Rome",
 			false,
 		},
+		{
+			// Greek titles used to normalize to nothing and never match
+			"greek reordering",
+			"Η μάχη του Μαραθώνα και οι Πέρσες",
+			"Οι Πέρσες και η μάχη του Μαραθώνα",
+			true,
+		},
+		{
+			"greek series episodes",
+			"Η μάχη του Μαραθώνα",
+			"Η μάχη των Θερμοπυλών",
+			false,
+		},
+		{
+			// Japanese has no spaces: compared as character bigrams
+			"japanese truncation retitle",
+			"ローマ帝国の滅亡とその後の世界",
+			"ローマ帝国の滅亡とその後",
+			true,
+		},
+		{
+			"japanese series episodes",
+			"ローマ帝国の滅亡",
+			"ローマ帝国の誕生",
+			false,
+		},
+		{
+			"fullwidth colon label prefix",
+			"ゆっくり解説：ローマ帝国の滅亡",
+			"ローマ帝国の滅亡",
+			true,
+		},
+		{
+			"accents folded",
+			"Café Society: Opening Night at the Paris Opéra",
+			"Cafe Society: Opening Night at the Paris Opera",
+			true,
+		},
 	}
 	for _, c := range cases {
 		if got := materialTitleOverlap(c.a, c.b); got != c.want {
@@ -0,0 +1,342 @@
+package main
+
+// The interactive skip review: each skipped_episodes row beside the
+// sibling the download pass matched it to (title, date and where its file
+// is), with the rule reason planDownloadSkips recorded. A false positive is
+// overridden and downloaded in a keypress; a right call is accepted for
+// good. Both are download_overrides verdicts (see overrides.go), so the
+// batch pass honours them too.
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// skipReview is one skipped episode and what it was matched to.
+type skipReview struct {
+	skippedEpisodeRow
+	episode     episodeItem // the skipped episode; url is "" without an enclosure
+	episodeFile string      // where the skipped episode's file is, once downloaded
+	matched     episodeItem // the sibling kept instead
+	matchedFile string      // where the sibling's file is; "" if not on disk
+	verdict     string      // its download_overrides action; "" for none
+}
+
+// episodesByHash reads episodes rows as search results, keyed by hash.
+func (s *store) episodesByHash(hashes []string) (map[string]searchResult, error) {
+	out := make(map[string]searchResult)
+	if len(hashes) == 0 {
+		return out, nil
+	}
+	args := make([]interface{}, 0, len(hashes))
+	for _, h := range hashes {
+		args = append(args, h)
+	}
+	rows, err := s.q.Query(`
+		SELECT IFNULL(e.podcast_title, ''), IFNULL(e.title, ''),
+			IFNULL(NULLIF(e.published, ''), IFNULL(e.first_seen, '')),
+			e.podcastname_episodename_hash, IFNULL(e.author, ''), IFNULL(e.file, ''),
+			`+episodeStatusSQL+`, IFNULL(e.season, ''), IFNULL(e.episode, ''), IFNULL(e.description, '')
+		FROM episodes AS e
+		WHERE e.podcastname_episodename_hash IN (?`+strings.Repeat(`, ?`, len(hashes)-1)+`)
+		;`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results, err := scanSearchResults(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		out[r.episodeHash] = r
+	}
+	return out, nil
+}
+
+// reviewItem is r as an episode list item; one without an enclosure keeps
+// its title and date but can't be downloaded.
+func reviewItem(r searchResult, now time.Time) episodeItem {
+	if items := searchResultItems([]searchResult{r}, now); len(items) == 1 {
+		return items[0]
+	}
+	return episodeItem{podcastTitle: r.podcastTitle, title: strings.TrimSpace(r.title),
+		dateStr: publishedDate10(r.published), hash: r.episodeHash, status: r.status}
+}
+
+// loadSkipReviews lists the skipped episodes, most recently skipped first,
+// each with its matched sibling and any download override.
+func loadSkipReviews(s *store, scanPaths []string) ([]skipReview, error) {
+	rows, err := s.skippedEpisodes()
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := s.downloadOverrides()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0, 2*len(rows))
+	for _, r := range rows {
+		hashes = append(hashes, r.episodeHash)
+		if r.matchedHash != "" {
+			hashes = append(hashes, r.matchedHash)
+		}
+	}
+	episodes, err := s.episodesByHash(hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	out := make([]skipReview, 0, len(rows))
+	for _, r := range rows {
+		review := skipReview{skippedEpisodeRow: r, verdict: overrides[r.episodeHash]}
+		if ep, ok := episodes[r.episodeHash]; ok {
+			review.episode = reviewItem(ep, now)
+			if review.episode.downloaded {
+				if review.episodeFile, err = s.episodeFile(scanPaths, r.episodeHash, review.episode.filename); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			review.episode = episodeItem{podcastTitle: r.podcastTitle, title: r.title, hash: r.episodeHash}
+		}
+		if ep, ok := episodes[r.matchedHash]; ok {
+			review.matched = reviewItem(ep, now)
+			if review.matchedFile, err = s.episodeFile(scanPaths, r.matchedHash, review.matched.filename); err != nil {
+				return nil, err
+			}
+		} else {
+			review.matched = episodeItem{title: r.matchedTitle, hash: r.matchedHash}
+		}
+		out = append(out, review)
+	}
+	return out, nil
+}
+
+type skipReviewMsg struct {
+	reviews  []skipReview
+	note     string
+	download []episodeItem // to queue now that the action is recorded
+	err      error
+}
+
+func loadSkipReviewsCmd(s *store, scanPaths []string, note string) tea.Cmd {
+	return func() tea.Msg {
+		reviews, err := loadSkipReviews(s, scanPaths)
+		return skipReviewMsg{reviews: reviews, note: note, err: err}
+	}
+}
+
+// skipVerdictCmd records a download override (or clears it, for ""), then
+// reloads the review.
+func skipVerdictCmd(s *store, scanPaths []string, r skipReview, action string) tea.Cmd {
+	return func() tea.Msg {
+		var note string
+		var download []episodeItem
+		switch action {
+		case overrideNever:
+			if err := s.setDownloadOverride(r.episodeHash, overrideNever); err != nil {
+				return skipReviewMsg{err: err}
+			}
+			note = fmt.Sprintf("Skip accepted: %q will never be downloaded.", r.title)
+		case overrideForce:
+			if err := s.setDownloadOverride(r.episodeHash, overrideForce); err != nil {
+				return skipReviewMsg{err: err}
+			}
+			note = fmt.Sprintf("Skip overridden: downloading %q.", r.title)
+			download = []episodeItem{r.episode}
+		default:
+			if _, err := s.clearDownloadOverride(r.episodeHash); err != nil {
+				return skipReviewMsg{err: err}
+			}
+			note = fmt.Sprintf("Override cleared: the heuristics decide %q again.", r.title)
+		}
+		msg := loadSkipReviewsCmd(s, scanPaths, note)().(skipReviewMsg)
+		msg.download = download
+		return msg
+	}
+}
+
+func (m interactiveModel) updateSkipReview(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.updateWindowSize(msg)
+		return m, nil
+	case skipReviewMsg:
+		if msg.err != nil {
+			m.errMsg = msg.err.Error()
+			return m, nil
+		}
+		m.skipReviews = msg.reviews
+		m.errMsg = msg.note
+		if m.skipCursor >= len(m.skipReviews) {
+			m.skipCursor = len(m.skipReviews) - 1
+		}
+		if m.skipCursor < 0 {
+			m.skipCursor = 0
+		}
+		if len(msg.download) > 0 {
+			_, cmd := m.downloads.add(msg.download, m.scanPaths[0], "")
+			m.errMsg += " " + m.keys.global.downloads.Help().Key + " shows the downloads."
+			return m, cmd
+		}
+		return m, nil
+	case tea.KeyMsg:
+		k := m.keys.skips
+		switch {
+		case key.Matches(msg, m.keys.global.up):
+			if m.skipCursor > 0 {
+				m.skipCursor--
+			}
+			m.errMsg = ""
+			return m, nil
+		case key.Matches(msg, m.keys.global.down):
+			if m.skipCursor < len(m.skipReviews)-1 {
+				m.skipCursor++
+			}
+			m.errMsg = ""
+			return m, nil
+		case key.Matches(msg, m.keys.global.back):
+			m.errMsg = ""
+			m.step = stepFeedSelect
+			m.ensureFeedVisible()
+			return m, nil
+		}
+		if len(m.skipReviews) == 0 {
+			return m, nil
+		}
+		r := m.skipReviews[m.skipCursor]
+		switch {
+		case key.Matches(msg, k.accept):
+			if r.verdict == overrideNever {
+				m.errMsg = "Already accepted."
+				return m, nil
+			}
+			return m, skipVerdictCmd(m.store, m.scanPaths, r, overrideNever)
+		case key.Matches(msg, k.override):
+			if r.episode.url == "" {
+				m.errMsg = "The skipped episode has no audio enclosure to download."
+				return m, nil
+			}
+			if r.episode.downloaded {
+				m.errMsg = "Already downloaded."
+				return m, nil
+			}
+			if m.downloads.active(r.episode.filename) {
+				m.errMsg = "Already downloading. Press " + m.keys.global.downloads.Help().Key + " to see the downloads."
+				return m, nil
+			}
+			return m, skipVerdictCmd(m.store, m.scanPaths, r, overrideForce)
+		case key.Matches(msg, k.clear):
+			if r.verdict == "" {
+				m.errMsg = "No override to clear."
+				return m, nil
+			}
+			return m, skipVerdictCmd(m.store, m.scanPaths, r, "")
+		}
+	}
+	return m, nil
+}
+
+// reviewColumn fits s to width runes, cutting it with an ellipsis and
+// padding it with spaces.
+func reviewColumn(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n <= width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
+
+func (m interactiveModel) viewSkipReview() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Skipped episodes: %d\n\n", len(m.skipReviews)))
+	if m.errMsg != "" {
+		b.WriteString(m.errMsg)
+		b.WriteString("\n\n")
+	}
+	if len(m.skipReviews) == 0 {
+		b.WriteString("The download pass hasn't skipped anything.\n\n" + keyHints(m.keys.global.back, m.keys.global.quit) + "\n")
+		return b.String()
+	}
+
+	rows := m.windowSize
+	if rows < 3 {
+		rows = 3
+	}
+	start := 0
+	if m.skipCursor >= rows {
+		start = m.skipCursor - rows + 1
+	}
+	end := start + rows
+	if end > len(m.skipReviews) {
+		end = len(m.skipReviews)
+	}
+	for i := start; i < end; i++ {
+		r := m.skipReviews[i]
+		cursor := " "
+		if i == m.skipCursor {
+			cursor = ">"
+		}
+		mark := " "
+		switch {
+		case r.episode.downloaded:
+			mark = "✓"
+		case m.downloads.active(r.episode.filename):
+			mark = "↓"
+		}
+		verdict := "skipped"
+		if r.verdict != "" {
+			verdict = r.verdict
+		}
+		b.WriteString(fmt.Sprintf("%s %s %-7s %s %s / %s\n", cursor, mark, verdict,
+			publishedDate10(r.lastSkipped), r.podcastTitle, r.title))
+	}
+
+	r := m.skipReviews[m.skipCursor]
+	width := 36
+	if m.width > 0 {
+		if w := (m.width - 9) / 2; w >= 20 {
+			width = w
+		}
+	}
+	file := func(item episodeItem, onDisk string) string {
+		switch {
+		case onDisk != "":
+			return onDisk
+		case item.filename != "":
+			return item.filename + " (not on disk)"
+		}
+		return "-"
+	}
+	b.WriteString("\n       " + reviewColumn("Skipped", width) + "  Kept\n")
+	for _, line := range [][3]string{
+		{"Title", r.episode.title, r.matched.title},
+		{"Date", r.episode.dateStr, r.matched.dateStr},
+		{"File", file(r.episode, r.episodeFile), file(r.matched, r.matchedFile)},
+		{"Hash", r.episodeHash, r.matchedHash},
+	} {
+		b.WriteString(fmt.Sprintf("%-6s %s  %s\n", line[0], reviewColumn(line[1], width), line[2]))
+	}
+	b.WriteString(fmt.Sprintf("Reason %s\n", r.reason))
+	b.WriteString(fmt.Sprintf("Skipped first %s, last %s\n", publishedDate10(r.firstSkipped), publishedDate10(r.lastSkipped)))
+	switch r.verdict {
+	case overrideNever:
+		b.WriteString("Accepted: never downloaded.\n")
+	case overrideForce:
+		b.WriteString("Overridden: downloaded despite the rule.\n")
+	}
+
+	if len(m.skipReviews) > rows {
+		b.WriteString(fmt.Sprintf("\nShowing %d-%d of %d skips.\n", start+1, end, len(m.skipReviews)))
+	}
+	k := m.keys.skips
+	b.WriteString("\n" + keyHints(k.accept, k.override, k.clear, m.keys.global.back, m.keys.global.quit, m.keys.global.help) + "\n")
+	b.WriteString(m.downloadsFooter())
+	return b.String()
+}
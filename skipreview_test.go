@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// seedSkip records a retitle skip of "Ep 5 (repeat)" against "Ep 5", whose
+// file is in the podcasts dir. Returns the podcasts dir.
+func seedSkip(t *testing.T, st *store, audioURL string) string {
+	t.Helper()
+	dir := t.TempDir()
+	keptName := buildEpisodeFilename("Alpha", "Ep 5", "2024-03-01")
+	if err := os.WriteFile(filepath.Join(dir, keptName), []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	keptHash, _, _ := hashFromFilename(keptName)
+	for _, ep := range []struct{ title, hash, published string }{
+		{"Ep 5", keptHash, "2024-03-01T06:00:00Z"},
+		{"Ep 5 (repeat)", "5e1ec7ed5e1ec7ed5e1ec7ed5e1ec7ed", "2024-03-02T06:00:00Z"},
+	} {
+		if _, err := st.q.Exec(`INSERT INTO episodes (title, published, file, first_seen, last_seen, podcast_title, podcastname_episodename_hash)
+			VALUES (?, ?, ?, ?, ?, 'Alpha', ?);`, ep.title, ep.published, audioURL, ts, ts, ep.hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := st.recordDownloadSeen(keptName, keptHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.recordSkippedEpisodes([]skippedEpisodeRecord{{episodeHash: "5e1ec7ed5e1ec7ed5e1ec7ed5e1ec7ed",
+		podcastTitle: "Alpha", title: "Ep 5 (repeat)", matchedHash: keptHash, matchedTitle: "Ep 5",
+		reason: "rule 2: same published day, overlapping titles"}}); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoadSkipReviews(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	dir := seedSkip(t, st, "http://example.com/ep.mp3")
+
+	reviews, err := loadSkipReviews(st, []string{dir})
+	if err != nil {
+		t.Fatalf("loadSkipReviews: %v", err)
+	}
+	if len(reviews) != 1 {
+		t.Fatalf("reviews = %+v", reviews)
+	}
+	r := reviews[0]
+	if r.episode.title != "Ep 5 (repeat)" || r.episode.dateStr != "2024-03-02" || r.episode.url == "" || r.episode.downloaded {
+		t.Fatalf("skipped episode = %+v", r.episode)
+	}
+	if r.matched.title != "Ep 5" || r.matched.dateStr != "2024-03-01" || r.matchedFile != filepath.Join(dir, r.matched.filename) {
+		t.Fatalf("matched = %+v at %q", r.matched, r.matchedFile)
+	}
+	if r.verdict != "" {
+		t.Fatalf("verdict = %q", r.verdict)
+	}
+}
+
+// a accepts the skip as a never-download; o overrides it with a force and
+// queues the download.
+func TestSkipReviewScreen(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	srv, _ := episodeServer(t, bytes.Repeat([]byte{0}, 4096))
+	dir := seedSkip(t, st, srv.URL+"/ep.mp3")
+
+	m := newInteractiveModel(st, dir, "", "")
+	m.step = stepFeedSelect
+	update := func(msg tea.Msg) {
+		t.Helper()
+		next, cmd := m.Update(msg)
+		m = next.(interactiveModel)
+		if cmd != nil {
+			if msg, ok := cmd().(skipReviewMsg); ok {
+				next, _ = m.Update(msg)
+				m = next.(interactiveModel)
+			}
+		}
+	}
+	key := func(k string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)} }
+	override := func() string {
+		overrides, err := st.downloadOverrides()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return overrides["5e1ec7ed5e1ec7ed5e1ec7ed5e1ec7ed"]
+	}
+
+	update(key("r"))
+	view := m.View()
+	if m.step != stepSkipReview || !strings.Contains(view, "Alpha / Ep 5 (repeat)") ||
+		!strings.Contains(view, "rule 2: same published day") || !strings.Contains(view, "2024-03-02") ||
+		!strings.Contains(view, m.skipReviews[0].matchedFile) {
+		t.Fatalf("review view:\n%s", view)
+	}
+
+	update(key("a"))
+	if override() != overrideNever || m.skipReviews[0].verdict != overrideNever || !strings.Contains(m.View(), "Accepted") {
+		t.Fatalf("after a: override %q\n%s", override(), m.View())
+	}
+
+	update(key("o"))
+	if override() != overrideForce || len(m.downloads.jobs) != 1 {
+		t.Fatalf("after o: override %q, %d jobs", override(), len(m.downloads.jobs))
+	}
+	next, _ := m.Update(m.downloads.start(m.downloads.jobs[0])())
+	m = next.(interactiveModel)
+	if !m.skipReviews[0].episode.downloaded || !strings.Contains(m.View(), "✓ force") {
+		t.Fatalf("download not shown:\n%s", m.View())
+	}
+
+	update(key("c"))
+	if override() != "" {
+		t.Fatalf("after c: override %q", override())
+	}
+	update(key("b"))
+	if m.step != stepFeedSelect {
+		t.Fatalf("b went to step %v", m.step)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// storeBusyTimeoutMs is how long a connection waits on a locked database
+// before giving up. The batch pipeline, the TUI and ad-hoc sqlite3 sessions
+// can all have the file open at once; five seconds rides out any write we
+// make without hanging a wedged run forever.
+const storeBusyTimeoutMs = 5000
+
+// dbtx is the query surface shared by *sql.DB and *sql.Tx, so every typed
+// store method runs unchanged inside or outside a transaction.
+type dbtx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+// store owns the one connection pool a run uses. Subsystems take a *store
+// instead of a database path and call its typed methods (podcasts, episodes,
+// downloads, archive, skips, queue) rather than opening connections of their
+// own. A store returned by begin wraps an open transaction: its methods run
+// on that transaction until commit or rollback.
+type store struct {
+	path string
+	db   *sql.DB
+	q    dbtx
+	tx   *sql.Tx
+	fts  bool // episodes_fts exists; see search.go
+}
+
+// openStore opens the database at path in WAL mode with a busy timeout.
+// Write transactions take the write lock up front (_txlock=immediate) so two
+// writers queue on the busy timeout instead of deadlocking on a lock upgrade.
+// ":memory:" opens a private in-memory database for tests; it is pinned to a
+// single connection because every new connection would see an empty db.
+func openStore(path string) (*store, error) {
+	memory := path == ":memory:"
+	params := []string{fmt.Sprintf("_busy_timeout=%d", storeBusyTimeoutMs)}
+	if !memory {
+		params = append(params, "_journal_mode=WAL", "_txlock=immediate")
+	}
+	db, err := sql.Open(sqlite3, path+"?"+strings.Join(params, "&"))
+	if err != nil {
+		return nil, err
+	}
+	if memory {
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return &store{path: path, db: db, q: db}, nil
+}
+
+// openStoreReadOnly opens the database at path read-only (mode=ro), leaving
+// its journal mode alone, so nothing done through it can change the file.
+func openStoreReadOnly(path string) (*store, error) {
+	db, err := sql.Open(sqlite3, fmt.Sprintf("file:%s?mode=ro&_busy_timeout=%d", path, storeBusyTimeoutMs))
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return &store{path: path, db: db, q: db}, nil
+}
+
+// Close closes the connection pool. Closing a transaction-scoped store is a
+// no-op; it shares the pool of the store that began it.
+func (s *store) Close() error {
+	if s.tx != nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// begin starts a transaction and returns a store scoped to it. The caller
+// must finish with commit or rollback. Beginning on a store that is already
+// transaction-scoped is an error: SQLite has no nested transactions.
+func (s *store) begin() (*store, error) {
+	if s.tx != nil {
+		return nil, fmt.Errorf("transaction already open")
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &store{path: s.path, db: s.db, q: tx, tx: tx, fts: s.fts}, nil
+}
+
+func (s *store) commit() error {
+	if s.tx == nil {
+		return fmt.Errorf("commit outside a transaction")
+	}
+	return s.tx.Commit()
+}
+
+// rollback aborts the transaction. It is safe to defer after a commit; the
+// second call is a no-op.
+func (s *store) rollback() error {
+	if s.tx == nil {
+		return fmt.Errorf("rollback outside a transaction")
+	}
+	err := s.tx.Rollback()
+	if err == sql.ErrTxDone {
+		return nil
+	}
+	return err
+}
+
+// inTx runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise (including on panic). On a store that is already
+// transaction-scoped, fn joins the open transaction, so batch steps can
+// compose without knowing who owns the commit.
+func (s *store) inTx(fn func(tx *store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.commit()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	mapset "github.com/deckarep/golang-set"
+)
+
+// openTestStore opens dbFileName in the current (temporary) working
+// directory with the tables created, and closes it when the test ends.
+func openTestStore(t *testing.T) *store {
+	t.Helper()
+	s, err := openStore(dbFileName)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if err := s.createTablesIfNotExist(); err != nil {
+		t.Fatalf("createTablesIfNotExist: %v", err)
+	}
+	return s
+}
+
+// An in-memory store is a whole working database: tables, typed writes and
+// typed reads, with no file on disk.
+func TestOpenStoreInMemory(t *testing.T) {
+	s, err := openStore(":memory:")
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	defer s.Close()
+	if err := s.createTablesIfNotExist(); err != nil {
+		t.Fatalf("createTablesIfNotExist: %v", err)
+	}
+
+	if err := s.upsertArchived("hash-a", "/archive/A-2024-01-01-T-hash-a.mp3"); err != nil {
+		t.Fatalf("upsertArchived: %v", err)
+	}
+	hashes, err := s.archivedHashes()
+	if err != nil {
+		t.Fatalf("archivedHashes: %v", err)
+	}
+	if !hashes.Contains("hash-a") || hashes.Cardinality() != 1 {
+		t.Fatalf("archivedHashes = %v, want {hash-a}", hashes)
+	}
+	names, err := s.archivedBasenames()
+	if err != nil {
+		t.Fatalf("archivedBasenames: %v", err)
+	}
+	if len(names) != 1 || names[0] != "A-2024-01-01-T-hash-a.mp3" {
+		t.Fatalf("archivedBasenames = %v", names)
+	}
+}
+
+func TestOpenStoreUsesWAL(t *testing.T) {
+	useTempWorkingDir(t)
+	s := openTestStore(t)
+
+	var mode string
+	if err := s.db.QueryRow(`PRAGMA journal_mode;`).Scan(&mode); err != nil {
+		t.Fatalf("journal_mode: %v", err)
+	}
+	if mode != "wal" {
+		t.Fatalf("journal_mode = %q, want wal", mode)
+	}
+	var timeout int
+	if err := s.db.QueryRow(`PRAGMA busy_timeout;`).Scan(&timeout); err != nil {
+		t.Fatalf("busy_timeout: %v", err)
+	}
+	if timeout != storeBusyTimeoutMs {
+		t.Fatalf("busy_timeout = %d, want %d", timeout, storeBusyTimeoutMs)
+	}
+}
+
+// inTx commits on success, rolls back on error, and joins an already-open
+// transaction instead of nesting.
+func TestStoreInTx(t *testing.T) {
+	s, err := openStore(":memory:")
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	defer s.Close()
+	if err := s.createTablesIfNotExist(); err != nil {
+		t.Fatalf("createTablesIfNotExist: %v", err)
+	}
+
+	rolledBack := s.inTx(func(tx *store) error {
+		if err := tx.upsertArchived("gone", "/x/gone.mp3"); err != nil {
+			return err
+		}
+		return errTestRollback
+	})
+	if rolledBack != errTestRollback {
+		t.Fatalf("inTx error = %v, want %v", rolledBack, errTestRollback)
+	}
+
+	err = s.inTx(func(tx *store) error {
+		if err := tx.upsertArchived("kept", "/x/kept.mp3"); err != nil {
+			return err
+		}
+		return tx.inTx(func(inner *store) error {
+			if inner != tx {
+				t.Fatal("nested inTx should join the open transaction")
+			}
+			return inner.upsertArchived("kept-too", "/x/kept-too.mp3")
+		})
+	})
+	if err != nil {
+		t.Fatalf("inTx: %v", err)
+	}
+
+	hashes, err := s.archivedHashes()
+	if err != nil {
+		t.Fatalf("archivedHashes: %v", err)
+	}
+	if hashes.Contains("gone") || !hashes.Contains("kept") || !hashes.Contains("kept-too") {
+		t.Fatalf("archivedHashes = %v, want {kept, kept-too}", hashes)
+	}
+}
+
+var errTestRollback = errors.New("roll me back")
+
+func mustArchivedHashes(t *testing.T, s *store) mapset.Set {
+	t.Helper()
+	hashes, err := s.archivedHashes()
+	if err != nil {
+		t.Fatalf("archivedHashes: %v", err)
+	}
+	return hashes
+}
@@ -0,0 +1,523 @@
+package main
+
+// The interactive subscriptions screen: the feeds in gopodder.conf (batch
+// mode) and gopodder-extra.conf, plus feeds that have been fetched but are
+// in neither (entered with m, or unsubscribed), each with how its fetches
+// have gone and how many episodes the db holds for it. From there a feed
+// can be subscribed to batch mode, unsubscribed, paused, or moved between
+// the two files.
+//
+// Every change rewrites the whole conf file through a temp file and a
+// rename, keeping its other lines (settings, comments) as they were, so a
+// crash or a concurrent cron run never sees half a file.
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pausedFeedPrefix comments out a paused feed's line; readConfig skips
+// comment lines, so batch mode leaves the feed alone until it is resumed.
+const pausedFeedPrefix = "#paused "
+
+// Which list a subscription is on.
+const (
+	subBatch = "batch"
+	subExtra = "extra"
+	subNone  = "none"
+)
+
+// feedHealth is a feed_health row: how fetching a feed has been going.
+type feedHealth struct {
+	podcast   string
+	lastFetch string
+	lastOK    string
+	lastError string
+	failures  int // since the last good fetch
+}
+
+type subscription struct {
+	url      string
+	list     string // subBatch, subExtra or subNone
+	paused   bool
+	health   feedHealth
+	episodes int
+}
+
+// subscriptionFiles are the two conf files the screen edits.
+type subscriptionFiles struct {
+	batch string // gopodder.conf
+	extra string // gopodder-extra.conf
+}
+
+func (f subscriptionFiles) path(list string) string {
+	if list == subBatch {
+		return f.batch
+	}
+	return f.extra
+}
+
+// recordFeedFetch notes one fetch of a feed in feed_health; fetchErr is nil
+// for a good fetch. The podcast title is kept from the last good one.
+func (s *store) recordFeedFetch(url, podcast string, fetchErr error) error {
+	url = strings.TrimSpace(url)
+	if fetchErr == nil {
+		_, err := s.q.Exec(`
+			INSERT INTO feed_health (url, podcast_title, last_fetch, last_ok, last_error, failures)
+			VALUES (?, ?, ?, ?, NULL, 0)
+			ON CONFLICT(url) DO UPDATE SET
+				podcast_title = excluded.podcast_title,
+				last_fetch = excluded.last_fetch,
+				last_ok = excluded.last_ok,
+				last_error = NULL,
+				failures = 0
+			;`, url, strings.TrimSpace(podcast), ts, ts)
+		return err
+	}
+	_, err := s.q.Exec(`
+		INSERT INTO feed_health (url, last_fetch, last_error, failures)
+		VALUES (?, ?, ?, 1)
+		ON CONFLICT(url) DO UPDATE SET
+			last_fetch = excluded.last_fetch,
+			last_error = excluded.last_error,
+			failures = feed_health.failures + 1
+		;`, url, ts, fetchErr.Error())
+	return err
+}
+
+func (s *store) feedHealthByURL() (map[string]feedHealth, error) {
+	rows, err := s.q.Query(`
+		SELECT url, IFNULL(podcast_title, ''), last_fetch, IFNULL(last_ok, ''), IFNULL(last_error, ''), failures
+		FROM feed_health;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]feedHealth)
+	for rows.Next() {
+		var url string
+		var h feedHealth
+		if err := rows.Scan(&url, &h.podcast, &h.lastFetch, &h.lastOK, &h.lastError, &h.failures); err != nil {
+			return nil, err
+		}
+		out[url] = h
+	}
+	return out, rows.Err()
+}
+
+// episodeCount counts a podcast's episodes in table (episodes for batch
+// feeds, interactive_episodes for the rest).
+func (s *store) episodeCount(table, podcast string) (int, error) {
+	var n int
+	err := s.q.QueryRow(`SELECT count(*) FROM `+table+` WHERE podcast_title = ?;`, podcast).Scan(&n)
+	return n, err
+}
+
+// readSubscriptionFile lists the feeds in a conf file, paused ones
+// included. A missing file has none.
+func readSubscriptionFile(path, list string) ([]subscription, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var subs []subscription
+	for _, line := range strings.Split(string(content), "\n") {
+		if url, paused, ok := feedLine(line); ok {
+			subs = append(subs, subscription{url: url, list: list, paused: paused})
+		}
+	}
+	return subs, nil
+}
+
+// feedLine picks the feed URL out of a conf line, as readConfig would, or
+// out of a line paused with pausedFeedPrefix.
+func feedLine(line string) (url string, paused bool, ok bool) {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, pausedFeedPrefix) {
+		trimmed, paused = strings.TrimSpace(strings.TrimPrefix(trimmed, pausedFeedPrefix)), true
+	} else if strings.HasPrefix(trimmed, "#") {
+		return "", false, false
+	}
+	if configSettingRe.MatchString(trimmed) || !strings.Contains(trimmed, "http") {
+		return "", false, false
+	}
+	return trimmed, paused, true
+}
+
+// loadSubscriptions lists the batch feeds, then the extra feeds, then the
+// fetched feeds in neither file, each with its health and episode count.
+func loadSubscriptions(s *store, files subscriptionFiles) ([]subscription, error) {
+	batch, err := readSubscriptionFile(files.batch, subBatch)
+	if err != nil {
+		return nil, err
+	}
+	extra, err := readSubscriptionFile(files.extra, subExtra)
+	if err != nil {
+		return nil, err
+	}
+	health, err := s.feedHealthByURL()
+	if err != nil {
+		return nil, err
+	}
+
+	subs := append(batch, extra...)
+	listed := make(map[string]bool, len(subs))
+	for _, sub := range subs {
+		listed[sub.url] = true
+	}
+	var others []string
+	for url := range health {
+		if !listed[url] {
+			others = append(others, url)
+		}
+	}
+	sort.Strings(others)
+	for _, url := range others {
+		subs = append(subs, subscription{url: url, list: subNone})
+	}
+
+	for i := range subs {
+		subs[i].health = health[subs[i].url]
+		if subs[i].health.podcast == "" {
+			continue
+		}
+		table := "interactive_episodes"
+		if subs[i].list == subBatch {
+			table = "episodes"
+		}
+		if subs[i].episodes, err = s.episodeCount(table, subs[i].health.podcast); err != nil {
+			return nil, err
+		}
+	}
+	return subs, nil
+}
+
+// rewriteConfFile replaces path with edit applied to its lines, through a
+// temp file renamed over it. A missing file starts empty.
+func rewriteConfFile(path string, edit func(lines []string) ([]string, error)) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	var lines []string
+	if text := strings.TrimSuffix(string(content), "\n"); text != "" {
+		lines = strings.Split(text, "\n")
+	}
+	lines, err = edit(lines)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // a no-op once renamed
+	out := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		out += "\n"
+	}
+	if _, err := tmp.WriteString(out); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// findFeedLine is the index of url's line in lines, or -1.
+func findFeedLine(lines []string, url string) int {
+	for i, line := range lines {
+		if u, _, ok := feedLine(line); ok && u == url {
+			return i
+		}
+	}
+	return -1
+}
+
+// addFeed appends url to the conf file at path, paused if asked.
+func addFeed(path, url string, paused bool) error {
+	return rewriteConfFile(path, func(lines []string) ([]string, error) {
+		if findFeedLine(lines, url) >= 0 {
+			return nil, fmt.Errorf("%s is already in %s", url, filepath.Base(path))
+		}
+		if paused {
+			url = pausedFeedPrefix + url
+		}
+		return append(lines, url), nil
+	})
+}
+
+// removeFeed drops url's line from the conf file at path.
+func removeFeed(path, url string) error {
+	return rewriteConfFile(path, func(lines []string) ([]string, error) {
+		i := findFeedLine(lines, url)
+		if i < 0 {
+			return nil, fmt.Errorf("%s is not in %s", url, filepath.Base(path))
+		}
+		return append(lines[:i], lines[i+1:]...), nil
+	})
+}
+
+// setFeedPaused pauses or resumes url in the conf file at path.
+func setFeedPaused(path, url string, paused bool) error {
+	return rewriteConfFile(path, func(lines []string) ([]string, error) {
+		i := findFeedLine(lines, url)
+		if i < 0 {
+			return nil, fmt.Errorf("%s is not in %s", url, filepath.Base(path))
+		}
+		lines[i] = url
+		if paused {
+			lines[i] = pausedFeedPrefix + url
+		}
+		return lines, nil
+	})
+}
+
+// moveFeed moves a feed from one conf file to the other, keeping it
+// paused if it was. It is added before it is removed, so a failure part way
+// leaves it in both files rather than neither.
+func moveFeed(files subscriptionFiles, sub subscription) error {
+	to := subBatch
+	if sub.list == subBatch {
+		to = subExtra
+	}
+	if err := addFeed(files.path(to), sub.url, sub.paused); err != nil {
+		return err
+	}
+	return removeFeed(files.path(sub.list), sub.url)
+}
+
+type subscriptionsMsg struct {
+	subs []subscription
+	note string // what the action that led here did
+	err  error
+}
+
+func loadSubscriptionsCmd(s *store, files subscriptionFiles, note string) tea.Cmd {
+	return func() tea.Msg {
+		subs, err := loadSubscriptions(s, files)
+		return subscriptionsMsg{subs: subs, note: note, err: err}
+	}
+}
+
+// subscriptionActionCmd runs one change to the conf files, then reloads
+// the list.
+func subscriptionActionCmd(s *store, files subscriptionFiles, action func() (string, error)) tea.Cmd {
+	return func() tea.Msg {
+		note, err := action()
+		if err != nil {
+			return subscriptionsMsg{err: err}
+		}
+		return loadSubscriptionsCmd(s, files, note)()
+	}
+}
+
+func (m interactiveModel) updateSubscriptions(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.updateWindowSize(msg)
+		return m, nil
+	case subscriptionsMsg:
+		if msg.err != nil {
+			m.errMsg = msg.err.Error()
+			return m, nil
+		}
+		m.subs = msg.subs
+		m.errMsg = msg.note
+		if m.subCursor >= len(m.subs) {
+			m.subCursor = len(m.subs) - 1
+		}
+		if m.subCursor < 0 {
+			m.subCursor = 0
+		}
+		return m, nil
+	case tea.KeyMsg:
+		k := m.keys.subscriptions
+		switch {
+		case key.Matches(msg, m.keys.global.up):
+			if m.subCursor > 0 {
+				m.subCursor--
+			}
+			return m, nil
+		case key.Matches(msg, m.keys.global.down):
+			if m.subCursor < len(m.subs)-1 {
+				m.subCursor++
+			}
+			return m, nil
+		case key.Matches(msg, m.keys.global.back):
+			m.errMsg = ""
+			m.step = stepFeedSelect
+			if m.feedOptionsAreURLs {
+				// The extra feeds may have changed
+				if _, urls, err, _ := loadExtraFeeds(filepath.Dir(m.subFiles.extra)); err == nil {
+					m.feedOptions = urls
+				}
+			}
+			m.ensureFeedVisible()
+			return m, nil
+		}
+		if len(m.subs) == 0 {
+			return m, nil
+		}
+		sub := m.subs[m.subCursor]
+		files := m.subFiles
+		var action func() (string, error)
+		switch {
+		case key.Matches(msg, k.subscribe):
+			if sub.list == subBatch {
+				m.errMsg = "Already subscribed in batch mode."
+				return m, nil
+			}
+			action = func() (string, error) {
+				return "Subscribed in batch mode; the next -p run fetches it.", addFeed(files.batch, sub.url, false)
+			}
+		case key.Matches(msg, k.unsubscribe):
+			if sub.list == subNone {
+				m.errMsg = "Not subscribed."
+				return m, nil
+			}
+			action = func() (string, error) {
+				return "Unsubscribed from " + filepath.Base(files.path(sub.list)) + ".", removeFeed(files.path(sub.list), sub.url)
+			}
+		case key.Matches(msg, k.pause):
+			if sub.list == subNone {
+				m.errMsg = "Only a subscribed feed can be paused."
+				return m, nil
+			}
+			action = func() (string, error) {
+				note := "Paused."
+				if sub.paused {
+					note = "Resumed."
+				}
+				return note, setFeedPaused(files.path(sub.list), sub.url, !sub.paused)
+			}
+		case key.Matches(msg, k.move):
+			if sub.list == subNone {
+				m.errMsg = "Not subscribed; " + k.subscribe.Help().Key + " subscribes it in batch mode."
+				return m, nil
+			}
+			action = func() (string, error) {
+				to := extraConfName
+				if sub.list == subExtra {
+					to = confFile
+				}
+				return "Moved to " + to + ".", moveFeed(files, sub)
+			}
+		default:
+			return m, nil
+		}
+		m.errMsg = ""
+		return m, subscriptionActionCmd(m.store, files, action)
+	}
+	return m, nil
+}
+
+func (m interactiveModel) viewSubscriptions() string {
+	var b strings.Builder
+	b.WriteString("Subscriptions\n")
+	b.WriteString(fmt.Sprintf("Batch: %s\nExtra: %s\n\n", m.subFiles.batch, m.subFiles.extra))
+	if m.errMsg != "" {
+		b.WriteString(m.errMsg)
+		b.WriteString("\n\n")
+	}
+	if len(m.subs) == 0 {
+		b.WriteString("No feeds yet. Enter one with m on the podcast list.\n")
+		b.WriteString("\n" + keyHints(m.keys.global.back, m.keys.global.quit) + "\n")
+		return b.String()
+	}
+
+	// Each feed takes two lines, plus the list headings
+	rows := m.windowSize/2 - 1
+	if rows < 3 {
+		rows = 3
+	}
+	start := 0
+	if m.subCursor >= rows {
+		start = m.subCursor - rows + 1
+	}
+	end := start + rows
+	if end > len(m.subs) {
+		end = len(m.subs)
+	}
+	headings := map[string]string{
+		subBatch: confFile + " (batch mode)",
+		subExtra: extraConfName + " (interactive)",
+		subNone:  "In neither (entered with m, or unsubscribed)",
+	}
+	for i := start; i < end; i++ {
+		sub := m.subs[i]
+		if i == start || m.subs[i-1].list != sub.list {
+			b.WriteString(headings[sub.list] + "\n")
+		}
+		cursor := " "
+		if i == m.subCursor {
+			cursor = ">"
+		}
+		paused := ""
+		if sub.paused {
+			paused = "[paused] "
+		}
+		b.WriteString(fmt.Sprintf("%s %s%s\n", cursor, paused, sub.url))
+		b.WriteString("    " + sub.healthLine() + "\n")
+	}
+	if len(m.subs) > rows {
+		b.WriteString(fmt.Sprintf("\nShowing %d-%d of %d feeds.\n", start+1, end, len(m.subs)))
+	}
+	k := m.keys.subscriptions
+	b.WriteString("\n" + keyHints(k.subscribe, k.unsubscribe, k.pause, k.move, m.keys.global.back, m.keys.global.quit,
+		m.keys.global.help) + "\n")
+	return b.String()
+}
+
+// healthLine sums up a feed's fetches and episodes in one line.
+func (sub subscription) healthLine() string {
+	h := sub.health
+	if h.lastFetch == "" {
+		return "never fetched"
+	}
+	name := h.podcast
+	if name == "" {
+		name = "(title unknown)"
+	}
+	line := fmt.Sprintf("%s: %d episodes, last fetched %s", name, sub.episodes, shortTimestamp(h.lastFetch))
+	if h.failures == 0 {
+		return line + ", ok"
+	}
+	line += fmt.Sprintf(", %d failed fetch(es)", h.failures)
+	if h.lastOK != "" {
+		line += " since " + shortTimestamp(h.lastOK)
+	}
+	return line + ": " + h.lastError
+}
+
+// shortTimestamp trims an RFC 3339 timestamp to the minute.
+func shortTimestamp(t string) string {
+	if len(t) >= 16 {
+		return strings.Replace(t[:16], "T", " ", 1)
+	}
+	return t
+}
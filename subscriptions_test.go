@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// Edits keep the file's other lines, and a paused feed drops out of
+// readConfig.
+func TestConfFileEdits(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, confFile)
+	orig := "# my feeds\ndb = /srv/pods/gopodder.sqlite\nhttps://a.example/feed.rss\nhttps://b.example/feed.rss\n"
+	if err := os.WriteFile(path, []byte(orig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setFeedPaused(path, "https://a.example/feed.rss", true); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	if err := addFeed(path, "https://c.example/feed.rss", false); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := addFeed(path, "https://b.example/feed.rss", false); err == nil {
+		t.Fatal("added a feed already in the file")
+	}
+	if err := removeFeed(path, "https://b.example/feed.rss"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	want := "# my feeds\ndb = /srv/pods/gopodder.sqlite\n#paused https://a.example/feed.rss\nhttps://c.example/feed.rss\n"
+	if got := readFile(t, path); got != want {
+		t.Fatalf("file =\n%s\nwant\n%s", got, want)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("mode after rewrite: %v, %v", info.Mode(), err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".*")); len(leftovers) != 0 {
+		t.Fatalf("temp files left: %v", leftovers)
+	}
+
+	urls, err := readConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(urls, ",") != "https://c.example/feed.rss" {
+		t.Fatalf("readConfig = %v, want only the unpaused feed", urls)
+	}
+
+	if err := setFeedPaused(path, "https://a.example/feed.rss", false); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if !strings.Contains(readFile(t, path), "\nhttps://a.example/feed.rss\n") {
+		t.Fatalf("resume left:\n%s", readFile(t, path))
+	}
+}
+
+func TestRecordFeedFetch(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	url := "https://a.example/feed.rss"
+	for _, err := range []error{nil, errors.New("HTTP 500"), errors.New("timeout")} {
+		if recErr := st.recordFeedFetch(url, "Alpha", err); recErr != nil {
+			t.Fatal(recErr)
+		}
+	}
+	health, err := st.feedHealthByURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := health[url]
+	if h.podcast != "Alpha" || h.failures != 2 || h.lastError != "timeout" || h.lastOK == "" {
+		t.Fatalf("health = %+v", h)
+	}
+	if err := st.recordFeedFetch(url, "Alpha", nil); err != nil {
+		t.Fatal(err)
+	}
+	if health, _ = st.feedHealthByURL(); health[url].failures != 0 || health[url].lastError != "" {
+		t.Fatalf("a good fetch left %+v", health[url])
+	}
+}
+
+// The screen lists both files and the fetched feeds in neither, and moves
+// a feed between the files.
+func TestSubscriptionsScreen(t *testing.T) {
+	dir := useTempWorkingDir(t)
+	st := openTestStore(t)
+	files := subscriptionFiles{batch: filepath.Join(dir, confFile), extra: filepath.Join(dir, extraConfName)}
+	if err := os.WriteFile(files.batch, []byte("https://a.example/feed.rss\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(files.extra, []byte("#paused https://b.example/feed.rss\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.recordFeedFetch("https://a.example/feed.rss", "Alpha", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.recordFeedFetch("https://m.example/feed.rss", "", errors.New("HTTP 404")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.q.Exec(`INSERT INTO episodes (title, first_seen, last_seen, podcast_title, podcastname_episodename_hash)
+		VALUES ('One', ?, ?, 'Alpha', 'h1'), ('Two', ?, ?, 'Alpha', 'h2');`, ts, ts, ts, ts); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newInteractiveModel(st, dir, "", "")
+	m.subFiles = files
+	m.step = stepFeedSelect
+	update := func(msg tea.Msg) {
+		t.Helper()
+		next, cmd := m.Update(msg)
+		m = next.(interactiveModel)
+		if cmd != nil {
+			if msg, ok := cmd().(subscriptionsMsg); ok {
+				next, _ = m.Update(msg)
+				m = next.(interactiveModel)
+			}
+		}
+	}
+	key := func(k string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)} }
+
+	update(key("f"))
+	if m.step != stepSubscriptions || len(m.subs) != 3 {
+		t.Fatalf("step=%v subs=%+v", m.step, m.subs)
+	}
+	var lists []string
+	for _, sub := range m.subs {
+		lists = append(lists, sub.list)
+	}
+	if strings.Join(lists, ",") != "batch,extra,none" || !m.subs[1].paused {
+		t.Fatalf("subs = %+v", m.subs)
+	}
+	view := m.View()
+	for _, want := range []string{"Alpha: 2 episodes", "[paused] https://b.example/feed.rss", "1 failed fetch(es): HTTP 404"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view missing %q:\n%s", want, view)
+		}
+	}
+
+	// Move the paused extra feed to batch mode; it stays paused
+	update(tea.KeyMsg{Type: tea.KeyDown})
+	update(key("v"))
+	if m.errMsg != "Moved to "+confFile+"." {
+		t.Fatalf("errMsg = %q", m.errMsg)
+	}
+	if got := readFile(t, files.batch); got != "https://a.example/feed.rss\n#paused https://b.example/feed.rss\n" {
+		t.Fatalf("batch file:\n%s", got)
+	}
+	if got := readFile(t, files.extra); got != "" {
+		t.Fatalf("extra file:\n%s", got)
+	}
+
+	// Subscribe the feed entered by hand
+	update(tea.KeyMsg{Type: tea.KeyDown})
+	update(tea.KeyMsg{Type: tea.KeyDown})
+	if m.subs[m.subCursor].list != subNone {
+		t.Fatalf("cursor on %+v", m.subs[m.subCursor])
+	}
+	update(key("s"))
+	if !strings.HasSuffix(readFile(t, files.batch), "\nhttps://m.example/feed.rss\n") {
+		t.Fatalf("batch file:\n%s", readFile(t, files.batch))
+	}
+
+	update(key("b"))
+	if m.step != stepFeedSelect {
+		t.Fatalf("b went to step %v", m.step)
+	}
+}
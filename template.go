@@ -0,0 +1,184 @@
+package main
+
+// Filename templates: how downloaded episodes are named and laid out.
+//
+// The default, "{podcast}-{date}-{title}-{hash}", is the flat layout gopodder
+// has always used. A "filename_template = ..." line in gopodder.conf can add
+// subdirectories ("{podcast}/{year}/...") and the season and episode number.
+// Two rules keep every name-based mechanism working whatever the template:
+//
+//   - The file name ends "{title}-{hash}", so hashFromFilename and
+//     nameMinusHash still find the hash (and the transformed title) at the
+//     end of the name.
+//   - The file name (not just its directories) holds {podcast} and {date},
+//     so the name-minus-hash prefix the twin checks compare is still unique
+//     to one podcast's episode on one day.
+//
+// Changing the template only affects new downloads; --relayout moves an
+// existing library over.
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const defaultFilenameTemplate = "{podcast}-{date}-{title}-{hash}"
+
+// maxTemplateDirs bounds template nesting, and so how deep the scans look
+// when the library may be nested (see scanDepth).
+const maxTemplateDirs = 3
+
+// libraryNested is set at startup when the db shows a nested layout in the
+// past: a download recorded under a folder, or an applied --relayout that
+// was not undone. The library may still hold those folders even if the
+// current template is flat.
+var libraryNested bool
+
+// scanDepth is how many folder levels the scans descend below a podcasts
+// or archive dir. A flat layout that was never relaid out keeps the old
+// behaviour of ignoring subdirectories.
+func scanDepth() int {
+	if nameTemplate.nested() || libraryNested {
+		return maxTemplateDirs
+	}
+	return 0
+}
+
+// filenameTemplateSetting is the gopodder.conf setting holding the template.
+const filenameTemplateSetting = "filename_template"
+
+// Template fields, in the order the README lists them.
+var templateFields = map[string]bool{
+	"podcast": true, "date": true, "year": true, "month": true,
+	"title": true, "season": true, "episode": true, "hash": true,
+}
+
+var templateFieldRe = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// filenameTemplate is a parsed, validated template.
+type filenameTemplate struct {
+	raw  string
+	dirs []string // directory segments, may be empty
+	file string   // file name segment, without .mp3
+}
+
+var defaultNameTemplate = mustParseFilenameTemplate(defaultFilenameTemplate)
+
+// nameTemplate is the template in force for this run. Set at startup from
+// gopodder.conf, like verbose.
+var nameTemplate = defaultNameTemplate
+
+func mustParseFilenameTemplate(s string) filenameTemplate {
+	t, err := parseFilenameTemplate(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// parseFilenameTemplate checks a template against the rules above.
+func parseFilenameTemplate(s string) (filenameTemplate, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "."+mp3)
+	if s == "" {
+		return filenameTemplate{}, fmt.Errorf("empty filename template")
+	}
+	if strings.ContainsAny(s, `'\`) {
+		return filenameTemplate{}, fmt.Errorf("filename template %q: quotes and backslashes are not allowed", s)
+	}
+	for _, m := range templateFieldRe.FindAllStringSubmatch(s, -1) {
+		if !templateFields[m[1]] {
+			return filenameTemplate{}, fmt.Errorf("filename template %q: unknown field {%s}", s, m[1])
+		}
+	}
+	if strings.ContainsAny(templateFieldRe.ReplaceAllString(s, ""), "{}") {
+		return filenameTemplate{}, fmt.Errorf("filename template %q: unbalanced braces", s)
+	}
+	segments := strings.Split(s, "/")
+	for _, seg := range segments {
+		// Dot dirs are skipped when scanning (the dedup trash lives in one)
+		if seg == "" || strings.HasPrefix(seg, ".") {
+			return filenameTemplate{}, fmt.Errorf("filename template %q: empty or dot-prefixed path segment", s)
+		}
+	}
+	if len(segments)-1 > maxTemplateDirs {
+		return filenameTemplate{}, fmt.Errorf("filename template %q: at most %d directory levels", s, maxTemplateDirs)
+	}
+	t := filenameTemplate{raw: s, dirs: segments[:len(segments)-1], file: segments[len(segments)-1]}
+	if strings.Count(s, "{hash}") != 1 || !strings.HasSuffix(t.file, "{title}-{hash}") {
+		return filenameTemplate{}, fmt.Errorf("filename template %q: the file name must end with {title}-{hash}", s)
+	}
+	if !strings.Contains(t.file, "{podcast}") || !strings.Contains(t.file, "{date}") {
+		return filenameTemplate{}, fmt.Errorf("filename template %q: the file name must contain {podcast} and {date}", s)
+	}
+	return t, nil
+}
+
+// nested reports whether the template puts files in subdirectories.
+func (t filenameTemplate) nested() bool { return len(t.dirs) > 0 }
+
+// episodeNaming is what a filename is made from. date is YYYY-MM-DD; season
+// and episode are the feed's itunes numbers, if any.
+type episodeNaming struct {
+	podcast, title, date, hash string
+	season, episode            string
+}
+
+// templateNumber renders a season or episode number two digits wide, "00"
+// when the feed gave none.
+func templateNumber(s string) string {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 {
+		return "00"
+	}
+	return fmt.Sprintf("%02d", n)
+}
+
+// render returns the slash-separated path, relative to a podcasts dir, that
+// the template gives n.
+func (t filenameTemplate) render(n episodeNaming) string {
+	date := n.date
+	year, month := "0000", "00"
+	if len(date) >= 7 {
+		year, month = date[:4], date[5:7]
+	}
+	values := map[string]string{
+		"podcast": titleTransformation(strings.TrimSpace(n.podcast)),
+		"title":   titleTransformation(strings.TrimSpace(n.title)),
+		"date":    date,
+		"year":    year,
+		"month":   month,
+		"season":  templateNumber(n.season),
+		"episode": templateNumber(n.episode),
+		"hash":    n.hash,
+	}
+	fill := func(seg string) string {
+		return templateFieldRe.ReplaceAllStringFunc(seg, func(f string) string {
+			return values[f[1:len(f)-1]]
+		})
+	}
+	parts := make([]string, 0, len(t.dirs)+1)
+	for _, d := range t.dirs {
+		// A title that transforms to nothing must not collapse the layout
+		if dir := fill(d); dir != "" {
+			parts = append(parts, dir)
+		} else {
+			parts = append(parts, "_")
+		}
+	}
+	parts = append(parts, fill(t.file)+"."+mp3)
+	return path.Join(parts...)
+}
+
+// relName trims a path down to the part the template lays out: the file
+// name plus as many directories as the template has.
+func (t filenameTemplate) relName(p string) string {
+	parts := strings.Split(filepath.ToSlash(strings.TrimSpace(p)), "/")
+	if keep := len(t.dirs) + 1; len(parts) > keep {
+		parts = parts[len(parts)-keep:]
+	}
+	return strings.Join(parts, "/")
+}
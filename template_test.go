@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setNameTemplate installs a filename template for one test.
+func setNameTemplate(t *testing.T, raw string) {
+	t.Helper()
+	tmpl, err := parseFilenameTemplate(raw)
+	if err != nil {
+		t.Fatalf("parseFilenameTemplate(%q): %v", raw, err)
+	}
+	old := nameTemplate
+	nameTemplate = tmpl
+	t.Cleanup(func() { nameTemplate = old })
+}
+
+func TestParseFilenameTemplate(t *testing.T) {
+	for _, ok := range []string{
+		defaultFilenameTemplate,
+		defaultFilenameTemplate + ".mp3",
+		"{podcast}/{year}/{podcast}-{date}-{title}-{hash}",
+		"{podcast}/S{season}/{podcast}-S{season}E{episode}-{date}-{title}-{hash}",
+	} {
+		if _, err := parseFilenameTemplate(ok); err != nil {
+			t.Errorf("parseFilenameTemplate(%q): %v", ok, err)
+		}
+	}
+	for _, bad := range []string{
+		"",
+		"{podcast}-{date}-{hash}-{title}",        // hash not last
+		"{podcast}-{date}-{title}",               // no hash
+		"{year}/{date}-{title}-{hash}",           // podcast only in a dir
+		"{podcast}/{title}-{hash}",               // no date in the file name
+		"{podcast}-{date}-{nope}-{title}-{hash}", // unknown field
+		"{podcast}-{date}-{title-{hash}",         // unbalanced
+		"{podcast}//{podcast}-{date}-{title}-{hash}",
+		".hidden/{podcast}-{date}-{title}-{hash}",
+		"a/b/c/d/{podcast}-{date}-{title}-{hash}",
+		"{podcast}'s-{date}-{title}-{hash}",
+	} {
+		if _, err := parseFilenameTemplate(bad); err == nil {
+			t.Errorf("parseFilenameTemplate(%q) should fail", bad)
+		}
+	}
+}
+
+// The default template names exactly as gopodder always has; nested ones
+// keep the hash and transformed title where the parsers look for them.
+func TestRenderFilenameTemplate(t *testing.T) {
+	n := episodeNaming{podcast: "In Our Time", title: "The Tudors", date: "2024-03-07", hash: "abc123", season: "2", episode: "7"}
+	if got, want := defaultNameTemplate.render(n), "In_Our_Time-2024-03-07-The_Tudors-abc123.mp3"; got != want {
+		t.Fatalf("default render = %q, want %q", got, want)
+	}
+
+	nested := mustParseFilenameTemplate("{podcast}/{year}/{podcast}-S{season}E{episode}-{date}-{title}-{hash}")
+	got := nested.render(n)
+	if want := "In_Our_Time/2024/In_Our_Time-S02E07-2024-03-07-The_Tudors-abc123.mp3"; got != want {
+		t.Fatalf("nested render = %q, want %q", got, want)
+	}
+	hash, tt, err := hashFromFilename(got)
+	if err != nil || hash != "abc123" || tt != "The_Tudors" {
+		t.Fatalf("hashFromFilename(%q) = %q, %q, %v", got, hash, tt, err)
+	}
+	if nmh, ok := nameMinusHash(got); !ok || nmh != "In_Our_Time-S02E07-2024-03-07-The_Tudors" {
+		t.Fatalf("nameMinusHash(%q) = %q, %v", got, nmh, ok)
+	}
+	if !isPodcastFileName(filepath.Base(got)) {
+		t.Fatalf("%q should be recognised as a podcast file", got)
+	}
+	if rel := nested.relName("/home/me/podcasts/" + got); rel != got {
+		t.Fatalf("relName = %q, want %q", rel, got)
+	}
+
+	// No season or episode number, and a title that transforms to nothing
+	bare := mustParseFilenameTemplate("{title}/{podcast}-E{episode}-{date}-{title}-{hash}")
+	if got, want := bare.render(episodeNaming{podcast: "Pod", title: "2024", date: "2024-01-01", hash: "h"}),
+		"_/Pod-E00-2024-01-01--h.mp3"; got != want {
+		t.Fatalf("bare render = %q, want %q", got, want)
+	}
+}
+
+func TestGenScriptLineMakesTemplateDirs(t *testing.T) {
+	flat := genScriptLine("https://x/a.mp3", "Pod-2024-01-01-Ep-h.mp3")
+	if strings.Contains(flat, "mkdir") {
+		t.Fatalf("flat layout needs no mkdir: %s", flat)
+	}
+	nested := genScriptLine("https://x/a.mp3", "Pod/2024/Pod-2024-01-01-Ep-h.mp3")
+	if !strings.HasPrefix(nested, "mkdir -p 'Pod/2024' && wget ") || !strings.Contains(nested, "-O 'Pod/2024/Pod-2024-01-01-Ep-h.mp3'") {
+		t.Fatalf("nested script line = %s", nested)
+	}
+}
+
+// With a nested template, files in template subdirectories are found, as
+// relative paths; the trash and anything deeper than a template can nest are
+// not.
+func TestArchiveCandidatesInDirRecurses(t *testing.T) {
+	setNameTemplate(t, "{podcast}/{year}/{podcast}-{date}-{title}-{hash}")
+	dir := t.TempDir()
+	files := map[string]bool{
+		"Pod-2024-01-01-Ep-aaa.mp3":                     true,
+		"Pod/2024/Pod-S01E02-2024-02-01-Ep-bbb.mp3":     true,
+		"Pod/2024/notes.txt":                            false,
+		trashDirName + "/run/Pod-2024-01-01-Ep-ccc.mp3": false,
+		"a/b/c/d/Pod-2024-01-01-Ep-ddd.mp3":             false,
+	}
+	for name := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("x"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := archiveCandidatesInDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]bool)
+	for _, name := range got {
+		found[name] = true
+	}
+	for name, want := range files {
+		if found[name] != want {
+			t.Errorf("%s: found = %v, want %v", name, found[name], want)
+		}
+	}
+	if len(got) != 2 {
+		t.Errorf("got %v, want the 2 podcast files", got)
+	}
+}
+
+// A flat layout never relaid out keeps ignoring subdirectories; once the db
+// shows a nested past, they are scanned whatever the current template.
+func TestArchiveCandidatesInDirFlat(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	dir := t.TempDir()
+	for _, name := range []string{"Pod-2024-01-01-Ep-aaa.mp3", "keep/Pod-2024-02-01-Ep-bbb.mp3"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("x"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scan := func() []string {
+		t.Helper()
+		got, err := archiveCandidatesInDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	if nested, err := st.libraryWasNested(); err != nil || nested {
+		t.Fatalf("fresh db nested = %v (%v)", nested, err)
+	}
+	if got := scan(); len(got) != 1 || got[0] != "Pod-2024-01-01-Ep-aaa.mp3" {
+		t.Fatalf("flat scan got %v", got)
+	}
+
+	if _, err := st.recordDownloadSeen("Pod/2024/Pod-2024-03-01-Ep-ccc.mp3", "ccc"); err != nil {
+		t.Fatal(err)
+	}
+	nested, err := st.libraryWasNested()
+	if err != nil || !nested {
+		t.Fatalf("nested download not noticed: %v (%v)", nested, err)
+	}
+	old := libraryNested
+	libraryNested = nested
+	t.Cleanup(func() { libraryNested = old })
+	if got := scan(); len(got) != 2 {
+		t.Fatalf("scan after a nested layout got %v", got)
+	}
+}
+
+// The download pass names new files with the feed's season and episode.
+func TestPlanDownloadsUsesTemplate(t *testing.T) {
+	setNameTemplate(t, "{podcast}/S{season}/{podcast}-E{episode}-{date}-{title}-{hash}")
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	hash := fmt.Sprintf("%x", md5.Sum([]byte("ShowPilot")))
+	if _, err := st.q.Exec(`INSERT INTO episodes (title, published, first_seen, last_seen, podcast_title,
+		podcastname_episodename_hash, file, season, episode) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		"Pilot", "2024-05-01T00:00:00Z", ts, ts, "Show", hash, "https://x/p.mp3", "3", 1); err != nil {
+		t.Fatal(err)
+	}
+	plan := planDownloads(st, []string{t.TempDir()})
+	if len(plan.queued) != 1 {
+		t.Fatalf("queued %+v, want one episode", plan.queued)
+	}
+	if want := "Show/S03/Show-E01-2024-05-01-Pilot-" + hash + ".mp3"; plan.queued[0].filename != want {
+		t.Fatalf("queued as %q, want %q", plan.queued[0].filename, want)
+	}
+}
@@ -0,0 +1,581 @@
+package main
+
+// Trash and undo for the destructive dedup passes.
+//
+// A -delete dedup pass (and --prune-stale-episodes-delete) is a "dedup run"
+// with a run id. Files it would have deleted are moved into
+// <scan dir>/.gopodder-trash/<run id>/ instead — the same volume, so the move
+// is a rename — and every file move and every downloads, archived_episodes,
+// episodes and download_overrides row it deletes or inserts is written to
+// dedup_journal in the pass's own transaction. Deleted rows are journalled as SQL literals
+// (quote()), so they restore byte for byte.
+//
+// --undo-dedup <run id> replays the journal backwards: files move back and
+// rows are restored. --purge-trash removes trash run dirs older than
+// --older-than to reclaim the space; a purged run can no longer be undone.
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	trashDirName     = ".gopodder-trash"
+	dedupRunIDLayout = "20060102-150405"
+
+	// defaultTrashAge is --older-than's default.
+	defaultTrashAge = "30d"
+)
+
+// dedup_journal ops
+const (
+	journalMove      = "move"       // file moved from path to new_path
+	journalDeleteRow = "delete_row" // row deleted; row_json holds its values
+	journalInsertRow = "insert_row" // row inserted under key
+)
+
+// journalTables are the tables a dedup run may change, with their key
+// column. Undo only touches these.
+var journalTables = map[string]string{
+	"downloads":          "filename",
+	"archived_episodes":  "podcastname_episodename_hash",
+	"episodes":           "podcastname_episodename_hash",
+	"download_overrides": "podcastname_episodename_hash",
+}
+
+// renameFile is os.Rename; tests swap it to see moves across volumes.
+var renameFile = os.Rename
+
+// moveFile renames from to to, or, when they are on different volumes (an
+// archive dir on another disk), copies it, syncs the copy and removes from.
+func moveFile(from, to string) error {
+	err := renameFile(from, to)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if _, err := os.Stat(to); err == nil {
+		return fmt.Errorf("%s already exists", to)
+	}
+	if err := copyFileSynced(from, to); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+// copyFileSynced copies from to to through a temp file in to's dir, synced
+// before it takes the name, keeping from's mode and mtime.
+func copyFileSynced(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.CreateTemp(filepath.Dir(to), "."+filepath.Base(to)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := out.Name()
+	defer os.Remove(tmp) // a no-op once renamed
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, to)
+}
+
+// fileMoves remembers moves so they can be put back if the transaction
+// they belong to fails.
+type fileMoves [][2]string
+
+func (m *fileMoves) move(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	if err := moveFile(from, to); err != nil {
+		return err
+	}
+	*m = append(*m, [2]string{from, to})
+	return nil
+}
+
+// revert undoes the moves, newest first; failures are logged, not returned,
+// since the caller is already handling an error.
+func (m fileMoves) revert() {
+	for i := len(m) - 1; i >= 0; i-- {
+		if err := moveFile(m[i][1], m[i][0]); err != nil {
+			log.Printf("could not move %s back to %s: %v", m[i][1], m[i][0], err)
+		}
+	}
+}
+
+// dedupJournal records one dedup run's changes inside its transaction.
+type dedupJournal struct {
+	tx        *store
+	runID     string
+	seq       int
+	moves     fileMoves
+	committed bool
+}
+
+// newDedupJournal starts a run for command in tx. Run ids are the start time,
+// suffixed if two runs start in the same second.
+func newDedupJournal(tx *store, command string, now time.Time) (*dedupJournal, error) {
+	base := now.Format(dedupRunIDLayout)
+	runID := base
+	for i := 2; ; i++ {
+		var n int
+		if err := tx.q.QueryRow(`SELECT count(*) FROM dedup_runs WHERE run_id = ?;`, runID).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		runID = fmt.Sprintf("%s-%d", base, i)
+	}
+	if _, err := tx.q.Exec(`INSERT INTO dedup_runs (run_id, command, started) VALUES (?, ?, ?);`,
+		runID, command, ts); err != nil {
+		return nil, err
+	}
+	return &dedupJournal{tx: tx, runID: runID}, nil
+}
+
+// trashPath is where f goes in this run's trash.
+func (j *dedupJournal) trashPath(f dedupFile) string {
+	return filepath.Join(f.dir, trashDirName, j.runID, f.name)
+}
+
+// trash moves f into this run's trash dir.
+func (j *dedupJournal) trash(f dedupFile) error {
+	return j.move(f.path, j.trashPath(f))
+}
+
+// move renames a file and journals it.
+func (j *dedupJournal) move(from, to string) error {
+	if err := j.moves.move(from, to); err != nil {
+		return err
+	}
+	return j.record(journalMove, from, to, "", "", "")
+}
+
+// saveRows journals every row of table under key, ahead of deleting them.
+func (j *dedupJournal) saveRows(table, key string) error {
+	rows, err := j.tx.rowLiterals(table, key)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		b, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if err := j.record(journalDeleteRow, "", "", table, key, string(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replacingRow journals an upsert of table under key: any row it overwrites,
+// then the insert.
+func (j *dedupJournal) replacingRow(table, key string) error {
+	if err := j.saveRows(table, key); err != nil {
+		return err
+	}
+	return j.record(journalInsertRow, "", "", table, key, "")
+}
+
+func (j *dedupJournal) record(op, path, newPath, table, key, row string) error {
+	j.seq++
+	_, err := j.tx.q.Exec(`
+		INSERT INTO dedup_journal (run_id, seq, op, path, new_path, table_name, row_key, row_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		;`, j.runID, j.seq, op, nullWrap(path), nullWrap(newPath), nullWrap(table), nullWrap(key), nullWrap(row))
+	return err
+}
+
+// done marks the transaction committed; until then, close puts the files
+// back.
+func (j *dedupJournal) done() { j.committed = true }
+
+func (j *dedupJournal) close() {
+	if !j.committed {
+		j.moves.revert()
+	}
+}
+
+// rowLiterals reads the rows of table under key as column -> SQL literal.
+func (s *store) rowLiterals(table, key string) ([]map[string]string, error) {
+	keyCol, ok := journalTables[table]
+	if !ok {
+		return nil, fmt.Errorf("table %s is not journalled", table)
+	}
+	cols, err := s.tableColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	exprs := make([]string, len(cols))
+	for i, c := range cols {
+		exprs[i] = "quote(" + c + ")"
+	}
+	rows, err := s.q.Query(fmt.Sprintf(`SELECT %s FROM %s WHERE %s = ?;`,
+		strings.Join(exprs, ", "), table, keyCol), key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]map[string]string, 0, 1)
+	for rows.Next() {
+		vals := make([]string, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]string, len(cols))
+		for i, c := range cols {
+			row[c] = vals[i]
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// tableColumns lists a table's column names.
+func (s *store) tableColumns(table string) ([]string, error) {
+	rows, err := s.q.Query(`SELECT name FROM pragma_table_info(?);`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		out = append(out, name)
+	}
+	return out, rows.Err()
+}
+
+// restoreRow re-inserts a journalled row. Columns dropped since are ignored.
+func (s *store) restoreRow(table string, row map[string]string) error {
+	if _, ok := journalTables[table]; !ok {
+		return fmt.Errorf("table %s is not journalled", table)
+	}
+	cols, err := s.tableColumns(table)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(cols))
+	literals := make([]string, 0, len(cols))
+	for _, c := range cols {
+		if v, ok := row[c]; ok {
+			names = append(names, c)
+			literals = append(literals, v)
+		}
+	}
+	if _, err := s.q.Exec(fmt.Sprintf(`INSERT OR REPLACE INTO %s (%s) VALUES (%s);`,
+		table, strings.Join(names, ", "), strings.Join(literals, ", "))); err != nil {
+		return err
+	}
+	if table != "episodes" {
+		return nil
+	}
+	// Restored episodes go back into the search index
+	var h, podcastTitle, title, desc, author string
+	err = s.q.QueryRow(`SELECT podcastname_episodename_hash, IFNULL(podcast_title, ''), IFNULL(title, ''),
+		IFNULL(description, ''), IFNULL(author, '') FROM episodes WHERE rowid = last_insert_rowid();`).
+		Scan(&h, &podcastTitle, &title, &desc, &author)
+	if err != nil {
+		return err
+	}
+	if err := s.unindexEpisodeForSearch(h); err != nil {
+		return err
+	}
+	return s.indexEpisodeForSearch(h, podcastTitle, title, desc, author)
+}
+
+// deleteJournalledRow removes the row a run inserted.
+func (s *store) deleteJournalledRow(table, key string) error {
+	keyCol, ok := journalTables[table]
+	if !ok {
+		return fmt.Errorf("table %s is not journalled", table)
+	}
+	_, err := s.q.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s = ?;`, table, keyCol), key)
+	return err
+}
+
+// dedupRun is a dedup_runs row.
+type dedupRun struct {
+	runID, command, started, undone, purged string
+}
+
+func (s *store) dedupRun(runID string) (dedupRun, bool, error) {
+	var r dedupRun
+	err := s.q.QueryRow(`
+		SELECT run_id, command, started, IFNULL(undone, ''), IFNULL(purged, '')
+		FROM dedup_runs WHERE run_id = ?
+		;`, runID).Scan(&r.runID, &r.command, &r.started, &r.undone, &r.purged)
+	if err == sql.ErrNoRows {
+		return r, false, nil
+	}
+	return r, err == nil, err
+}
+
+// journalEntry is a dedup_journal row.
+type journalEntry struct {
+	op, path, newPath, table, key, row string
+}
+
+// journalEntries lists a run's journal newest first, the order undo needs.
+func (s *store) journalEntries(runID string) ([]journalEntry, error) {
+	rows, err := s.q.Query(`
+		SELECT op, IFNULL(path, ''), IFNULL(new_path, ''), IFNULL(table_name, ''),
+			IFNULL(row_key, ''), IFNULL(row_json, '')
+		FROM dedup_journal WHERE run_id = ?
+		ORDER BY seq DESC
+		;`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]journalEntry, 0)
+	for rows.Next() {
+		var e journalEntry
+		if err := rows.Scan(&e.op, &e.path, &e.newPath, &e.table, &e.key, &e.row); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// undoResult counts what --undo-dedup put back.
+type undoResult struct {
+	files, rows int
+}
+
+// undoDedupRun restores a run's files and rows. Every file must still be
+// where the run left it, and its original path free, before anything moves.
+func undoDedupRun(s *store, runID string) (undoResult, error) {
+	var res undoResult
+	run, ok, err := s.dedupRun(runID)
+	if err != nil {
+		return res, err
+	}
+	switch {
+	case !ok:
+		return res, fmt.Errorf("no dedup run %s", runID)
+	case run.undone != "":
+		return res, fmt.Errorf("dedup run %s was already undone at %s", runID, run.undone)
+	case run.purged != "":
+		return res, fmt.Errorf("dedup run %s's trash was purged at %s; it cannot be undone", runID, run.purged)
+	}
+	entries, err := s.journalEntries(runID)
+	if err != nil {
+		return res, err
+	}
+
+	problems := make([]string, 0)
+	for _, e := range entries {
+		if e.op != journalMove {
+			continue
+		}
+		if _, err := os.Stat(e.newPath); err != nil {
+			problems = append(problems, "missing "+e.newPath)
+		}
+		if _, err := os.Stat(e.path); err == nil {
+			problems = append(problems, "in the way: "+e.path)
+		}
+	}
+	if len(problems) > 0 {
+		return res, fmt.Errorf("cannot undo dedup run %s: %s", runID, strings.Join(problems, "; "))
+	}
+
+	var moves fileMoves
+	committed := false
+	defer func() {
+		if !committed {
+			moves.revert()
+		}
+	}()
+	err = s.inTx(func(tx *store) error {
+		for _, e := range entries {
+			switch e.op {
+			case journalMove:
+				if err := moves.move(e.newPath, e.path); err != nil {
+					return err
+				}
+				res.files++
+			case journalDeleteRow:
+				row := make(map[string]string)
+				if err := json.Unmarshal([]byte(e.row), &row); err != nil {
+					return fmt.Errorf("journal row for %s %s: %w", e.table, e.key, err)
+				}
+				if err := tx.restoreRow(e.table, row); err != nil {
+					return err
+				}
+				res.rows++
+			case journalInsertRow:
+				if err := tx.deleteJournalledRow(e.table, e.key); err != nil {
+					return err
+				}
+				res.rows++
+			}
+		}
+		_, err := tx.q.Exec(`UPDATE dedup_runs SET undone = ? WHERE run_id = ?;`, ts, runID)
+		return err
+	})
+	if err != nil {
+		return res, err
+	}
+	committed = true
+
+	// Tidy the now-empty trash (and relayout) dirs
+	for _, m := range moves {
+		pruneEmptyDirs(filepath.Dir(m[0]), commonDir(m[0], m[1]))
+	}
+	return res, nil
+}
+
+// pruneEmptyDirs removes dir and its parents while they are empty, stopping
+// at (and never removing) stop.
+func pruneEmptyDirs(dir, stop string) {
+	dir, err1 := filepath.Abs(dir)
+	stop, err2 := filepath.Abs(stop)
+	if err1 != nil || err2 != nil {
+		return
+	}
+	for d := dir; strings.HasPrefix(d, stop+string(filepath.Separator)); d = filepath.Dir(d) {
+		if os.Remove(d) != nil {
+			return
+		}
+	}
+}
+
+// commonDir is the deepest directory holding both paths.
+func commonDir(a, b string) string {
+	a, _ = filepath.Abs(a)
+	b, _ = filepath.Abs(b)
+	pa := strings.Split(a, string(filepath.Separator))
+	pb := strings.Split(b, string(filepath.Separator))
+	n := 0
+	for n < len(pa)-1 && n < len(pb)-1 && pa[n] == pb[n] {
+		n++
+	}
+	d := strings.Join(pa[:n], string(filepath.Separator))
+	if d == "" {
+		return string(filepath.Separator)
+	}
+	return d
+}
+
+// parseTrashAge parses --older-than: a Go duration, or whole days as "30d".
+func parseTrashAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("bad age %q (want e.g. 30d or 12h)", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("bad age %q (want e.g. 30d or 12h)", s)
+	}
+	return d, nil
+}
+
+// purgeResult counts what --purge-trash reclaimed.
+type purgeResult struct {
+	runs  int
+	files int
+	bytes int64
+}
+
+// purgeTrash deletes trash run dirs older than olderThan on every scan path,
+// judging age by the run id, and marks those runs purged.
+func purgeTrash(s *store, scanPaths []string, olderThan time.Duration, now time.Time) (purgeResult, error) {
+	var res purgeResult
+	purged := make(map[string]bool)
+	for _, dir := range scanPaths {
+		trashDir := filepath.Join(dir, trashDirName)
+		entries, err := os.ReadDir(trashDir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() || len(e.Name()) < len(dedupRunIDLayout) {
+				continue
+			}
+			started, err := time.ParseInLocation(dedupRunIDLayout, e.Name()[:len(dedupRunIDLayout)], now.Location())
+			if err != nil || now.Sub(started) <= olderThan {
+				continue
+			}
+			runDir := filepath.Join(trashDir, e.Name())
+			// A nested filename template leaves subdirectories in the run dir
+			nFiles := 0
+			err = filepath.WalkDir(runDir, func(_ string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				if info, err := d.Info(); err == nil {
+					res.bytes += info.Size()
+				}
+				nFiles++
+				return nil
+			})
+			if err != nil {
+				return res, err
+			}
+			res.files += nFiles
+			if err := os.RemoveAll(runDir); err != nil {
+				return res, err
+			}
+			log.Printf("purged %s (%d file(s))", runDir, nFiles)
+			purged[e.Name()] = true
+		}
+		os.Remove(trashDir) // only if now empty
+	}
+	for runID := range purged {
+		if _, err := s.q.Exec(`UPDATE dedup_runs SET purged = ? WHERE run_id = ? AND purged IS NULL;`, ts, runID); err != nil {
+			return res, err
+		}
+	}
+	res.runs = len(purged)
+	return res, nil
+}
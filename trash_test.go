@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// latestDedupRun is the id of the most recent dedup run.
+func latestDedupRun(t *testing.T, st *store) string {
+	t.Helper()
+	var runID string
+	if err := st.q.QueryRow(`SELECT run_id FROM dedup_runs ORDER BY started DESC, run_id DESC LIMIT 1;`).Scan(&runID); err != nil {
+		t.Fatalf("no dedup run recorded: %v", err)
+	}
+	return runID
+}
+
+// A -delete pass trashes rather than deletes, and --undo-dedup puts the files
+// and the downloads and archived_episodes rows back exactly.
+func TestDedupTrashAndUndo(t *testing.T) {
+	tmpDir := useTempWorkingDir(t)
+	st := openTestStore(t)
+	archDir := t.TempDir()
+
+	podcast, title := "Pat Show", "Secret Episode"
+	epHash := fmt.Sprintf("%x", md5.Sum([]byte(podcast+title)))
+	legacyHash := strings.Repeat("9", 32)
+	stubName := buildEpisodeFilenameWithHash(podcast, title, "2020-01-01", epHash)
+	legacyName := buildEpisodeFilenameWithHash(podcast, title, "2020-01-01", legacyHash)
+	if err := os.WriteFile(filepath.Join(tmpDir, stubName), []byte("errorpage"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(archDir, legacyName), make([]byte, 2000000), 0666); err != nil {
+		t.Fatal(err)
+	}
+	nowStr := time.Now().Format(time.RFC3339)
+	if _, err := st.q.Exec(`INSERT INTO episodes (title, published, first_seen, last_seen, podcast_title,
+		podcastname_episodename_hash, file_url_hash, file) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`,
+		title, "2020-01-01T00:00:00Z", nowStr, nowStr, podcast, epHash, "cafe"+strings.Repeat("0", 28), "https://x/cur.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.q.Exec(`INSERT INTO downloads (filename, hash, first_seen, last_seen, tagged_at)
+		VALUES (?, ?, ?, ?, NULL), (?, ?, ?, ?, 'tagged');`,
+		stubName, epHash, nowStr, nowStr, legacyName, legacyHash, nowStr, nowStr); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.upsertArchived(legacyHash, filepath.Join(archDir, legacyName)); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := func() string {
+		t.Helper()
+		var out []string
+		for _, q := range []string{
+			`SELECT filename || '|' || hash || '|' || IFNULL(tagged_at, 'NULL') FROM downloads ORDER BY filename;`,
+			`SELECT podcastname_episodename_hash || '|' || archived_path FROM archived_episodes ORDER BY 1;`,
+		} {
+			rows, err := st.q.Query(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for rows.Next() {
+				var s string
+				rows.Scan(&s)
+				out = append(out, s)
+			}
+			rows.Close()
+		}
+		return strings.Join(out, "\n")
+	}
+	before := snapshot()
+
+	if err := runDedupTwins(st, []string{tmpDir, archDir}, true); err != nil {
+		t.Fatalf("runDedupTwins: %v", err)
+	}
+	runID := latestDedupRun(t, st)
+	if _, err := os.Stat(filepath.Join(tmpDir, trashDirName, runID, stubName)); err != nil {
+		t.Fatalf("expected the stub in the trash: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(archDir, stubName)); err != nil {
+		t.Fatalf("expected the keeper renamed: %v", err)
+	}
+	if snapshot() == before {
+		t.Fatal("expected the apply to change the downloads and archive rows")
+	}
+
+	res, err := undoDedupRun(st, runID)
+	if err != nil {
+		t.Fatalf("undoDedupRun: %v", err)
+	}
+	if res.files != 2 {
+		t.Fatalf("restored %d files, want 2", res.files)
+	}
+	for _, p := range []string{filepath.Join(tmpDir, stubName), filepath.Join(archDir, legacyName)} {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("expected %s restored: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, trashDirName)); !os.IsNotExist(err) {
+		t.Fatalf("expected the empty trash dir tidied away, err=%v", err)
+	}
+	if after := snapshot(); after != before {
+		t.Fatalf("rows after undo:\n%s\nwant:\n%s", after, before)
+	}
+	if _, err := undoDedupRun(st, runID); err == nil {
+		t.Fatal("expected undoing twice to fail")
+	}
+}
+
+func TestUndoPruneRestoresEpisodeRows(t *testing.T) {
+	st := searchTestStore(t)
+	tmpDir := t.TempDir()
+	old := time.Now().Add(-2 * dedupLivenessWindow).Format(time.RFC3339)
+	if _, err := st.q.Exec(`UPDATE episodes SET last_seen = ?;`, old); err != nil {
+		t.Fatal(err)
+	}
+	var before int
+	st.q.QueryRow(`SELECT count(*) FROM episodes;`).Scan(&before)
+
+	if err := pruneStaleEpisodes(st, []string{tmpDir}, true); err != nil {
+		t.Fatalf("pruneStaleEpisodes: %v", err)
+	}
+	var n int
+	st.q.QueryRow(`SELECT count(*) FROM episodes;`).Scan(&n)
+	if n == before {
+		t.Fatal("expected the prune to remove rows")
+	}
+	if _, err := undoDedupRun(st, latestDedupRun(t, st)); err != nil {
+		t.Fatalf("undoDedupRun: %v", err)
+	}
+	st.q.QueryRow(`SELECT count(*) FROM episodes;`).Scan(&n)
+	if n != before {
+		t.Fatalf("episodes after undo = %d, want %d", n, before)
+	}
+	results, err := st.searchEpisodes("Tudor", 10)
+	if err != nil || len(results) == 0 {
+		t.Fatalf("restored episodes should be searchable again: %v %v", results, err)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	tmpDir := useTempWorkingDir(t)
+	st := openTestStore(t)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+
+	oldRun, newRun := "20260901-120000", "20261017-120000"
+	for _, runID := range []string{oldRun, newRun} {
+		dir := filepath.Join(tmpDir, trashDirName, runID)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "a.mp3"), make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.q.Exec(`INSERT INTO dedup_runs (run_id, command, started) VALUES (?, 'dedup-twins', ?);`, runID, ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	age, err := parseTrashAge("30d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := purgeTrash(st, []string{tmpDir}, age, now)
+	if err != nil {
+		t.Fatalf("purgeTrash: %v", err)
+	}
+	if res.runs != 1 || res.files != 1 || res.bytes != 100 {
+		t.Fatalf("purge = %+v, want 1 run, 1 file, 100 bytes", res)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, trashDirName, oldRun)); !os.IsNotExist(err) {
+		t.Fatalf("expected the old run purged, err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, trashDirName, newRun)); err != nil {
+		t.Fatalf("expected the recent run kept: %v", err)
+	}
+	if _, err := undoDedupRun(st, oldRun); err == nil || !strings.Contains(err.Error(), "purged") {
+		t.Fatalf("undo of a purged run should say so, got %v", err)
+	}
+
+	for _, bad := range []string{"", "x", "-3d", "3days"} {
+		if _, err := parseTrashAge(bad); err == nil {
+			t.Errorf("parseTrashAge(%q) should fail", bad)
+		}
+	}
+}
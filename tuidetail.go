@@ -0,0 +1,263 @@
+package main
+
+// The `i` detail pane under the interactive episode list: the cursor
+// episode's description, duration, size and guid, and everything gopodder
+// has recorded about it (downloads, archive registration, skip and
+// override verdicts). Details load from the db the first time the cursor
+// lands on an episode and are cached for the rest of the list.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// detailPaneHeight is how many lines the list gives up to the pane.
+const detailPaneHeight = 14
+
+// detailDescLines caps the description shown in the pane.
+const detailDescLines = 5
+
+// episodeDetail is what the pane shows beyond the list row.
+type episodeDetail struct {
+	guid         string
+	published    string
+	duration     string // as the feed gives it (seconds, MM:SS or H:MM:SS)
+	fileSize     string // enclosure length in bytes, as the feed gives it
+	downloads    []downloadRecord
+	archivedPath string
+	archivedAt   string
+	skipReason   string
+	skipMatched  string // title of the episode the skip matched
+	override     string // download_overrides action
+}
+
+// downloadRecord is one downloads row.
+type downloadRecord struct {
+	filename  string
+	firstSeen string
+	taggedAt  string
+}
+
+type episodeDetailMsg struct {
+	hash   string
+	detail episodeDetail
+	err    error
+}
+
+// loadEpisodeDetail gathers the detail pane for one episode hash. The feed
+// metadata comes from episodes, or interactive_episodes for a podcast only
+// ever opened in the TUI.
+func (s *store) loadEpisodeDetail(hash string) (episodeDetail, error) {
+	var d episodeDetail
+	err := s.q.QueryRow(`
+		SELECT IFNULL(guid, ''), IFNULL(published, ''), IFNULL(duration, ''), IFNULL(file_size, '')
+		FROM (
+			SELECT guid, published, duration, file_size, 0 AS pref
+			FROM episodes WHERE podcastname_episodename_hash = ?
+			UNION ALL
+			SELECT guid, published, duration, file_size, 1 AS pref
+			FROM interactive_episodes WHERE podcastname_episodename_hash = ?
+		)
+		ORDER BY pref
+		LIMIT 1
+		;`, hash, hash).Scan(&d.guid, &d.published, &d.duration, &d.fileSize)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return d, err
+	}
+
+	rows, err := s.q.Query(`SELECT filename, first_seen, IFNULL(tagged_at, '') FROM downloads WHERE hash = ? ORDER BY first_seen, filename;`, hash)
+	if err != nil {
+		return d, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r downloadRecord
+		if err := rows.Scan(&r.filename, &r.firstSeen, &r.taggedAt); err != nil {
+			return d, err
+		}
+		d.downloads = append(d.downloads, r)
+	}
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+
+	for _, q := range []struct {
+		query string
+		dest  []interface{}
+	}{
+		{`SELECT IFNULL(archived_path, ''), archived_at FROM archived_episodes WHERE podcastname_episodename_hash = ?;`,
+			[]interface{}{&d.archivedPath, &d.archivedAt}},
+		{`SELECT IFNULL(reason, ''), IFNULL(matched_title, '') FROM skipped_episodes WHERE podcastname_episodename_hash = ?;`,
+			[]interface{}{&d.skipReason, &d.skipMatched}},
+		{`SELECT action FROM download_overrides WHERE podcastname_episodename_hash = ?;`,
+			[]interface{}{&d.override}},
+	} {
+		if err := s.q.QueryRow(q.query, hash).Scan(q.dest...); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return d, err
+		}
+	}
+	return d, nil
+}
+
+func loadEpisodeDetailCmd(s *store, hash string) tea.Cmd {
+	return func() tea.Msg {
+		d, err := s.loadEpisodeDetail(hash)
+		return episodeDetailMsg{hash: hash, detail: d, err: err}
+	}
+}
+
+// detailCmd loads the cursor episode's details if the pane is open and
+// they aren't cached yet.
+func (m interactiveModel) detailCmd() tea.Cmd {
+	if m.step != stepSelect || !m.showDetail || m.store == nil || m.cursor >= len(m.items) {
+		return nil
+	}
+	hash := m.items[m.cursor].hash
+	if hash == "" {
+		return nil
+	}
+	if _, ok := m.details[hash]; ok {
+		return nil
+	}
+	return loadEpisodeDetailCmd(m.store, hash)
+}
+
+// viewDetail renders the pane for item.
+func (m interactiveModel) viewDetail(item episodeItem) string {
+	width := m.width
+	if width <= 0 {
+		width = 80
+	}
+	var b strings.Builder
+	b.WriteString(strings.Repeat("─", width))
+	b.WriteString("\n")
+	b.WriteString(item.title)
+	b.WriteString("\n")
+
+	d, loaded := m.details[item.hash]
+	published := item.dateStr
+	if loaded && d.published != "" {
+		published = d.published
+	}
+	status := item.status
+	if status == "" {
+		status = "not in the db yet"
+	}
+	facts := []string{"Published " + published}
+	if loaded {
+		if dur := formatEpisodeDuration(d.duration); dur != "" {
+			facts = append(facts, "Duration "+dur)
+		}
+		if size := formatEpisodeSize(d.fileSize); size != "" {
+			facts = append(facts, "Size "+size)
+		}
+	}
+	facts = append(facts, "Status "+status)
+	b.WriteString(strings.Join(facts, "  "))
+	b.WriteString("\n")
+
+	switch {
+	case item.hash == "":
+	case !loaded:
+		b.WriteString("Loading…\n")
+	default:
+		if d.guid != "" {
+			b.WriteString("GUID: " + d.guid + "\n")
+		}
+		for _, r := range d.downloads {
+			line := fmt.Sprintf("Downloaded: %s (%s", r.filename, shortDate(r.firstSeen))
+			if r.taggedAt != "" {
+				line += ", tagged " + shortDate(r.taggedAt)
+			}
+			b.WriteString(line + ")\n")
+		}
+		if d.archivedAt != "" {
+			b.WriteString(fmt.Sprintf("Archived: %s (%s)\n", d.archivedPath, shortDate(d.archivedAt)))
+		}
+		if d.skipReason != "" {
+			b.WriteString("Skipped: " + d.skipReason + "\n")
+			if d.skipMatched != "" {
+				b.WriteString("  matched: " + d.skipMatched + "\n")
+			}
+		}
+		if d.override != "" {
+			b.WriteString("Override: " + d.override + "\n")
+		}
+	}
+
+	desc := item.description
+	if desc == "" {
+		desc = "(no description)"
+	}
+	lines := wrapText(desc, width)
+	if len(lines) > detailDescLines {
+		lines = lines[:detailDescLines]
+		lines[detailDescLines-1] += " …"
+	}
+	b.WriteString(strings.Join(lines, "\n"))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// formatEpisodeDuration normalises an itunes:duration (seconds, MM:SS or
+// H:MM:SS) to M:SS or H:MM:SS. Anything else is shown as given; "" and
+// zero are unknown.
+func formatEpisodeDuration(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	secs := 0
+	for _, part := range strings.Split(raw, ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return raw
+		}
+		secs = secs*60 + int(n)
+	}
+	if secs == 0 {
+		return ""
+	}
+	h, mins, s := secs/3600, secs/60%60, secs%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, mins, s)
+	}
+	return fmt.Sprintf("%d:%02d", mins, s)
+}
+
+// formatEpisodeSize shows an enclosure length in MB. Feeds often put 0 or
+// junk there; that is unknown.
+func formatEpisodeSize(raw string) string {
+	n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	if err != nil || n <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/1e6)
+}
+
+// wrapText breaks s into lines of at most width runes at spaces; a word
+// longer than width gets a line of its own.
+func wrapText(s string, width int) []string {
+	var lines []string
+	var line []rune
+	for _, word := range strings.Fields(s) {
+		w := []rune(word)
+		if len(line) > 0 && len(line)+1+len(w) > width {
+			lines = append(lines, string(line))
+			line = nil
+		}
+		if len(line) > 0 {
+			line = append(line, ' ')
+		}
+		line = append(line, w...)
+	}
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestFormatEpisodeDuration(t *testing.T) {
+	for raw, want := range map[string]string{
+		"":         "",
+		"0":        "",
+		"3492":     "58:12",
+		"58:12":    "58:12",
+		"1:02:03":  "1:02:03",
+		"01:02:03": "1:02:03",
+		"125.5":    "2:05",
+		"about 1h": "about 1h",
+	} {
+		if got := formatEpisodeDuration(raw); got != want {
+			t.Errorf("formatEpisodeDuration(%q) = %q, want %q", raw, got, want)
+		}
+	}
+	for raw, want := range map[string]string{"": "", "0": "", "junk": "", "52428800": "52.4 MB"} {
+		if got := formatEpisodeSize(raw); got != want {
+			t.Errorf("formatEpisodeSize(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	got := wrapText("the quick  brown fox jumps over\nthe lazy dog supercalifragilistic", 10)
+	want := []string{"the quick", "brown fox", "jumps over", "the lazy", "dog", "supercalifragilistic"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("wrapText = %q, want %q", got, want)
+	}
+}
+
+// The pane shows everything recorded about an episode, loaded on demand
+// when the cursor reaches it.
+func TestEpisodeDetailPane(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	for _, stmt := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{`INSERT INTO episodes (title, published, first_seen, last_seen, podcast_title, podcastname_episodename_hash,
+			file, guid, duration, file_size) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+			[]interface{}{"Kept", "2024-03-07T10:00:00Z", ts, ts, "Pod", "hash-kept", "https://x/k.mp3", "guid-1", "3492", "52428800"}},
+		{`INSERT INTO downloads (filename, hash, first_seen, last_seen, tagged_at) VALUES (?, ?, ?, ?, ?);`,
+			[]interface{}{"Pod-2024-03-07-Kept-hash-kept.mp3", "hash-kept", "2024-03-08T00:00:00Z", ts, "2024-03-09T00:00:00Z"}},
+		{`INSERT INTO archived_episodes (podcastname_episodename_hash, archived_path, archived_at) VALUES (?, ?, ?);`,
+			[]interface{}{"hash-kept", "/archive/Pod-2024-03-07-Kept-hash-kept.mp3", "2024-06-01T00:00:00Z"}},
+		{`INSERT INTO skipped_episodes (podcastname_episodename_hash, podcast_title, title, matched_episode_hash, matched_title,
+			reason, first_skipped, last_skipped) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`,
+			[]interface{}{"hash-skip", "Pod", "Kept (repeat)", "hash-kept", "Kept", "repeat: identical title as downloaded episode hash-kept", ts, ts}},
+		{`INSERT INTO download_overrides (podcastname_episodename_hash, action, created) VALUES (?, ?, ?);`,
+			[]interface{}{"hash-skip", overrideNever, ts}},
+	} {
+		if _, err := st.q.Exec(stmt.query, stmt.args...); err != nil {
+			t.Fatalf("%s: %v", stmt.query, err)
+		}
+	}
+
+	m := newInteractiveModel(st, t.TempDir(), "", "")
+	m.step = stepSelect
+	m.allItems = []episodeItem{
+		{title: "Kept", dateStr: "2024-03-07", filename: "k.mp3", hash: "hash-kept", status: statusDownloaded,
+			description: "A long description that the pane wraps."},
+		{title: "Kept (repeat)", dateStr: "2024-03-07", filename: "r.mp3", hash: "hash-skip", status: statusSkipped},
+	}
+	m.rebuildVisibleItems()
+
+	// run feeds a key through Update and delivers the detail load it asks for
+	run := func(msg tea.Msg) string {
+		t.Helper()
+		next, cmd := m.Update(msg)
+		m = next.(interactiveModel)
+		if cmd != nil {
+			if dm, ok := cmd().(episodeDetailMsg); ok {
+				next, _ = m.Update(dm)
+				m = next.(interactiveModel)
+			}
+		}
+		return m.View()
+	}
+
+	if strings.Contains(m.View(), "GUID") {
+		t.Fatalf("pane should start closed")
+	}
+	view := run(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("i")})
+	for _, want := range []string{
+		"Published 2024-03-07T10:00:00Z  Duration 58:12  Size 52.4 MB  Status downloaded",
+		"GUID: guid-1",
+		"Downloaded: Pod-2024-03-07-Kept-hash-kept.mp3 (2024-03-08, tagged 2024-03-09)",
+		"Archived: /archive/Pod-2024-03-07-Kept-hash-kept.mp3 (2024-06-01)",
+		"A long description that the pane wraps.",
+	} {
+		if !strings.Contains(view, want) {
+			t.Errorf("pane missing %q:\n%s", want, view)
+		}
+	}
+
+	view = run(tea.KeyMsg{Type: tea.KeyDown})
+	for _, want := range []string{
+		"Skipped: repeat: identical title as downloaded episode hash-kept",
+		"matched: Kept",
+		"Override: never",
+		"(no description)",
+	} {
+		if !strings.Contains(view, want) {
+			t.Errorf("pane missing %q:\n%s", want, view)
+		}
+	}
+	if len(m.details) != 2 {
+		t.Fatalf("cached %d details, want 2", len(m.details))
+	}
+}
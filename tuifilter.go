@@ -0,0 +1,137 @@
+package main
+
+// The `/` filter on the interactive episode list. A filter is a line of
+// words and field tokens:
+//
+//	tudors since:2020-01-01 until:2023-12-31 status:archived played:no
+//
+// Every word must match the title, description or podcast title (accents
+// and case ignored); a word of three or more letters also matches a title
+// that has its letters in order, so "tdrs" finds "The Tudors". The tokens
+// reuse the -l date and status spellings; played:no is -l --unplayed.
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// fuzzyMinLen is the shortest word matched as a subsequence of the title;
+// shorter ones would match nearly every title.
+const fuzzyMinLen = 3
+
+// episodeFilter narrows the interactive episode list. The zero value
+// matches everything.
+type episodeFilter struct {
+	raw    string
+	words  []string // folded
+	since  string   // YYYY-MM-DD, inclusive
+	until  string   // YYYY-MM-DD, inclusive
+	status string   // a search status
+	played string   // "yes" or "no"; "" for either
+}
+
+func (f episodeFilter) active() bool {
+	return len(f.words) > 0 || f.since != "" || f.until != "" || f.status != "" || f.played != ""
+}
+
+// parseEpisodeFilter parses the filter line.
+func parseEpisodeFilter(s string) (episodeFilter, error) {
+	f := episodeFilter{raw: strings.TrimSpace(s)}
+	for _, tok := range strings.Fields(s) {
+		key, val, ok := strings.Cut(tok, ":")
+		switch key = strings.ToLower(key); {
+		case ok && (key == "since" || key == "until"):
+			t, err := parseLatestDate(key+":", val)
+			if err != nil {
+				return f, err
+			}
+			if t.IsZero() {
+				return f, fmt.Errorf("%s: needs a date (YYYY-MM-DD)", key)
+			}
+			if key == "since" {
+				f.since = t.Format("2006-01-02")
+			} else {
+				f.until = t.Format("2006-01-02")
+			}
+		case ok && key == "status":
+			st, err := parseLatestStatus(val)
+			if err != nil || st == "" {
+				return f, fmt.Errorf("status:%s: want downloaded, archived, skipped or pending", val)
+			}
+			f.status = st
+		case ok && key == "played":
+			switch strings.ToLower(val) {
+			case "yes", "y", "true":
+				f.played = "yes"
+			case "no", "n", "false":
+				f.played = "no"
+			default:
+				return f, fmt.Errorf("played:%s: want yes or no", val)
+			}
+		default:
+			f.words = append(f.words, foldFilterText(tok))
+		}
+	}
+	if f.since != "" && f.until != "" && f.until < f.since {
+		return f, fmt.Errorf("until:%s is before since:%s", f.until, f.since)
+	}
+	return f, nil
+}
+
+// matches reports whether item passes the filter.
+func (f episodeFilter) matches(item episodeItem) bool {
+	if f.since != "" && item.dateStr < f.since {
+		return false
+	}
+	if f.until != "" && item.dateStr > f.until {
+		return false
+	}
+	if f.status != "" {
+		status := item.status
+		if status == "" {
+			status = statusNotDownloaded
+		}
+		if status != f.status {
+			return false
+		}
+	}
+	if f.played != "" && item.play.played() != (f.played == "yes") {
+		return false
+	}
+	if len(f.words) == 0 {
+		return true
+	}
+	title := foldFilterText(item.title)
+	other := foldFilterText(item.podcastTitle + "\n" + item.description)
+	for _, w := range f.words {
+		if strings.Contains(title, w) || strings.Contains(other, w) {
+			continue
+		}
+		if utf8.RuneCountInString(w) >= fuzzyMinLen && isSubsequence(title, w) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// foldFilterText folds s for filter matching.
+func foldFilterText(s string) string {
+	return strings.ToLower(foldLatin(s))
+}
+
+// isSubsequence reports whether the runes of sub appear in s in order.
+func isSubsequence(s, sub string) bool {
+	want := []rune(sub)
+	i := 0
+	for _, r := range s {
+		if i == len(want) {
+			break
+		}
+		if r == want[i] {
+			i++
+		}
+	}
+	return i == len(want)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestParseEpisodeFilter(t *testing.T) {
+	f, err := parseEpisodeFilter("  Tudors since:2020-01-01 UNTIL:2021-06-30 status:Pending ")
+	if err != nil {
+		t.Fatalf("parseEpisodeFilter: %v", err)
+	}
+	if len(f.words) != 1 || f.words[0] != "tudors" || f.since != "2020-01-01" || f.until != "2021-06-30" ||
+		f.status != statusNotDownloaded || f.raw != "Tudors since:2020-01-01 UNTIL:2021-06-30 status:Pending" {
+		t.Fatalf("filter = %+v", f)
+	}
+	if f, err := parseEpisodeFilter(""); err != nil || f.active() {
+		t.Fatalf("empty filter = %+v, %v", f, err)
+	}
+	// A colon in an ordinary word is just part of the word
+	if f, err := parseEpisodeFilter("re:view"); err != nil || len(f.words) != 1 {
+		t.Fatalf("re:view = %+v, %v", f, err)
+	}
+	for _, bad := range []string{
+		"since:2020-13-01",
+		"until:",
+		"status:dow",
+		"since:2021-01-01 until:2020-01-01",
+	} {
+		if _, err := parseEpisodeFilter(bad); err == nil {
+			t.Errorf("parseEpisodeFilter(%q) should fail", bad)
+		}
+	}
+}
+
+func TestEpisodeFilterMatches(t *testing.T) {
+	items := []episodeItem{
+		{title: "The Tudors", dateStr: "2020-03-01", description: "Henry VIII and his wives", status: statusArchived},
+		{title: "Café Society", dateStr: "2021-05-01", description: "Coffee houses", status: statusDownloaded},
+		{title: "Plate Tectonics", dateStr: "2022-07-01", description: "Continental drift", status: statusSkipped},
+		{title: "Fresh From The Feed", dateStr: "2023-01-01"},
+	}
+	for _, tc := range []struct {
+		filter string
+		want   []string
+	}{
+		{"", []string{"The Tudors", "Café Society", "Plate Tectonics", "Fresh From The Feed"}},
+		{"tudors", []string{"The Tudors"}},
+		{"tdrs", []string{"The Tudors"}},        // letters in order in the title
+		{"cafe", []string{"Café Society"}},      // accents folded
+		{"wives henry", []string{"The Tudors"}}, // every word, description too
+		{"th", []string{"The Tudors", "Fresh From The Feed"}},
+		{"since:2021-05-01 until:2022-07-01", []string{"Café Society", "Plate Tectonics"}},
+		{"status:skipped", []string{"Plate Tectonics"}},
+		{"status:pending", []string{"Fresh From The Feed"}},
+		{"tudors status:downloaded", nil},
+	} {
+		f, err := parseEpisodeFilter(tc.filter)
+		if err != nil {
+			t.Fatalf("parseEpisodeFilter(%q): %v", tc.filter, err)
+		}
+		var got []string
+		for _, item := range items {
+			if f.matches(item) {
+				got = append(got, item.title)
+			}
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%q matched %v, want %v", tc.filter, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%q matched %v, want %v", tc.filter, got, tc.want)
+				break
+			}
+		}
+	}
+}
+
+// Selections made before and while filtering survive the filter changing
+// and count towards what gets downloaded.
+func TestFilterKeepsSelections(t *testing.T) {
+	useTempWorkingDir(t)
+	allItems := []episodeItem{
+		{title: "Alpha", filename: "a.mp3", dateStr: "2024-01-03"},
+		{title: "Beta", filename: "b.mp3", dateStr: "2024-01-02"},
+		{title: "Gamma", filename: "c.mp3", dateStr: "2024-01-01"},
+	}
+	m := newInteractiveModel(openTestStore(t), t.TempDir(), "", "")
+	m.step = stepSelect
+	m.allItems = allItems
+	m.rebuildVisibleItems()
+
+	press := func(keys ...string) {
+		t.Helper()
+		for _, k := range keys {
+			var msg tea.KeyMsg
+			switch k {
+			case "enter":
+				msg = tea.KeyMsg{Type: tea.KeyEnter}
+			case "esc":
+				msg = tea.KeyMsg{Type: tea.KeyEsc}
+			case " ":
+				msg = tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}}
+			default:
+				msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+			}
+			next, _ := m.Update(msg)
+			m = next.(interactiveModel)
+		}
+	}
+
+	press(" ")                          // select Alpha
+	press("/", "g", "a", "m", "m", "a") // typing narrows the list as it goes
+	if len(m.items) != 1 || m.items[0].title != "Gamma" {
+		t.Fatalf("filtered items = %+v", m.items)
+	}
+	press("enter", " ") // keep the filter, select Gamma
+	if !m.filter.active() || m.filtering {
+		t.Fatalf("enter should keep the filter and leave the input: %+v", m.filter)
+	}
+	if got := m.selectedCount(); got != 2 {
+		t.Fatalf("selectedCount = %d, want 2 (Alpha is hidden but still selected)", got)
+	}
+
+	press("esc") // clears the filter rather than going back
+	if m.step != stepSelect || m.filter.active() || len(m.items) != 3 {
+		t.Fatalf("esc: step=%v filter=%+v items=%d", m.step, m.filter, len(m.items))
+	}
+	var selected []string
+	for _, item := range m.selectedItems() {
+		selected = append(selected, item.title)
+	}
+	if len(selected) != 2 || selected[0] != "Alpha" || selected[1] != "Gamma" {
+		t.Fatalf("selected = %v, want Alpha and Gamma", selected)
+	}
+
+	// q types into the filter instead of quitting
+	press("/", "q")
+	if m.filterInput.Value() != "q" || len(m.items) != 0 {
+		t.Fatalf("filter value %q, %d items", m.filterInput.Value(), len(m.items))
+	}
+}
+
+// The picker carries each episode's status and description from the db.
+func TestLoadEpisodeItemsStatus(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	for _, ep := range []struct{ title, hash string }{
+		{"Skipped Ep", "hash-sk"},
+		{"New Ep", "hash-new"},
+	} {
+		if _, err := st.q.Exec(`
+			INSERT INTO interactive_episodes (
+				podcast_title, title, description, published, file, first_seen, last_seen,
+				podcastname_episodename_hash, file_url_hash
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+			"Status Podcast", ep.title, "About "+ep.title, "2024-01-01T01:00:00Z",
+			"https://example.com/"+ep.hash+".mp3", ts, ts, ep.hash, "f"+ep.hash); err != nil {
+			t.Fatalf("insert episode: %v", err)
+		}
+	}
+	if _, err := st.q.Exec(`INSERT INTO skipped_episodes (podcastname_episodename_hash, podcast_title, title, reason, first_skipped, last_skipped)
+		VALUES (?, ?, ?, ?, ?, ?);`, "hash-sk", "Status Podcast", "Skipped Ep", "retitle", ts, ts); err != nil {
+		t.Fatalf("insert skipped: %v", err)
+	}
+	items, err := st.loadEpisodeItemsFromDatabase("Status Podcast")
+	if err != nil {
+		t.Fatalf("loadEpisodeItemsFromDatabase: %v", err)
+	}
+	for _, item := range items {
+		want := statusNotDownloaded
+		if item.title == "Skipped Ep" {
+			want = statusSkipped
+		}
+		if item.status != want || item.downloaded || item.description != "About "+item.title {
+			t.Errorf("%s: status %q description %q downloaded %v", item.title, item.status, item.description, item.downloaded)
+		}
+	}
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"fmt"
 	"os"
+	"path"
 	"regexp"
 	"runtime"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/forPelevin/gomoji"
 	"golang.org/x/text/cases"
@@ -14,6 +16,7 @@ import (
 	"golang.org/x/text/runes"
 	"golang.org/x/text/transform"
 	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
 )
 
 // checkErr is a utility function to checkErr err and also give line number of the calling function
@@ -289,46 +292,134 @@ func getCwd() string {
 }
 
 // titleTransformation takes a podcast title and transforms it (removing spaces etc)
-// so it can sensibly be used in the podcast filename
+// so it can sensibly be used in the podcast filename. Latin-script words are
+// folded to ASCII (accents dropped, "ß" to "ss") and non-Latin words
+// (Greek, Cyrillic, CJK, ...) are kept in their own script, so a Japanese
+// title no longer yields an empty stem. ASCII titles transform exactly as
+// they always have.
 func titleTransformation(s string) string {
 
 	// Reflect strings.Title functionality; strings.Title is deprecated
 	caser := cases.Title(language.English)
 
 	// Get rid of any quotation characters
-	var sC string
 	sA := strings.ReplaceAll(s, "\"", "")
 	sB := strings.ReplaceAll(sA, "'", "")
 
-	// Make the string less than 100 runes if it is more than that
-	if len(sB) > 100 {
-		sC = sB[:100]
-	} else {
-		sC = sB
-	}
+	// Make the string no more than 100 bytes, without splitting a rune
+	sC := truncateUTF8(sB, 100)
 
 	// Get the words and join them together with _
-	regexS := `[A-Za-z]+`
-	re := regexp.MustCompile(regexS)
-	strSlice := re.FindAllStringSubmatch(sC, -1)
-
 	newStr := make([]string, 0)
-
-	for _, v := range strSlice {
-		s := v[0]
+	for _, w := range titleWords(sC) {
 		// If the word is all upper case make it title case
-		if isUpper(s) {
-			buff := caser.String(strings.ToLower(s))
-			newStr = append(newStr, buff)
+		if isUpper(w) {
+			newStr = append(newStr, caser.String(strings.ToLower(w)))
 		} else {
-			newStr = append(newStr, s)
+			newStr = append(newStr, w)
 		}
 	}
 
 	return strings.Join(newStr, "_")
 }
 
-// genScriptLine generate our wget shell command give a URL and filename
+// truncateUTF8 cuts s to at most n bytes, backing off to a rune boundary.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+var asciiWordRe = regexp.MustCompile(`[A-Za-z]+`)
+
+// latinFolds spells out the Latin letters that have no decomposition to
+// strip an accent from.
+var latinFolds = map[rune]string{
+	'ß': "ss", 'ẞ': "SS", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE",
+	'ø': "o", 'Ø': "O", 'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D",
+	'ł': "l", 'Ł': "L", 'þ': "th", 'Þ': "Th", 'ı': "i",
+}
+
+// foldLatin maps Latin-script letters to ASCII where it can: fullwidth
+// forms to their ASCII counterparts, accents dropped, ligatures spelled
+// out. Other scripts pass through untouched; their combining marks (kana
+// voicing, Indic vowel signs) are part of the letter.
+func foldLatin(s string) string {
+	s = norm.NFC.String(width.Fold.String(s))
+	var b strings.Builder
+	latinBase := false
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Mn, r) && latinBase:
+			// an accent left uncomposed after a Latin letter
+		case r < utf8.RuneSelf || !unicode.Is(unicode.Latin, r):
+			b.WriteRune(r)
+			latinBase = r < utf8.RuneSelf && unicode.IsLetter(r)
+		default:
+			latinBase = true
+			if f, ok := latinFolds[r]; ok {
+				b.WriteString(f)
+				continue
+			}
+			for _, d := range norm.NFD.String(string(r)) {
+				if !unicode.Is(unicode.Mn, d) {
+					b.WriteRune(d)
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// titleWords splits a title into filename words. Latin runs become their
+// ASCII letter runs (so digits and anything unfoldable still split words, as
+// they always have); runs of any other script are words of their own, with
+// their combining marks.
+func titleWords(s string) []string {
+	out := make([]string, 0)
+	var run []rune
+	runLatin := false
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		if runLatin {
+			out = append(out, asciiWordRe.FindAllString(foldLatin(string(run)), -1)...)
+		} else {
+			out = append(out, norm.NFC.String(string(run)))
+		}
+		run = run[:0]
+	}
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.M, r):
+			if len(run) > 0 {
+				run = append(run, r)
+			}
+		case unicode.IsLetter(r):
+			latin := unicode.Is(unicode.Latin, r)
+			if len(run) > 0 && latin != runLatin {
+				flush()
+			}
+			runLatin = latin
+			run = append(run, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return out
+}
+
+// genScriptLine generate our wget shell command give a URL and filename,
+// creating the filename template's directories first if it has any
 func genScriptLine(url string, filename string) string {
+	if dir := path.Dir(filename); dir != "." {
+		return fmt.Sprintf("mkdir -p '%s' && wget --no-clobber --continue --no-check-certificate --no-verbose '%s' -O '%s' && chmod 666 '%s'", dir, url, filename, filename)
+	}
 	return fmt.Sprintf("wget --no-clobber --continue --no-check-certificate --no-verbose '%s' -O '%s' && chmod 666 '%s'", url, filename, filename)
 }
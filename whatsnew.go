@@ -0,0 +1,97 @@
+package main
+
+// The interactive "what's new" screen: episodes from the last
+// whatsNewDays not yet downloaded, archived or skipped, across every
+// podcast in episodes and interactive_episodes. It is the first screen
+// when the db knows some podcasts; picks from several shows go through
+// the usual folder and download steps in one pass.
+
+import (
+	"sort"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// whatsNewDays is how far back the what's new screen looks.
+const whatsNewDays = 30
+
+// whatsNewLimit caps the what's new list.
+const whatsNewLimit = 500
+
+// whatsNewEpisodes lists the episodes published (or first seen, without a
+// date) since since that are still to download, newest first.
+// interactive_episodes rows only count for episodes the batch side doesn't
+// know.
+func (s *store) whatsNewEpisodes(since time.Time, limit int) ([]searchResult, error) {
+	cols := func(a string) string {
+		return `IFNULL(` + a + `.podcast_title, '') AS podcast_title, IFNULL(` + a + `.title, '') AS title,
+			IFNULL(NULLIF(` + a + `.published, ''), IFNULL(` + a + `.first_seen, '')) AS published,
+			` + a + `.podcastname_episodename_hash AS hash, IFNULL(` + a + `.author, '') AS author,
+			IFNULL(` + a + `.file, '') AS file, ` + statusCaseSQL(a) + ` AS status,
+			IFNULL(` + a + `.season, '') AS season, IFNULL(` + a + `.episode, '') AS episode,
+			IFNULL(` + a + `.description, '') AS description`
+	}
+	// The date filter goes inside, so status is only worked out for recent
+	// rows
+	cutoff := since.Format("2006-01-02")
+	rows, err := s.q.Query(`
+		SELECT podcast_title, title, published, hash, author, file, status, season, episode, description
+		FROM (
+			SELECT `+cols("e")+`
+			FROM episodes AS e
+			WHERE IFNULL(NULLIF(e.published, ''), IFNULL(e.first_seen, '')) >= ?
+			UNION ALL
+			SELECT `+cols("i")+`
+			FROM interactive_episodes AS i
+			WHERE IFNULL(NULLIF(i.published, ''), IFNULL(i.first_seen, '')) >= ?
+				AND NOT EXISTS (SELECT 1 FROM episodes AS x WHERE x.podcastname_episodename_hash = i.podcastname_episodename_hash)
+		)
+		WHERE status = ? AND TRIM(file) != '' AND TRIM(podcast_title) != ''
+		ORDER BY published DESC
+		LIMIT ?
+		;`, cutoff, cutoff, statusNotDownloaded, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanSearchResults(rows)
+}
+
+func loadWhatsNewCmd(s *store) tea.Cmd {
+	return func() tea.Msg {
+		now := time.Now()
+		results, err := s.whatsNewEpisodes(now.AddDate(0, 0, -whatsNewDays), whatsNewLimit)
+		if err != nil {
+			return feedParsedMsg{whatsNew: true, err: err}
+		}
+		items := searchResultItems(results, now)
+		if err := s.annotatePlayed(items); err != nil {
+			return feedParsedMsg{whatsNew: true, err: err}
+		}
+		return feedParsedMsg{whatsNew: true, episodes: groupByPodcast(items)}
+	}
+}
+
+// groupByPodcast orders items podcast by podcast, the podcast with the
+// newest episode first, newest first within each.
+func groupByPodcast(items []episodeItem) []episodeItem {
+	newest := make(map[string]time.Time)
+	for _, item := range items {
+		if item.date.After(newest[item.podcastTitle]) {
+			newest[item.podcastTitle] = item.date
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.podcastTitle != b.podcastTitle {
+			na, nb := newest[a.podcastTitle], newest[b.podcastTitle]
+			if !na.Equal(nb) {
+				return na.After(nb)
+			}
+			return a.podcastTitle < b.podcastTitle
+		}
+		return a.date.After(b.date)
+	})
+	return items
+}
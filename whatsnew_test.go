@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// seedWhatsNew fills both episode tables with a mix of new, old, handled
+// and interactive-only episodes, dated relative to now.
+func seedWhatsNew(t *testing.T, st *store, now time.Time) {
+	t.Helper()
+	day := func(n int) string { return now.AddDate(0, 0, -n).Format(time.RFC3339) }
+	for _, ep := range []struct {
+		table, podcast, title, published, hash string
+	}{
+		{"episodes", "Alpha", "Alpha new", day(1), "h-a1"},
+		{"episodes", "Alpha", "Alpha older", day(10), "h-a2"},
+		{"episodes", "Alpha", "Alpha ancient", day(whatsNewDays + 5), "h-a3"},
+		{"episodes", "Alpha", "Alpha downloaded", day(2), "h-a4"},
+		{"episodes", "Beta", "Beta newest", day(0), "h-b1"},
+		{"episodes", "Beta", "Beta skipped", day(3), "h-b2"},
+		{"interactive_episodes", "Beta", "Beta newest", day(0), "h-b1"}, // the same episode, counted once
+		{"interactive_episodes", "Gamma", "Gamma tui only", day(5), "h-g1"},
+	} {
+		if _, err := st.q.Exec(`INSERT INTO `+ep.table+` (title, published, first_seen, last_seen, podcast_title,
+			podcastname_episodename_hash, file) VALUES (?, ?, ?, ?, ?, ?, ?);`,
+			ep.title, ep.published, ts, ts, ep.podcast, ep.hash, "https://x/"+ep.hash+".mp3"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := st.recordDownloadSeen("Alpha-downloaded.mp3", "h-a4"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.q.Exec(`INSERT INTO skipped_episodes (podcastname_episodename_hash, reason, first_skipped, last_skipped)
+		VALUES (?, ?, ?, ?);`, "h-b2", "retitle", ts, ts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWhatsNewEpisodes(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	now := time.Now()
+	seedWhatsNew(t, st, now)
+
+	results, err := st.whatsNewEpisodes(now.AddDate(0, 0, -whatsNewDays), whatsNewLimit)
+	if err != nil {
+		t.Fatalf("whatsNewEpisodes: %v", err)
+	}
+	items := groupByPodcast(searchResultItems(results, now))
+	var got []string
+	for _, item := range items {
+		got = append(got, item.title)
+	}
+	// Beta has the newest episode so comes first; Gamma's only episode is
+	// older than Alpha's newest
+	want := []string{"Beta newest", "Alpha new", "Alpha older", "Gamma tui only"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("what's new = %q, want %q", got, want)
+	}
+	if items[0].podcastTitle != "Beta" || items[0].status != statusNotDownloaded {
+		t.Fatalf("first item = %+v", items[0])
+	}
+}
+
+// What's new is the first screen; picks from several podcasts go to the
+// download step together, each tagged with its own podcast.
+func TestWhatsNewScreen(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	seedWhatsNew(t, st, time.Now())
+
+	m := newInteractiveModel(st, t.TempDir(), "", "")
+	if m.step != stepLoading {
+		t.Fatalf("start step = %v, want loading what's new", m.step)
+	}
+	next, _ := m.Update(m.Init()())
+	m = next.(interactiveModel)
+	if m.step != stepSelect || !m.whatsNew || len(m.items) != 4 {
+		t.Fatalf("step=%v whatsNew=%v items=%d", m.step, m.whatsNew, len(m.items))
+	}
+	view := m.View()
+	for _, heading := range []string{"\nBeta\n", "\nAlpha\n", "\nGamma\n"} {
+		if !strings.Contains(view, heading) {
+			t.Errorf("view missing podcast heading %q:\n%s", heading, view)
+		}
+	}
+
+	press := func(msgs ...tea.KeyMsg) {
+		for _, msg := range msgs {
+			next, _ := m.Update(msg)
+			m = next.(interactiveModel)
+		}
+	}
+	space := tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}}
+	down := tea.KeyMsg{Type: tea.KeyDown}
+	press(space, down, space) // Beta newest, Alpha new
+	var podcasts []string
+	for _, item := range m.selectedItems() {
+		podcasts = append(podcasts, item.podcastTitle)
+	}
+	if strings.Join(podcasts, ",") != "Beta,Alpha" {
+		t.Fatalf("selected podcasts = %v", podcasts)
+	}
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.step != stepFolder {
+		t.Fatalf("enter went to step %v, want the folder step", m.step)
+	}
+
+	// b from the list goes to the podcast list
+	m.step = stepSelect
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("b")})
+	if m.step != stepFeedSelect {
+		t.Fatalf("b went to step %v, want the podcast list", m.step)
+	}
+}
+
+func TestWhatsNewNothingNew(t *testing.T) {
+	useTempWorkingDir(t)
+	st := openTestStore(t)
+	if _, err := st.q.Exec(`INSERT INTO interactive_episodes (title, published, first_seen, last_seen, podcast_title,
+		podcastname_episodename_hash, file) VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		"Old", "2001-01-01T00:00:00Z", ts, ts, "Pod", "h-old", "https://x/old.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	m := newInteractiveModel(st, t.TempDir(), "", "")
+	next, _ := m.Update(m.Init()())
+	m = next.(interactiveModel)
+	if m.step != stepFeedSelect || !strings.Contains(m.errMsg, "Nothing new") {
+		t.Fatalf("step=%v errMsg=%q, want the podcast list", m.step, m.errMsg)
+	}
+}